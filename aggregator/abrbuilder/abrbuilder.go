@@ -0,0 +1,188 @@
+// Package abrbuilder builds AddBlockRequests from local chaintrees and applies the aggregator's responses back onto them.
+package abrbuilder
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/chaintree/safewrap"
+	"github.com/quorumcontrol/messages/v2/build/go/services"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/quorumcontrol/tupelo/sdk/reftracking"
+)
+
+var (
+	policiesPath      = []string{"tree", "data", ".well-known", "policies"}
+	policyImportsPath = []string{"tree", "data", ".well-known", "policyImports"}
+	schemasPath       = []string{"tree", "data", ".well-known", "schemas"}
+	ownersPath        = []string{"tree", "_tupelo", "authentications"}
+)
+
+// NewAddBlockRequest signs a block of transactions with treeKey and plays it on a copy of the tree to
+// build the AddBlockRequest, including the State (the nodes of the tree the block touches) the aggregator
+// needs to validate it. The tree itself is not changed, see ApplyResponse.
+// Unlike the tupelo sdk the aggregator's validators are not run locally, the aggregator reports invalid blocks instead.
+func NewAddBlockRequest(ctx context.Context, tree *chaintree.ChainTree, treeKey *ecdsa.PrivateKey, txs []*transactions.Transaction) (*services.AddBlockRequest, error) {
+	return NewMultiSigAddBlockRequest(ctx, tree, []*ecdsa.PrivateKey{treeKey}, txs)
+}
+
+// NewMultiSigAddBlockRequest is NewAddBlockRequest for a block signed with every one of keys, which is what
+// changing the threshold or the ownership of a tree with a threshold takes (see policy.ThresholdValidator).
+func NewMultiSigAddBlockRequest(ctx context.Context, tree *chaintree.ChainTree, keys []*ecdsa.PrivateKey, txs []*transactions.Transaction) (*services.AddBlockRequest, error) {
+	did, err := tree.Id(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting id: %w", err)
+	}
+
+	treeTip := tree.Dag.Tip
+	genesis := IsGenesis(ctx, did, tree)
+
+	height, err := nextHeight(ctx, tree, genesis)
+	if err != nil {
+		return nil, fmt.Errorf("error getting tree height: %w", err)
+	}
+
+	var blockTip *cid.Cid
+	if !genesis {
+		blockTip = &treeTip
+	}
+
+	blockWithHeaders := &chaintree.BlockWithHeaders{
+		Block: chaintree.Block{
+			Height:       height,
+			PreviousTip:  blockTip,
+			Transactions: txs,
+		},
+	}
+	for _, key := range keys {
+		blockWithHeaders, err = consensus.SignBlock(ctx, blockWithHeaders, key)
+		if err != nil {
+			return nil, fmt.Errorf("error signing block: %w", err)
+		}
+	}
+
+	trackedTree, tracker, err := reftracking.WrapTree(ctx, tree)
+	if err != nil {
+		return nil, fmt.Errorf("error creating reference tracker: %w", err)
+	}
+
+	if !genesis {
+		// the aggregator evaluates the tree's own policies, so their nodes need to be in the state
+		_, _, err = trackedTree.Dag.Resolve(ctx, policiesPath)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving policies: %w", err)
+		}
+		// imported policies come from the aggregator's own trees, only the imports need to be in the state
+		_, _, err = trackedTree.Dag.Resolve(ctx, policyImportsPath)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving policy imports: %w", err)
+		}
+		_, _, err = trackedTree.Dag.Resolve(ctx, schemasPath)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving schemas: %w", err)
+		}
+		// the owners and threshold the signatures are checked against
+		_, _, err = trackedTree.Dag.Resolve(ctx, ownersPath)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving owners: %w", err)
+		}
+		_, _, err = trackedTree.Dag.Resolve(ctx, identity.ThresholdPath)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving threshold: %w", err)
+		}
+	}
+
+	valid, err := trackedTree.ProcessBlock(ctx, blockWithHeaders)
+	if !valid || err != nil {
+		return nil, fmt.Errorf("error processing block (valid: %t): %v", valid, err)
+	}
+
+	if !genesis {
+		// the aggregator also validates the values the block changes against the schemas of the tree after the block
+		err = policy.ResolveSchemas(ctx, trackedTree.Dag, blockWithHeaders)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving schemas: %w", err)
+		}
+	}
+
+	var state [][]byte
+	// the genesis state is the empty tree, which the aggregator can create itself
+	if !genesis {
+		touchedNodes, err := tracker.TouchedNodes(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting touched nodes: %w", err)
+		}
+		state = nodesToBytes(touchedNodes)
+	}
+
+	sw := &safewrap.SafeWrap{}
+	payload := sw.WrapObject(blockWithHeaders).RawData()
+	if sw.Err != nil {
+		return nil, fmt.Errorf("error wrapping block: %w", sw.Err)
+	}
+
+	return &services.AddBlockRequest{
+		PreviousTip: treeTip.Bytes(),
+		Height:      blockWithHeaders.Height,
+		Payload:     payload,
+		NewTip:      trackedTree.Dag.Tip.Bytes(),
+		ObjectId:    []byte(did),
+		State:       state,
+	}, nil
+}
+
+// ApplyResponse adds the new nodes of a successful Add to the tree's store and moves the tree to the new tip.
+// It returns aggregator.ErrInvalidBlock if the block was not accepted.
+func ApplyResponse(ctx context.Context, tree *chaintree.ChainTree, resp *aggregator.AddResponse) error {
+	if !resp.IsValid {
+		return aggregator.ErrInvalidBlock
+	}
+	if len(resp.NewNodes) > 0 {
+		err := tree.Dag.AddNodes(ctx, resp.NewNodes...)
+		if err != nil {
+			return fmt.Errorf("error adding nodes: %w", err)
+		}
+	}
+	tree.Dag = tree.Dag.WithNewTip(resp.NewTip)
+	return nil
+}
+
+// IsGenesis returns true when the tree has no blocks yet (it is the empty tree of did)
+func IsGenesis(ctx context.Context, did string, tree *chaintree.ChainTree) bool {
+	empty := consensus.NewEmptyTree(ctx, did, nodestore.MustMemoryStore(ctx))
+	return empty.Tip.Equals(tree.Dag.Tip)
+}
+
+func nextHeight(ctx context.Context, tree *chaintree.ChainTree, genesis bool) (uint64, error) {
+	if genesis {
+		return 0, nil
+	}
+	rootNode, err := tree.Dag.Get(ctx, tree.Dag.Tip)
+	if rootNode == nil || err != nil {
+		return 0, fmt.Errorf("error, missing root: %v", err)
+	}
+	root := &chaintree.RootNode{}
+	err = cbornode.DecodeInto(rootNode.RawData(), root)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding root: %w", err)
+	}
+	return root.Height + 1, nil
+}
+
+func nodesToBytes(nodes []format.Node) [][]byte {
+	bits := make([][]byte, len(nodes))
+	for i, n := range nodes {
+		bits[i] = n.RawData()
+	}
+	return bits
+}
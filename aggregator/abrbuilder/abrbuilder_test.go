@@ -0,0 +1,197 @@
+package abrbuilder
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setDataTxns(t testing.TB, path string, value interface{}) []*transactions.Transaction {
+	txn, err := chaintree.NewSetDataTransaction(path, value)
+	require.Nil(t, err)
+	return []*transactions.Transaction{txn}
+}
+
+func TestNewAddBlockRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := types.DefaultConfig()
+	config.ValidatorGenerators = append(config.ValidatorGenerators, policy.ValidatorGenerator)
+	config.ID = "testnotary"
+	ng := types.NewNotaryGroupFromConfig(config)
+	agg, err := aggregator.NewAggregator(ctx, &aggregator.AggregatorConfig{KeyValueStore: aggregator.NewMemoryStore(), Group: ng})
+	require.Nil(t, err)
+	ng.DagGetter = agg
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	signedTree, err := consensus.NewSignedChainTree(ctx, treeKey.PublicKey, nodestore.MustMemoryStore(ctx))
+	require.Nil(t, err)
+	tree := signedTree.ChainTree
+	did := signedTree.MustId()
+	require.True(t, IsGenesis(ctx, did, tree))
+
+	genesisTip := tree.Dag.Tip
+	abr, err := NewAddBlockRequest(ctx, tree, treeKey, setDataTxns(t, "some/path", "hi"))
+	require.Nil(t, err)
+	assert.Equal(t, uint64(0), abr.Height)
+	assert.Equal(t, genesisTip.Bytes(), abr.PreviousTip)
+	assert.Empty(t, abr.State)
+	// the tree is only changed by ApplyResponse
+	assert.True(t, tree.Dag.Tip.Equals(genesisTip))
+
+	resp, err := agg.Add(ctx, abr)
+	require.Nil(t, err)
+	assert.Equal(t, abr.NewTip, resp.NewTip.Bytes())
+	require.Nil(t, ApplyResponse(ctx, tree, resp))
+	assert.True(t, tree.Dag.Tip.Equals(resp.NewTip))
+	assert.False(t, IsGenesis(ctx, did, tree))
+
+	t.Run("later blocks include the state", func(t *testing.T) {
+		previousTip := tree.Dag.Tip
+		abr, err := NewAddBlockRequest(ctx, tree, treeKey, setDataTxns(t, "other/path", "bye"))
+		require.Nil(t, err)
+		assert.Equal(t, uint64(1), abr.Height)
+		assert.Equal(t, previousTip.Bytes(), abr.PreviousTip)
+		assert.NotEmpty(t, abr.State)
+
+		resp, err := agg.Add(ctx, abr)
+		require.Nil(t, err)
+		require.Nil(t, ApplyResponse(ctx, tree, resp))
+
+		latest, err := agg.GetLatest(ctx, did)
+		require.Nil(t, err)
+		assert.True(t, latest.Dag.Tip.Equals(tree.Dag.Tip))
+
+		val, _, err := tree.Dag.Resolve(ctx, []string{"tree", "data", "some", "path"})
+		require.Nil(t, err)
+		assert.Equal(t, "hi", val)
+		val, _, err = tree.Dag.Resolve(ctx, []string{"tree", "data", "other", "path"})
+		require.Nil(t, err)
+		assert.Equal(t, "bye", val)
+	})
+
+	t.Run("invalid responses are not applied", func(t *testing.T) {
+		tip := tree.Dag.Tip
+		err := ApplyResponse(ctx, tree, &aggregator.AddResponse{IsValid: false})
+		require.Equal(t, aggregator.ErrInvalidBlock, err)
+		assert.True(t, tree.Dag.Tip.Equals(tip))
+	})
+
+	t.Run("the policies of the tree are evaluated", func(t *testing.T) {
+		policedKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		policed, err := consensus.NewSignedChainTree(ctx, policedKey.PublicKey, nodestore.MustMemoryStore(ctx))
+		require.Nil(t, err)
+		abr, err := NewAddBlockRequest(ctx, policed.ChainTree, policedKey, setDataTxns(t, ".well-known/policies", map[string]string{
+			"main": `
+				package main
+				default allow = true
+
+				allow = false {
+					contains(input.transactions[_].setDataPayload.path, "forbidden")
+				}
+			`,
+		}))
+		require.Nil(t, err)
+		resp, err := agg.Add(ctx, abr)
+		require.Nil(t, err)
+		require.Nil(t, ApplyResponse(ctx, policed.ChainTree, resp))
+
+		// the nodes of the policies are in the state of later blocks
+		abr, err = NewAddBlockRequest(ctx, policed.ChainTree, policedKey, setDataTxns(t, "allowed", "yes"))
+		require.Nil(t, err)
+		resp, err = agg.Add(ctx, abr)
+		require.Nil(t, err)
+		require.Nil(t, ApplyResponse(ctx, policed.ChainTree, resp))
+
+		abr, err = NewAddBlockRequest(ctx, policed.ChainTree, policedKey, setDataTxns(t, "forbidden", "no"))
+		require.Nil(t, err)
+		_, err = agg.Add(ctx, abr)
+		assert.True(t, errors.Is(err, aggregator.ErrPolicyDenied))
+	})
+
+	t.Run("imported policies are evaluated", func(t *testing.T) {
+		libraryKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		library, err := consensus.NewSignedChainTree(ctx, libraryKey.PublicKey, nodestore.MustMemoryStore(ctx))
+		require.Nil(t, err)
+		abr, err := NewAddBlockRequest(ctx, library.ChainTree, libraryKey, setDataTxns(t, "policies/readonly", `
+			package main
+			default allow = false
+		`))
+		require.Nil(t, err)
+		resp, err := agg.Add(ctx, abr)
+		require.Nil(t, err)
+		require.True(t, resp.IsValid)
+
+		abr, err = NewAddBlockRequest(ctx, tree, treeKey, setDataTxns(t, ".well-known/policyImports", []string{library.MustId() + "/policies"}))
+		require.Nil(t, err)
+		resp, err = agg.Add(ctx, abr)
+		require.Nil(t, err)
+		require.Nil(t, ApplyResponse(ctx, tree, resp))
+
+		abr, err = NewAddBlockRequest(ctx, tree, treeKey, setDataTxns(t, "other/path", "denied"))
+		require.Nil(t, err)
+		_, err = agg.Add(ctx, abr)
+		assert.True(t, errors.Is(err, aggregator.ErrPolicyDenied))
+	})
+}
+
+func TestNewMultiSigAddBlockRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := types.DefaultConfig()
+	config.ValidatorGenerators = append(config.ValidatorGenerators, policy.ThresholdValidatorGenerator)
+	config.ID = "testnotary"
+	ng := types.NewNotaryGroupFromConfig(config)
+	agg, err := aggregator.NewAggregator(ctx, &aggregator.AggregatorConfig{KeyValueStore: aggregator.NewMemoryStore(), Group: ng})
+	require.Nil(t, err)
+	ng.DagGetter = agg
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	signedTree, err := consensus.NewSignedChainTree(ctx, treeKey.PublicKey, nodestore.MustMemoryStore(ctx))
+	require.Nil(t, err)
+	tree := signedTree.ChainTree
+
+	ownerKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	setOwnership, err := chaintree.NewSetOwnershipTransaction([]string{
+		crypto.PubkeyToAddress(treeKey.PublicKey).String(),
+		crypto.PubkeyToAddress(ownerKey.PublicKey).String(),
+	})
+	require.Nil(t, err)
+	txns := append(setDataTxns(t, ".well-known/threshold", 2), setOwnership)
+	abr, err := NewAddBlockRequest(ctx, tree, treeKey, txns)
+	require.Nil(t, err)
+	resp, err := agg.Add(ctx, abr)
+	require.Nil(t, err)
+	require.Nil(t, ApplyResponse(ctx, tree, resp))
+
+	// one owner can no longer lower the threshold
+	abr, err = NewAddBlockRequest(ctx, tree, treeKey, setDataTxns(t, ".well-known/threshold", 1))
+	require.Nil(t, err)
+	_, err = agg.Add(ctx, abr)
+	assert.True(t, errors.Is(err, aggregator.ErrInvalidSignature))
+
+	abr, err = NewMultiSigAddBlockRequest(ctx, tree, []*ecdsa.PrivateKey{treeKey, ownerKey}, setDataTxns(t, ".well-known/threshold", 1))
+	require.Nil(t, err)
+	resp, err = agg.Add(ctx, abr)
+	require.Nil(t, err)
+	require.Nil(t, ApplyResponse(ctx, tree, resp))
+}
@@ -28,8 +28,12 @@ import (
 
 var logger = logging.Logger("aggregator")
 var ErrNotFound = datastore.ErrNotFound
+
+// ErrInvalidBlock is matched (errors.Is) by the *AddError that Add returns for rejected blocks
 var ErrInvalidBlock = fmt.Errorf("InvalidBlock")
+
 var CacheSize = 100
+var VerifyCacheSize = 1000
 
 // type DagGetter interface {
 // 	GetTip(ctx context.Context, did string) (*cid.Cid, error)
@@ -47,6 +51,7 @@ var _ graftabledag.DagGetter = (*Aggregator)(nil)
 // implement your own channel sender if you'd prefer async
 type UpdateFunc func(*gossip.AddBlockWrapper)
 
+// AddResponse is the result of Add, IsValid is false when the global write policy denied the block
 type AddResponse struct {
 	IsValid  bool
 	NewTip   cid.Cid
@@ -55,9 +60,14 @@ type AddResponse struct {
 }
 
 type ResolveResponse struct {
+	// Tip is the tip of the tree that was resolved (undefined when the tree was not found or not readable)
+	Tip           cid.Cid
 	RemainingPath []string
 	Value         interface{}
 	TouchedBlocks []format.Node
+	// Hops are the trees resolved through when following grafts (see ResolveOptions.MaxHops), starting with
+	// the tree that was resolved. TouchedBlocks has the blocks of all of them.
+	Hops []ResolveHop
 }
 
 type Aggregator struct {
@@ -67,6 +77,7 @@ type Aggregator struct {
 	keyValueStore datastore.Batching
 	group         *types.NotaryGroup
 	updateFunc    UpdateFunc
+	verifyCache   *identity.VerifyCache
 
 	configDid  string
 	configTree *chaintree.ChainTree
@@ -75,6 +86,16 @@ type Aggregator struct {
 	hasWriteWants     bool
 	globalReadPolicy  *rego.PreparedEvalQuery
 	hasReadWants      bool
+
+	blameIndex bool
+	ownerIndex bool
+	entries    EntryStore
+
+	indexes       []IndexDefinition
+	configIndexes []IndexDefinition
+
+	search       []SearchDefinition
+	configSearch []SearchDefinition
 }
 
 // AggregatorConfig is used to configure a new Aggregator
@@ -84,6 +105,19 @@ type AggregatorConfig struct {
 	UpdateFunc    UpdateFunc
 
 	ConfigTree string // DID
+
+	// BlameIndex indexes the transactions of every block in Add so that Blame does not walk the chain
+	BlameIndex bool
+
+	// Indexes are maintained in Add (along with the ones of the config tree, see IndexesPath)
+	Indexes []IndexDefinition
+	// Search makes paths searchable (along with the ones of the config tree, see SearchPath)
+	Search []SearchDefinition
+	// OwnerIndex indexes the (grafted) owners of trees in Add for OwnedTrees and GraftDependents
+	OwnerIndex bool
+	// EntryStore stores the entries of index lists, by default they are keys of the KeyValueStore
+	// (see NewDatastoreEntries), which lists them with a Query
+	EntryStore EntryStore
 }
 
 func NewAggregator(ctx context.Context, config *AggregatorConfig) (*Aggregator, error) {
@@ -95,13 +129,26 @@ func NewAggregator(ctx context.Context, config *AggregatorConfig) (*Aggregator,
 	if err != nil {
 		return nil, err
 	}
+	verifyCache, err := identity.NewVerifyCache(VerifyCacheSize)
+	if err != nil {
+		return nil, err
+	}
 	a := &Aggregator{
 		keyValueStore: config.KeyValueStore,
 		DagStore:      dagStore,
 		validator:     validator,
 		group:         config.Group,
 		updateFunc:    config.UpdateFunc,
+		verifyCache:   verifyCache,
 		configDid:     config.ConfigTree,
+		blameIndex:    config.BlameIndex,
+		ownerIndex:    config.OwnerIndex,
+		entries:       config.EntryStore,
+		indexes:       config.Indexes,
+		search:        config.Search,
+	}
+	if a.entries == nil {
+		a.entries = NewDatastoreEntries(config.KeyValueStore)
 	}
 	if a.configDid != "" {
 		err = a.setupConfigTree(ctx)
@@ -137,6 +184,18 @@ func (a *Aggregator) setupConfigTree(ctx context.Context) error {
 	a.globalReadPolicy = readPolicy
 	a.hasReadWants = hasReadWants
 
+	indexes, err := indexesFromTree(ctx, tree.Dag)
+	if err != nil {
+		return fmt.Errorf("error getting indexes: %w", err)
+	}
+	a.configIndexes = indexes
+
+	search, err := searchFromTree(ctx, tree.Dag)
+	if err != nil {
+		return fmt.Errorf("error getting search: %w", err)
+	}
+	a.configSearch = search
+
 	return nil
 }
 
@@ -156,42 +215,86 @@ func (a *Aggregator) GetTip(ctx context.Context, objectID string) (*cid.Cid, err
 	return &tip, nil
 }
 
+// VerifyIdentity verifies the identity using the aggregator as the DagGetter. The ownership
+// of the subject is cached until its tip changes.
+func (a *Aggregator) VerifyIdentity(ctx context.Context, t identity.Token) (bool, error) {
+	return a.verifyCache.Verify(ctx, a, t)
+}
+
+// CheckSigners checks that enough of signers are owners of did (see identity.ThresholdPath)
+// and returns the ones that are
+func (a *Aggregator) CheckSigners(ctx context.Context, did string, signers []string) ([]string, error) {
+	return a.verifyCache.CheckSigners(ctx, a, did, signers)
+}
+
+// CheckIdentity is the same as VerifyIdentity but returns the reason verification failed
+// (see identity.IsUnverified)
+func (a *Aggregator) CheckIdentity(ctx context.Context, t identity.Token) error {
+	return a.verifyCache.Check(ctx, a, t)
+}
+
 func (a *Aggregator) ResolveWithReadControls(ctx context.Context, id *identity.Identity, objectID string, path []string) (*ResolveResponse, error) {
-	latest, err := a.GetLatest(ctx, objectID)
+	return a.ResolveWithOptions(ctx, id, objectID, path, nil)
+}
+
+// ResolveWithOptions is ResolveWithReadControls with the value expanded (and grafts followed) by opts (nil for none)
+func (a *Aggregator) ResolveWithOptions(ctx context.Context, id *identity.Identity, objectID string, path []string, opts *ResolveOptions) (*ResolveResponse, error) {
+	if opts != nil && opts.MaxHops > 0 {
+		return a.resolveGrafted(ctx, a.getReadable, id, objectID, path, opts)
+	}
+	readable, err := a.getReadable(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+	return a.resolveReadable(ctx, readable, id, path, opts)
+}
 
+// readableTree is the latest version of a tree with its prepared read policy, latest is nil when the tree was not found
+type readableTree struct {
+	objectID   string
+	latest     *chaintree.ChainTree
+	readPolicy *policy.ReadPolicy
+}
+
+func (a *Aggregator) getReadable(ctx context.Context, objectID string) (*readableTree, error) {
+	latest, err := a.GetLatest(ctx, objectID)
 	if err == ErrNotFound {
 		logger.Debugf("resolve %s not found", objectID)
-		return &ResolveResponse{
-			RemainingPath: path,
-		}, nil
+		return &readableTree{objectID: objectID}, nil
 	}
 	if err != nil {
 		logger.Errorf("error getting latest %s %v", objectID, err)
 		return nil, fmt.Errorf("error getting latest: %w", err)
 	}
-	globalValid, err := a.evaluateGlobalReadPolicy(ctx, id, objectID, path)
+	readPolicy, err := policy.NewReadPolicy(ctx, latest.Dag, a)
 	if err != nil {
-		return nil, fmt.Errorf("error validating: %w", err)
+		return nil, fmt.Errorf("error getting read policy: %w", err)
 	}
+	return &readableTree{
+		objectID:   objectID,
+		latest:     latest,
+		readPolicy: readPolicy,
+	}, nil
+}
 
-	logger.Debugf("globalReadValidator: %v", globalValid)
-	if !globalValid {
-		// if not valid then just return as if it was not found
+func (a *Aggregator) resolveReadable(ctx context.Context, readable *readableTree, id *identity.Identity, path []string, opts *ResolveOptions) (*ResolveResponse, error) {
+	if readable.latest == nil {
 		return &ResolveResponse{
 			RemainingPath: path,
 		}, nil
 	}
+	objectID := readable.objectID
+	latest := readable.latest
 
-	valid, err := policy.ReadValidator(ctx, latest.Dag, a, &policy.ReadInput{
-		Method:   "GET",
+	valid, err := a.evaluateReadPolicies(ctx, readable.readPolicy, &policy.ReadInput{
+		Method:   policy.MethodGet,
 		Object:   objectID,
 		Path:     strings.Join(path, "/"),
 		Identity: id,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("error validating: %w", err)
+		return nil, err
 	}
-	logger.Debugf("readValidator: %v", valid)
 	if !valid {
 		// if not valid then just return as if it was not found
 		return &ResolveResponse{
@@ -210,6 +313,17 @@ func (a *Aggregator) ResolveWithReadControls(ctx context.Context, id *identity.I
 		return nil, fmt.Errorf("error resolving: %v", err)
 	}
 
+	if opts != nil && len(remain) == 0 {
+		val, err = a.expand(ctx, &expansion{
+			readable: readable,
+			dag:      trackedTree.Dag,
+			identity: id,
+		}, val, path, opts.Depth, newProjection(opts.Fields))
+		if err != nil {
+			return nil, fmt.Errorf("error expanding: %w", err)
+		}
+	}
+
 	// Grab the nodes that were actually used:
 	touchedNodes, err := tracker.TouchedNodes(ctx)
 	if err != nil {
@@ -217,12 +331,53 @@ func (a *Aggregator) ResolveWithReadControls(ctx context.Context, id *identity.I
 	}
 
 	return &ResolveResponse{
+		Tip:           latest.Dag.Tip,
 		Value:         val,
 		RemainingPath: remain,
 		TouchedBlocks: touchedNodes,
 	}, nil
 }
 
+// ReadAllowed evaluates the global and the tree's read policies against input. A tree
+// the aggregator does not know about is allowed as there is nothing to read yet.
+func (a *Aggregator) ReadAllowed(ctx context.Context, input *policy.ReadInput) (bool, error) {
+	latest, err := a.GetLatest(ctx, input.Object)
+	if err == ErrNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error getting latest: %w", err)
+	}
+	return a.readAllowed(ctx, latest, input)
+}
+
+func (a *Aggregator) readAllowed(ctx context.Context, latest *chaintree.ChainTree, input *policy.ReadInput) (bool, error) {
+	readPolicy, err := policy.NewReadPolicy(ctx, latest.Dag, a)
+	if err != nil {
+		return false, fmt.Errorf("error validating: %w", err)
+	}
+	return a.evaluateReadPolicies(ctx, readPolicy, input)
+}
+
+// evaluateReadPolicies evaluates the global read policy and then the tree's
+func (a *Aggregator) evaluateReadPolicies(ctx context.Context, readPolicy *policy.ReadPolicy, input *policy.ReadInput) (bool, error) {
+	globalValid, err := a.evaluateGlobalReadPolicy(ctx, input)
+	if err != nil {
+		return false, fmt.Errorf("error validating: %w", err)
+	}
+	logger.Debugf("globalReadValidator: %v", globalValid)
+	if !globalValid {
+		return false, nil
+	}
+
+	valid, err := readPolicy.Allowed(ctx, input)
+	if err != nil {
+		return false, fmt.Errorf("error validating: %w", err)
+	}
+	logger.Debugf("readValidator: %v", valid)
+	return valid, nil
+}
+
 func (a *Aggregator) GetLatest(ctx context.Context, objectID string) (*chaintree.ChainTree, error) {
 	tip, err := a.GetTip(ctx, objectID)
 	if err != nil {
@@ -274,7 +429,7 @@ func (a *Aggregator) Add(ctx context.Context, abr *services.AddBlockRequest) (*A
 
 	newTip, isValid, newNodes, err := a.validator.ValidateAbr(wrapper)
 	if !isValid {
-		return nil, ErrInvalidBlock
+		return nil, rejected(err)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("invalid ABR: %w", err)
@@ -292,7 +447,11 @@ func (a *Aggregator) Add(ctx context.Context, abr *services.AddBlockRequest) (*A
 
 	if curr != nil && !bytes.Equal(curr.Bytes(), abr.PreviousTip) {
 		logger.Debugf("non matching tips: %w", err)
-		return nil, fmt.Errorf("previous tip did not match existing tip: %s", curr.String())
+		return nil, &AddError{
+			Reason:     ErrTipConflict,
+			CurrentTip: *curr,
+			Err:        fmt.Errorf("previous tip did not match existing tip: %s", curr.String()),
+		}
 	}
 
 	logger.Infof("storing %s (height: %d) new tip: %s", did, abr.Height, newTip.String())
@@ -301,6 +460,20 @@ func (a *Aggregator) Add(ctx context.Context, abr *services.AddBlockRequest) (*A
 	if err != nil {
 		return nil, fmt.Errorf("error putting key: %w", err)
 	}
+	err = a.storeMetadata(ctx, did, newTip)
+	if err != nil {
+		// TreeMetadata falls back to the blocks of the tree
+		logger.Errorf("error storing metadata: %v", err)
+	}
+	if a.blameIndex {
+		a.updateBlameIndex(ctx, did, newTip, abr.Height)
+	}
+	err = a.updateTreeIndexes(ctx, did, curr, newTip)
+	if err != nil {
+		// the block is stored, trees whose indexes could not be updated are indexed again by later Adds
+		logger.Errorf("error updating indexes: %v", err)
+	}
+	a.verifyCache.Evict(did)
 
 	if string(abr.ObjectId) == a.configDid {
 		err = a.setupConfigTree(ctx)
@@ -361,14 +534,9 @@ func (a *Aggregator) evaluateGlobalWritePolicy(ctx context.Context, abr *service
 	return true, nil
 }
 
-func (a *Aggregator) evaluateGlobalReadPolicy(ctx context.Context, id *identity.Identity, objectID string, path []string) (bool, error) {
+func (a *Aggregator) evaluateGlobalReadPolicy(ctx context.Context, input *policy.ReadInput) (bool, error) {
 	if a.globalReadPolicy != nil {
-		inputMap, err := (&policy.ReadInput{
-			Method:   "GET",
-			Identity: id,
-			Object:   objectID,
-			Path:     strings.Join(path, "/"),
-		}).ToInputMap()
+		inputMap, err := input.ToInputMap()
 		if err != nil {
 			return false, fmt.Errorf("error getting input: %w", err)
 		}
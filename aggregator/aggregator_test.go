@@ -3,8 +3,10 @@ package aggregator
 import (
 	"context"
 	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/quorumcontrol/chaintree/chaintree"
@@ -89,6 +91,11 @@ func TestAddingAbrs(t *testing.T) {
 		require.Nil(t, err)
 		_, err = agg.Add(ctx, &abr2)
 		require.NotNil(t, err)
+		assert.True(t, errors.Is(err, ErrInvalidBlock))
+		assert.True(t, errors.Is(err, ErrTipConflict))
+		var addErr *AddError
+		require.True(t, errors.As(err, &addErr))
+		assert.Equal(t, abr1.NewTip, addErr.CurrentTip.Bytes())
 	})
 }
 
@@ -302,19 +309,65 @@ func TestResolveWithReadControls(t *testing.T) {
 
 }
 
+func TestVerifyIdentity(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ng := types.NewNotaryGroup("testnotary")
+
+	agg, err := NewAggregator(ctx, &AggregatorConfig{KeyValueStore: NewMemoryStore(), Group: ng})
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+
+	abr := NewValidTransactionWithPathAndValue(t, treeKey, "/my/data", "foo")
+	_, err = agg.Add(ctx, &abr)
+	require.Nil(t, err)
+
+	did := string(abr.ObjectId)
+	ident, err := (&identity.Identity{
+		Iss: did,
+		Sub: did,
+		Exp: time.Now().UTC().Unix() + 5000,
+	}).Sign(treeKey)
+	require.Nil(t, err)
+
+	verified, err := agg.VerifyIdentity(ctx, ident)
+	require.Nil(t, err)
+	require.True(t, verified)
+
+	otherKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	otherIdent, err := (&identity.Identity{
+		Iss: did,
+		Sub: did,
+		Exp: time.Now().UTC().Unix() + 5000,
+	}).Sign(otherKey)
+	require.Nil(t, err)
+
+	verified, err = agg.VerifyIdentity(ctx, otherIdent)
+	require.Nil(t, err)
+	require.False(t, verified)
+}
+
 // This is only slightly different than the one in testhelpers (it takes an interface value rather than a string value)
 func NewValidTransactionWithPathAndValue(t testing.TB, treeKey *ecdsa.PrivateKey, path string, value interface{}) services.AddBlockRequest {
-	ctx := context.TODO()
-	sw := safewrap.SafeWrap{}
-
 	txn, err := chaintree.NewSetDataTransaction(path, value)
 	require.Nil(t, err)
+	return NewValidTransactionWithTransactions(t, treeKey, txn)
+}
+
+// NewValidTransactionWithTransactions returns the genesis ABR of the tree of treeKey with txs
+func NewValidTransactionWithTransactions(t testing.TB, treeKey *ecdsa.PrivateKey, txs ...*transactions.Transaction) services.AddBlockRequest {
+	ctx := context.TODO()
+	sw := safewrap.SafeWrap{}
 
 	unsignedBlock := chaintree.BlockWithHeaders{
 		Block: chaintree.Block{
 			PreviousTip:  nil,
 			Height:       0,
-			Transactions: []*transactions.Transaction{txn},
+			Transactions: txs,
 		},
 	}
 
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+)
+
+// AuthErrorContextKey is set on the context when a presented identity failed
+// verification but the request was allowed to continue anonymously (non-strict mode).
+const AuthErrorContextKey = "tupelo-lite:authError"
+
+// Auth error codes, these are used as the "code" extension of GraphQL errors
+const (
+	AuthMalformed        = "AUTH_MALFORMED"
+	AuthInvalidSignature = "AUTH_INVALID_SIGNATURE"
+	AuthExpired          = "AUTH_EXPIRED"
+	AuthNotOwner         = "AUTH_NOT_OWNER"
+	AuthBackendError     = "AUTH_BACKEND_ERROR"
+)
+
+// AuthError is a classified failure to authenticate a request
+type AuthError struct {
+	Code       string
+	StatusCode int
+	Err        error
+}
+
+// NewAuthError classifies err (usually one of the identity errors) into an AuthError
+func NewAuthError(err error) *AuthError {
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		return authErr
+	}
+	code, status := AuthBackendError, http.StatusInternalServerError
+	switch {
+	case errors.Is(err, identity.ErrMalformed):
+		code, status = AuthMalformed, http.StatusUnauthorized
+	case errors.Is(err, identity.ErrInvalidSignature):
+		code, status = AuthInvalidSignature, http.StatusUnauthorized
+	case errors.Is(err, identity.ErrExpired), errors.Is(err, identity.ErrRevoked):
+		code, status = AuthExpired, http.StatusUnauthorized
+	case errors.Is(err, identity.ErrNotOwner), errors.Is(err, aggregator.ErrNotFound):
+		// a subject tree the aggregator doesn't know about has no owners
+		code, status = AuthNotOwner, http.StatusForbidden
+	}
+	return &AuthError{
+		Code:       code,
+		StatusCode: status,
+		Err:        err,
+	}
+}
+
+func (e *AuthError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// Extensions is used by graphql-go to add the code to the GraphQL error
+func (e *AuthError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code": e.Code,
+	}
+}
+
+// Response is the body for a rejected request, shaped like a GraphQL response
+// so that clients can handle it the same way as other errors.
+func (e *AuthError) Response() []byte {
+	message := e.Error()
+	if e.Code == AuthBackendError {
+		message = "error verifying identity"
+	}
+	bits, err := json.Marshal(&graphql.Response{
+		Errors: []*gqlerrors.QueryError{{
+			Message:    message,
+			Extensions: e.Extensions(),
+		}},
+	})
+	if err != nil {
+		logger.Errorf("error marshaling auth error: %v", err)
+	}
+	return bits
+}
+
+// Authenticate verifies the session or signed identity in the headers and returns a context
+// with the verified identity (see RequesterFromCtx). When it returns an error (always an *AuthError)
+// the request should be rejected. Malformed headers and backend errors always reject the request,
+// an identity that does not verify only does in StrictAuth mode, otherwise the request continues
+// anonymously with the AuthError available at AuthErrorContextKey.
+func (r *Resolver) Authenticate(ctx context.Context, headers map[string][]string) (context.Context, error) {
+	var failed *AuthError
+
+	session, err := identity.SessionFromHeader(headers)
+	if err != nil {
+		return ctx, NewAuthError(err)
+	}
+	if session != nil {
+		err = r.Sessions.Check(session)
+		if err == nil {
+			logger.Debugf("session id: %v", session.Identity)
+			ctx = context.WithValue(ctx, IdentityContextKey, session.Identity)
+			ctx = context.WithValue(ctx, SessionContextKey, true)
+			return ctx, nil
+		}
+		failed = NewAuthError(err)
+		if r.StrictAuth || failed.Code == AuthBackendError {
+			return ctx, failed
+		}
+		logger.Debugf("unverified session: %v", err)
+	}
+
+	token, err := identity.TokenFromHeader(headers)
+	if err != nil {
+		return ctx, NewAuthError(err)
+	}
+	if token != nil {
+		err = r.Aggregator.CheckIdentity(ctx, token)
+		if err == nil {
+			logger.Debugf("id: %v", token.Claims())
+			return context.WithValue(ctx, IdentityContextKey, *token.Claims()), nil
+		}
+		failed = NewAuthError(err)
+		if failed.Code == AuthBackendError {
+			logger.Errorf("error verifying: %v", err)
+			return ctx, failed
+		}
+		if r.StrictAuth {
+			return ctx, failed
+		}
+		logger.Debugf("unverified identity: %v", err)
+	}
+
+	if failed != nil {
+		ctx = context.WithValue(ctx, AuthErrorContextKey, failed)
+	}
+	return ctx, nil
+}
+
+// AuthErrorFromCtx returns the AuthError of an identity that was presented but
+// not verified (in non-strict mode)
+func AuthErrorFromCtx(ctx context.Context) *AuthError {
+	authErr, _ := ctx.Value(AuthErrorContextKey).(*AuthError)
+	return authErr
+}
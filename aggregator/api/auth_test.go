@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := NewResolver(ctx, &Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	abr := testhelpers.NewValidTransactionWithPathAndValue(t, treeKey, "/my/path", "hi")
+	_, err = r.Aggregator.Add(ctx, &abr)
+	require.Nil(t, err)
+	did := string(abr.ObjectId)
+
+	sign := func(t *testing.T, exp int64, sub string) map[string][]string {
+		key := treeKey
+		if sub != did {
+			otherKey, err := crypto.GenerateKey()
+			require.Nil(t, err)
+			key = otherKey
+		}
+		ident, err := (&identity.Identity{Iss: did, Sub: did, Exp: exp}).Sign(key)
+		require.Nil(t, err)
+		return map[string][]string{identity.IdentityHeaderField: {ident.String()}}
+	}
+	valid := time.Now().UTC().Unix() + 5000
+
+	t.Run("anonymous", func(t *testing.T) {
+		authCtx, err := r.Authenticate(ctx, map[string][]string{})
+		require.Nil(t, err)
+		assert.Nil(t, RequesterFromCtx(authCtx))
+		assert.Nil(t, AuthErrorFromCtx(authCtx))
+	})
+
+	t.Run("verified", func(t *testing.T) {
+		authCtx, err := r.Authenticate(ctx, sign(t, valid, did))
+		require.Nil(t, err)
+		require.NotNil(t, RequesterFromCtx(authCtx))
+		assert.Equal(t, did, RequesterFromCtx(authCtx).Sub)
+	})
+
+	t.Run("malformed is always rejected", func(t *testing.T) {
+		_, err := r.Authenticate(ctx, map[string][]string{identity.IdentityHeaderField: {"notanidentity"}})
+		require.NotNil(t, err)
+		authErr := NewAuthError(err)
+		assert.Equal(t, AuthMalformed, authErr.Code)
+		assert.Equal(t, http.StatusUnauthorized, authErr.StatusCode)
+
+		resp := make(map[string][]map[string]interface{})
+		require.Nil(t, json.Unmarshal(authErr.Response(), &resp))
+		assert.Equal(t, map[string]interface{}{"code": AuthMalformed}, resp["errors"][0]["extensions"])
+	})
+
+	t.Run("not an owner downgrades to anonymous", func(t *testing.T) {
+		authCtx, err := r.Authenticate(ctx, sign(t, valid, "someoneelse"))
+		require.Nil(t, err)
+		assert.Nil(t, RequesterFromCtx(authCtx))
+		require.NotNil(t, AuthErrorFromCtx(authCtx))
+		assert.Equal(t, AuthNotOwner, AuthErrorFromCtx(authCtx).Code)
+
+		// and the session query explains why
+		_, err = r.Session(authCtx)
+		require.NotNil(t, err)
+		assert.Equal(t, AuthNotOwner, NewAuthError(err).Code)
+	})
+
+	t.Run("strict mode", func(t *testing.T) {
+		r.StrictAuth = true
+		defer func() { r.StrictAuth = false }()
+
+		_, err := r.Authenticate(ctx, sign(t, valid, "someoneelse"))
+		require.NotNil(t, err)
+		assert.Equal(t, http.StatusForbidden, NewAuthError(err).StatusCode)
+
+		_, err = r.Authenticate(ctx, sign(t, time.Now().UTC().Unix()-1, did))
+		require.NotNil(t, err)
+		assert.Equal(t, AuthExpired, NewAuthError(err).Code)
+		assert.Equal(t, http.StatusUnauthorized, NewAuthError(err).StatusCode)
+
+		_, err = r.Authenticate(ctx, map[string][]string{identity.SessionHeaderField: {(&identity.Session{Identity: identity.Identity{Sub: did}}).String()}})
+		require.NotNil(t, err)
+		assert.Equal(t, AuthInvalidSignature, NewAuthError(err).Code)
+	})
+
+	t.Run("unknown subject", func(t *testing.T) {
+		key, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		unknown := "did:tupelo:" + crypto.PubkeyToAddress(key.PublicKey).String()
+		ident, err := (&identity.Identity{Iss: unknown, Sub: unknown, Exp: valid}).Sign(key)
+		require.Nil(t, err)
+
+		authCtx, err := r.Authenticate(ctx, map[string][]string{identity.IdentityHeaderField: {ident.String()}})
+		require.Nil(t, err)
+		assert.Equal(t, AuthNotOwner, AuthErrorFromCtx(authCtx).Code)
+	})
+}
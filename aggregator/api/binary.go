@@ -0,0 +1,307 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/quorumcontrol/chaintree/safewrap"
+	"github.com/quorumcontrol/messages/v2/build/go/services"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/car"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+)
+
+// Content types of the binary endpoints
+const (
+	ContentTypeCAR      = "application/vnd.ipld.car"
+	ContentTypeDagCBOR  = "application/vnd.ipld.dag-cbor"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// RemainingPathHeader carries the remaining path of a resolve in CAR responses
+const RemainingPathHeader = "X-Tupelo-Remaining-Path"
+
+// MaxBinaryBodySize limits the size of a posted AddBlockRequest
+var MaxBinaryBodySize int64 = 10 << 20
+
+func init() {
+	cbornode.RegisterCborType(BinaryAddBlockResponse{})
+	cbornode.RegisterCborType(BinaryResolveResponse{})
+	cbornode.RegisterCborType(BinaryTreeResponse{})
+}
+
+// BinaryAddBlockResponse is the dag-cbor response of the binary addBlock
+type BinaryAddBlockResponse struct {
+	NewTip    cid.Cid  `refmt:"newTip"`
+	NewBlocks [][]byte `refmt:"newBlocks"`
+}
+
+// BinaryResolveResponse is the dag-cbor response of the binary resolve
+type BinaryResolveResponse struct {
+	Tip           *cid.Cid    `refmt:"tip,omitempty"` // nil when the tree was not found
+	Value         interface{} `refmt:"value"`
+	RemainingPath []string    `refmt:"remainingPath"`
+	TouchedBlocks [][]byte    `refmt:"touchedBlocks"`
+}
+
+// BinaryTreeResponse is the dag-cbor response of the binary tree (see Aggregator.TreeMetadata)
+type BinaryTreeResponse struct {
+	Tip       cid.Cid  `refmt:"tip"`
+	Height    uint64   `refmt:"height"`
+	UpdatedAt int64    `refmt:"updatedAt"` // seconds since the epoch, 0 when not known
+	Owners    []string `refmt:"owners"`
+}
+
+// BinaryHandler serves addBlock and resolve without the base64 and JSON overhead of the GraphQL API:
+//
+//	POST /addBlock with the protobuf AddBlockRequest as the body
+//	GET  /resolve?did=<did>&path=<path>
+//	GET  /tree?did=<did>
+//
+// The response is content negotiated with the Accept header: ContentTypeDagCBOR (the default) responds with a
+// BinaryAddBlockResponse or BinaryResolveResponse, ContentTypeCAR responds with a CAR of the new (or touched)
+// blocks rooted at the tip, for resolve the remaining path is in the RemainingPathHeader and the value is
+// resolved from the blocks. Invalid blocks are rejected with a 422, or a 409 when the previous tip is not
+// the current tip. /tree always responds with a dag-cbor BinaryTreeResponse, or a 404 for unknown (or unreadable) trees.
+//
+// The GET responses have the tip as their ETag, a request with an If-None-Match of the current tip gets a 304
+// (after the read policies are checked) so clients can cheaply check whether their copy is stale. Both the
+// standalone server and the Lambda handler serve it at /blocks/ and pass the headers through.
+// Like the GraphQL handler it expects the identity to be on the context already (see Authenticate).
+func (r *Resolver) BinaryHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/addBlock", r.serveAddBlock)
+	mux.HandleFunc("/resolve", r.serveResolve)
+	mux.HandleFunc("/tree", r.serveTree)
+	return mux
+}
+
+// negotiate returns the content type to respond with (or empty if none is acceptable)
+func negotiate(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return ContentTypeDagCBOR
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case ContentTypeCAR:
+			return ContentTypeCAR
+		case ContentTypeDagCBOR, "application/cbor", "application/*", "*/*":
+			return ContentTypeDagCBOR
+		}
+	}
+	return ""
+}
+
+func (r *Resolver) serveAddBlock(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	contentType := negotiate(req.Header.Get("Accept"))
+	if contentType == "" {
+		http.Error(w, "not acceptable", http.StatusNotAcceptable)
+		return
+	}
+
+	bits, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, MaxBinaryBodySize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading body: %v", err), http.StatusBadRequest)
+		return
+	}
+	abr := &services.AddBlockRequest{}
+	err = abr.Unmarshal(bits)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error unmarshaling: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	logger.Infof("binary addBlock %s", abr.ObjectId)
+
+	resp, err := r.Aggregator.Add(req.Context(), abr)
+	if errors.Is(err, aggregator.ErrTipConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, aggregator.ErrSchemaViolation) {
+		// the error lists the violations
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, aggregator.ErrInvalidBlock) || (err == nil && !resp.IsValid) {
+		http.Error(w, "invalid block", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		logger.Errorf("error validating block: %v", err)
+		http.Error(w, fmt.Sprintf("error validating block: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if contentType == ContentTypeCAR {
+		writeCAR(w, []cid.Cid{resp.NewTip}, resp.NewNodes, nil)
+		return
+	}
+	writeDagCBOR(w, &BinaryAddBlockResponse{
+		NewTip:    resp.NewTip,
+		NewBlocks: nodesToBytes(resp.NewNodes),
+	})
+}
+
+func (r *Resolver) serveResolve(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	contentType := negotiate(req.Header.Get("Accept"))
+	if contentType == "" {
+		http.Error(w, "not acceptable", http.StatusNotAcceptable)
+		return
+	}
+
+	did := req.URL.Query().Get("did")
+	if did == "" {
+		http.Error(w, "missing did", http.StatusBadRequest)
+		return
+	}
+	path := strings.Split(strings.TrimPrefix(req.URL.Query().Get("path"), "/"), "/")
+
+	resp, err := r.Aggregator.ResolveWithReadControls(req.Context(), RequesterFromCtx(req.Context()), did, path)
+	if err != nil {
+		logger.Errorf("error resolving %s %v", did, err)
+		http.Error(w, fmt.Sprintf("error resolving: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if resp.Tip.Defined() && notModified(w, req, resp.Tip) {
+		return
+	}
+
+	if contentType == ContentTypeCAR {
+		if !resp.Tip.Defined() {
+			// unknown (or unreadable) trees have no blocks to root the CAR at
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		header := http.Header{}
+		header.Set(RemainingPathHeader, strings.Join(resp.RemainingPath, "/"))
+		writeCAR(w, []cid.Cid{resp.Tip}, resp.TouchedBlocks, header)
+		return
+	}
+	var tip *cid.Cid
+	if resp.Tip.Defined() {
+		tip = &resp.Tip
+	}
+	writeDagCBOR(w, &BinaryResolveResponse{
+		Tip:           tip,
+		Value:         resp.Value,
+		RemainingPath: resp.RemainingPath,
+		TouchedBlocks: nodesToBytes(resp.TouchedBlocks),
+	})
+}
+
+func (r *Resolver) serveTree(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if negotiate(req.Header.Get("Accept")) == "" {
+		http.Error(w, "not acceptable", http.StatusNotAcceptable)
+		return
+	}
+
+	did := req.URL.Query().Get("did")
+	if did == "" {
+		http.Error(w, "missing did", http.StatusBadRequest)
+		return
+	}
+
+	meta, err := r.Aggregator.TreeMetadata(req.Context(), RequesterFromCtx(req.Context()), did)
+	if err != nil {
+		logger.Errorf("error getting tree metadata %s %v", did, err)
+		http.Error(w, fmt.Sprintf("error getting tree metadata: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if meta == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if notModified(w, req, meta.Tip) {
+		return
+	}
+
+	resp := &BinaryTreeResponse{
+		Tip:    meta.Tip,
+		Height: meta.Height,
+		Owners: meta.Owners,
+	}
+	if !meta.UpdatedAt.IsZero() {
+		resp.UpdatedAt = meta.UpdatedAt.Unix()
+	}
+	writeDagCBOR(w, resp)
+}
+
+// notModified sets the ETag of the response to the tip and responds with a 304 (returning true)
+// when it matches the If-None-Match of the request. The response depends on who is asking so it is
+// only cacheable privately.
+func notModified(w http.ResponseWriter, req *http.Request, tip cid.Cid) bool {
+	etag := `"` + tip.String() + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("Vary", strings.Join([]string{"Accept", identity.IdentityHeaderField, identity.SessionHeaderField}, ", "))
+
+	for _, candidate := range strings.Split(req.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+func writeCAR(w http.ResponseWriter, roots []cid.Cid, nodes []format.Node, header http.Header) {
+	buf := &bytes.Buffer{}
+	err := car.Write(buf, roots, nodes)
+	if err != nil {
+		logger.Errorf("error writing car: %v", err)
+		http.Error(w, "error writing car", http.StatusInternalServerError)
+		return
+	}
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Type", ContentTypeCAR)
+	w.Write(buf.Bytes())
+}
+
+func writeDagCBOR(w http.ResponseWriter, obj interface{}) {
+	sw := &safewrap.SafeWrap{}
+	node := sw.WrapObject(obj)
+	if sw.Err != nil {
+		logger.Errorf("error wrapping response: %v", sw.Err)
+		http.Error(w, "error encoding response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentTypeDagCBOR)
+	w.Write(node.RawData())
+}
+
+func nodesToBytes(nodes []format.Node) [][]byte {
+	bits := make([][]byte, len(nodes))
+	for i, n := range nodes {
+		bits[i] = n.RawData()
+	}
+	return bits
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/abrbuilder"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/car"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinaryHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := NewResolver(ctx, &Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+	srv := httptest.NewServer(r.BinaryHandler())
+	defer srv.Close()
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	signedTree, err := consensus.NewSignedChainTree(ctx, treeKey.PublicKey, nodestore.MustMemoryStore(ctx))
+	require.Nil(t, err)
+	tree := signedTree.ChainTree
+	did := signedTree.MustId()
+
+	post := func(t *testing.T, accept string, key interface{}, path string) *http.Response {
+		txn, err := chaintree.NewSetDataTransaction(path, "hi")
+		require.Nil(t, err)
+		abr, err := abrbuilder.NewAddBlockRequest(ctx, tree, treeKey, []*transactions.Transaction{txn})
+		require.Nil(t, err)
+		if key != nil {
+			otherKey, err := crypto.GenerateKey()
+			require.Nil(t, err)
+			abr, err = abrbuilder.NewAddBlockRequest(ctx, tree, otherKey, []*transactions.Transaction{txn})
+			require.Nil(t, err)
+		}
+		bits, err := abr.Marshal()
+		require.Nil(t, err)
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/addBlock", bytes.NewReader(bits))
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", ContentTypeProtobuf)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		return resp
+	}
+
+	get := func(t *testing.T, accept string, path string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/resolve?"+url.Values{"did": {did}, "path": {path}}.Encode(), nil)
+		require.Nil(t, err)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		return resp
+	}
+
+	t.Run("addBlock dag-cbor", func(t *testing.T) {
+		resp := post(t, "", nil, "some/path")
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, ContentTypeDagCBOR, resp.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(resp.Body)
+		require.Nil(t, err)
+		abResp := &BinaryAddBlockResponse{}
+		require.Nil(t, cbornode.DecodeInto(body, abResp))
+		assert.NotEmpty(t, abResp.NewBlocks)
+		tree.Dag = tree.Dag.WithNewTip(abResp.NewTip)
+
+		tip, err := r.Aggregator.GetTip(ctx, did)
+		require.Nil(t, err)
+		assert.True(t, tip.Equals(abResp.NewTip))
+	})
+
+	t.Run("addBlock car", func(t *testing.T) {
+		resp := post(t, ContentTypeCAR, nil, "other/path")
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, ContentTypeCAR, resp.Header.Get("Content-Type"))
+		roots, nodes, err := car.Read(resp.Body)
+		require.Nil(t, err)
+		require.Len(t, roots, 1)
+		assert.NotEmpty(t, nodes)
+		tree.Dag = tree.Dag.WithNewTip(roots[0])
+
+		tip, err := r.Aggregator.GetTip(ctx, did)
+		require.Nil(t, err)
+		assert.True(t, tip.Equals(roots[0]))
+	})
+
+	t.Run("invalid blocks are unprocessable", func(t *testing.T) {
+		resp := post(t, ContentTypeCAR, "other key", "third/path")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	})
+
+	t.Run("resolve dag-cbor", func(t *testing.T) {
+		resp := get(t, ContentTypeDagCBOR, "tree/data/some/path")
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.Nil(t, err)
+		resolveResp := &BinaryResolveResponse{}
+		require.Nil(t, cbornode.DecodeInto(body, resolveResp))
+		assert.Equal(t, "hi", resolveResp.Value)
+		require.NotNil(t, resolveResp.Tip)
+		assert.True(t, resolveResp.Tip.Equals(tree.Dag.Tip))
+		assert.Len(t, resolveResp.RemainingPath, 0)
+		assert.Len(t, resolveResp.TouchedBlocks, 4)
+	})
+
+	t.Run("resolve car", func(t *testing.T) {
+		resp := get(t, "text/html, "+ContentTypeCAR, "tree/data/other/path/deeper")
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "deeper", resp.Header.Get(RemainingPathHeader))
+		roots, nodes, err := car.Read(resp.Body)
+		require.Nil(t, err)
+		require.Len(t, roots, 1)
+
+		// the value can be resolved from the blocks
+		store := nodestore.MustMemoryStore(ctx)
+		require.Nil(t, store.AddMany(ctx, nodes))
+		val, remaining, err := dag.NewDag(ctx, roots[0], store).Resolve(ctx, []string{"tree", "data", "other", "path"})
+		require.Nil(t, err)
+		assert.Len(t, remaining, 0)
+		assert.Equal(t, "hi", val)
+	})
+
+	t.Run("resolve unknown car", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/resolve?did=did:tupelo:unknown&path=tree", nil)
+		require.Nil(t, err)
+		req.Header.Set("Accept", ContentTypeCAR)
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("tree with etag", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/tree?"+url.Values{"did": {did}}.Encode(), nil)
+		require.Nil(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		etag := resp.Header.Get("ETag")
+		assert.Equal(t, `"`+tree.Dag.Tip.String()+`"`, etag)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.Nil(t, err)
+		treeResp := &BinaryTreeResponse{}
+		require.Nil(t, cbornode.DecodeInto(body, treeResp))
+		assert.True(t, treeResp.Tip.Equals(tree.Dag.Tip))
+		assert.NotZero(t, treeResp.UpdatedAt)
+
+		req.Header.Set("If-None-Match", etag)
+		resp, err = http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+		req.Header.Set("If-None-Match", `"stale"`)
+		resp, err = http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("resolve with etag", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/resolve?"+url.Values{"did": {did}, "path": {"tree/data"}}.Encode(), nil)
+		require.Nil(t, err)
+		req.Header.Set("If-None-Match", `W/"`+tree.Dag.Tip.String()+`"`)
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	})
+
+	t.Run("unknown tree", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/tree?did=did:tupelo:unknown")
+		require.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("not acceptable", func(t *testing.T) {
+		resp := get(t, "text/html", "tree")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+	})
+}
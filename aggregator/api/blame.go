@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type BlameInput struct {
+	Did  string
+	Path string
+}
+
+type BlameEntry struct {
+	Height          int32
+	Block           CID
+	Tip             CID
+	Signers         []string
+	TransactionType string
+	Transaction     JSON
+	Path            string
+	Value           *JSON
+}
+
+type BlamePayload struct {
+	Tip     *CID
+	Entries []BlameEntry
+}
+
+// Blame returns the transactions that touched a path, see Aggregator.BlameWithReadControls
+func (r *Resolver) Blame(ctx context.Context, input BlameInput) (*BlamePayload, error) {
+	requester := RequesterFromCtx(ctx)
+	logger.Infof("blame %s %s with requester %v", input.Did, input.Path, requester)
+	var path []string
+	for _, segment := range strings.Split(input.Path, "/") {
+		if segment != "" {
+			path = append(path, segment)
+		}
+	}
+
+	resp, err := r.Aggregator.BlameWithReadControls(ctx, requester, input.Did, path)
+	if err != nil {
+		logger.Errorf("error blaming: %v", err)
+		return nil, NewCodedError(fmt.Errorf("error blaming: %w", err))
+	}
+
+	entries := make([]BlameEntry, len(resp.Entries))
+	for i, entry := range resp.Entries {
+		entries[i] = BlameEntry{
+			Height:          int32(entry.Height),
+			Block:           CID{Cid: entry.Block},
+			Tip:             CID{Cid: entry.Tip},
+			Signers:         entry.Signers,
+			TransactionType: entry.Transaction.Type.String(),
+			Transaction:     JSON{Object: entry.Transaction},
+			Path:            strings.Join(entry.Path, "/"),
+		}
+		if entry.Value != nil {
+			entries[i].Value = &JSON{Object: entry.Value}
+		}
+	}
+	return &BlamePayload{
+		Tip:     NewCID(resp.Tip),
+		Entries: entries,
+	}, nil
+}
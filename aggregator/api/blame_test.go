@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/abrbuilder"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlame(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := NewResolver(ctx, &Config{KeyValueStore: aggregator.NewMemoryStore(), BlameIndex: true})
+	require.Nil(t, err)
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema, err := graphql.ParseSchema(Schema, r, opts...)
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	signedTree, err := consensus.NewSignedChainTree(ctx, treeKey.PublicKey, nodestore.MustMemoryStore(ctx))
+	require.Nil(t, err)
+	tree := signedTree.ChainTree
+	did := signedTree.MustId()
+
+	add := func(t *testing.T, path string, value interface{}) string {
+		txn, err := chaintree.NewSetDataTransaction(path, value)
+		require.Nil(t, err)
+		abr, err := abrbuilder.NewAddBlockRequest(ctx, tree, treeKey, []*transactions.Transaction{txn})
+		require.Nil(t, err)
+		resp, err := r.Aggregator.Add(ctx, abr)
+		require.Nil(t, err)
+		tree.Dag = tree.Dag.WithNewTip(resp.NewTip)
+		return resp.NewTip.String()
+	}
+	first := add(t, "my/path", "hi")
+	add(t, "other", "x")
+	third := add(t, "my/path", "bye")
+
+	schemaResp := schema.Exec(ctx, `query blame($did: String!, $path: String!) {
+		blame(did: $did, path: $path) {
+			tip
+			entries {
+				height
+				tip
+				signers
+				transactionType
+				path
+				value
+			}
+		}
+	}`, "blame", map[string]interface{}{
+		"did":  did,
+		"path": "/tree/data/my/path",
+	})
+	require.Len(t, schemaResp.Errors, 0)
+
+	var result struct {
+		Blame struct {
+			Tip     string
+			Entries []struct {
+				Height          int
+				Tip             string
+				Signers         []string
+				TransactionType string
+				Path            string
+				Value           interface{}
+			}
+		}
+	}
+	require.Nil(t, json.Unmarshal(schemaResp.Data, &result))
+	assert.Equal(t, third, result.Blame.Tip)
+	require.Len(t, result.Blame.Entries, 2)
+	assert.Equal(t, 2, result.Blame.Entries[0].Height)
+	assert.Equal(t, third, result.Blame.Entries[0].Tip)
+	assert.Equal(t, "bye", result.Blame.Entries[0].Value)
+	assert.Equal(t, "SETDATA", result.Blame.Entries[0].TransactionType)
+	assert.Equal(t, "tree/data/my/path", result.Blame.Entries[0].Path)
+	assert.Equal(t, []string{crypto.PubkeyToAddress(treeKey.PublicKey).String()}, result.Blame.Entries[0].Signers)
+	assert.Equal(t, first, result.Blame.Entries[1].Tip)
+	assert.Equal(t, "hi", result.Blame.Entries[1].Value)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DefaultChildrenPageSize and MaxChildrenPageSize limit the children returned by a page
+var (
+	DefaultChildrenPageSize = 100
+	MaxChildrenPageSize     = 1000
+)
+
+type ChildrenInput struct {
+	Did   string
+	Path  string
+	First *int32
+	After *string
+}
+
+type Child struct {
+	Key  string
+	Type string
+	Cid  *CID
+}
+
+type ChildrenPayload struct {
+	Tip      *CID
+	Children []Child
+	PageInfo
+}
+
+// Children lists a page of the keys under a path, see Aggregator.Children
+func (r *Resolver) Children(ctx context.Context, input ChildrenInput) (*ChildrenPayload, error) {
+	first, after, err := pageArgs(input.First, input.After, DefaultChildrenPageSize, MaxChildrenPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	requester := RequesterFromCtx(ctx)
+	logger.Infof("children %s %s with requester %v", input.Did, input.Path, requester)
+	var path []string
+	for _, segment := range strings.Split(input.Path, "/") {
+		// the root of the tree is "/" (or "")
+		if segment != "" {
+			path = append(path, segment)
+		}
+	}
+
+	resp, err := r.Aggregator.Children(ctx, requester, input.Did, path, first, after)
+	if err != nil {
+		logger.Errorf("error listing children %s %v", input.Did, err)
+		return nil, NewCodedError(fmt.Errorf("error listing children: %w", err))
+	}
+
+	payload := &ChildrenPayload{
+		Tip:      NewCID(resp.Tip),
+		Children: make([]Child, len(resp.Children)),
+	}
+	for i, child := range resp.Children {
+		payload.Children[i] = Child{
+			Key:  child.Key,
+			Type: child.Type,
+			Cid:  NewCID(child.Link),
+		}
+	}
+	var last string
+	if len(resp.Children) > 0 {
+		last = resp.Children[len(resp.Children)-1].Key
+	}
+	payload.PageInfo = newPageInfo(last, resp.HasMore)
+	return payload, nil
+}
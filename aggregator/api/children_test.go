@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChildren(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := NewResolver(ctx, &Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema, err := graphql.ParseSchema(Schema, r, opts...)
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	abr := testhelpers.NewValidTransactionWithPathAndValue(t, treeKey, "/my/path", "hi")
+	_, err = r.Aggregator.Add(ctx, &abr)
+	require.Nil(t, err)
+	did := string(abr.ObjectId)
+
+	query := `query children($did: String!, $path: String!, $first: Int, $after: String) {
+		children(did: $did, path: $path, first: $first, after: $after) {
+			tip
+			children {
+				key
+				type
+				cid
+			}
+			endCursor
+			hasNextPage
+		}
+	}`
+
+	type Response struct {
+		Children struct {
+			Tip      *CID `json:"tip"`
+			Children []struct {
+				Key  string `json:"key"`
+				Type string `json:"type"`
+				Cid  *CID   `json:"cid"`
+			} `json:"children"`
+			EndCursor   *string `json:"endCursor"`
+			HasNextPage bool    `json:"hasNextPage"`
+		} `json:"children"`
+	}
+
+	children := func(t *testing.T, vars map[string]interface{}) *Response {
+		schemaResp := schema.Exec(ctx, query, "children", vars)
+		require.Len(t, schemaResp.Errors, 0)
+		resp := &Response{}
+		require.Nil(t, json.Unmarshal(schemaResp.Data, resp))
+		return resp
+	}
+
+	// the root of a tree has (at least) chain, height, id and tree
+	resp := children(t, map[string]interface{}{"did": did, "path": "/", "first": 1})
+	require.Len(t, resp.Children.Children, 1)
+	assert.NotNil(t, resp.Children.Tip)
+	assert.True(t, resp.Children.HasNextPage)
+	require.NotNil(t, resp.Children.EndCursor)
+	first := resp.Children.Children[0].Key
+
+	var keys []string
+	keys = append(keys, first)
+	after := resp.Children.EndCursor
+	for after != nil {
+		resp = children(t, map[string]interface{}{"did": did, "path": "/", "first": 1, "after": *after})
+		for _, c := range resp.Children.Children {
+			keys = append(keys, c.Key)
+		}
+		if !resp.Children.HasNextPage {
+			break
+		}
+		after = resp.Children.EndCursor
+	}
+	assert.Contains(t, keys, "tree")
+	assert.Contains(t, keys, "id")
+
+	resp = children(t, map[string]interface{}{"did": did, "path": "tree"})
+	for _, c := range resp.Children.Children {
+		if c.Key == "data" {
+			assert.Equal(t, aggregator.ChildTypeLink, c.Type)
+			assert.NotNil(t, c.Cid)
+		}
+	}
+
+	t.Run("invalid first", func(t *testing.T) {
+		schemaResp := schema.Exec(ctx, query, "children", map[string]interface{}{"did": did, "path": "/", "first": MaxChildrenPageSize + 1})
+		require.Len(t, schemaResp.Errors, 1)
+		assert.Equal(t, ErrCodeBadInput, schemaResp.Errors[0].Extensions["code"])
+	})
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+)
+
+// CID is a custom GraphQL type for content identifiers. It has to be added to a schema
+// via "scalar CID", it is sent as the string form of the CID.
+type CID struct {
+	cid.Cid
+}
+
+// NewCID returns the GraphQL CID of id (nil when id is undefined)
+func NewCID(id cid.Cid) *CID {
+	if !id.Defined() {
+		return nil
+	}
+	return &CID{Cid: id}
+}
+
+// ImplementsGraphQLType maps this custom Go type
+// to the graphql scalar type in the schema.
+func (CID) ImplementsGraphQLType(name string) bool {
+	return name == "CID"
+}
+
+// UnmarshalGraphQL parses the string form of a CID when it is used as an input
+func (c *CID) UnmarshalGraphQL(input interface{}) error {
+	str, ok := input.(string)
+	if !ok {
+		return fmt.Errorf("wrong type")
+	}
+	id, err := cid.Decode(str)
+	if err != nil {
+		return fmt.Errorf("error decoding cid: %w", err)
+	}
+	c.Cid = id
+	return nil
+}
+
+func (c CID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Cid.String())
+}
+
+func (c *CID) UnmarshalJSON(bits []byte) error {
+	var str string
+	err := json.Unmarshal(bits, &str)
+	if err != nil {
+		return err
+	}
+	return c.UnmarshalGraphQL(str)
+}
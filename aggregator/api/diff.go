@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+)
+
+type DiffInput struct {
+	Did  string
+	From CID
+	To   *CID
+}
+
+type Change struct {
+	Path     string
+	Type     string
+	OldValue *JSON
+	NewValue *JSON
+}
+
+type DiffPayload struct {
+	From    *CID
+	To      *CID
+	Changes []Change
+}
+
+// Diff returns the changes between two versions of a tree, see Aggregator.DiffWithReadControls
+func (r *Resolver) Diff(ctx context.Context, input DiffInput) (*DiffPayload, error) {
+	requester := RequesterFromCtx(ctx)
+	logger.Infof("diff %s %s with requester %v", input.Did, input.From.String(), requester)
+
+	to := cid.Undef
+	if input.To != nil {
+		to = input.To.Cid
+	}
+	diff, err := r.Aggregator.DiffWithReadControls(ctx, requester, input.Did, input.From.Cid, to)
+	if err != nil {
+		logger.Errorf("error diffing: %v", err)
+		return nil, NewCodedError(fmt.Errorf("error diffing: %w", err))
+	}
+	if diff == nil {
+		return &DiffPayload{Changes: []Change{}}, nil
+	}
+
+	changes := make([]Change, len(diff.Changes))
+	for i, change := range diff.Changes {
+		changes[i] = Change{
+			Path: strings.Join(change.Path, "/"),
+			Type: change.Type,
+		}
+		if change.OldValue != nil {
+			changes[i].OldValue = &JSON{Object: change.OldValue}
+		}
+		if change.NewValue != nil {
+			changes[i].NewValue = &JSON{Object: change.NewValue}
+		}
+	}
+	return &DiffPayload{
+		From:    NewCID(diff.From),
+		To:      NewCID(diff.To),
+		Changes: changes,
+	}, nil
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/gqltesting"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/abrbuilder"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := NewResolver(ctx, &Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema, err := graphql.ParseSchema(Schema, r, opts...)
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	signedTree, err := consensus.NewSignedChainTree(ctx, treeKey.PublicKey, nodestore.MustMemoryStore(ctx))
+	require.Nil(t, err)
+	tree := signedTree.ChainTree
+	did := signedTree.MustId()
+
+	add := func(t *testing.T, path string, value interface{}) string {
+		txn, err := chaintree.NewSetDataTransaction(path, value)
+		require.Nil(t, err)
+		abr, err := abrbuilder.NewAddBlockRequest(ctx, tree, treeKey, []*transactions.Transaction{txn})
+		require.Nil(t, err)
+		resp, err := r.Aggregator.Add(ctx, abr)
+		require.Nil(t, err)
+		require.True(t, resp.IsValid)
+		tree.Dag = tree.Dag.WithNewTip(resp.NewTip)
+		return resp.NewTip.String()
+	}
+	first := add(t, "my/path", "hi")
+	second := add(t, "my/path", "bye")
+
+	query := `query diff($did: String!, $from: CID!, $to: CID) {
+		diff(did: $did, from: $from, to: $to) {
+			from
+			to
+			changes {
+				path
+				type
+				oldValue
+				newValue
+			}
+		}
+	}`
+
+	gqltesting.RunTests(t, []*gqltesting.Test{
+		{
+			Schema:    schema,
+			Query:     query,
+			Variables: map[string]interface{}{"did": did, "from": first},
+			ExpectedResult: `
+				{
+					"diff":{
+						"from":"` + first + `",
+						"to":"` + second + `",
+						"changes":[{"path":"tree/data/my/path","type":"modified","oldValue":"hi","newValue":"bye"}]
+					}
+				}
+			`,
+		},
+		{
+			Schema:    schema,
+			Query:     query,
+			Variables: map[string]interface{}{"did": did, "from": first, "to": first},
+			ExpectedResult: `
+				{
+					"diff":{"from":"` + first + `","to":"` + first + `","changes":[]}
+				}
+			`,
+		},
+		{
+			Schema:    schema,
+			Query:     query,
+			Variables: map[string]interface{}{"did": "did:tupelo:unknown", "from": first},
+			ExpectedResult: `
+				{
+					"diff":{"from":null,"to":null,"changes":[]}
+				}
+			`,
+		},
+	})
+}
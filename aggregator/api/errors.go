@@ -0,0 +1,76 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+)
+
+// Error codes, these are used as the "code" extension of GraphQL errors
+// and as the errorCode of a rejected addBlock
+const (
+	ErrCodeTipConflict      = "TIP_CONFLICT"
+	ErrCodePolicyDenied     = "POLICY_DENIED"
+	ErrCodeInvalidSignature = "INVALID_SIGNATURE"
+	ErrCodeInvalidBlock     = "INVALID_BLOCK"
+	ErrCodeSchemaViolation  = "SCHEMA_VIOLATION"
+	ErrCodeNotFound         = "NOT_FOUND"
+	ErrCodeBadInput         = "BAD_INPUT"
+	ErrCodeInternal         = "INTERNAL"
+)
+
+// CodedError is an error with one of the error codes
+type CodedError struct {
+	Code string
+	Err  error
+}
+
+// NewCodedError classifies err (usually from the Aggregator) into a CodedError
+func NewCodedError(err error) *CodedError {
+	var codedErr *CodedError
+	if errors.As(err, &codedErr) {
+		return codedErr
+	}
+	return &CodedError{
+		Code: ErrorCode(err),
+		Err:  err,
+	}
+}
+
+// ErrorCode returns the error code of err
+func ErrorCode(err error) string {
+	var codedErr *CodedError
+	switch {
+	case errors.As(err, &codedErr):
+		return codedErr.Code
+	case errors.Is(err, aggregator.ErrTipConflict):
+		return ErrCodeTipConflict
+	case errors.Is(err, aggregator.ErrPolicyDenied):
+		return ErrCodePolicyDenied
+	case errors.Is(err, aggregator.ErrInvalidSignature):
+		return ErrCodeInvalidSignature
+	case errors.Is(err, aggregator.ErrSchemaViolation):
+		return ErrCodeSchemaViolation
+	case errors.Is(err, aggregator.ErrInvalidBlock):
+		return ErrCodeInvalidBlock
+	case errors.Is(err, aggregator.ErrNotFound):
+		return ErrCodeNotFound
+	default:
+		return ErrCodeInternal
+	}
+}
+
+func (e *CodedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CodedError) Unwrap() error {
+	return e.Err
+}
+
+// Extensions is used by graphql-go to add the code to the GraphQL error
+func (e *CodedError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code": e.Code,
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+)
+
+type FindInput struct {
+	Index string
+	Value string
+	First *int32
+	After *string
+}
+
+type FindPayload struct {
+	Dids []string
+	PageInfo
+}
+
+// Find lists a page of the trees with a value in a secondary index, see Aggregator.Find
+func (r *Resolver) Find(ctx context.Context, input FindInput) (*FindPayload, error) {
+	first, after, err := pageArgs(input.First, input.After, DefaultFindPageSize, MaxFindPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	requester := RequesterFromCtx(ctx)
+	logger.Infof("find %s %s with requester %v", input.Index, input.Value, requester)
+
+	resp, err := r.Aggregator.Find(ctx, requester, input.Index, input.Value, first, after)
+	if err != nil {
+		if errors.Is(err, aggregator.ErrUnknownIndex) {
+			return nil, &CodedError{Code: ErrCodeBadInput, Err: err}
+		}
+		logger.Errorf("error finding %s %v", input.Index, err)
+		return nil, NewCodedError(fmt.Errorf("error finding: %w", err))
+	}
+
+	payload := &FindPayload{
+		Dids:     resp.Dids,
+		PageInfo: newPageInfo(lastDid(resp.Dids), resp.HasMore),
+	}
+	if payload.Dids == nil {
+		payload.Dids = []string{}
+	}
+	return payload, nil
+}
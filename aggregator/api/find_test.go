@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFind(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	indexes, err := aggregator.ParseIndexDefinitions("type=tree/data/type")
+	require.Nil(t, err)
+	pf := newPageFixture(t, ctx, &Config{Indexes: indexes})
+
+	var dids []string
+	for i := 0; i < 2; i++ {
+		did, _ := pf.addTree(t, "type", "note")
+		dids = append(dids, did)
+	}
+
+	query := `query find($index: String!, $value: String!, $first: Int, $after: String) {
+		find(index: $index, value: $value, first: $first, after: $after) {
+			dids
+			endCursor
+			hasNextPage
+		}
+	}`
+
+	type Response struct {
+		Find struct {
+			Dids        []string `json:"dids"`
+			EndCursor   *string  `json:"endCursor"`
+			HasNextPage bool     `json:"hasNextPage"`
+		} `json:"find"`
+	}
+
+	find := func(t *testing.T, vars map[string]interface{}) *Response {
+		resp := &Response{}
+		require.Len(t, pf.exec(t, ctx, query, "find", vars, resp), 0)
+		return resp
+	}
+
+	resp := find(t, map[string]interface{}{"index": "type", "value": "note", "first": 1})
+	require.Len(t, resp.Find.Dids, 1)
+	assert.True(t, resp.Find.HasNextPage)
+	require.NotNil(t, resp.Find.EndCursor)
+	found := resp.Find.Dids
+
+	resp = find(t, map[string]interface{}{"index": "type", "value": "note", "first": 1, "after": *resp.Find.EndCursor})
+	require.Len(t, resp.Find.Dids, 1)
+	assert.False(t, resp.Find.HasNextPage)
+	assert.ElementsMatch(t, dids, append(found, resp.Find.Dids...))
+
+	resp = find(t, map[string]interface{}{"index": "type", "value": "task"})
+	assert.Len(t, resp.Find.Dids, 0)
+	assert.Nil(t, resp.Find.EndCursor)
+
+	t.Run("unknown indexes are bad input", func(t *testing.T) {
+		errs := pf.exec(t, ctx, query, "find", map[string]interface{}{"index": "missing", "value": "note"}, nil)
+		require.Len(t, errs, 1)
+		assert.Equal(t, ErrCodeBadInput, errs[0].Extensions["code"])
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api"
+)
+
+// blocksResource is the API Gateway resource of the binary API (see serverless.yml)
+const blocksResource = "/blocks/{proxy+}"
+
+// binaryMediaTypes are the content types that the API Gateway passes as binary (base64 encoded),
+// they need to be in the binaryMediaTypes of serverless.yml too
+var binaryMediaTypes = map[string]bool{
+	api.ContentTypeCAR:      true,
+	api.ContentTypeDagCBOR:  true,
+	api.ContentTypeProtobuf: true,
+}
+
+// BlocksHandler serves the binary API (see api.Resolver.BinaryHandler) at /blocks/, like the standalone server
+// does. The headers are passed through, so the ETags and 304s of the GET responses work the same.
+func BlocksHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			return corsResponse(http.StatusBadRequest, "invalid body", nil), nil
+		}
+		body = decoded
+	}
+
+	query := make(url.Values)
+	for k, v := range request.QueryStringParameters {
+		query.Set(k, v)
+	}
+	for k, vs := range request.MultiValueQueryStringParameters {
+		query[k] = vs
+	}
+	reqURL := &url.URL{Path: "/" + request.PathParameters["proxy"], RawQuery: query.Encode()}
+	req, err := http.NewRequest(request.HTTPMethod, reqURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return corsResponse(http.StatusBadRequest, "invalid request", nil), nil
+	}
+	for k, v := range request.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, vs := range request.MultiValueHeaders {
+		req.Header[http.CanonicalHeaderKey(k)] = vs
+	}
+
+	ctx, err = appResolver.Authenticate(ctx, req.Header)
+	if err != nil {
+		return authErrorResponse(err), nil
+	}
+
+	rec := &responseRecorder{header: make(http.Header)}
+	appResolver.BinaryHandler().ServeHTTP(rec, req.WithContext(ctx))
+
+	headers := make(map[string]string, len(rec.header))
+	for k := range rec.header {
+		headers[k] = rec.header.Get(k)
+	}
+	resp := corsResponse(rec.status(), rec.body.String(), headers)
+	if binaryMediaTypes[rec.header.Get("Content-Type")] {
+		resp.Body = base64.StdEncoding.EncodeToString(rec.body.Bytes())
+		resp.IsBase64Encoded = true
+	}
+	return resp, nil
+}
+
+// corsResponse is a response with the CORS headers of the other responses
+func corsResponse(statusCode int, body string, headers map[string]string) events.APIGatewayProxyResponse {
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers["Access-Control-Allow-Origin"] = "*"
+	headers["Access-Control-Allow-Headers"] = "*"
+	headers["Access-Control-Expose-Headers"] = "ETag, " + api.RemainingPathHeader
+	return events.APIGatewayProxyResponse{
+		Body:       body,
+		StatusCode: statusCode,
+		Headers:    headers,
+	}
+}
+
+// responseRecorder collects the response of an http.Handler for the API Gateway
+type responseRecorder struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rr *responseRecorder) Header() http.Header {
+	return rr.header
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	return rr.body.Write(b)
+}
+
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	if rr.statusCode == 0 {
+		rr.statusCode = statusCode
+	}
+}
+
+func (rr *responseRecorder) status() int {
+	if rr.statusCode == 0 {
+		return http.StatusOK
+	}
+	return rr.statusCode
+}
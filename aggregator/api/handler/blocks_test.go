@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/iotdataplane"
+	"github.com/ethereum/go-ethereum/crypto"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/abrbuilder"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/car"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlocksHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the updates of addBlock are published to IoT
+	iotSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer iotSrv.Close()
+	iotDataCli = iotdataplane.New(awsSession, &aws.Config{
+		Endpoint:    aws.String(iotSrv.URL),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	defer func() { iotDataCli = nil }()
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	signedTree, err := consensus.NewSignedChainTree(ctx, treeKey.PublicKey, nodestore.MustMemoryStore(ctx))
+	require.Nil(t, err)
+	tree := signedTree.ChainTree
+	did := signedTree.MustId()
+
+	blocksRequest := func(method, proxy string, headers map[string]string) events.APIGatewayProxyRequest {
+		return events.APIGatewayProxyRequest{
+			Resource:       "/blocks/{proxy+}",
+			Path:           "/blocks/" + proxy,
+			HTTPMethod:     method,
+			PathParameters: map[string]string{"proxy": proxy},
+			Headers:        headers,
+		}
+	}
+
+	t.Run("addBlock", func(t *testing.T) {
+		txn, err := chaintree.NewSetDataTransaction("some/path", "hi")
+		require.Nil(t, err)
+		abr, err := abrbuilder.NewAddBlockRequest(ctx, tree, treeKey, []*transactions.Transaction{txn})
+		require.Nil(t, err)
+		bits, err := abr.Marshal()
+		require.Nil(t, err)
+
+		request := blocksRequest(http.MethodPost, "addBlock", map[string]string{
+			"content-type": api.ContentTypeProtobuf,
+			"accept":       api.ContentTypeCAR,
+		})
+		request.Body = base64.StdEncoding.EncodeToString(bits)
+		request.IsBase64Encoded = true
+
+		resp, err := Handler(ctx, request)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+		assert.Equal(t, api.ContentTypeCAR, resp.Headers["Content-Type"])
+		assert.Equal(t, "*", resp.Headers["Access-Control-Allow-Origin"])
+		require.True(t, resp.IsBase64Encoded)
+
+		body, err := base64.StdEncoding.DecodeString(resp.Body)
+		require.Nil(t, err)
+		roots, nodes, err := car.Read(bytes.NewReader(body))
+		require.Nil(t, err)
+		require.Len(t, roots, 1)
+		assert.NotEmpty(t, nodes)
+		tree.Dag = tree.Dag.WithNewTip(roots[0])
+	})
+
+	t.Run("resolve", func(t *testing.T) {
+		request := blocksRequest(http.MethodGet, "resolve", nil)
+		request.QueryStringParameters = map[string]string{"did": did, "path": "tree/data/some/path"}
+
+		resp, err := Handler(ctx, request)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+		assert.Equal(t, api.ContentTypeDagCBOR, resp.Headers["Content-Type"])
+		body, err := base64.StdEncoding.DecodeString(resp.Body)
+		require.Nil(t, err)
+		resolveResp := &api.BinaryResolveResponse{}
+		require.Nil(t, cbornode.DecodeInto(body, resolveResp))
+		assert.Equal(t, "hi", resolveResp.Value)
+	})
+
+	t.Run("tree is not modified", func(t *testing.T) {
+		request := blocksRequest(http.MethodGet, "tree", nil)
+		request.QueryStringParameters = map[string]string{"did": did}
+
+		resp, err := Handler(ctx, request)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+		etag := resp.Headers["Etag"]
+		assert.Equal(t, `"`+tree.Dag.Tip.String()+`"`, etag)
+
+		request.Headers = map[string]string{"if-none-match": etag}
+		resp, err = Handler(ctx, request)
+		require.Nil(t, err)
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+		assert.Empty(t, resp.Body)
+
+		request.Headers = map[string]string{"if-none-match": `"stale"`}
+		resp, err = Handler(ctx, request)
+		require.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("unknown trees are not found", func(t *testing.T) {
+		request := blocksRequest(http.MethodGet, "tree", nil)
+		request.QueryStringParameters = map[string]string{"did": "did:tupelo:unknown"}
+
+		resp, err := Handler(ctx, request)
+		require.Nil(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.False(t, resp.IsBase64Encoded)
+	})
+}
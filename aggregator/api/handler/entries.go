@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/ipfs/go-datastore"
+)
+
+const (
+	entryListKey = "l"
+	entryNameKey = "n"
+
+	// batchWriteMax is the largest amount of items a BatchWriteItem call takes
+	batchWriteMax = 25
+)
+
+var entryAttributeNames = map[string]*string{
+	"#l": aws.String(entryListKey),
+	"#n": aws.String(entryNameKey),
+}
+
+// dynamoEntries stores the entries of index lists (see aggregator.EntryStore) in a DynamoDB table with the list as
+// the partition key and the name as the sort key, so that a list is read with a Query rather than a Scan of the
+// blocks table. Every entry is an item of its own, concurrent Adds do not overwrite each other's entries.
+type dynamoEntries struct {
+	db    *dynamodb.DynamoDB
+	table string
+}
+
+func entryItemKey(list datastore.Key, name string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		entryListKey: {S: aws.String(list.String())},
+		entryNameKey: {S: aws.String(name)},
+	}
+}
+
+func (de *dynamoEntries) PutEntry(list datastore.Key, name string) error {
+	_, err := de.db.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(de.table),
+		Item:      entryItemKey(list, name),
+	})
+	if err != nil {
+		return fmt.Errorf("error putting entry: %w", err)
+	}
+	return nil
+}
+
+func (de *dynamoEntries) DeleteEntry(list datastore.Key, name string) error {
+	_, err := de.db.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(de.table),
+		Key:       entryItemKey(list, name),
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting entry: %w", err)
+	}
+	return nil
+}
+
+func (de *dynamoEntries) ListEntries(list datastore.Key, after string, limit int) ([]string, error) {
+	input := &dynamodb.QueryInput{
+		TableName:                aws.String(de.table),
+		KeyConditionExpression:   aws.String("#l = :list"),
+		ExpressionAttributeNames: entryAttributeNames,
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":list": {S: aws.String(list.String())},
+		},
+	}
+	if after != "" {
+		input.KeyConditionExpression = aws.String("#l = :list AND #n > :after")
+		input.ExpressionAttributeValues[":after"] = &dynamodb.AttributeValue{S: aws.String(after)}
+	}
+
+	var names []string
+	for {
+		if limit > 0 {
+			input.Limit = aws.Int64(int64(limit - len(names)))
+		}
+		resp, err := de.db.Query(input)
+		if err != nil {
+			return nil, fmt.Errorf("error querying entries: %w", err)
+		}
+		for _, item := range resp.Items {
+			names = append(names, aws.StringValue(item[entryNameKey].S))
+		}
+		if len(resp.LastEvaluatedKey) == 0 || (limit > 0 && len(names) >= limit) {
+			return names, nil
+		}
+		input.ExclusiveStartKey = resp.LastEvaluatedKey
+	}
+}
+
+// DeleteLists scans the table, it is only used to delete an index generation after RebuildIndexes
+func (de *dynamoEntries) DeleteLists(prefix datastore.Key) error {
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(de.table),
+		FilterExpression:         aws.String("begins_with(#l, :prefix)"),
+		ProjectionExpression:     aws.String("#l, #n"),
+		ExpressionAttributeNames: entryAttributeNames,
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			// the lists below prefix, not the ones of prefixes that start with it
+			":prefix": {S: aws.String(prefix.String() + "/")},
+		},
+	}
+	for {
+		resp, err := de.db.Scan(input)
+		if err != nil {
+			return fmt.Errorf("error scanning entries: %w", err)
+		}
+		for start := 0; start < len(resp.Items); start += batchWriteMax {
+			end := start + batchWriteMax
+			if end > len(resp.Items) {
+				end = len(resp.Items)
+			}
+			requests := make([]*dynamodb.WriteRequest, 0, end-start)
+			for _, item := range resp.Items[start:end] {
+				requests = append(requests, &dynamodb.WriteRequest{
+					DeleteRequest: &dynamodb.DeleteRequest{Key: item},
+				})
+			}
+			err = de.batchWrite(requests)
+			if err != nil {
+				return err
+			}
+		}
+		if len(resp.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = resp.LastEvaluatedKey
+	}
+}
+
+// batchWrite writes requests, including the ones DynamoDB leaves unprocessed
+func (de *dynamoEntries) batchWrite(requests []*dynamodb.WriteRequest) error {
+	items := map[string][]*dynamodb.WriteRequest{de.table: requests}
+	for len(items[de.table]) > 0 {
+		resp, err := de.db.BatchWriteItem(&dynamodb.BatchWriteItemInput{RequestItems: items})
+		if err != nil {
+			return fmt.Errorf("error deleting entries: %w", err)
+		}
+		items = resp.UnprocessedItems
+	}
+	return nil
+}
@@ -6,7 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	logging "github.com/ipfs/go-log"
 
@@ -17,13 +20,16 @@ import (
 	"github.com/aws/aws-sdk-go/service/cognitoidentity"
 	"github.com/aws/aws-sdk-go/service/iot"
 	"github.com/aws/aws-sdk-go/service/iotdataplane"
+	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/graph-gophers/graphql-go"
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	dynamods "github.com/quorumcontrol/go-ds-dynamodb"
 	"github.com/quorumcontrol/tupelo-lite/aggregator"
 	"github.com/quorumcontrol/tupelo-lite/aggregator/api"
 	"github.com/quorumcontrol/tupelo-lite/aggregator/api/publisher"
 	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo/signer/gossip"
 )
 
 var (
@@ -34,11 +40,24 @@ var (
 	deploymentStage         = os.Getenv("STAGE")
 	iotPolicyName           = os.Getenv("IOT_POLICY_NAME")
 	dynamoTableName         = os.Getenv("TABLE_NAME")
+	entriesTableName        = os.Getenv("ENTRIES_TABLE_NAME")
+	sessionSecret           = os.Getenv("SESSION_SECRET")
+	sessionSecretParameter  = os.Getenv("SESSION_SECRET_PARAMETER")
+	strictAuth              = os.Getenv("STRICT_AUTH") == "true"
+	privateTopics           = os.Getenv("PRIVATE_TOPICS") == "true"
+	durableInbox            = os.Getenv("DURABLE_INBOX") == "true"
+	publishDiffs            = os.Getenv("PUBLISH_DIFFS") == "true"
+	blameIndex              = os.Getenv("BLAME_INDEX") == "true"
+	ownerIndex              = os.Getenv("OWNER_INDEX") == "true"
+	indexes                 = os.Getenv("INDEXES")
+	search                  = os.Getenv("SEARCH")
+	iotArnPrefix            = os.Getenv("IOT_ARN_PREFIX")
 
 	logger = logging.Logger("handler.Main")
 
 	mainSchema  *graphql.Schema
 	appResolver *api.Resolver
+	appStore    datastore.Batching
 
 	awsSession  *session.Session
 	identityCli *cognitoidentity.CognitoIdentity
@@ -59,6 +78,10 @@ func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (events
 		}, nil
 	}
 
+	if request.Resource == blocksResource {
+		return BlocksHandler(ctx, request)
+	}
+
 	// If no query is provided in the HTTP request body then show the explorer
 	if len(request.Body) < 1 {
 		return events.APIGatewayProxyResponse{
@@ -86,31 +109,13 @@ func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (events
 		}, nil
 	}
 
-	header, ok := request.Headers[identity.IdentityHeaderField]
-	if ok {
-		ident, err := identity.FromHeader(map[string][]string{identity.IdentityHeaderField: {header}})
-		if err != nil {
-			logger.Warningf("Could not get identity, %v", err)
-			return events.APIGatewayProxyResponse{
-				Body:       fmt.Sprintf("could not decode: %v", err),
-				StatusCode: 500,
-			}, nil
-		}
-		if ident != nil {
-			//TODO: this can probably be debug
-			logger.Infof("identity: %s", ident.Sub)
-			isVerified, err := ident.Verify(ctx, appResolver.Aggregator)
-			if err != nil {
-				logger.Errorf("error verifying: %v", err)
-				return events.APIGatewayProxyResponse{
-					Body:       fmt.Sprintf("error verifying: %v", err),
-					StatusCode: 500,
-				}, nil
-			}
-			if isVerified {
-				ctx = context.WithValue(ctx, api.IdentityContextKey, ident.Identity)
-			}
-		}
+	headers := make(map[string][]string, len(request.Headers))
+	for k, v := range request.Headers {
+		headers[http.CanonicalHeaderKey(k)] = []string{v}
+	}
+	ctx, err := appResolver.Authenticate(ctx, headers)
+	if err != nil {
+		return authErrorResponse(err), nil
 	}
 
 	//TODO: remove
@@ -133,6 +138,20 @@ func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (events
 
 }
 
+func authErrorResponse(err error) events.APIGatewayProxyResponse {
+	authErr := api.NewAuthError(err)
+	logger.Warningf("rejecting request: %v", authErr)
+	return events.APIGatewayProxyResponse{
+		Body:       string(authErr.Response()),
+		StatusCode: authErr.StatusCode,
+		Headers: map[string]string{
+			"Content-Type":                 "application/json",
+			"Access-Control-Allow-Origin":  "*",
+			"Access-Control-Allow-Headers": "*",
+		},
+	}
+}
+
 func getDatastore() datastore.Batching {
 	if dynamoTableName != "" {
 		logger.Infof("using dynamo datastore: %s", dynamoTableName)
@@ -147,6 +166,19 @@ func getDatastore() datastore.Batching {
 	return aggregator.NewMemoryStore()
 }
 
+// getEntryStore is the store of index entries, which the dynamo datastore could only list with a Scan
+// (nil for the default, see aggregator.NewDatastoreEntries)
+func getEntryStore(store datastore.Batching) aggregator.EntryStore {
+	dynds, ok := store.(*dynamods.DynamoTable)
+	if !ok {
+		return nil
+	}
+	if entriesTableName == "" {
+		panic(fmt.Errorf("ENTRIES_TABLE_NAME is needed with the dynamo datastore"))
+	}
+	return &dynamoEntries{db: dynds.DynamoDB, table: entriesTableName}
+}
+
 func tokenHandler(ctx context.Context) (*api.IdentityTokenPayload, error) {
 	logger.Infof("tokenHandler")
 	requester := api.RequesterFromCtx(ctx)
@@ -175,6 +207,12 @@ func tokenHandler(ctx context.Context) (*api.IdentityTokenPayload, error) {
 		return nil, fmt.Errorf("error attching policy: %w", err)
 	}
 
+	err = attachPrivateTopicPolicies(ctx, requester, *out.IdentityId)
+	if err != nil {
+		logger.Errorf("error attaching private topic policies: %v", err)
+		return nil, fmt.Errorf("error attaching private topic policies: %w", err)
+	}
+
 	return &api.IdentityTokenPayload{
 		Result: true,
 		Token:  *out.Token,
@@ -190,7 +228,18 @@ func init() {
 	identityCli = cognitoidentity.New(awsSession)
 	iotCli = iot.New(awsSession)
 
-	updateFunc, err := publisher.Wrap(ctx, func(ctx context.Context, topic string, msg string) error {
+	var publisherOpts []publisher.Option
+	if privateTopics {
+		publisherOpts = append(publisherOpts, publisher.WithPrivateTopics())
+	}
+	if publishDiffs {
+		// updates are only published once the resolver exists
+		publisherOpts = append(publisherOpts, publisher.WithDiffs(func(ctx context.Context, did string, from, to cid.Cid) (*aggregator.DiffResponse, error) {
+			return appResolver.Aggregator.DiffWithReadControls(ctx, nil, did, from, to)
+		}))
+	}
+
+	publish := func(ctx context.Context, topic string, msg string) error {
 		logger.Infof("publishing to %s", topic)
 		_, err := iotDataCli.Publish(&iotdataplane.PublishInput{
 			Topic:   aws.String(topic),
@@ -203,15 +252,47 @@ func init() {
 			return err
 		}
 		return nil
-	})
+	}
 
-	resolver, err := api.NewResolver(ctx, &api.Config{KeyValueStore: getDatastore(), UpdateFunc: updateFunc})
+	updateFunc, err := publisher.Wrap(ctx, publish, publisherOpts...)
+	if err != nil {
+		panic(err)
+	}
+
+	sessionSecret, err = loadSessionSecret(ssm.New(awsSession))
+	if err != nil {
+		panic(err)
+	}
+
+	indexDefinitions, err := aggregator.ParseIndexDefinitions(indexes)
+	if err != nil {
+		panic(err)
+	}
+	searchDefinitions, err := aggregator.ParseSearchDefinitions(search)
+	if err != nil {
+		panic(err)
+	}
+
+	appStore = getDatastore()
+	if privateTopics {
+		publishUpdate := updateFunc
+		updateFunc = func(wrapper *gossip.AddBlockWrapper) {
+			publishUpdate(wrapper)
+			revokeSubscriptions(wrapper)
+		}
+		api.MaxSubscribeTrees = maxPrivateTopics
+	}
+
+	resolver, err := api.NewResolver(ctx, &api.Config{KeyValueStore: appStore, UpdateFunc: updateFunc, SessionSecret: []byte(sessionSecret), StrictAuth: strictAuth, MessageRelay: publisher.WrapMessages(publish), DurableInbox: durableInbox, BlameIndex: blameIndex, Indexes: indexDefinitions, Search: searchDefinitions, OwnerIndex: ownerIndex, EntryStore: getEntryStore(appStore)})
 	if err != nil {
 		panic(err)
 	}
 	resolver.TokenHandler = tokenHandler
+	if privateTopics {
+		resolver.SubscriptionHandler = subscriptionHandler
+	}
 
-	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers(), graphql.MaxParallelism(20)}
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers(), graphql.MaxParallelism(api.MaxParallelism)}
 	schema, err := graphql.ParseSchema(api.Schema, resolver, opts...)
 	if err != nil {
 		panic(err)
@@ -220,9 +301,57 @@ func init() {
 	appResolver = resolver
 }
 
+// attachPrivateTopicPolicies lets the cognito identity subscribe to the message topic of the requester
+// and (with PRIVATE_TOPICS) checks the read policies of the private topics it was granted (see subscribeTrees) again.
+func attachPrivateTopicPolicies(ctx context.Context, requester *identity.Identity, identityID string) error {
+	policySuffix := strings.ReplaceAll(identityID, ":", "_")
+
+	err := attachTopicPolicy(fmt.Sprintf("%s-messages-%s", iotPolicyName, policySuffix), []string{publisher.MessageTopic(requester.Sub)}, identityID, false)
+	if err != nil {
+		return err
+	}
+
+	if !privateTopics {
+		return nil
+	}
+	return refreshPrivateTopics(ctx, requester, identityID)
+}
+
 func main() {
 	ctx := context.Background()
 
+	if len(os.Args) > 1 && os.Args[1] == "rebuild-indexes" {
+		// indexes (and the owners of) the trees that were stored before the INDEXES (or SEARCH) were defined,
+		// it is also needed once to move the index entries to the ENTRIES_TABLE_NAME table (see RebuildIndexes)
+		err := appResolver.Aggregator.RebuildIndexes(ctx)
+		if err != nil {
+			panic(fmt.Errorf("error rebuilding indexes: %v", err))
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "rebuild-search" {
+		// indexes the search terms of the trees that changed since the (optional) RFC 3339 time again
+		var since time.Time
+		if len(os.Args) > 2 {
+			var err error
+			since, err = time.Parse(time.RFC3339, os.Args[2])
+			if err != nil {
+				panic(fmt.Errorf("invalid time %s: %v", os.Args[2], err))
+			}
+		}
+		err := appResolver.Aggregator.RebuildSearch(ctx, since)
+		if err != nil {
+			panic(fmt.Errorf("error rebuilding search: %v", err))
+		}
+		return
+	}
+
+	// without a shared secret, sessions would only be valid on the lambda instance that issued them
+	if sessionSecret == "" {
+		panic(fmt.Errorf("no session secret, set SESSION_SECRET_PARAMETER (or SESSION_SECRET)"))
+	}
+
 	if iotDataCli == nil {
 		endpointResp, err := iotCli.DescribeEndpointWithContext(ctx, &iot.DescribeEndpointInput{})
 		if err != nil {
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// loadSessionSecret returns the session secret from the SSM parameter (a SecureString) named by
+// SESSION_SECRET_PARAMETER, or SESSION_SECRET when there is none
+func loadSessionSecret(ssmCli *ssm.SSM) (string, error) {
+	if sessionSecretParameter == "" {
+		return sessionSecret, nil
+	}
+	resp, err := ssmCli.GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(sessionSecretParameter),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting parameter %s: %w", sessionSecretParameter, err)
+	}
+	return aws.StringValue(resp.Parameter.Value), nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSessionSecret(t *testing.T) {
+	var requested map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&requested))
+		w.Write([]byte(`{"Parameter": {"Name": "/test/session-secret", "Type": "SecureString", "Value": "from ssm"}}`))
+	}))
+	defer srv.Close()
+	ssmCli := ssm.New(awsSession, &aws.Config{
+		Endpoint:    aws.String(srv.URL),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})
+
+	defer func(parameter, secret string) {
+		sessionSecretParameter, sessionSecret = parameter, secret
+	}(sessionSecretParameter, sessionSecret)
+
+	sessionSecretParameter, sessionSecret = "", "from env"
+	secret, err := loadSessionSecret(ssmCli)
+	require.Nil(t, err)
+	assert.Equal(t, "from env", secret)
+	assert.Nil(t, requested)
+
+	sessionSecretParameter = "/test/session-secret"
+	secret, err = loadSessionSecret(ssmCli)
+	require.Nil(t, err)
+	assert.Equal(t, "from ssm", secret)
+	assert.Equal(t, "/test/session-secret", requested["Name"])
+	assert.Equal(t, true, requested["WithDecryption"])
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cognitoidentity"
+	"github.com/aws/aws-sdk-go/service/iot"
+	"github.com/ipfs/go-datastore"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api/publisher"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+	"github.com/quorumcontrol/tupelo/signer/gossip"
+)
+
+/*
+On AWS the broker is IoT, whose policies can't evaluate the read policy of a tree when a client subscribes. Instead
+subscribeTrees (see api.Resolver.SubscribeTrees) checks the read policies and the subscriptionHandler writes the
+private topics of the allowed trees into a single IoT policy of the cognito identity (a new version of it every time,
+so they don't pile up). The grants are kept in the KeyValueStore so that they can be revoked when the read policy of
+a tree changes (see revokeSubscriptions) and checked again whenever the identity gets a new token.
+*/
+
+// maxPrivateTopics is how many private topics fit into the 2048 characters of an IoT policy document
+const maxPrivateTopics = 8
+
+var (
+	subscriptionsPrefix = datastore.NewKey("_iot/subscriptions") // /<cognito identity id> -> DIDs
+	subscribersPrefix   = datastore.NewKey("_iot/subscribers")   // /<did> -> cognito identity ids
+
+	readPolicyPaths = [][]string{{".well-known", "policies"}, {".well-known", "policyImports"}}
+)
+
+// subscriptionHandler is the api.SubscriptionHandlerFunc of the lambda
+func subscriptionHandler(ctx context.Context, requester *identity.Identity, dids []string) error {
+	out, err := identityCli.LookupDeveloperIdentity(&cognitoidentity.LookupDeveloperIdentityInput{
+		IdentityPoolId:          aws.String(identityPoolID),
+		DeveloperUserIdentifier: aws.String(requester.Sub),
+		MaxResults:              aws.Int64(1),
+	})
+	if err != nil {
+		return fmt.Errorf("error looking up identity: %w", err)
+	}
+	return setPrivateTopics(*out.IdentityId, dids)
+}
+
+// refreshPrivateTopics checks the read policies of the trees the identity was granted again (when it gets a new token)
+func refreshPrivateTopics(ctx context.Context, requester *identity.Identity, identityID string) error {
+	granted, err := getList(subscriptionsPrefix.ChildString(identityID))
+	if err != nil {
+		return err
+	}
+	allowed := make([]string, 0, len(granted))
+	for _, did := range granted {
+		ok, err := appResolver.Aggregator.ReadAllowed(ctx, &policy.ReadInput{
+			Method:   policy.MethodSubscribe,
+			Object:   did,
+			Identity: requester,
+		})
+		if err != nil {
+			return fmt.Errorf("error checking read policy: %w", err)
+		}
+		if ok {
+			allowed = append(allowed, did)
+		}
+	}
+	if len(allowed) == len(granted) {
+		return nil
+	}
+	return setPrivateTopics(identityID, allowed)
+}
+
+// setPrivateTopics makes the private topics of dids the only ones the identity can subscribe to
+func setPrivateTopics(identityID string, dids []string) error {
+	if len(dids) > maxPrivateTopics {
+		return fmt.Errorf("at most %d private topics can be subscribed to", maxPrivateTopics)
+	}
+	dids = uniqueSorted(dids)
+	previous, err := getList(subscriptionsPrefix.ChildString(identityID))
+	if err != nil {
+		return err
+	}
+
+	policyName := fmt.Sprintf("%s-private-%s", iotPolicyName, strings.ReplaceAll(identityID, ":", "_"))
+	if len(dids) == 0 {
+		err = deleteTopicPolicy(policyName, identityID)
+	} else {
+		topics := make([]string, len(dids))
+		for i, did := range dids {
+			topics[i] = publisher.PrivateTopic(did)
+		}
+		err = attachTopicPolicy(policyName, topics, identityID, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	// the subscribers are only used to revoke, so they are updated after the policy
+	isCurrent := make(map[string]bool, len(dids))
+	for _, did := range dids {
+		isCurrent[did] = true
+		err = updateList(subscribersPrefix.ChildString(did), identityID, true)
+		if err != nil {
+			return err
+		}
+	}
+	for _, did := range previous {
+		if isCurrent[did] {
+			continue
+		}
+		err = updateList(subscribersPrefix.ChildString(did), identityID, false)
+		if err != nil {
+			return err
+		}
+	}
+	return putList(subscriptionsPrefix.ChildString(identityID), dids)
+}
+
+// revokeSubscriptions takes the private topic of the tree of the block away from every identity it was granted to
+// when the block changes the read policy (or the ownership) of the tree, subscribeTrees checks the new policy.
+// Policies imported from other trees are only checked again with the next token of an identity.
+func revokeSubscriptions(wrapper *gossip.AddBlockWrapper) {
+	block := &chaintree.BlockWithHeaders{}
+	err := cbornode.DecodeInto(wrapper.Payload, block)
+	if err != nil {
+		logger.Errorf("error decoding block: %v", err)
+		return
+	}
+	if !changesReadPolicy(block) {
+		return
+	}
+
+	did := string(wrapper.ObjectId)
+	subscribers, err := getList(subscribersPrefix.ChildString(did))
+	if err != nil {
+		logger.Errorf("error getting subscribers of %s: %v", did, err)
+		return
+	}
+	for _, identityID := range subscribers {
+		granted, err := getList(subscriptionsPrefix.ChildString(identityID))
+		if err != nil {
+			logger.Errorf("error getting subscriptions of %s: %v", identityID, err)
+			continue
+		}
+		remaining := make([]string, 0, len(granted))
+		for _, grantedDid := range granted {
+			if grantedDid != did {
+				remaining = append(remaining, grantedDid)
+			}
+		}
+		err = setPrivateTopics(identityID, remaining)
+		if err != nil {
+			logger.Errorf("error revoking %s from %s: %v", did, identityID, err)
+		}
+	}
+}
+
+func changesReadPolicy(block *chaintree.BlockWithHeaders) bool {
+	for _, txn := range block.Transactions {
+		switch txn.Type {
+		case transactions.Transaction_SETOWNERSHIP:
+			return true
+		case transactions.Transaction_SETDATA:
+			path := strings.Split(strings.Trim(txn.GetSetDataPayload().Path, "/"), "/")
+			for _, policyPath := range readPolicyPaths {
+				if overlaps(path, policyPath) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// overlaps is true when one of the paths is within the other
+func overlaps(a []string, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// topicPolicyDocument allows subscribing to topics
+func topicPolicyDocument(topics []string) (string, error) {
+	filters := make([]string, len(topics))
+	resources := make([]string, len(topics))
+	for i, topic := range topics {
+		filters[i] = fmt.Sprintf("%s:topicfilter/%s", iotArnPrefix, topic)
+		resources[i] = fmt.Sprintf("%s:topic/%s", iotArnPrefix, topic)
+	}
+	doc, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"iot:Subscribe"},
+				"Resource": filters,
+			},
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"iot:Receive"},
+				"Resource": resources,
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling policy: %w", err)
+	}
+	return string(doc), nil
+}
+
+// attachTopicPolicy creates (if necessary, otherwise it replaces the document with replace) a policy allowing
+// subscriptions to topics and attaches it to the identity
+func attachTopicPolicy(policyName string, topics []string, identityID string, replace bool) error {
+	doc, err := topicPolicyDocument(topics)
+	if err != nil {
+		return err
+	}
+
+	_, err = iotCli.CreatePolicy(&iot.CreatePolicyInput{
+		PolicyName:     aws.String(policyName),
+		PolicyDocument: aws.String(doc),
+	})
+	aerr, ok := err.(awserr.Error)
+	exists := ok && aerr.Code() == iot.ErrCodeResourceAlreadyExistsException
+	switch {
+	case exists && replace:
+		// IoT keeps at most 5 versions of a policy
+		err = deletePolicyVersions(policyName)
+		if err != nil {
+			return err
+		}
+		_, err = iotCli.CreatePolicyVersion(&iot.CreatePolicyVersionInput{
+			PolicyName:     aws.String(policyName),
+			PolicyDocument: aws.String(doc),
+			SetAsDefault:   aws.Bool(true),
+		})
+		if err != nil {
+			return fmt.Errorf("error creating policy version: %w", err)
+		}
+	case err != nil && !exists:
+		return fmt.Errorf("error creating policy: %w", err)
+	}
+
+	_, err = iotCli.AttachPolicy(&iot.AttachPolicyInput{
+		PolicyName: aws.String(policyName),
+		Target:     aws.String(identityID),
+	})
+	if err != nil {
+		return fmt.Errorf("error attaching policy: %w", err)
+	}
+	return nil
+}
+
+// deleteTopicPolicy detaches and deletes a policy (if it exists)
+func deleteTopicPolicy(policyName string, identityID string) error {
+	_, err := iotCli.DetachPolicy(&iot.DetachPolicyInput{
+		PolicyName: aws.String(policyName),
+		Target:     aws.String(identityID),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == iot.ErrCodeResourceNotFoundException {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error detaching policy: %w", err)
+	}
+	err = deletePolicyVersions(policyName)
+	if err != nil {
+		return err
+	}
+	_, err = iotCli.DeletePolicy(&iot.DeletePolicyInput{
+		PolicyName: aws.String(policyName),
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting policy: %w", err)
+	}
+	return nil
+}
+
+// deletePolicyVersions deletes the versions of a policy that are not the default one
+func deletePolicyVersions(policyName string) error {
+	out, err := iotCli.ListPolicyVersions(&iot.ListPolicyVersionsInput{
+		PolicyName: aws.String(policyName),
+	})
+	if err != nil {
+		return fmt.Errorf("error listing policy versions: %w", err)
+	}
+	for _, version := range out.PolicyVersions {
+		if aws.BoolValue(version.IsDefaultVersion) {
+			continue
+		}
+		_, err = iotCli.DeletePolicyVersion(&iot.DeletePolicyVersionInput{
+			PolicyName:      aws.String(policyName),
+			PolicyVersionId: version.VersionId,
+		})
+		if err != nil {
+			return fmt.Errorf("error deleting policy version: %w", err)
+		}
+	}
+	return nil
+}
+
+func getList(key datastore.Key) ([]string, error) {
+	bits, err := appStore.Get(key)
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s: %w", key.String(), err)
+	}
+	var names []string
+	err = cbornode.DecodeInto(bits, &names)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s: %w", key.String(), err)
+	}
+	return names, nil
+}
+
+func putList(key datastore.Key, names []string) error {
+	if len(names) == 0 {
+		err := appStore.Delete(key)
+		if err != nil && err != datastore.ErrNotFound {
+			return fmt.Errorf("error deleting %s: %w", key.String(), err)
+		}
+		return nil
+	}
+	bits, err := cbornode.DumpObject(names)
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", key.String(), err)
+	}
+	err = appStore.Put(key, bits)
+	if err != nil {
+		return fmt.Errorf("error putting %s: %w", key.String(), err)
+	}
+	return nil
+}
+
+// updateList adds name to (or removes it from) the list at key
+func updateList(key datastore.Key, name string, add bool) error {
+	names, err := getList(key)
+	if err != nil {
+		return err
+	}
+	updated := make([]string, 0, len(names)+1)
+	for _, existing := range names {
+		if existing != name {
+			updated = append(updated, existing)
+		}
+	}
+	if add {
+		updated = append(updated, name)
+	}
+	return putList(key, uniqueSorted(updated))
+}
+
+func uniqueSorted(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	unique := make([]string, 0, len(names))
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/messaging"
+)
+
+type SendMessageInput struct {
+	Input struct {
+		Message string // base64
+	}
+}
+
+type SendMessagePayload struct {
+	Accepted bool
+	Stored   bool
+}
+
+type InboxInput struct {
+	Input *struct {
+		First *int32
+	}
+}
+
+type InboxMessage struct {
+	Id     string
+	From   string
+	To     string
+	Body   string
+	Sent   int32
+	Signed string
+}
+
+type InboxPayload struct {
+	Messages []*InboxMessage
+}
+
+type AcknowledgeMessagesInput struct {
+	Input struct {
+		Ids []string
+	}
+}
+
+type AcknowledgeMessagesPayload struct {
+	Result bool
+}
+
+// SendMessage relays a signed message to the recipient if the recipient's message policy allows it.
+// The message is authenticated by its own signatures, so the requester does not need to be the sender.
+func (r *Resolver) SendMessage(ctx context.Context, input SendMessageInput) (*SendMessagePayload, error) {
+	sm, err := messaging.FromString(input.Input.Message)
+	if err != nil {
+		return nil, NewAuthError(err)
+	}
+	logger.Infof("sendMessage from %s to %s", sm.From, sm.To)
+
+	stored, err := r.Messenger.Send(ctx, sm)
+	if errors.Is(err, messaging.ErrNotAllowed) {
+		return &SendMessagePayload{
+			Accepted: false,
+		}, nil
+	}
+	if err != nil {
+		if identity.IsUnverified(err) {
+			return nil, NewAuthError(err)
+		}
+		return nil, fmt.Errorf("error sending message: %w", err)
+	}
+	return &SendMessagePayload{
+		Accepted: true,
+		Stored:   stored,
+	}, nil
+}
+
+func (r *Resolver) inboxOf(ctx context.Context) (*messaging.Inbox, string, error) {
+	inbox := r.Messenger.Inbox()
+	if inbox == nil {
+		return nil, "", fmt.Errorf("no durable inbox")
+	}
+	requester := RequesterFromCtx(ctx)
+	if requester == nil {
+		if authErr := AuthErrorFromCtx(ctx); authErr != nil {
+			return nil, "", authErr
+		}
+		return nil, "", fmt.Errorf("the inbox requires an identity")
+	}
+	return inbox, requester.Sub, nil
+}
+
+// Inbox returns the oldest messages in the durable inbox of the requester
+func (r *Resolver) Inbox(ctx context.Context, input InboxInput) (*InboxPayload, error) {
+	inbox, did, err := r.inboxOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limit := 0
+	if input.Input != nil && input.Input.First != nil {
+		limit = int(*input.Input.First)
+	}
+
+	stored, err := inbox.List(ctx, did, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing inbox: %w", err)
+	}
+	msgs := make([]*InboxMessage, len(stored))
+	for i, s := range stored {
+		msgs[i] = &InboxMessage{
+			Id:     s.ID,
+			From:   s.Message.From,
+			To:     s.Message.To,
+			Body:   s.Message.Body,
+			Sent:   int32(s.Message.Sent),
+			Signed: s.Message.String(),
+		}
+	}
+	return &InboxPayload{
+		Messages: msgs,
+	}, nil
+}
+
+// AcknowledgeMessages removes messages from the durable inbox of the requester
+func (r *Resolver) AcknowledgeMessages(ctx context.Context, input AcknowledgeMessagesInput) (*AcknowledgeMessagesPayload, error) {
+	inbox, did, err := r.inboxOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = inbox.Delete(ctx, did, input.Input.Ids...)
+	if errors.Is(err, messaging.ErrInvalidMessageID) {
+		return nil, &CodedError{Code: ErrCodeBadInput, Err: err}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error acknowledging messages: %w", err)
+	}
+	return &AcknowledgeMessagesPayload{
+		Result: true,
+	}, nil
+}
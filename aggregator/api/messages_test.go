@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/messaging"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	relayed := make(chan *messaging.SignedMessage, 1)
+	r, err := NewResolver(ctx, &Config{
+		KeyValueStore: aggregator.NewMemoryStore(),
+		DurableInbox:  true,
+		MessageRelay: func(ctx context.Context, sm *messaging.SignedMessage) error {
+			relayed <- sm
+			return nil
+		},
+	})
+	require.Nil(t, err)
+
+	senderKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	senderAbr := testhelpers.NewValidTransactionWithPathAndValue(t, senderKey, "name", "sender")
+	_, err = r.Aggregator.Add(ctx, &senderAbr)
+	require.Nil(t, err)
+	sender := string(senderAbr.ObjectId)
+
+	recipientKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	recipientAbr := testhelpers.NewValidTransactionWithPathAndValue(t, recipientKey, ".well-known/policies/message", `
+		package message
+		default allow = true
+	`)
+	_, err = r.Aggregator.Add(ctx, &recipientAbr)
+	require.Nil(t, err)
+	recipient := string(recipientAbr.ObjectId)
+
+	sm, err := (&messaging.Message{
+		From: sender,
+		To:   recipient,
+		Body: "hi",
+		Sent: time.Now().Unix(),
+	}).Sign(&identity.Secp256k1Signer{Key: senderKey})
+	require.Nil(t, err)
+
+	input := SendMessageInput{}
+	input.Input.Message = sm.String()
+	resp, err := r.SendMessage(ctx, input)
+	require.Nil(t, err)
+	assert.True(t, resp.Accepted)
+	assert.True(t, resp.Stored)
+	assert.Equal(t, "hi", (<-relayed).Body)
+
+	// the inbox requires the recipient identity
+	_, err = r.Inbox(ctx, InboxInput{})
+	require.NotNil(t, err)
+
+	recipientCtx := context.WithValue(ctx, IdentityContextKey, identity.Identity{Iss: recipient, Sub: recipient})
+	inbox, err := r.Inbox(recipientCtx, InboxInput{})
+	require.Nil(t, err)
+	require.Len(t, inbox.Messages, 1)
+	assert.Equal(t, sender, inbox.Messages[0].From)
+
+	// ids are checked so that they cannot delete other keys (such as the tip of the sender)
+	ack := AcknowledgeMessagesInput{}
+	ack.Input.Ids = []string{"../../../" + sender}
+	_, err = r.AcknowledgeMessages(recipientCtx, ack)
+	require.NotNil(t, err)
+	assert.Equal(t, ErrCodeBadInput, ErrorCode(err))
+	_, err = r.Aggregator.GetLatest(ctx, sender)
+	require.Nil(t, err)
+
+	ack.Input.Ids = []string{inbox.Messages[0].Id}
+	_, err = r.AcknowledgeMessages(recipientCtx, ack)
+	require.Nil(t, err)
+
+	inbox, err = r.Inbox(recipientCtx, InboxInput{})
+	require.Nil(t, err)
+	require.Len(t, inbox.Messages, 0)
+
+	// a tampered message is an auth error
+	sm.Body = "changed"
+	input.Input.Message = sm.String()
+	_, err = r.SendMessage(ctx, input)
+	require.NotNil(t, err)
+	assert.IsType(t, &AuthError{}, err)
+}
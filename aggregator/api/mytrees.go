@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+type MyTreesInput struct {
+	First *int32
+	After *string
+}
+
+type MyTreesPayload struct {
+	Dids []string
+	PageInfo
+}
+
+// MyTrees lists a page of the trees owned by the addresses that signed the requester's identity, see Aggregator.OwnedTrees
+func (r *Resolver) MyTrees(ctx context.Context, input MyTreesInput) (*MyTreesPayload, error) {
+	first, after, err := pageArgs(input.First, input.After, DefaultFindPageSize, MaxFindPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	requester := RequesterFromCtx(ctx)
+	if requester == nil {
+		if authErr := AuthErrorFromCtx(ctx); authErr != nil {
+			return nil, authErr
+		}
+		return nil, fmt.Errorf("myTrees requires an identity")
+	}
+	logger.Infof("myTrees with requester %v", requester)
+
+	resp, err := r.Aggregator.OwnedTrees(ctx, requester.Signers, first, after)
+	if err != nil {
+		logger.Errorf("error listing owned trees %v", err)
+		return nil, NewCodedError(fmt.Errorf("error listing owned trees: %w", err))
+	}
+
+	payload := &MyTreesPayload{
+		Dids:     resp.Dids,
+		PageInfo: newPageInfo(lastDid(resp.Dids), resp.HasMore),
+	}
+	if payload.Dids == nil {
+		payload.Dids = []string{}
+	}
+	return payload, nil
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMyTrees(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pf := newPageFixture(t, ctx, &Config{OwnerIndex: true})
+
+	did, treeKey := pf.addTree(t, "some/path", "hi")
+
+	query := `query myTrees {
+		myTrees {
+			dids
+			hasNextPage
+		}
+	}`
+
+	t.Run("requires an identity", func(t *testing.T) {
+		require.Len(t, pf.exec(t, ctx, query, "myTrees", nil, nil), 1)
+	})
+
+	t.Run("lists the trees owned by the signers", func(t *testing.T) {
+		identCtx := context.WithValue(ctx, IdentityContextKey, identity.Identity{
+			Iss:     did,
+			Sub:     did,
+			Signers: []string{crypto.PubkeyToAddress(treeKey.PublicKey).String()},
+		})
+		resp := &struct {
+			MyTrees struct {
+				Dids        []string `json:"dids"`
+				HasNextPage bool     `json:"hasNextPage"`
+			} `json:"myTrees"`
+		}{}
+		require.Len(t, pf.exec(t, identCtx, query, "myTrees", nil, resp), 0)
+		assert.Equal(t, []string{did}, resp.MyTrees.Dids)
+		assert.False(t, resp.MyTrees.HasNextPage)
+	})
+}
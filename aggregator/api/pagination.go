@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// DefaultFindPageSize and MaxFindPageSize limit the DIDs returned by a page of find, search and myTrees
+var (
+	DefaultFindPageSize = 100
+	MaxFindPageSize     = 1000
+)
+
+// PageInfo ends the payload of a paginated query, EndCursor is the after argument of the next page
+// (nil for an empty page)
+type PageInfo struct {
+	EndCursor   *string
+	HasNextPage bool
+}
+
+// newPageInfo is the PageInfo of a page that ends at the key last, cursors are the keys base64 (URL) encoded
+func newPageInfo(last string, hasMore bool) PageInfo {
+	info := PageInfo{HasNextPage: hasMore}
+	if last != "" {
+		cursor := base64.RawURLEncoding.EncodeToString([]byte(last))
+		info.EndCursor = &cursor
+	}
+	return info
+}
+
+// pageArgs validates the first and after arguments of a paginated query and returns the page size
+// (defaultSize when first is nil) and the key after decodes to (see newPageInfo)
+func pageArgs(first *int32, after *string, defaultSize, maxSize int) (int, string, error) {
+	size := defaultSize
+	if first != nil {
+		size = int(*first)
+	}
+	if size < 0 || size > maxSize {
+		return 0, "", &CodedError{Code: ErrCodeBadInput, Err: fmt.Errorf("first must be between 0 and %d", maxSize)}
+	}
+	if after == nil {
+		return size, "", nil
+	}
+	key, err := base64.RawURLEncoding.DecodeString(*after)
+	if err != nil {
+		return 0, "", &CodedError{Code: ErrCodeBadInput, Err: fmt.Errorf("invalid cursor: %w", err)}
+	}
+	return size, string(key), nil
+}
+
+// lastDid is the key newPageInfo takes for a page of DIDs
+func lastDid(dids []string) string {
+	if len(dids) == 0 {
+		return ""
+	}
+	return dids[len(dids)-1]
+}
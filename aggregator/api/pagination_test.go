@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pageFixture is a resolver (of an in memory store) and its schema for the tests of the paginated queries
+type pageFixture struct {
+	ctx    context.Context
+	r      *Resolver
+	schema *graphql.Schema
+}
+
+func newPageFixture(t *testing.T, ctx context.Context, config *Config) *pageFixture {
+	config.KeyValueStore = aggregator.NewMemoryStore()
+	r, err := NewResolver(ctx, config)
+	require.Nil(t, err)
+	schema, err := graphql.ParseSchema(Schema, r, graphql.UseFieldResolvers())
+	require.Nil(t, err)
+	return &pageFixture{ctx: ctx, r: r, schema: schema}
+}
+
+// addTree adds a new tree with value at path (within tree/data) and returns its DID and key
+func (pf *pageFixture) addTree(t *testing.T, path, value string) (string, *ecdsa.PrivateKey) {
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	abr := testhelpers.NewValidTransactionWithPathAndValue(t, treeKey, path, value)
+	_, err = pf.r.Aggregator.Add(pf.ctx, &abr)
+	require.Nil(t, err)
+	return string(abr.ObjectId), treeKey
+}
+
+// exec runs the operation of query with vars (in ctx) and returns its errors,
+// the data is unmarshaled into resp when there are none
+func (pf *pageFixture) exec(t *testing.T, ctx context.Context, query, operation string, vars map[string]interface{}, resp interface{}) []*gqlerrors.QueryError {
+	schemaResp := pf.schema.Exec(ctx, query, operation, vars)
+	if len(schemaResp.Errors) == 0 {
+		require.Nil(t, json.Unmarshal(schemaResp.Data, resp))
+	}
+	return schemaResp.Errors
+}
+
+func TestPageArgs(t *testing.T) {
+	first, after, err := pageArgs(nil, nil, 10, 20)
+	require.Nil(t, err)
+	assert.Equal(t, 10, first)
+	assert.Equal(t, "", after)
+
+	info := newPageInfo("did:tupelo:test", true)
+	require.NotNil(t, info.EndCursor)
+	assert.True(t, info.HasNextPage)
+	size := int32(20)
+	first, after, err = pageArgs(&size, info.EndCursor, 10, 20)
+	require.Nil(t, err)
+	assert.Equal(t, 20, first)
+	assert.Equal(t, "did:tupelo:test", after)
+
+	assert.Nil(t, newPageInfo("", false).EndCursor)
+
+	t.Run("bad input", func(t *testing.T) {
+		tooMany := int32(21)
+		_, _, err := pageArgs(&tooMany, nil, 10, 20)
+		require.NotNil(t, err)
+		assert.Equal(t, ErrCodeBadInput, err.(*CodedError).Code)
+
+		invalid := "not a cursor!"
+		_, _, err = pageArgs(nil, &invalid, 10, 20)
+		require.NotNil(t, err)
+		assert.Equal(t, ErrCodeBadInput, err.(*CodedError).Code)
+	})
+}
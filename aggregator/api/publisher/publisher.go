@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log"
@@ -11,6 +12,7 @@ import (
 	cbornode "github.com/ipfs/go-ipld-cbor"
 	format "github.com/ipfs/go-ipld-format"
 	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/messaging"
 	"github.com/quorumcontrol/tupelo/signer/gossip"
 )
 
@@ -25,8 +27,22 @@ type AddBlockMessage struct {
 	Did    string  `json:"did"`
 	NewTip cid.Cid `json:"newTip"`
 	Height uint64  `json:"height"`
+	// Diff is the changes from the previous tip when using WithDiffs
+	Diff []DiffChange `json:"diff,omitempty"`
 }
 
+// DiffChange is an aggregator.Change in an AddBlockMessage
+type DiffChange struct {
+	Path     string      `json:"path"`
+	Type     string      `json:"type"`
+	OldValue interface{} `json:"oldValue,omitempty"`
+	NewValue interface{} `json:"newValue,omitempty"`
+}
+
+// DiffFunc returns the changes between two versions of a tree, normally Aggregator.DiffWithReadControls
+// without an identity so that only the changes anyone can read are published.
+type DiffFunc func(ctx context.Context, did string, from, to cid.Cid) (*aggregator.DiffResponse, error)
+
 func blocksToBytes(blocks []format.Node) [][]byte {
 	retBits := make([][]byte, len(blocks))
 	for i, blk := range blocks {
@@ -39,8 +55,58 @@ func blocksToBytes(blocks []format.Node) [][]byte {
 // and sends them along
 type MessageQueueFunc func(ctx context.Context, topic string, msg string) error
 
+// PublicTopic is where updates of a tree are published by default
+func PublicTopic(did string) string {
+	return fmt.Sprintf("public/trees/%s", did)
+}
+
+// PrivateTopic is where updates of a tree are published when using WithPrivateTopics,
+// brokers only allow subscriptions from identities that pass the tree's read policy
+// with the policy.MethodSubscribe method (on AWS once they are granted with subscribeTrees).
+func PrivateTopic(did string) string {
+	return fmt.Sprintf("private/trees/%s", did)
+}
+
+// MessageTopic is where messages to a tree are relayed (see WrapMessages), only identities
+// with the tree as their subject can subscribe to it.
+func MessageTopic(did string) string {
+	return PrivateTopic(did) + "/messages"
+}
+
+type options struct {
+	private bool
+	diff    DiffFunc
+}
+
+// Option configures Wrap
+type Option func(o *options)
+
+// WithPrivateTopics publishes updates to the PrivateTopic of the tree instead of the PublicTopic
+func WithPrivateTopics() Option {
+	return func(o *options) {
+		o.private = true
+	}
+}
+
+// WithDiffs attaches the changes from the previous tip to the AddBlockMessage. The message is
+// published without a diff when diff fails (for instance when the previous tip is not stored).
+func WithDiffs(diff DiffFunc) Option {
+	return func(o *options) {
+		o.diff = diff
+	}
+}
+
 // Wraps a message queue function into an UpdateFunc
-func Wrap(ctx context.Context, publishFunc MessageQueueFunc) (aggregator.UpdateFunc, error) {
+func Wrap(ctx context.Context, publishFunc MessageQueueFunc, opts ...Option) (aggregator.UpdateFunc, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	topic := PublicTopic
+	if o.private {
+		topic = PrivateTopic
+	}
+
 	return func(wrapper *gossip.AddBlockWrapper) {
 		tip, err := cid.Cast(wrapper.NewTip)
 		if err != nil {
@@ -53,10 +119,13 @@ func Wrap(ctx context.Context, publishFunc MessageQueueFunc) (aggregator.UpdateF
 			NewTip: tip,
 			Height: wrapper.Height,
 		}
+		if o.diff != nil {
+			addBlockMessage.Diff = diffChanges(ctx, o.diff, wrapper, tip)
+		}
 
 		bits, err := json.Marshal(addBlockMessage)
 
-		err = publishFunc(ctx, fmt.Sprintf("public/trees/%s", string(wrapper.ObjectId)), string(bits))
+		err = publishFunc(ctx, topic(string(wrapper.ObjectId)), string(bits))
 		if err != nil {
 			logger.Errorf("error publishing: %v", err)
 			return
@@ -64,6 +133,32 @@ func Wrap(ctx context.Context, publishFunc MessageQueueFunc) (aggregator.UpdateF
 	}, nil
 }
 
+func diffChanges(ctx context.Context, diff DiffFunc, wrapper *gossip.AddBlockWrapper, tip cid.Cid) []DiffChange {
+	previousTip, err := cid.Cast(wrapper.PreviousTip)
+	if err != nil {
+		logger.Errorf("error casting previous tip: %v", err)
+		return nil
+	}
+	resp, err := diff(ctx, string(wrapper.ObjectId), previousTip, tip)
+	if err != nil {
+		logger.Warningf("error diffing %s: %v", string(wrapper.ObjectId), err)
+		return nil
+	}
+	if resp == nil {
+		return nil
+	}
+	changes := make([]DiffChange, len(resp.Changes))
+	for i, change := range resp.Changes {
+		changes[i] = DiffChange{
+			Path:     strings.Join(change.Path, "/"),
+			Type:     change.Type,
+			OldValue: change.OldValue,
+			NewValue: change.NewValue,
+		}
+	}
+	return changes
+}
+
 // // StartPublishing takes the actual basic publisherFunc (the one that sends bits to a topic) and then will setup the goroutine, etc
 // // to call that function with the correct formats.
 // func StartPublishing(ctx context.Context, publishFunc MessageQueueFunc) (aggregator.UpdateChan, error) {
@@ -99,3 +194,36 @@ func Wrap(ctx context.Context, publishFunc MessageQueueFunc) (aggregator.UpdateF
 // 	}()
 // 	return updateCh, nil
 // }
+
+// DirectMessage is sent to the MessageTopic of the recipient for every message
+type DirectMessage struct {
+	ID   string `json:"id"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	Body string `json:"body"`
+	Sent int64  `json:"sent"`
+	// Signed is the base64 encoded messaging.SignedMessage so the recipient can verify it
+	Signed string `json:"signed"`
+}
+
+// WrapMessages wraps a message queue function into a messaging.RelayFunc
+func WrapMessages(publishFunc MessageQueueFunc) messaging.RelayFunc {
+	return func(ctx context.Context, sm *messaging.SignedMessage) error {
+		id, err := sm.ID()
+		if err != nil {
+			return err
+		}
+		bits, err := json.Marshal(&DirectMessage{
+			ID:     id,
+			From:   sm.From,
+			To:     sm.To,
+			Body:   sm.Body,
+			Sent:   sm.Sent,
+			Signed: sm.String(),
+		})
+		if err != nil {
+			return fmt.Errorf("error marshaling: %w", err)
+		}
+		return publishFunc(ctx, MessageTopic(sm.To), string(bits))
+	}
+}
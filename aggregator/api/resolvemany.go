@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+)
+
+// MaxResolveManyInputs limits the number of inputs of a resolveMany
+var MaxResolveManyInputs = 100
+
+type ResolveManyInput struct {
+	Inputs []ResolveInputObject
+}
+
+type ResolveManyResult struct {
+	Did           string
+	Path          string
+	Tip           *CID
+	RemainingPath []string
+	Value         *JSON
+}
+
+type ResolveManyPayload struct {
+	Results       []ResolveManyResult
+	TouchedBlocks *[]Block
+}
+
+// ResolveMany resolves many paths (of many trees) in one request, see Aggregator.ResolveManyWithReadControls
+func (r *Resolver) ResolveMany(ctx context.Context, input ResolveManyInput) (*ResolveManyPayload, error) {
+	if len(input.Inputs) > MaxResolveManyInputs {
+		return nil, &CodedError{Code: ErrCodeBadInput, Err: fmt.Errorf("too many inputs %d (max: %d)", len(input.Inputs), MaxResolveManyInputs)}
+	}
+	requester := RequesterFromCtx(ctx)
+	logger.Infof("resolving %d paths with requester %v", len(input.Inputs), requester)
+
+	requests := make([]aggregator.ResolveRequest, len(input.Inputs))
+	for i, in := range input.Inputs {
+		opts, err := in.options()
+		if err != nil {
+			return nil, err
+		}
+		requests[i] = aggregator.ResolveRequest{
+			ObjectID: in.Did,
+			Path:     strings.Split(strings.TrimPrefix(in.Path, "/"), "/"),
+			Options:  opts,
+		}
+	}
+
+	responses, err := r.Aggregator.ResolveManyWithReadControls(ctx, requester, requests, MaxParallelism)
+	if err != nil {
+		logger.Errorf("error resolving many %v", err)
+		return nil, NewCodedError(fmt.Errorf("error resolving: %w", err))
+	}
+
+	results := make([]ResolveManyResult, len(responses))
+	seen := make(map[cid.Cid]struct{})
+	var touched []format.Node
+	for i, resp := range responses {
+		results[i] = ResolveManyResult{
+			Did:           input.Inputs[i].Did,
+			Path:          input.Inputs[i].Path,
+			Tip:           NewCID(resp.Tip),
+			RemainingPath: resp.RemainingPath,
+			Value: &JSON{
+				Object: resp.Value,
+			},
+		}
+		for _, node := range resp.TouchedBlocks {
+			if _, ok := seen[node.Cid()]; ok {
+				continue
+			}
+			seen[node.Cid()] = struct{}{}
+			touched = append(touched, node)
+		}
+	}
+	blocks := blocksToGraphQLBlocks(touched)
+
+	return &ResolveManyPayload{
+		Results:       results,
+		TouchedBlocks: &blocks,
+	}, nil
+}
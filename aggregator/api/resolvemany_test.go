@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveMany(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := NewResolver(ctx, &Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers(), graphql.MaxParallelism(MaxParallelism)}
+	schema, err := graphql.ParseSchema(Schema, r, opts...)
+	require.Nil(t, err)
+
+	dids := make([]string, 2)
+	for i := range dids {
+		treeKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		abr := testhelpers.NewValidTransactionWithPathAndValue(t, treeKey, "/my/path", "hi")
+		_, err = r.Aggregator.Add(ctx, &abr)
+		require.Nil(t, err)
+		dids[i] = string(abr.ObjectId)
+	}
+
+	query := `query resolveMany($inputs: [ResolveInput!]!) {
+		resolveMany(inputs: $inputs) {
+			results {
+				did
+				path
+				tip
+				remainingPath
+				value
+			}
+			touchedBlocks {
+				cid
+			}
+		}
+	}`
+
+	type Response struct {
+		ResolveMany struct {
+			Results []struct {
+				Did           string      `json:"did"`
+				Path          string      `json:"path"`
+				Tip           *CID        `json:"tip"`
+				RemainingPath []string    `json:"remainingPath"`
+				Value         interface{} `json:"value"`
+			} `json:"results"`
+			TouchedBlocks []Block `json:"touchedBlocks"`
+		} `json:"resolveMany"`
+	}
+
+	schemaResp := schema.Exec(ctx, query, "resolveMany", map[string]interface{}{
+		"inputs": []interface{}{
+			map[string]interface{}{"did": dids[0], "path": "tree/data/my/path"},
+			map[string]interface{}{"did": dids[1], "path": "tree/data/my/path"},
+			map[string]interface{}{"did": dids[0], "path": "tree/data/my/path/deeper"},
+			map[string]interface{}{"did": "did:tupelo:unknown", "path": "tree/data"},
+		},
+	})
+	require.Len(t, schemaResp.Errors, 0)
+
+	resp := &Response{}
+	require.Nil(t, json.Unmarshal(schemaResp.Data, resp))
+	results := resp.ResolveMany.Results
+	require.Len(t, results, 4)
+
+	assert.Equal(t, dids[0], results[0].Did)
+	assert.Equal(t, "hi", results[0].Value)
+	assert.Len(t, results[0].RemainingPath, 0)
+	require.NotNil(t, results[0].Tip)
+
+	assert.Equal(t, dids[1], results[1].Did)
+	assert.Equal(t, "hi", results[1].Value)
+
+	assert.Equal(t, "tree/data/my/path/deeper", results[2].Path)
+	assert.Equal(t, []string{"deeper"}, results[2].RemainingPath)
+	require.NotNil(t, results[2].Tip)
+	assert.True(t, results[2].Tip.Equals(results[0].Tip.Cid))
+
+	assert.Nil(t, results[3].Tip)
+	assert.Equal(t, []string{"tree", "data"}, results[3].RemainingPath)
+
+	// the touched blocks are the union of the blocks of the single resolves
+	expected := make(map[string]bool)
+	for _, did := range dids {
+		single, err := r.Aggregator.ResolveWithReadControls(ctx, nil, did, []string{"tree", "data", "my", "path"})
+		require.Nil(t, err)
+		for _, node := range single.TouchedBlocks {
+			expected[node.Cid().String()] = true
+		}
+	}
+	seen := make(map[string]bool)
+	for _, block := range resp.ResolveMany.TouchedBlocks {
+		require.NotNil(t, block.Cid)
+		assert.False(t, seen[block.Cid.String()])
+		seen[block.Cid.String()] = true
+	}
+	assert.Equal(t, expected, seen)
+
+	t.Run("too many inputs", func(t *testing.T) {
+		inputs := make([]interface{}, MaxResolveManyInputs+1)
+		for i := range inputs {
+			inputs[i] = map[string]interface{}{"did": dids[0], "path": "tree"}
+		}
+		schemaResp := schema.Exec(ctx, query, "resolveMany", map[string]interface{}{"inputs": inputs})
+		require.Len(t, schemaResp.Errors, 1)
+		assert.Equal(t, ErrCodeBadInput, schemaResp.Errors[0].Extensions["code"])
+	})
+}
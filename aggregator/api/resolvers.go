@@ -3,66 +3,176 @@ package api
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	logging "github.com/ipfs/go-log"
 
-	"github.com/graph-gophers/graphql-go"
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	format "github.com/ipfs/go-ipld-format"
 
-	"github.com/ipfs/go-cid"
 	"github.com/quorumcontrol/messages/v2/build/go/services"
 	"github.com/quorumcontrol/tupelo-lite/aggregator"
 	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/messaging"
 	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
 	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/quorumcontrol/tupelo/signer/gossip"
 )
 
 const IdentityContextKey = "tupelo-lite:identity"
 
+// SessionContextKey is set on the context when the identity came from a session
+// rather than from a signed identity.
+const SessionContextKey = "tupelo-lite:session"
+
 var logger = logging.Logger("resolver")
 
+// MaxParallelism limits the resolvers that run concurrently for a request, it is used for
+// the graphql.MaxParallelism schema option and for the resolves of resolveMany
+var MaxParallelism = 20
+
 type TokenHandlerFunc func(ctx context.Context) (*IdentityTokenPayload, error)
 
 type Resolver struct {
 	Aggregator   *aggregator.Aggregator
 	TokenHandler TokenHandlerFunc
+	Sessions     *identity.SessionManager
+	Messenger    *messaging.Messenger
+
+	// SubscriptionHandler grants the subscriptions of subscribeTrees (optional, see SubscribeTrees)
+	SubscriptionHandler SubscriptionHandlerFunc
+
+	// StrictAuth rejects requests whose presented identity fails verification
+	// instead of treating them as anonymous (see Authenticate)
+	StrictAuth bool
 }
 
 type Config struct {
 	KeyValueStore datastore.Batching
 	UpdateFunc    aggregator.UpdateFunc
+
+	// SessionSecret is used to sign sessions, if it is empty a random
+	// secret is used (which means sessions only work against this resolver)
+	SessionSecret   []byte
+	SessionDuration time.Duration
+
+	StrictAuth bool
+
+	// MessageRelay delivers messages sent with sendMessage (see publisher.WrapMessages)
+	MessageRelay messaging.RelayFunc
+	// DurableInbox stores messages in the KeyValueStore until the recipient acknowledges them
+	DurableInbox bool
+	// BlameIndex indexes the transactions of every block for blame (see aggregator.AggregatorConfig)
+	BlameIndex bool
+	// Indexes are the secondary indexes for find (see aggregator.AggregatorConfig)
+	Indexes []aggregator.IndexDefinition
+	// Search makes paths searchable with search (see aggregator.AggregatorConfig)
+	Search []aggregator.SearchDefinition
+	// OwnerIndex indexes the owners of trees for myTrees, the sessions of the trees grafted from a tree are
+	// only revoked (along with the ones of the tree) with it (see aggregator.AggregatorConfig)
+	OwnerIndex bool
+	// EntryStore stores the entries of the indexes (see aggregator.AggregatorConfig)
+	EntryStore aggregator.EntryStore
 }
 
 func NewResolver(ctx context.Context, config *Config) (*Resolver, error) {
 	defaultConfig := types.DefaultConfig()
-	defaultConfig.ValidatorGenerators = append(defaultConfig.ValidatorGenerators, policy.ValidatorGenerator)
+	defaultConfig.ValidatorGenerators = append(defaultConfig.ValidatorGenerators, policy.ValidatorGenerator, policy.SchemaValidatorGenerator, policy.ThresholdValidatorGenerator)
 	defaultConfig.ID = "aggregator"
 	ng := types.NewNotaryGroupFromConfig(defaultConfig)
 
-	agg, err := aggregator.NewAggregator(ctx, &aggregator.AggregatorConfig{KeyValueStore: config.KeyValueStore, Group: ng, UpdateFunc: config.UpdateFunc})
+	sessions, err := identity.NewSessionManager(config.SessionSecret, config.SessionDuration, config.KeyValueStore)
+	if err != nil {
+		return nil, fmt.Errorf("error creating session manager: %w", err)
+	}
+
+	updateFunc := func(wrapper *gossip.AddBlockWrapper) {
+		sessions.HandleUpdate(wrapper)
+		if config.UpdateFunc != nil {
+			config.UpdateFunc(wrapper)
+		}
+	}
+
+	agg, err := aggregator.NewAggregator(ctx, &aggregator.AggregatorConfig{KeyValueStore: config.KeyValueStore, Group: ng, UpdateFunc: updateFunc, BlameIndex: config.BlameIndex, Indexes: config.Indexes, Search: config.Search, OwnerIndex: config.OwnerIndex, EntryStore: config.EntryStore})
 	if err != nil {
 		return nil, fmt.Errorf("error creating aggregator: %w", err)
 	}
 	ng.DagGetter = agg
+	sessions.GraftDependents = agg.GraftDependents
+
+	messengerConfig := &messaging.Config{
+		Aggregator: agg,
+		Relay:      config.MessageRelay,
+	}
+	if config.DurableInbox {
+		messengerConfig.Inbox = config.KeyValueStore
+	}
+
 	return &Resolver{
 		Aggregator: agg,
+		Sessions:   sessions,
+		Messenger:  messaging.NewMessenger(messengerConfig),
+		StrictAuth: config.StrictAuth,
 	}, nil
 }
 
 type ResolveInput struct {
-	Input struct {
-		Did  string
-		Path string
+	Input ResolveInputObject
+}
+
+type ResolveInputObject struct {
+	Did     string
+	Path    string
+	Depth   *int32
+	Fields  *[]string
+	MaxHops *int32
+}
+
+// MaxResolveDepth limits the depth of links a resolve expands
+var MaxResolveDepth = 10
+
+// MaxResolveHops limits the references to other trees a resolve follows
+var MaxResolveHops = 5
+
+// options returns the aggregator.ResolveOptions of the input (nil when there are none)
+func (in *ResolveInputObject) options() (*aggregator.ResolveOptions, error) {
+	if in.Depth == nil && in.Fields == nil && in.MaxHops == nil {
+		return nil, nil
+	}
+	opts := &aggregator.ResolveOptions{}
+	if in.Depth != nil {
+		if *in.Depth < 0 || int(*in.Depth) > MaxResolveDepth {
+			return nil, &CodedError{Code: ErrCodeBadInput, Err: fmt.Errorf("depth must be between 0 and %d", MaxResolveDepth)}
+		}
+		opts.Depth = int(*in.Depth)
 	}
+	if in.Fields != nil {
+		opts.Fields = *in.Fields
+	}
+	if in.MaxHops != nil {
+		if *in.MaxHops < 0 || int(*in.MaxHops) > MaxResolveHops {
+			return nil, &CodedError{Code: ErrCodeBadInput, Err: fmt.Errorf("maxHops must be between 0 and %d", MaxResolveHops)}
+		}
+		opts.MaxHops = int(*in.MaxHops)
+	}
+	return opts, nil
 }
 
 type ResolvePayload struct {
-	Value         *JSON
-	RemainingPath []string
-	TouchedBlocks *[]Block
+	Value              *JSON
+	RemainingPath      []string
+	TouchedBlocks      *[]Block
+	TouchedBlocksByDid *[]TreeBlocks
+}
+
+type TreeBlocks struct {
+	Did    string
+	Tip    *CID
+	Blocks []Block
 }
 
 type IdentityTokenPayload struct {
@@ -71,6 +181,12 @@ type IdentityTokenPayload struct {
 	Id     string
 }
 
+type SessionPayload struct {
+	Result    bool
+	Token     string
+	ExpiresIn int32 // seconds
+}
+
 type AddBlockInput struct {
 	Input struct {
 		AddBlockRequest string //base64
@@ -78,14 +194,23 @@ type AddBlockInput struct {
 }
 
 type Block struct {
-	Data string      `json:"data"`
-	Cid  *graphql.ID `json:"cid"`
+	Data string `json:"data"`
+	Cid  *CID   `json:"cid"`
 }
 
 type AddBlockPayload struct {
-	Valid     bool
-	NewTip    string
-	NewBlocks *[]Block
+	Valid      bool
+	NewTip     *CID
+	NewBlocks  *[]Block
+	ErrorCode  *string
+	CurrentTip *CID
+	Violations *[]SchemaViolation
+}
+
+type SchemaViolation struct {
+	Path    string
+	Schema  string
+	Message string
 }
 
 func RequesterFromCtx(ctx context.Context) *identity.Identity {
@@ -99,35 +224,88 @@ func RequesterFromCtx(ctx context.Context) *identity.Identity {
 	return requester
 }
 
+// SessionIdentity returns the identity of the session in the headers (if there is a valid one)
+func (r *Resolver) SessionIdentity(headers map[string][]string) (*identity.Identity, error) {
+	session, err := identity.SessionFromHeader(headers)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding session: %w", err)
+	}
+	if session == nil {
+		return nil, nil
+	}
+	isVerified, err := r.Sessions.Verify(session)
+	if err != nil {
+		return nil, fmt.Errorf("error verifying session: %w", err)
+	}
+	if !isVerified {
+		return nil, nil
+	}
+	return &session.Identity, nil
+}
+
 func (r *Resolver) Resolve(ctx context.Context, input ResolveInput) (*ResolvePayload, error) {
 	requester := RequesterFromCtx(ctx)
 	logger.Infof("resolving %s %s with requester %v", input.Input.Did, input.Input.Path, requester)
 	path := strings.Split(strings.TrimPrefix(input.Input.Path, "/"), "/")
 
-	resp, err := r.Aggregator.ResolveWithReadControls(ctx, requester, input.Input.Did, path)
+	opts, err := input.Input.options()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Aggregator.ResolveWithOptions(ctx, requester, input.Input.Did, path, opts)
 
 	if err != nil {
 		logger.Errorf("error getting latest %s %v", input.Input.Did, err)
-		return nil, fmt.Errorf("error getting latest: %w", err)
+		return nil, NewCodedError(fmt.Errorf("error getting latest: %w", err))
 	}
 	blocks := blocksToGraphQLBlocks(resp.TouchedBlocks)
 
-	return &ResolvePayload{
+	payload := &ResolvePayload{
 		RemainingPath: resp.RemainingPath,
 		Value: &JSON{
 			Object: resp.Value,
 		},
 		TouchedBlocks: &blocks,
-	}, nil
+	}
+	if len(resp.Hops) > 0 {
+		byDid := hopsToTreeBlocks(resp.Hops)
+		payload.TouchedBlocksByDid = &byDid
+	}
+	return payload, nil
+}
+
+// hopsToTreeBlocks groups the touched blocks of the hops by their tree
+func hopsToTreeBlocks(hops []aggregator.ResolveHop) []TreeBlocks {
+	var trees []TreeBlocks
+	indexes := make(map[string]int)
+	seen := make(map[string]map[cid.Cid]struct{})
+	for _, hop := range hops {
+		i, ok := indexes[hop.ObjectID]
+		if !ok {
+			i = len(trees)
+			indexes[hop.ObjectID] = i
+			seen[hop.ObjectID] = make(map[cid.Cid]struct{})
+			trees = append(trees, TreeBlocks{Did: hop.ObjectID, Tip: NewCID(hop.Tip), Blocks: []Block{}})
+		}
+		var nodes []format.Node
+		for _, node := range hop.TouchedBlocks {
+			if _, ok := seen[hop.ObjectID][node.Cid()]; !ok {
+				seen[hop.ObjectID][node.Cid()] = struct{}{}
+				nodes = append(nodes, node)
+			}
+		}
+		trees[i].Blocks = append(trees[i].Blocks, blocksToGraphQLBlocks(nodes)...)
+	}
+	return trees
 }
 
 func blocksToGraphQLBlocks(nodes []format.Node) []Block {
 	retBlocks := make([]Block, len(nodes))
 	for i, node := range nodes {
-		id := graphql.ID(node.Cid().String())
 		retBlocks[i] = Block{
 			Data: base64.StdEncoding.EncodeToString(node.RawData()),
-			Cid:  &id,
+			Cid:  NewCID(node.Cid()),
 		}
 	}
 	return retBlocks
@@ -140,35 +318,82 @@ func (r *Resolver) IdentityToken(ctx context.Context) (*IdentityTokenPayload, er
 	return r.TokenHandler(ctx)
 }
 
+// Session exchanges a verified (signed) identity for a session that is cheaper to verify
+func (r *Resolver) Session(ctx context.Context) (*SessionPayload, error) {
+	if ctx.Value(SessionContextKey) != nil {
+		return nil, fmt.Errorf("sessions can only be created from a signed identity")
+	}
+	requester := RequesterFromCtx(ctx)
+	if requester == nil {
+		if authErr := AuthErrorFromCtx(ctx); authErr != nil {
+			return nil, authErr
+		}
+		return &SessionPayload{
+			Result: false,
+		}, nil
+	}
+	session, err := r.Sessions.Issue(requester)
+	if err != nil {
+		return nil, fmt.Errorf("error issuing session: %w", err)
+	}
+	return &SessionPayload{
+		Result:    true,
+		Token:     session.String(),
+		ExpiresIn: int32(r.Sessions.Duration().Seconds()),
+	}, nil
+}
+
 func (r *Resolver) AddBlock(ctx context.Context, input AddBlockInput) (*AddBlockPayload, error) {
 	abrBits, err := base64.StdEncoding.DecodeString(input.Input.AddBlockRequest)
 	if err != nil {
-		return nil, fmt.Errorf("error decoding string: %w", err)
+		return nil, &CodedError{Code: ErrCodeInvalidBlock, Err: fmt.Errorf("error decoding string: %w", err)}
 	}
 	abr := &services.AddBlockRequest{}
 	err = abr.Unmarshal(abrBits)
 	if err != nil {
-		return nil, fmt.Errorf("error unmarshaling %w", err)
+		return nil, &CodedError{Code: ErrCodeInvalidBlock, Err: fmt.Errorf("error unmarshaling %w", err)}
 	}
 
 	logger.Infof("addBlock %s", abr.ObjectId)
 
 	resp, err := r.Aggregator.Add(ctx, abr)
-	if err == aggregator.ErrInvalidBlock {
-		return &AddBlockPayload{
-			Valid:  false,
-			NewTip: cid.Undef.String(),
-		}, nil
+	if errors.Is(err, aggregator.ErrInvalidBlock) {
+		logger.Debugf("rejected %s: %v", abr.ObjectId, err)
+		code := ErrorCode(err)
+		payload := &AddBlockPayload{
+			Valid:     false,
+			ErrorCode: &code,
+		}
+		var addErr *aggregator.AddError
+		if errors.As(err, &addErr) {
+			payload.CurrentTip = NewCID(addErr.CurrentTip)
+		}
+		var schemaErr *policy.SchemaViolationError
+		if errors.As(err, &schemaErr) {
+			violations := make([]SchemaViolation, len(schemaErr.Violations))
+			for i, violation := range schemaErr.Violations {
+				violations[i] = SchemaViolation(violation)
+			}
+			payload.Violations = &violations
+		}
+		return payload, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("error validating block: %w", err)
+		return nil, NewCodedError(fmt.Errorf("error validating block: %w", err))
+	}
+	if !resp.IsValid {
+		code := ErrCodePolicyDenied
+		return &AddBlockPayload{
+			Valid:     false,
+			ErrorCode: &code,
+		}, nil
 	}
 
 	newBlocks := blocksToGraphQLBlocks(resp.NewNodes)
 
 	return &AddBlockPayload{
 		Valid:     true,
-		NewTip:    resp.NewTip.String(),
+		NewTip:    NewCID(resp.NewTip),
 		NewBlocks: &newBlocks,
 	}, nil
 }
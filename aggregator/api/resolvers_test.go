@@ -2,14 +2,22 @@ package api
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"encoding/base64"
 	"encoding/json"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
 	"github.com/graph-gophers/graphql-go/gqltesting"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
 	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/abrbuilder"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
 	"github.com/quorumcontrol/tupelo/sdk/gossip/testhelpers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -131,3 +139,407 @@ func TestSanity(t *testing.T) {
 		},
 	})
 }
+
+func TestResolveDepth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := NewResolver(ctx, &Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema, err := graphql.ParseSchema(Schema, r, opts...)
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	abr := testhelpers.NewValidTransactionWithPathAndValue(t, treeKey, "/my/path", "hi")
+	_, err = r.Aggregator.Add(ctx, &abr)
+	require.Nil(t, err)
+
+	query := `query resolve($did: String!, $path: String!, $depth: Int, $fields: [String!]) {
+		resolve(input: {did: $did, path: $path, depth: $depth, fields: $fields}) {
+			value
+		}
+	}`
+
+	gqltesting.RunTests(t, []*gqltesting.Test{
+		{
+			Schema: schema,
+			Query:  query,
+			Variables: map[string]interface{}{
+				"did":    string(abr.ObjectId),
+				"path":   "tree",
+				"depth":  3,
+				"fields": []interface{}{"data/my/path"},
+			},
+			ExpectedResult: `
+				{
+					"resolve":{"value":{"data":{"my":{"path":"hi"}}}}
+				}
+			`,
+		},
+	})
+
+	schemaResp := schema.Exec(ctx, query, "resolve", map[string]interface{}{
+		"did":   string(abr.ObjectId),
+		"path":  "tree",
+		"depth": MaxResolveDepth + 1,
+	})
+	require.Len(t, schemaResp.Errors, 1)
+	assert.Equal(t, ErrCodeBadInput, schemaResp.Errors[0].Extensions["code"])
+}
+
+func TestResolveMaxHops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := NewResolver(ctx, &Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema, err := graphql.ParseSchema(Schema, r, opts...)
+	require.Nil(t, err)
+
+	targetKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	target := testhelpers.NewValidTransactionWithPathAndValue(t, targetKey, "/my/path", "hi")
+	_, err = r.Aggregator.Add(ctx, &target)
+	require.Nil(t, err)
+
+	originKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	origin := testhelpers.NewValidTransactionWithPathAndValue(t, originKey, "/ref", string(target.ObjectId)+"/tree/data")
+	_, err = r.Aggregator.Add(ctx, &origin)
+	require.Nil(t, err)
+
+	query := `query resolve($did: String!, $path: String!, $maxHops: Int) {
+		resolve(input: {did: $did, path: $path, maxHops: $maxHops}) {
+			value
+			remainingPath
+			touchedBlocksByDid {
+				did
+				blocks {
+					cid
+				}
+			}
+		}
+	}`
+
+	schemaResp := schema.Exec(ctx, query, "resolve", map[string]interface{}{
+		"did":     string(origin.ObjectId),
+		"path":    "tree/data/ref/my/path",
+		"maxHops": 1,
+	})
+	require.Len(t, schemaResp.Errors, 0)
+
+	var result struct {
+		Resolve struct {
+			Value              interface{}
+			RemainingPath      []string
+			TouchedBlocksByDid []struct {
+				Did    string
+				Blocks []struct {
+					Cid string
+				}
+			}
+		}
+	}
+	require.Nil(t, json.Unmarshal(schemaResp.Data, &result))
+	assert.Equal(t, "hi", result.Resolve.Value)
+	assert.Len(t, result.Resolve.RemainingPath, 0)
+	require.Len(t, result.Resolve.TouchedBlocksByDid, 2)
+	assert.Equal(t, string(origin.ObjectId), result.Resolve.TouchedBlocksByDid[0].Did)
+	assert.Equal(t, string(target.ObjectId), result.Resolve.TouchedBlocksByDid[1].Did)
+	assert.NotEmpty(t, result.Resolve.TouchedBlocksByDid[1].Blocks)
+
+	schemaResp = schema.Exec(ctx, query, "resolve", map[string]interface{}{
+		"did":     string(origin.ObjectId),
+		"path":    "tree/data/ref/my/path",
+		"maxHops": MaxResolveHops + 1,
+	})
+	require.Len(t, schemaResp.Errors, 1)
+	assert.Equal(t, ErrCodeBadInput, schemaResp.Errors[0].Extensions["code"])
+}
+
+func TestTree(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := NewResolver(ctx, &Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema, err := graphql.ParseSchema(Schema, r, opts...)
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	abr := testhelpers.NewValidTransactionWithPathAndValue(t, treeKey, "/my/path", "hi")
+	resp, err := r.Aggregator.Add(ctx, &abr)
+	require.Nil(t, err)
+
+	query := `query tree($did: String!) {
+		tree(did: $did) {
+			did
+			tip
+			height
+			owners
+		}
+	}`
+
+	gqltesting.RunTests(t, []*gqltesting.Test{
+		{
+			Schema:    schema,
+			Query:     query,
+			Variables: map[string]interface{}{"did": string(abr.ObjectId)},
+			ExpectedResult: `
+				{
+					"tree":{
+						"did":"` + string(abr.ObjectId) + `",
+						"tip":"` + resp.NewTip.String() + `",
+						"height":0,
+						"owners":["` + crypto.PubkeyToAddress(treeKey.PublicKey).String() + `"]
+					}
+				}
+			`,
+		},
+		{
+			Schema:    schema,
+			Query:     query,
+			Variables: map[string]interface{}{"did": "did:tupelo:unknown"},
+			ExpectedResult: `
+				{
+					"tree":{"did":"did:tupelo:unknown","tip":null,"height":null,"owners":null}
+				}
+			`,
+		},
+	})
+}
+
+func TestAddBlockErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := NewResolver(ctx, &Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema, err := graphql.ParseSchema(Schema, r, opts...)
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	signedTree, err := consensus.NewSignedChainTree(ctx, treeKey.PublicKey, nodestore.MustMemoryStore(ctx))
+	require.Nil(t, err)
+	tree := signedTree.ChainTree
+
+	type payload struct {
+		Valid      bool    `json:"valid"`
+		NewTip     *CID    `json:"newTip"`
+		ErrorCode  *string `json:"errorCode"`
+		CurrentTip *CID    `json:"currentTip"`
+	}
+
+	addBlock := func(t *testing.T, abrString string) (*payload, []*gqlerrors.QueryError) {
+		schemaResp := schema.Exec(ctx,
+			`mutation addBlock($addBlockRequest: String!) {
+				addBlock(input: {addBlockRequest: $addBlockRequest}) {
+					valid
+					newTip
+					errorCode
+					currentTip
+				}
+			}`,
+			"addBlock",
+			map[string]interface{}{
+				"addBlockRequest": abrString,
+			},
+		)
+		resp := &struct {
+			AddBlock *payload `json:"addBlock"`
+		}{}
+		require.Nil(t, json.Unmarshal(schemaResp.Data, resp))
+		return resp.AddBlock, schemaResp.Errors
+	}
+
+	encode := func(t *testing.T, key *ecdsa.PrivateKey, path string, value interface{}) string {
+		txn, err := chaintree.NewSetDataTransaction(path, value)
+		require.Nil(t, err)
+		abr, err := abrbuilder.NewAddBlockRequest(ctx, tree, key, []*transactions.Transaction{txn})
+		require.Nil(t, err)
+		bits, err := abr.Marshal()
+		require.Nil(t, err)
+		return base64.StdEncoding.EncodeToString(bits)
+	}
+
+	policies := map[string]string{
+		"main": `
+			package main
+			default allow = true
+
+			allow = false {
+				contains(input.transactions[_].setDataPayload.path, "forbidden")
+			}
+		`,
+	}
+	genesis := encode(t, treeKey, ".well-known/policies", policies)
+	resp, errs := addBlock(t, genesis)
+	require.Len(t, errs, 0)
+	require.True(t, resp.Valid)
+	require.NotNil(t, resp.NewTip)
+	assert.Nil(t, resp.ErrorCode)
+	currentTip := resp.NewTip.Cid
+
+	t.Run("tip conflict", func(t *testing.T) {
+		resp, errs := addBlock(t, genesis)
+		require.Len(t, errs, 0)
+		assert.False(t, resp.Valid)
+		assert.Nil(t, resp.NewTip)
+		require.NotNil(t, resp.ErrorCode)
+		assert.Equal(t, ErrCodeTipConflict, *resp.ErrorCode)
+		require.NotNil(t, resp.CurrentTip)
+		assert.True(t, resp.CurrentTip.Equals(currentTip))
+	})
+
+	tree.Dag = tree.Dag.WithNewTip(currentTip)
+
+	t.Run("invalid signature", func(t *testing.T) {
+		otherKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		resp, errs := addBlock(t, encode(t, otherKey, "some/path", "hi"))
+		require.Len(t, errs, 0)
+		assert.False(t, resp.Valid)
+		require.NotNil(t, resp.ErrorCode)
+		assert.Equal(t, ErrCodeInvalidSignature, *resp.ErrorCode)
+		assert.Nil(t, resp.CurrentTip)
+	})
+
+	t.Run("policy denied", func(t *testing.T) {
+		resp, errs := addBlock(t, encode(t, treeKey, "forbidden/path", "hi"))
+		require.Len(t, errs, 0)
+		assert.False(t, resp.Valid)
+		require.NotNil(t, resp.ErrorCode)
+		assert.Equal(t, ErrCodePolicyDenied, *resp.ErrorCode)
+	})
+
+	t.Run("malformed request", func(t *testing.T) {
+		_, errs := addBlock(t, "not base64!")
+		require.Len(t, errs, 1)
+		assert.Equal(t, ErrCodeInvalidBlock, errs[0].Extensions["code"])
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		resp, errs := addBlock(t, encode(t, treeKey, "some/path", "hi"))
+		require.Len(t, errs, 0)
+		assert.True(t, resp.Valid)
+		assert.Nil(t, resp.ErrorCode)
+	})
+}
+
+func TestAddBlockSchemaViolation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := NewResolver(ctx, &Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema, err := graphql.ParseSchema(Schema, r, opts...)
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	signedTree, err := consensus.NewSignedChainTree(ctx, treeKey.PublicKey, nodestore.MustMemoryStore(ctx))
+	require.Nil(t, err)
+	tree := signedTree.ChainTree
+
+	addBlock := func(t *testing.T, path string, value interface{}) *gqlerrors.QueryError {
+		txn, err := chaintree.NewSetDataTransaction(path, value)
+		require.Nil(t, err)
+		abr, err := abrbuilder.NewAddBlockRequest(ctx, tree, treeKey, []*transactions.Transaction{txn})
+		require.Nil(t, err)
+		bits, err := abr.Marshal()
+		require.Nil(t, err)
+
+		schemaResp := schema.Exec(ctx,
+			`mutation addBlock($addBlockRequest: String!) {
+				addBlock(input: {addBlockRequest: $addBlockRequest}) {
+					valid
+					newTip
+					errorCode
+					violations {
+						path
+						schema
+						message
+					}
+				}
+			}`,
+			"addBlock",
+			map[string]interface{}{
+				"addBlockRequest": base64.StdEncoding.EncodeToString(bits),
+			},
+		)
+		require.Len(t, schemaResp.Errors, 0)
+		resp := &struct {
+			AddBlock struct {
+				Valid      bool    `json:"valid"`
+				NewTip     *CID    `json:"newTip"`
+				ErrorCode  *string `json:"errorCode"`
+				Violations []struct {
+					Path    string `json:"path"`
+					Schema  string `json:"schema"`
+					Message string `json:"message"`
+				} `json:"violations"`
+			} `json:"addBlock"`
+		}{}
+		require.Nil(t, json.Unmarshal(schemaResp.Data, resp))
+
+		if !resp.AddBlock.Valid {
+			require.NotNil(t, resp.AddBlock.ErrorCode)
+			assert.Equal(t, ErrCodeSchemaViolation, *resp.AddBlock.ErrorCode)
+			require.Len(t, resp.AddBlock.Violations, 1)
+			assert.Equal(t, "tree/data/title", resp.AddBlock.Violations[0].Path)
+			assert.Equal(t, "title", resp.AddBlock.Violations[0].Schema)
+			return nil
+		}
+		require.NotNil(t, resp.AddBlock.NewTip)
+		tree.Dag = tree.Dag.WithNewTip(resp.AddBlock.NewTip.Cid)
+		return nil
+	}
+
+	addBlock(t, ".well-known/schemas", map[string]string{"title": `{"type": "string"}`})
+	addBlock(t, "title", 1)
+
+	latest, err := r.Aggregator.GetLatest(ctx, signedTree.MustId())
+	require.Nil(t, err)
+	assert.Equal(t, tree.Dag.Tip, latest.Dag.Tip)
+}
+
+func TestSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := NewResolver(ctx, &Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+
+	did := "did:tupelo:test"
+
+	resp, err := r.Session(ctx)
+	require.Nil(t, err)
+	assert.False(t, resp.Result)
+
+	identCtx := context.WithValue(ctx, IdentityContextKey, identity.Identity{Iss: did, Sub: did})
+	resp, err = r.Session(identCtx)
+	require.Nil(t, err)
+	require.True(t, resp.Result)
+
+	sessionIdentity, err := r.SessionIdentity(map[string][]string{identity.SessionHeaderField: {resp.Token}})
+	require.Nil(t, err)
+	require.NotNil(t, sessionIdentity)
+	assert.Equal(t, did, sessionIdentity.Sub)
+
+	// a session cannot be used to create another session
+	_, err = r.Session(context.WithValue(identCtx, SessionContextKey, true))
+	require.NotNil(t, err)
+}
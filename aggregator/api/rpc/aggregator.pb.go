@@ -0,0 +1,803 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: aggregator.proto
+
+package rpc
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	services "github.com/quorumcontrol/messages/v2/build/go/services"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type AddBlockResponse struct {
+	Valid     bool     `protobuf:"varint,1,opt,name=valid,proto3" json:"valid,omitempty"`
+	NewTip    []byte   `protobuf:"bytes,2,opt,name=new_tip,json=newTip,proto3" json:"new_tip,omitempty"`
+	NewBlocks [][]byte `protobuf:"bytes,3,rep,name=new_blocks,json=newBlocks,proto3" json:"new_blocks,omitempty"`
+	// the error code (the same as the errorCode of the GraphQL addBlock) and message of an invalid block
+	ErrorCode    string `protobuf:"bytes,4,opt,name=error_code,json=errorCode,proto3" json:"error_code,omitempty"`
+	ErrorMessage string `protobuf:"bytes,5,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+	// the tip the block conflicted with (for a TIP_CONFLICT)
+	CurrentTip           []byte   `protobuf:"bytes,6,opt,name=current_tip,json=currentTip,proto3" json:"current_tip,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AddBlockResponse) Reset()         { *m = AddBlockResponse{} }
+func (m *AddBlockResponse) String() string { return proto.CompactTextString(m) }
+func (*AddBlockResponse) ProtoMessage()    {}
+func (*AddBlockResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_60785b04c84bec7e, []int{0}
+}
+
+func (m *AddBlockResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AddBlockResponse.Unmarshal(m, b)
+}
+func (m *AddBlockResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AddBlockResponse.Marshal(b, m, deterministic)
+}
+func (m *AddBlockResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AddBlockResponse.Merge(m, src)
+}
+func (m *AddBlockResponse) XXX_Size() int {
+	return xxx_messageInfo_AddBlockResponse.Size(m)
+}
+func (m *AddBlockResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_AddBlockResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AddBlockResponse proto.InternalMessageInfo
+
+func (m *AddBlockResponse) GetValid() bool {
+	if m != nil {
+		return m.Valid
+	}
+	return false
+}
+
+func (m *AddBlockResponse) GetNewTip() []byte {
+	if m != nil {
+		return m.NewTip
+	}
+	return nil
+}
+
+func (m *AddBlockResponse) GetNewBlocks() [][]byte {
+	if m != nil {
+		return m.NewBlocks
+	}
+	return nil
+}
+
+func (m *AddBlockResponse) GetErrorCode() string {
+	if m != nil {
+		return m.ErrorCode
+	}
+	return ""
+}
+
+func (m *AddBlockResponse) GetErrorMessage() string {
+	if m != nil {
+		return m.ErrorMessage
+	}
+	return ""
+}
+
+func (m *AddBlockResponse) GetCurrentTip() []byte {
+	if m != nil {
+		return m.CurrentTip
+	}
+	return nil
+}
+
+type ResolveRequest struct {
+	Did                  string   `protobuf:"bytes,1,opt,name=did,proto3" json:"did,omitempty"`
+	Path                 string   `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ResolveRequest) Reset()         { *m = ResolveRequest{} }
+func (m *ResolveRequest) String() string { return proto.CompactTextString(m) }
+func (*ResolveRequest) ProtoMessage()    {}
+func (*ResolveRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_60785b04c84bec7e, []int{1}
+}
+
+func (m *ResolveRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResolveRequest.Unmarshal(m, b)
+}
+func (m *ResolveRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResolveRequest.Marshal(b, m, deterministic)
+}
+func (m *ResolveRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResolveRequest.Merge(m, src)
+}
+func (m *ResolveRequest) XXX_Size() int {
+	return xxx_messageInfo_ResolveRequest.Size(m)
+}
+func (m *ResolveRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResolveRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResolveRequest proto.InternalMessageInfo
+
+func (m *ResolveRequest) GetDid() string {
+	if m != nil {
+		return m.Did
+	}
+	return ""
+}
+
+func (m *ResolveRequest) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+type ResolveResponse struct {
+	RemainingPath        []string `protobuf:"bytes,1,rep,name=remaining_path,json=remainingPath,proto3" json:"remaining_path,omitempty"`
+	Value                []byte   `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	TouchedBlocks        [][]byte `protobuf:"bytes,3,rep,name=touched_blocks,json=touchedBlocks,proto3" json:"touched_blocks,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ResolveResponse) Reset()         { *m = ResolveResponse{} }
+func (m *ResolveResponse) String() string { return proto.CompactTextString(m) }
+func (*ResolveResponse) ProtoMessage()    {}
+func (*ResolveResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_60785b04c84bec7e, []int{2}
+}
+
+func (m *ResolveResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResolveResponse.Unmarshal(m, b)
+}
+func (m *ResolveResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResolveResponse.Marshal(b, m, deterministic)
+}
+func (m *ResolveResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResolveResponse.Merge(m, src)
+}
+func (m *ResolveResponse) XXX_Size() int {
+	return xxx_messageInfo_ResolveResponse.Size(m)
+}
+func (m *ResolveResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResolveResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResolveResponse proto.InternalMessageInfo
+
+func (m *ResolveResponse) GetRemainingPath() []string {
+	if m != nil {
+		return m.RemainingPath
+	}
+	return nil
+}
+
+func (m *ResolveResponse) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *ResolveResponse) GetTouchedBlocks() [][]byte {
+	if m != nil {
+		return m.TouchedBlocks
+	}
+	return nil
+}
+
+type GetTipRequest struct {
+	Did                  string   `protobuf:"bytes,1,opt,name=did,proto3" json:"did,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetTipRequest) Reset()         { *m = GetTipRequest{} }
+func (m *GetTipRequest) String() string { return proto.CompactTextString(m) }
+func (*GetTipRequest) ProtoMessage()    {}
+func (*GetTipRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_60785b04c84bec7e, []int{3}
+}
+
+func (m *GetTipRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetTipRequest.Unmarshal(m, b)
+}
+func (m *GetTipRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetTipRequest.Marshal(b, m, deterministic)
+}
+func (m *GetTipRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetTipRequest.Merge(m, src)
+}
+func (m *GetTipRequest) XXX_Size() int {
+	return xxx_messageInfo_GetTipRequest.Size(m)
+}
+func (m *GetTipRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetTipRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetTipRequest proto.InternalMessageInfo
+
+func (m *GetTipRequest) GetDid() string {
+	if m != nil {
+		return m.Did
+	}
+	return ""
+}
+
+type GetTipResponse struct {
+	Tip                  []byte   `protobuf:"bytes,1,opt,name=tip,proto3" json:"tip,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetTipResponse) Reset()         { *m = GetTipResponse{} }
+func (m *GetTipResponse) String() string { return proto.CompactTextString(m) }
+func (*GetTipResponse) ProtoMessage()    {}
+func (*GetTipResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_60785b04c84bec7e, []int{4}
+}
+
+func (m *GetTipResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetTipResponse.Unmarshal(m, b)
+}
+func (m *GetTipResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetTipResponse.Marshal(b, m, deterministic)
+}
+func (m *GetTipResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetTipResponse.Merge(m, src)
+}
+func (m *GetTipResponse) XXX_Size() int {
+	return xxx_messageInfo_GetTipResponse.Size(m)
+}
+func (m *GetTipResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetTipResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetTipResponse proto.InternalMessageInfo
+
+func (m *GetTipResponse) GetTip() []byte {
+	if m != nil {
+		return m.Tip
+	}
+	return nil
+}
+
+type BlocksRequest struct {
+	Did                  string   `protobuf:"bytes,1,opt,name=did,proto3" json:"did,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BlocksRequest) Reset()         { *m = BlocksRequest{} }
+func (m *BlocksRequest) String() string { return proto.CompactTextString(m) }
+func (*BlocksRequest) ProtoMessage()    {}
+func (*BlocksRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_60785b04c84bec7e, []int{5}
+}
+
+func (m *BlocksRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BlocksRequest.Unmarshal(m, b)
+}
+func (m *BlocksRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BlocksRequest.Marshal(b, m, deterministic)
+}
+func (m *BlocksRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BlocksRequest.Merge(m, src)
+}
+func (m *BlocksRequest) XXX_Size() int {
+	return xxx_messageInfo_BlocksRequest.Size(m)
+}
+func (m *BlocksRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_BlocksRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BlocksRequest proto.InternalMessageInfo
+
+func (m *BlocksRequest) GetDid() string {
+	if m != nil {
+		return m.Did
+	}
+	return ""
+}
+
+type Block struct {
+	Cid                  []byte   `protobuf:"bytes,1,opt,name=cid,proto3" json:"cid,omitempty"`
+	Data                 []byte   `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Block) Reset()         { *m = Block{} }
+func (m *Block) String() string { return proto.CompactTextString(m) }
+func (*Block) ProtoMessage()    {}
+func (*Block) Descriptor() ([]byte, []int) {
+	return fileDescriptor_60785b04c84bec7e, []int{6}
+}
+
+func (m *Block) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Block.Unmarshal(m, b)
+}
+func (m *Block) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Block.Marshal(b, m, deterministic)
+}
+func (m *Block) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Block.Merge(m, src)
+}
+func (m *Block) XXX_Size() int {
+	return xxx_messageInfo_Block.Size(m)
+}
+func (m *Block) XXX_DiscardUnknown() {
+	xxx_messageInfo_Block.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Block proto.InternalMessageInfo
+
+func (m *Block) GetCid() []byte {
+	if m != nil {
+		return m.Cid
+	}
+	return nil
+}
+
+func (m *Block) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+type SubscribeRequest struct {
+	Did                  string   `protobuf:"bytes,1,opt,name=did,proto3" json:"did,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubscribeRequest) Reset()         { *m = SubscribeRequest{} }
+func (m *SubscribeRequest) String() string { return proto.CompactTextString(m) }
+func (*SubscribeRequest) ProtoMessage()    {}
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_60785b04c84bec7e, []int{7}
+}
+
+func (m *SubscribeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscribeRequest.Unmarshal(m, b)
+}
+func (m *SubscribeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscribeRequest.Marshal(b, m, deterministic)
+}
+func (m *SubscribeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscribeRequest.Merge(m, src)
+}
+func (m *SubscribeRequest) XXX_Size() int {
+	return xxx_messageInfo_SubscribeRequest.Size(m)
+}
+func (m *SubscribeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscribeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscribeRequest proto.InternalMessageInfo
+
+func (m *SubscribeRequest) GetDid() string {
+	if m != nil {
+		return m.Did
+	}
+	return ""
+}
+
+type Update struct {
+	Did                  string   `protobuf:"bytes,1,opt,name=did,proto3" json:"did,omitempty"`
+	NewTip               []byte   `protobuf:"bytes,2,opt,name=new_tip,json=newTip,proto3" json:"new_tip,omitempty"`
+	Height               uint64   `protobuf:"varint,3,opt,name=height,proto3" json:"height,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Update) Reset()         { *m = Update{} }
+func (m *Update) String() string { return proto.CompactTextString(m) }
+func (*Update) ProtoMessage()    {}
+func (*Update) Descriptor() ([]byte, []int) {
+	return fileDescriptor_60785b04c84bec7e, []int{8}
+}
+
+func (m *Update) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Update.Unmarshal(m, b)
+}
+func (m *Update) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Update.Marshal(b, m, deterministic)
+}
+func (m *Update) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Update.Merge(m, src)
+}
+func (m *Update) XXX_Size() int {
+	return xxx_messageInfo_Update.Size(m)
+}
+func (m *Update) XXX_DiscardUnknown() {
+	xxx_messageInfo_Update.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Update proto.InternalMessageInfo
+
+func (m *Update) GetDid() string {
+	if m != nil {
+		return m.Did
+	}
+	return ""
+}
+
+func (m *Update) GetNewTip() []byte {
+	if m != nil {
+		return m.NewTip
+	}
+	return nil
+}
+
+func (m *Update) GetHeight() uint64 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*AddBlockResponse)(nil), "tupelolite.AddBlockResponse")
+	proto.RegisterType((*ResolveRequest)(nil), "tupelolite.ResolveRequest")
+	proto.RegisterType((*ResolveResponse)(nil), "tupelolite.ResolveResponse")
+	proto.RegisterType((*GetTipRequest)(nil), "tupelolite.GetTipRequest")
+	proto.RegisterType((*GetTipResponse)(nil), "tupelolite.GetTipResponse")
+	proto.RegisterType((*BlocksRequest)(nil), "tupelolite.BlocksRequest")
+	proto.RegisterType((*Block)(nil), "tupelolite.Block")
+	proto.RegisterType((*SubscribeRequest)(nil), "tupelolite.SubscribeRequest")
+	proto.RegisterType((*Update)(nil), "tupelolite.Update")
+}
+
+func init() { proto.RegisterFile("aggregator.proto", fileDescriptor_60785b04c84bec7e) }
+
+var fileDescriptor_60785b04c84bec7e = []byte{
+	// 545 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x54, 0xdd, 0x6e, 0xd3, 0x4c,
+	0x10, 0x95, 0xeb, 0xd6, 0xad, 0xe7, 0x4b, 0xfa, 0x85, 0x15, 0xa2, 0xc6, 0x05, 0x61, 0x0c, 0x48,
+	0xbe, 0x69, 0x5c, 0x15, 0x09, 0x21, 0x55, 0xa8, 0x6a, 0x10, 0xe2, 0x02, 0x21, 0xa1, 0xa5, 0xdc,
+	0x70, 0x13, 0x39, 0xeb, 0x91, 0xbd, 0xc2, 0xf1, 0xba, 0xeb, 0x75, 0xf2, 0x84, 0x3c, 0x01, 0x2f,
+	0x84, 0xbc, 0xde, 0xfc, 0x98, 0x34, 0x77, 0xb3, 0x73, 0x66, 0xcf, 0xce, 0xcc, 0x39, 0x36, 0x8c,
+	0x92, 0x2c, 0x93, 0x98, 0x25, 0x4a, 0xc8, 0x71, 0x25, 0x85, 0x12, 0x04, 0x54, 0x53, 0x61, 0x21,
+	0x0a, 0xae, 0xd0, 0x3f, 0xab, 0x51, 0x2e, 0x38, 0xc3, 0x3a, 0x5e, 0x05, 0x5d, 0x51, 0xf8, 0xdb,
+	0x82, 0xd1, 0x6d, 0x9a, 0x4e, 0x0a, 0xc1, 0x7e, 0x51, 0xac, 0x2b, 0x51, 0xd6, 0x48, 0x1e, 0xc3,
+	0xd1, 0x22, 0x29, 0x78, 0xea, 0x59, 0x81, 0x15, 0x9d, 0xd0, 0xee, 0x40, 0xce, 0xe0, 0xb8, 0xc4,
+	0xe5, 0x54, 0xf1, 0xca, 0x3b, 0x08, 0xac, 0x68, 0x40, 0x9d, 0x12, 0x97, 0x77, 0xbc, 0x22, 0xcf,
+	0x01, 0x5a, 0x60, 0xd6, 0x72, 0xd4, 0x9e, 0x1d, 0xd8, 0xd1, 0x80, 0xba, 0x25, 0x2e, 0x35, 0x69,
+	0xdd, 0xc2, 0x28, 0xa5, 0x90, 0x53, 0x26, 0x52, 0xf4, 0x0e, 0x03, 0x2b, 0x72, 0xa9, 0xab, 0x33,
+	0x1f, 0x45, 0x8a, 0xe4, 0x15, 0x0c, 0x3b, 0x78, 0x8e, 0x75, 0x9d, 0x64, 0xe8, 0x1d, 0xe9, 0x8a,
+	0x81, 0x4e, 0x7e, 0xed, 0x72, 0xe4, 0x05, 0xfc, 0xc7, 0x1a, 0x29, 0xb1, 0x54, 0xfa, 0x7d, 0x47,
+	0xbf, 0x0f, 0x26, 0x75, 0xc7, 0xab, 0xf0, 0x1d, 0x9c, 0x52, 0xac, 0x45, 0xb1, 0x40, 0x8a, 0xf7,
+	0x0d, 0xd6, 0x8a, 0x8c, 0xc0, 0x4e, 0xcd, 0x08, 0x2e, 0x6d, 0x43, 0x42, 0xe0, 0xb0, 0x4a, 0x54,
+	0xae, 0xbb, 0x77, 0xa9, 0x8e, 0xc3, 0x06, 0xfe, 0x5f, 0xdf, 0x33, 0xd3, 0xbf, 0x81, 0x53, 0x89,
+	0xf3, 0x84, 0x97, 0xbc, 0xcc, 0xa6, 0xfa, 0x82, 0x15, 0xd8, 0x91, 0x4b, 0x87, 0xeb, 0xec, 0xb7,
+	0x44, 0xe5, 0x66, 0x49, 0x0d, 0x9a, 0x65, 0x74, 0x87, 0xf6, 0xb2, 0x12, 0x0d, 0xcb, 0x31, 0xed,
+	0xef, 0x63, 0x68, 0xb2, 0xdd, 0x4e, 0xc2, 0x97, 0x30, 0xfc, 0x8c, 0x6d, 0xe3, 0x7b, 0xbb, 0x0d,
+	0x43, 0x38, 0x5d, 0x95, 0x98, 0xc6, 0x46, 0x60, 0xb7, 0xc3, 0x5b, 0xfa, 0xbd, 0x36, 0x6c, 0x69,
+	0x3a, 0xc2, 0xfd, 0x34, 0x17, 0x70, 0xa4, 0x4b, 0x5a, 0x88, 0x19, 0x68, 0x40, 0x6d, 0xd6, 0xed,
+	0x23, 0x4d, 0x54, 0x62, 0x06, 0xd0, 0x71, 0xf8, 0x1a, 0x46, 0xdf, 0x9b, 0x59, 0xcd, 0x24, 0x9f,
+	0xed, 0xdf, 0x64, 0xf8, 0x05, 0x9c, 0x1f, 0x55, 0x9a, 0x28, 0xdc, 0xc5, 0xf6, 0xdb, 0xe4, 0x09,
+	0x38, 0x39, 0xf2, 0x2c, 0x57, 0x9e, 0x1d, 0x58, 0xd1, 0x21, 0x35, 0xa7, 0xab, 0x3f, 0x07, 0x00,
+	0xb7, 0x6b, 0xf3, 0x92, 0x4f, 0x70, 0xb2, 0x32, 0x24, 0x39, 0x1f, 0x2f, 0xae, 0xd6, 0x86, 0xdd,
+	0xd8, 0x54, 0xb7, 0xe5, 0x3f, 0x1b, 0x6f, 0x0c, 0x3e, 0xde, 0xf1, 0xf0, 0x04, 0x8e, 0x8d, 0xb0,
+	0xc4, 0xdf, 0x2e, 0xec, 0xbb, 0xc4, 0x3f, 0x7f, 0x10, 0x33, 0x1c, 0x37, 0xe0, 0x74, 0x12, 0x90,
+	0xa7, 0xdb, 0x65, 0x3d, 0xe5, 0x7c, 0xff, 0x21, 0xc8, 0x10, 0xbc, 0x07, 0xc7, 0x7c, 0x04, 0x3d,
+	0x82, 0x9e, 0x66, 0xfe, 0xa3, 0x1d, 0xe8, 0xd2, 0x22, 0x37, 0xe0, 0xae, 0x75, 0x20, 0xbd, 0x49,
+	0xff, 0x95, 0xc7, 0x27, 0xdb, 0x68, 0x27, 0xcb, 0xa5, 0x35, 0xf9, 0xf0, 0xf3, 0x3a, 0xe3, 0x2a,
+	0x6f, 0x66, 0x63, 0x26, 0xe6, 0xf1, 0x7d, 0x23, 0x64, 0x33, 0x67, 0xa2, 0x54, 0x52, 0x14, 0x71,
+	0x57, 0x7f, 0xd1, 0x5e, 0x88, 0x37, 0xbf, 0x8d, 0x38, 0xa9, 0x78, 0x2c, 0x2b, 0x76, 0x2d, 0x2b,
+	0x36, 0x73, 0xf4, 0xef, 0xe1, 0xed, 0xdf, 0x01, 0x00, 0x06, 0x2e, 0xe2, 0x9d, 0x57, 0x04, 0x00,
+	0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// AggregatorClient is the client API for Aggregator service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type AggregatorClient interface {
+	AddBlock(ctx context.Context, in *services.AddBlockRequest, opts ...grpc.CallOption) (*AddBlockResponse, error)
+	Resolve(ctx context.Context, in *ResolveRequest, opts ...grpc.CallOption) (*ResolveResponse, error)
+	GetTip(ctx context.Context, in *GetTipRequest, opts ...grpc.CallOption) (*GetTipResponse, error)
+	// Blocks streams the blocks of the latest version of a tree that its read policy allows
+	Blocks(ctx context.Context, in *BlocksRequest, opts ...grpc.CallOption) (Aggregator_BlocksClient, error)
+	// Subscribe streams the updates of a tree
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Aggregator_SubscribeClient, error)
+}
+
+type aggregatorClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewAggregatorClient(cc *grpc.ClientConn) AggregatorClient {
+	return &aggregatorClient{cc}
+}
+
+func (c *aggregatorClient) AddBlock(ctx context.Context, in *services.AddBlockRequest, opts ...grpc.CallOption) (*AddBlockResponse, error) {
+	out := new(AddBlockResponse)
+	err := c.cc.Invoke(ctx, "/tupelolite.Aggregator/AddBlock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aggregatorClient) Resolve(ctx context.Context, in *ResolveRequest, opts ...grpc.CallOption) (*ResolveResponse, error) {
+	out := new(ResolveResponse)
+	err := c.cc.Invoke(ctx, "/tupelolite.Aggregator/Resolve", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aggregatorClient) GetTip(ctx context.Context, in *GetTipRequest, opts ...grpc.CallOption) (*GetTipResponse, error) {
+	out := new(GetTipResponse)
+	err := c.cc.Invoke(ctx, "/tupelolite.Aggregator/GetTip", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aggregatorClient) Blocks(ctx context.Context, in *BlocksRequest, opts ...grpc.CallOption) (Aggregator_BlocksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Aggregator_serviceDesc.Streams[0], "/tupelolite.Aggregator/Blocks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &aggregatorBlocksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Aggregator_BlocksClient interface {
+	Recv() (*Block, error)
+	grpc.ClientStream
+}
+
+type aggregatorBlocksClient struct {
+	grpc.ClientStream
+}
+
+func (x *aggregatorBlocksClient) Recv() (*Block, error) {
+	m := new(Block)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *aggregatorClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Aggregator_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Aggregator_serviceDesc.Streams[1], "/tupelolite.Aggregator/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &aggregatorSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Aggregator_SubscribeClient interface {
+	Recv() (*Update, error)
+	grpc.ClientStream
+}
+
+type aggregatorSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *aggregatorSubscribeClient) Recv() (*Update, error) {
+	m := new(Update)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// AggregatorServer is the server API for Aggregator service.
+type AggregatorServer interface {
+	AddBlock(context.Context, *services.AddBlockRequest) (*AddBlockResponse, error)
+	Resolve(context.Context, *ResolveRequest) (*ResolveResponse, error)
+	GetTip(context.Context, *GetTipRequest) (*GetTipResponse, error)
+	// Blocks streams the blocks of the latest version of a tree that its read policy allows
+	Blocks(*BlocksRequest, Aggregator_BlocksServer) error
+	// Subscribe streams the updates of a tree
+	Subscribe(*SubscribeRequest, Aggregator_SubscribeServer) error
+}
+
+// UnimplementedAggregatorServer can be embedded to have forward compatible implementations.
+type UnimplementedAggregatorServer struct {
+}
+
+func (*UnimplementedAggregatorServer) AddBlock(ctx context.Context, req *services.AddBlockRequest) (*AddBlockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddBlock not implemented")
+}
+func (*UnimplementedAggregatorServer) Resolve(ctx context.Context, req *ResolveRequest) (*ResolveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Resolve not implemented")
+}
+func (*UnimplementedAggregatorServer) GetTip(ctx context.Context, req *GetTipRequest) (*GetTipResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTip not implemented")
+}
+func (*UnimplementedAggregatorServer) Blocks(req *BlocksRequest, srv Aggregator_BlocksServer) error {
+	return status.Errorf(codes.Unimplemented, "method Blocks not implemented")
+}
+func (*UnimplementedAggregatorServer) Subscribe(req *SubscribeRequest, srv Aggregator_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+
+func RegisterAggregatorServer(s *grpc.Server, srv AggregatorServer) {
+	s.RegisterService(&_Aggregator_serviceDesc, srv)
+}
+
+func _Aggregator_AddBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(services.AddBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AggregatorServer).AddBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tupelolite.Aggregator/AddBlock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AggregatorServer).AddBlock(ctx, req.(*services.AddBlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Aggregator_Resolve_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AggregatorServer).Resolve(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tupelolite.Aggregator/Resolve",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AggregatorServer).Resolve(ctx, req.(*ResolveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Aggregator_GetTip_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTipRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AggregatorServer).GetTip(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tupelolite.Aggregator/GetTip",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AggregatorServer).GetTip(ctx, req.(*GetTipRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Aggregator_Blocks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BlocksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AggregatorServer).Blocks(m, &aggregatorBlocksServer{stream})
+}
+
+type Aggregator_BlocksServer interface {
+	Send(*Block) error
+	grpc.ServerStream
+}
+
+type aggregatorBlocksServer struct {
+	grpc.ServerStream
+}
+
+func (x *aggregatorBlocksServer) Send(m *Block) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Aggregator_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AggregatorServer).Subscribe(m, &aggregatorSubscribeServer{stream})
+}
+
+type Aggregator_SubscribeServer interface {
+	Send(*Update) error
+	grpc.ServerStream
+}
+
+type aggregatorSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *aggregatorSubscribeServer) Send(m *Update) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Aggregator_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "tupelolite.Aggregator",
+	HandlerType: (*AggregatorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddBlock",
+			Handler:    _Aggregator_AddBlock_Handler,
+		},
+		{
+			MethodName: "Resolve",
+			Handler:    _Aggregator_Resolve_Handler,
+		},
+		{
+			MethodName: "GetTip",
+			Handler:    _Aggregator_GetTip_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Blocks",
+			Handler:       _Aggregator_Blocks_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Aggregator_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "aggregator.proto",
+}
@@ -0,0 +1,9 @@
+package rpc
+
+// The messages and the service of aggregator.proto are generated with protoc and the protoc-gen-go (and its grpc
+// plugin) of the github.com/golang/protobuf version in go.mod:
+//
+//	go install github.com/golang/protobuf/protoc-gen-go
+//	go generate ./api/rpc
+//
+//go:generate sh -c "protoc -I . -I $(go list -m -f '{{.Dir}}' github.com/quorumcontrol/messages/v2)/src --go_out=plugins=grpc,paths=source_relative:. aggregator.proto"
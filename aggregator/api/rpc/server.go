@@ -0,0 +1,314 @@
+// Package rpc is a gRPC API for the aggregator, it shares the Aggregator and the identity verification
+// of the GraphQL API (api.Resolver).
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+	"github.com/quorumcontrol/messages/v2/build/go/services"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+	"github.com/quorumcontrol/tupelo/signer/gossip"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var logger = logging.Logger("rpc")
+
+// SubscriptionBuffer is how many updates are buffered for each Subscribe stream,
+// updates for a stream that is further behind are dropped
+var SubscriptionBuffer = 16
+
+// Server implements AggregatorServer on top of an api.Resolver
+type Server struct {
+	resolver *api.Resolver
+
+	lock        sync.RWMutex
+	subscribers map[string]map[chan *Update]struct{} // did -> subscriptions
+}
+
+var _ AggregatorServer = (*Server)(nil)
+
+func NewServer(resolver *api.Resolver) *Server {
+	return &Server{
+		resolver:    resolver,
+		subscribers: make(map[string]map[chan *Update]struct{}),
+	}
+}
+
+// GRPCServer returns a grpc.Server with the service registered and the identity
+// in the metadata of every call verified (see Authenticate)
+func (s *Server) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.UnaryInterceptor(s.unaryInterceptor), grpc.StreamInterceptor(s.streamInterceptor))
+	g := grpc.NewServer(opts...)
+	RegisterAggregatorServer(g, s)
+	return g
+}
+
+// WithIdentity adds a signed identity to the outgoing metadata of ctx
+func WithIdentity(ctx context.Context, token identity.Token) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, strings.ToLower(identity.IdentityHeaderField), token.String())
+}
+
+// WithSession adds a session to the outgoing metadata of ctx
+func WithSession(ctx context.Context, session *identity.Session) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, strings.ToLower(identity.SessionHeaderField), session.String())
+}
+
+// Authenticate verifies the identity in the incoming metadata, the same way api.Resolver.Authenticate
+// verifies headers. Rejected calls get an Unauthenticated or PermissionDenied status prefixed with the auth error code.
+func (s *Server) Authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	headers := make(map[string][]string, len(md))
+	for k, v := range md {
+		headers[textproto.CanonicalMIMEHeaderKey(k)] = v
+	}
+	ctx, err := s.resolver.Authenticate(ctx, headers)
+	if err != nil {
+		authErr := api.NewAuthError(err)
+		code := codes.Internal
+		switch authErr.StatusCode {
+		case http.StatusUnauthorized:
+			code = codes.Unauthenticated
+		case http.StatusForbidden:
+			code = codes.PermissionDenied
+		}
+		return ctx, status.Errorf(code, "%s: %v", authErr.Code, authErr)
+	}
+	return ctx, nil
+}
+
+func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authenticatedStream replaces the context of a stream with the authenticated one
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (as *authenticatedStream) Context() context.Context {
+	return as.ctx
+}
+
+func (s *Server) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.Authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+func (s *Server) AddBlock(ctx context.Context, abr *services.AddBlockRequest) (*AddBlockResponse, error) {
+	logger.Infof("addBlock %s", abr.ObjectId)
+	resp, err := s.resolver.Aggregator.Add(ctx, abr)
+	if errors.Is(err, aggregator.ErrInvalidBlock) {
+		// the same codes as the GraphQL addBlock
+		invalid := &AddBlockResponse{
+			Valid:        false,
+			ErrorCode:    api.ErrorCode(err),
+			ErrorMessage: err.Error(),
+		}
+		var addErr *aggregator.AddError
+		if errors.As(err, &addErr) && addErr.CurrentTip.Defined() {
+			invalid.CurrentTip = addErr.CurrentTip.Bytes()
+		}
+		return invalid, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error validating block: %w", err)
+	}
+	if !resp.IsValid {
+		return &AddBlockResponse{Valid: false, ErrorCode: api.ErrCodePolicyDenied}, nil
+	}
+	return &AddBlockResponse{
+		Valid:     true,
+		NewTip:    resp.NewTip.Bytes(),
+		NewBlocks: nodesToBytes(resp.NewNodes),
+	}, nil
+}
+
+func (s *Server) Resolve(ctx context.Context, req *ResolveRequest) (*ResolveResponse, error) {
+	requester := api.RequesterFromCtx(ctx)
+	path := strings.Split(strings.TrimPrefix(req.Path, "/"), "/")
+	resp, err := s.resolver.Aggregator.ResolveWithReadControls(ctx, requester, req.Did, path)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving: %w", err)
+	}
+	var value []byte
+	if resp.Value != nil {
+		value, err = json.Marshal(resp.Value)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling value: %w", err)
+		}
+	}
+	return &ResolveResponse{
+		RemainingPath: resp.RemainingPath,
+		Value:         value,
+		TouchedBlocks: nodesToBytes(resp.TouchedBlocks),
+	}, nil
+}
+
+// readableTip returns the tip of did if the requester can read it, unreadable trees are NotFound
+// (the same as the resolve of the GraphQL API).
+func (s *Server) readableTip(ctx context.Context, did string) (*cid.Cid, error) {
+	tip, err := s.resolver.Aggregator.GetTip(ctx, did)
+	if err == aggregator.ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "%s not found", did)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting tip: %w", err)
+	}
+	allowed, err := s.resolver.Aggregator.ReadAllowed(ctx, &policy.ReadInput{
+		Method:   policy.MethodGet,
+		Object:   did,
+		Identity: api.RequesterFromCtx(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, status.Errorf(codes.NotFound, "%s not found", did)
+	}
+	return tip, nil
+}
+
+func (s *Server) GetTip(ctx context.Context, req *GetTipRequest) (*GetTipResponse, error) {
+	tip, err := s.readableTip(ctx, req.Did)
+	if err != nil {
+		return nil, err
+	}
+	return &GetTipResponse{Tip: tip.Bytes()}, nil
+}
+
+// Blocks streams the nodes of the latest version of a tree that the read policies allow
+// (see aggregator.WalkReadableNodes), unreadable trees are NotFound.
+func (s *Server) Blocks(req *BlocksRequest, stream Aggregator_BlocksServer) error {
+	ctx := stream.Context()
+	err := s.resolver.Aggregator.WalkReadableNodes(ctx, api.RequesterFromCtx(ctx), req.Did, func(n format.Node) error {
+		return stream.Send(&Block{
+			Cid:  n.Cid().Bytes(),
+			Data: n.RawData(),
+		})
+	})
+	switch err {
+	case aggregator.ErrNotFound:
+		return status.Errorf(codes.NotFound, "%s not found", req.Did)
+	case aggregator.ErrWalkLimit:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return err
+}
+
+// Subscribe streams the updates of a tree until the call is cancelled. Like the MQTT broker of the
+// standalone server it is allowed by the tree's read policy with the policy.MethodSubscribe method.
+// The policy is evaluated again for every update, so the stream ends (with PermissionDenied) once
+// the read policy of the tree no longer allows it.
+func (s *Server) Subscribe(req *SubscribeRequest, stream Aggregator_SubscribeServer) error {
+	ctx := stream.Context()
+	if req.Did == "" {
+		return status.Error(codes.InvalidArgument, "missing did")
+	}
+	err := s.subscribeAllowed(ctx, req.Did)
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan *Update, SubscriptionBuffer)
+	s.subscribe(req.Did, ch)
+	defer s.unsubscribe(req.Did, ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case update := <-ch:
+			err := s.subscribeAllowed(ctx, req.Did)
+			if err != nil {
+				return err
+			}
+			err = stream.Send(update)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// subscribeAllowed returns a PermissionDenied status when the read policy of did does not allow the requester to subscribe
+func (s *Server) subscribeAllowed(ctx context.Context, did string) error {
+	allowed, err := s.resolver.Aggregator.ReadAllowed(ctx, &policy.ReadInput{
+		Method:   policy.MethodSubscribe,
+		Object:   did,
+		Identity: api.RequesterFromCtx(ctx),
+	})
+	if err != nil {
+		return fmt.Errorf("error checking read policy: %w", err)
+	}
+	if !allowed {
+		return status.Errorf(codes.PermissionDenied, "not allowed to subscribe to %s", did)
+	}
+	return nil
+}
+
+func (s *Server) subscribe(did string, ch chan *Update) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	subs, ok := s.subscribers[did]
+	if !ok {
+		subs = make(map[chan *Update]struct{})
+		s.subscribers[did] = subs
+	}
+	subs[ch] = struct{}{}
+}
+
+func (s *Server) unsubscribe(did string, ch chan *Update) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.subscribers[did], ch)
+	if len(s.subscribers[did]) == 0 {
+		delete(s.subscribers, did)
+	}
+}
+
+// HandleUpdate sends the update to the Subscribe streams of the tree, it is meant to be called
+// from the aggregator.UpdateFunc
+func (s *Server) HandleUpdate(wrapper *gossip.AddBlockWrapper) {
+	did := string(wrapper.ObjectId)
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for ch := range s.subscribers[did] {
+		select {
+		case ch <- &Update{Did: did, NewTip: wrapper.NewTip, Height: wrapper.Height}:
+		default:
+			logger.Warningf("dropping update of %s for a slow subscriber", did)
+		}
+	}
+}
+
+func nodesToBytes(nodes []format.Node) [][]byte {
+	bits := make([][]byte, len(nodes))
+	for i, n := range nodes {
+		bits[i] = n.RawData()
+	}
+	return bits
+}
@@ -0,0 +1,238 @@
+package rpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ipfs/go-cid"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/abrbuilder"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/quorumcontrol/tupelo/signer/gossip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestService(ctx context.Context, t *testing.T) (*Server, AggregatorClient) {
+	var s *Server
+	r, err := api.NewResolver(ctx, &api.Config{
+		KeyValueStore: aggregator.NewMemoryStore(),
+		UpdateFunc: func(wrapper *gossip.AddBlockWrapper) {
+			s.HandleUpdate(wrapper)
+		},
+	})
+	require.Nil(t, err)
+	s = NewServer(r)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	g := s.GRPCServer()
+	go g.Serve(lis)
+
+	conn, err := grpc.DialContext(ctx, lis.Addr().String(), grpc.WithInsecure())
+	require.Nil(t, err)
+
+	t.Cleanup(func() {
+		conn.Close()
+		g.Stop()
+	})
+	return s, NewAggregatorClient(conn)
+}
+
+func setData(ctx context.Context, t *testing.T, cli AggregatorClient, tree *chaintree.ChainTree, treeKey *ecdsa.PrivateKey, path string, value interface{}) *AddBlockResponse {
+	txn, err := chaintree.NewSetDataTransaction(path, value)
+	require.Nil(t, err)
+	abr, err := abrbuilder.NewAddBlockRequest(ctx, tree, treeKey, []*transactions.Transaction{txn})
+	require.Nil(t, err)
+	resp, err := cli.AddBlock(ctx, abr)
+	require.Nil(t, err)
+	require.True(t, resp.Valid, resp.ErrorMessage)
+	newTip, err := cid.Cast(resp.NewTip)
+	require.Nil(t, err)
+	tree.Dag = tree.Dag.WithNewTip(newTip)
+	return resp
+}
+
+func TestServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, cli := newTestService(ctx, t)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	signedTree, err := consensus.NewSignedChainTree(ctx, treeKey.PublicKey, nodestore.MustMemoryStore(ctx))
+	require.Nil(t, err)
+	tree := signedTree.ChainTree
+	did := signedTree.MustId()
+
+	_, err = cli.GetTip(ctx, &GetTipRequest{Did: did})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	setData(ctx, t, cli, tree, treeKey, "some/path", "hi")
+
+	t.Run("get tip", func(t *testing.T) {
+		resp, err := cli.GetTip(ctx, &GetTipRequest{Did: did})
+		require.Nil(t, err)
+		assert.Equal(t, tree.Dag.Tip.Bytes(), resp.Tip)
+	})
+
+	t.Run("resolve", func(t *testing.T) {
+		resp, err := cli.Resolve(ctx, &ResolveRequest{Did: did, Path: "tree/data/some/path"})
+		require.Nil(t, err)
+		var val interface{}
+		require.Nil(t, json.Unmarshal(resp.Value, &val))
+		assert.Equal(t, "hi", val)
+		assert.Len(t, resp.RemainingPath, 0)
+		assert.Len(t, resp.TouchedBlocks, 4)
+	})
+
+	t.Run("blocks", func(t *testing.T) {
+		stream, err := cli.Blocks(ctx, &BlocksRequest{Did: did})
+		require.Nil(t, err)
+		var cids []string
+		for {
+			blk, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			require.Nil(t, err)
+			id, err := cid.Cast(blk.Cid)
+			require.Nil(t, err)
+			cids = append(cids, id.String())
+		}
+		assert.Contains(t, cids, tree.Dag.Tip.String())
+	})
+
+	t.Run("subscribe", func(t *testing.T) {
+		subCtx, subCancel := context.WithCancel(ctx)
+		defer subCancel()
+		stream, err := cli.Subscribe(subCtx, &SubscribeRequest{Did: did})
+		require.Nil(t, err)
+		require.Eventually(t, func() bool {
+			s.lock.RLock()
+			defer s.lock.RUnlock()
+			return len(s.subscribers[did]) == 1
+		}, 2*time.Second, 10*time.Millisecond)
+
+		resp := setData(ctx, t, cli, tree, treeKey, "other/path", "bye")
+
+		update, err := stream.Recv()
+		require.Nil(t, err)
+		assert.Equal(t, did, update.Did)
+		assert.Equal(t, resp.NewTip, update.NewTip)
+		assert.Equal(t, uint64(1), update.Height)
+
+		subCancel()
+		require.Eventually(t, func() bool {
+			s.lock.RLock()
+			defer s.lock.RUnlock()
+			return len(s.subscribers[did]) == 0
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("identity in metadata", func(t *testing.T) {
+		s.resolver.StrictAuth = true
+		defer func() { s.resolver.StrictAuth = false }()
+
+		ident, err := (&identity.Identity{
+			Iss: did,
+			Sub: did,
+			Exp: time.Now().UTC().Unix() + 60,
+		}).Sign(treeKey)
+		require.Nil(t, err)
+		_, err = cli.GetTip(WithIdentity(ctx, ident), &GetTipRequest{Did: did})
+		require.Nil(t, err)
+
+		otherKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		otherIdent, err := (&identity.Identity{
+			Iss: did,
+			Sub: did,
+			Exp: time.Now().UTC().Unix() + 60,
+		}).Sign(otherKey)
+		require.Nil(t, err)
+		_, err = cli.GetTip(WithIdentity(ctx, otherIdent), &GetTipRequest{Did: did})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+		assert.True(t, strings.HasPrefix(status.Convert(err).Message(), api.AuthNotOwner))
+
+		// streams are authenticated as well
+		stream, err := cli.Blocks(WithIdentity(ctx, otherIdent), &BlocksRequest{Did: did})
+		require.Nil(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+	t.Run("subscriptions end when the read policy no longer allows them", func(t *testing.T) {
+		subCtx, subCancel := context.WithCancel(ctx)
+		defer subCancel()
+		stream, err := cli.Subscribe(subCtx, &SubscribeRequest{Did: did})
+		require.Nil(t, err)
+		require.Eventually(t, func() bool {
+			s.lock.RLock()
+			defer s.lock.RUnlock()
+			return len(s.subscribers[did]) == 1
+		}, 2*time.Second, 10*time.Millisecond)
+
+		setData(ctx, t, cli, tree, treeKey, ".well-known/policies", map[string]string{
+			"read": `
+				package read
+				default allow = true
+				allow = false {
+					input.method == "SUBSCRIBE"
+				}
+			`,
+		})
+
+		_, err = stream.Recv()
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("invalid blocks have an error code", func(t *testing.T) {
+		// a tree of its own, without the policies of the tests above
+		treeKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		signedTree, err := consensus.NewSignedChainTree(ctx, treeKey.PublicKey, nodestore.MustMemoryStore(ctx))
+		require.Nil(t, err)
+		tree := signedTree.ChainTree
+		setData(ctx, t, cli, tree, treeKey, "some/path", "hi")
+
+		txn, err := chaintree.NewSetDataTransaction("some/path", "invalid")
+		require.Nil(t, err)
+		otherKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		abr, err := abrbuilder.NewAddBlockRequest(ctx, tree, otherKey, []*transactions.Transaction{txn})
+		require.Nil(t, err)
+		resp, err := cli.AddBlock(ctx, abr)
+		require.Nil(t, err)
+		assert.False(t, resp.Valid)
+		assert.Equal(t, api.ErrCodeInvalidSignature, resp.ErrorCode)
+		assert.NotEmpty(t, resp.ErrorMessage)
+
+		// the previous tip is not the current tip once the block is added
+		abr, err = abrbuilder.NewAddBlockRequest(ctx, tree, treeKey, []*transactions.Transaction{txn})
+		require.Nil(t, err)
+		previousTip := tree.Dag.Tip
+		setData(ctx, t, cli, tree, treeKey, "other/path", "hi")
+		resp, err = cli.AddBlock(ctx, abr)
+		require.Nil(t, err)
+		assert.False(t, resp.Valid)
+		assert.Equal(t, api.ErrCodeTipConflict, resp.ErrorCode)
+		assert.Equal(t, tree.Dag.Tip.Bytes(), resp.CurrentTip)
+		assert.NotEqual(t, previousTip.Bytes(), resp.CurrentTip)
+	})
+}
@@ -2,22 +2,125 @@ package api
 
 var Schema = `
 scalar JSON
+scalar CID
 
 type Block {
 	data: String! # base64
-	cid: ID
+	cid: CID
 }
 
 type AddBlockPayload {
 	valid: Boolean!
-	newTip: String! # base64 todo: CID scalar
+	newTip: CID # null when the block is not valid
 	newBlocks: [Block!]
+	errorCode: String # TIP_CONFLICT, POLICY_DENIED, INVALID_SIGNATURE, SCHEMA_VIOLATION or INVALID_BLOCK when the block is not valid
+	currentTip: CID # the tip of the tree on a TIP_CONFLICT
+	violations: [SchemaViolation!] # the values that do not conform to the schemas of the tree on a SCHEMA_VIOLATION
+}
+
+type SchemaViolation {
+	path: String!
+	schema: String! # the glob (under .well-known/schemas) of the schema
+	message: String!
+}
+
+type TreeBlocks {
+	did: String!
+	tip: CID # null when the tree was not found or is not readable
+	blocks: [Block!]!
 }
 
 type ResolvePayload {
 	remainingPath: [String!]!
 	value: JSON
 	touchedBlocks: [Block!]
+	touchedBlocksByDid: [TreeBlocks!] # the touched blocks of each tree when following references (maxHops)
+}
+
+type ResolveManyResult {
+	did: String!
+	path: String!
+	tip: CID # null when the tree was not found or is not readable
+	remainingPath: [String!]!
+	value: JSON
+}
+
+type ResolveManyPayload {
+	results: [ResolveManyResult!]! # in the order of the inputs
+	touchedBlocks: [Block!] # the blocks touched by all the resolves (without duplicates)
+}
+
+type Child {
+	key: String!
+	type: String! # map, list, link, string, int, float, bool, bytes or null
+	cid: CID # the linked CID when the type is link
+}
+
+type ChildrenPayload {
+	tip: CID # null when the tree was not found
+	children: [Child!]!
+	endCursor: String # pass as after to get the next page
+	hasNextPage: Boolean!
+}
+
+type FindPayload {
+	dids: [String!]!
+	endCursor: String # pass as after to get the next page
+	hasNextPage: Boolean!
+}
+
+type SearchHit {
+	did: String!
+	paths: [String!]! # the readable paths that matched
+}
+
+type SearchPayload {
+	hits: [SearchHit!]!
+	endCursor: String # pass as after to get the next page (a page can have fewer hits than asked for and still have a next page)
+	hasNextPage: Boolean!
+}
+
+type MyTreesPayload {
+	dids: [String!]!
+	endCursor: String # pass as after to get the next page
+	hasNextPage: Boolean!
+}
+
+type TreePayload {
+	did: String!
+	tip: CID # null when the tree was not found or is not readable
+	height: Int
+	updatedAt: Int # seconds since the epoch, null when not known
+	owners: [String!] # the authentications of the tree, grafted owners are not resolved
+}
+
+type Change {
+	path: String!
+	type: String! # added, removed or modified
+	oldValue: JSON # null when added
+	newValue: JSON # null when removed
+}
+
+type DiffPayload {
+	from: CID # null when the tree was not found or is not readable
+	to: CID
+	changes: [Change!]! # ordered by path
+}
+
+type BlameEntry {
+	height: Int!
+	block: CID! # the block of the chain with the transaction
+	tip: CID! # the tip of the tree after the block
+	signers: [String!]! # the addresses that signed the block
+	transactionType: String! # SETDATA, SETOWNERSHIP, ...
+	transaction: JSON!
+	path: String! # the path the transaction changed
+	value: JSON # the value of the blamed path at the tip
+}
+
+type BlamePayload {
+	tip: CID # null when the tree was not found or is not readable
+	entries: [BlameEntry!]! # the newest first
 }
 
 type IdentityTokenPayload {
@@ -26,21 +129,85 @@ type IdentityTokenPayload {
 	id: String!
 }
 
+type SessionPayload {
+	result: Boolean!
+	token: String!
+	expiresIn: Int! # seconds
+}
+
+type SendMessagePayload {
+	accepted: Boolean!
+	stored: Boolean! # true when stored in the durable inbox
+}
+
+type InboxMessage {
+	id: String!
+	from: String!
+	to: String!
+	body: String!
+	sent: Int! # seconds since the epoch
+	signed: String! # the base64 signed message
+}
+
+type InboxPayload {
+	messages: [InboxMessage!]!
+}
+
+type AcknowledgeMessagesPayload {
+	result: Boolean!
+}
+
 input ResolveInput {
 	did: String!
 	path: String!
+	depth: Int # how many levels of links to expand into the value
+	fields: [String!] # the (slash separated) paths of the value to return, all of it when empty
+	maxHops: Int # how many "did:tupelo:<did>/<path>" references to other trees to follow
 }
 
 input AddBlockInput {
   addBlockRequest: String! # The serialized protobuf as base64
 }
 
+input SendMessageInput {
+	message: String! # The base64 signed message
+}
+
+input InboxInput {
+	first: Int
+}
+
+input AcknowledgeMessagesInput {
+	ids: [String!]!
+}
+
+input SubscribeTreesInput {
+	dids: [String!]!
+}
+
+type SubscribeTreesPayload {
+	dids: [String!]! # the trees whose read policy allows the subscription
+}
+
 type Query {
   resolve(input:ResolveInput!):ResolvePayload
+  resolveMany(inputs:[ResolveInput!]!):ResolveManyPayload
+  children(did:String!, path:String!, first:Int, after:String):ChildrenPayload
+  tree(did:String!):TreePayload
+  diff(did:String!, from:CID!, to:CID):DiffPayload # to is the latest tip when null
+  blame(did:String!, path:String!):BlamePayload
+  find(index:String!, value:String!, first:Int, after:String):FindPayload # the trees with value in a secondary index
+  search(query:String!, first:Int, after:String):SearchPayload # the trees with every word of the query
+  myTrees(first:Int, after:String):MyTreesPayload # the trees owned by the signers of the identity
   identityToken:IdentityTokenPayload
+  session:SessionPayload
+  inbox(input:InboxInput):InboxPayload
 }
 
 type Mutation {
   addBlock(input:AddBlockInput!):AddBlockPayload
+  sendMessage(input:SendMessageInput!):SendMessagePayload
+  acknowledgeMessages(input:AcknowledgeMessagesInput!):AcknowledgeMessagesPayload
+  subscribeTrees(input:SubscribeTreesInput!):SubscribeTreesPayload # the private topics of trees (replacing earlier ones)
 }
 `
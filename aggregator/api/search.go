@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+type SearchInput struct {
+	Query string
+	First *int32
+	After *string
+}
+
+type SearchHit struct {
+	Did   string
+	Paths []string
+}
+
+type SearchPayload struct {
+	Hits []SearchHit
+	PageInfo
+}
+
+// Search lists a page of the trees that match every word of the query, see Aggregator.Search
+func (r *Resolver) Search(ctx context.Context, input SearchInput) (*SearchPayload, error) {
+	first, after, err := pageArgs(input.First, input.After, DefaultFindPageSize, MaxFindPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	requester := RequesterFromCtx(ctx)
+	logger.Infof("search %s with requester %v", input.Query, requester)
+
+	resp, err := r.Aggregator.Search(ctx, requester, input.Query, first, after)
+	if err != nil {
+		logger.Errorf("error searching %s %v", input.Query, err)
+		return nil, NewCodedError(fmt.Errorf("error searching: %w", err))
+	}
+
+	payload := &SearchPayload{
+		Hits: make([]SearchHit, len(resp.Hits)),
+		// the end cursor can be past the last hit (see aggregator.SearchResponse)
+		PageInfo: newPageInfo(resp.EndCursor, resp.HasMore),
+	}
+	for i, hit := range resp.Hits {
+		payload.Hits[i] = SearchHit{
+			Did:   hit.Did,
+			Paths: hit.Paths,
+		}
+	}
+	return payload, nil
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	search, err := aggregator.ParseSearchDefinitions("*=tree/data/title")
+	require.Nil(t, err)
+	pf := newPageFixture(t, ctx, &Config{Search: search})
+
+	did, _ := pf.addTree(t, "title", "Hello World")
+
+	query := `query search($query: String!) {
+		search(query: $query) {
+			hits {
+				did
+				paths
+			}
+			endCursor
+			hasNextPage
+		}
+	}`
+
+	resp := &struct {
+		Search struct {
+			Hits []struct {
+				Did   string   `json:"did"`
+				Paths []string `json:"paths"`
+			} `json:"hits"`
+			EndCursor   *string `json:"endCursor"`
+			HasNextPage bool    `json:"hasNextPage"`
+		} `json:"search"`
+	}{}
+	require.Len(t, pf.exec(t, ctx, query, "search", map[string]interface{}{"query": "hello"}, resp), 0)
+	require.Len(t, resp.Search.Hits, 1)
+	assert.Equal(t, did, resp.Search.Hits[0].Did)
+	assert.Equal(t, []string{"tree/data/title"}, resp.Search.Hits[0].Paths)
+	assert.NotNil(t, resp.Search.EndCursor)
+	assert.False(t, resp.Search.HasNextPage)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api/rpc"
+)
+
+// StartGRPC serves the gRPC API on GRPC_PORT (default 9012) in the background
+func StartGRPC(resolver *api.Resolver) (*rpc.Server, error) {
+	port := os.Getenv("GRPC_PORT")
+	if port == "" {
+		port = "9012"
+	}
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, fmt.Errorf("error listening: %w", err)
+	}
+
+	s := rpc.NewServer(resolver)
+	g := s.GRPCServer()
+	go func() {
+		err := g.Serve(lis)
+		if err != nil {
+			logger.Errorf("error serving grpc: %v", err)
+		}
+	}()
+	return s, nil
+}
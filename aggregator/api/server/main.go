@@ -5,16 +5,19 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
+	mqtt "github.com/eclipse/paho.mqtt.golang"
 	logging "github.com/ipfs/go-log"
 
 	"github.com/graph-gophers/graphql-go"
 	"github.com/graph-gophers/graphql-go/relay"
-	"github.com/quorumcontrol/chaintree/graftabledag"
+	"github.com/ipfs/go-cid"
 	"github.com/quorumcontrol/tupelo-lite/aggregator"
 	"github.com/quorumcontrol/tupelo-lite/aggregator/api"
 	"github.com/quorumcontrol/tupelo-lite/aggregator/api/publisher"
-	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api/rpc"
+	"github.com/quorumcontrol/tupelo/signer/gossip"
 )
 
 var logger = logging.Logger("server")
@@ -32,31 +35,32 @@ func CorsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func IdentityMiddleware(next http.Handler, getter graftabledag.DagGetter) http.Handler {
+func IdentityMiddleware(next http.Handler, resolver *api.Resolver) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id, err := identity.FromHeader(r.Header)
+		ctx, err := resolver.Authenticate(r.Context(), r.Header)
 		if err != nil {
-			w.WriteHeader(500)
+			authErr := api.NewAuthError(err)
+			logger.Debugf("rejecting request: %v", authErr)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(authErr.StatusCode)
+			w.Write(authErr.Response())
 			return
 		}
-		if id != nil {
-			isVerified, err := id.Verify(context.TODO(), getter)
-			if err != nil {
-				logger.Errorf("error verifying: %v", err)
-				w.WriteHeader(500)
-				return
-			}
-			if isVerified {
-				logger.Debugf("id: %v", id)
-				newR := r.WithContext(context.WithValue(r.Context(), api.IdentityContextKey, id.Identity))
-				next.ServeHTTP(w, newR)
-				return
-			}
-		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// publicTopicACLs is whether subscriptions to public topics are checked against read policies with the SUBSCRIBE
+// method (so trees whose read policy only allows GET cannot be subscribed to), PUBLIC_TOPIC_ACLS=false opts out
+func publicTopicACLs() bool {
+	return os.Getenv("PUBLIC_TOPIC_ACLS") != "false"
+}
+
+// BlocksHandler serves the binary API (see api.Resolver.BinaryHandler) at /blocks/
+func BlocksHandler(resolver *api.Resolver) http.Handler {
+	return CorsMiddleware(IdentityMiddleware(http.StripPrefix("/blocks", resolver.BinaryHandler()), resolver))
+}
+
 // TODO: return errors
 func Setup() *api.Resolver {
 	logging.SetLogLevel("*", "info")
@@ -64,14 +68,28 @@ func Setup() *api.Resolver {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	cli, err := StartMQTT()
-	if err != nil {
-		panic(err)
+	var publisherOpts []publisher.Option
+	if os.Getenv("PRIVATE_TOPICS") == "true" {
+		publisherOpts = append(publisherOpts, publisher.WithPrivateTopics())
+	}
+
+	// the internal mqtt client needs the resolver (for broker auth) so it is set once the resolver exists
+	var cli mqtt.Client
+	// diffs need the aggregator of the resolver as well
+	var r *api.Resolver
+	if os.Getenv("PUBLISH_DIFFS") == "true" {
+		publisherOpts = append(publisherOpts, publisher.WithDiffs(func(ctx context.Context, did string, from, to cid.Cid) (*aggregator.DiffResponse, error) {
+			return r.Aggregator.DiffWithReadControls(ctx, nil, did, from, to)
+		}))
 	}
+	// the same goes for the gRPC server which streams updates to its subscribers
+	var rpcServer *rpc.Server
 
-	// TODO: publish this to an mqtt broker
-	updateFunc, err := publisher.Wrap(ctx, func(ctx context.Context, topic string, msg string) error {
-		logger.Debugf("updated: %s", topic)
+	publish := func(ctx context.Context, topic string, msg string) error {
+		logger.Debugf("publishing: %s", topic)
+		if cli == nil {
+			return fmt.Errorf("mqtt client not started")
+		}
 		tok := cli.Publish(topic, byte(1), false, msg)
 		go func() {
 			tok.Wait()
@@ -83,32 +101,71 @@ func Setup() *api.Resolver {
 		}()
 
 		return nil
+	}
+
+	publishUpdate, err := publisher.Wrap(ctx, publish, publisherOpts...)
+	if err != nil {
+		panic(err)
+	}
+	updateFunc := func(wrapper *gossip.AddBlockWrapper) {
+		publishUpdate(wrapper)
+		if rpcServer != nil {
+			rpcServer.HandleUpdate(wrapper)
+		}
+	}
+
+	indexes, err := aggregator.ParseIndexDefinitions(os.Getenv("INDEXES"))
+	if err != nil {
+		panic(err)
+	}
+	search, err := aggregator.ParseSearchDefinitions(os.Getenv("SEARCH"))
+	if err != nil {
+		panic(err)
+	}
+
+	r, err = api.NewResolver(ctx, &api.Config{
+		KeyValueStore: aggregator.NewMemoryStore(),
+		UpdateFunc:    updateFunc,
+		StrictAuth:    os.Getenv("STRICT_AUTH") == "true",
+		MessageRelay:  publisher.WrapMessages(publish),
+		DurableInbox:  os.Getenv("DURABLE_INBOX") == "true",
+		BlameIndex:    os.Getenv("BLAME_INDEX") == "true",
+		OwnerIndex:    os.Getenv("OWNER_INDEX") == "true",
+		Indexes:       indexes,
+		Search:        search,
 	})
 	if err != nil {
 		panic(err)
 	}
+	r.TokenHandler = TokenHandler(r)
+
+	cli, err = StartMQTT(r, publicTopicACLs())
+	if err != nil {
+		panic(err)
+	}
 
-	r, err := api.NewResolver(ctx, &api.Config{KeyValueStore: aggregator.NewMemoryStore(), UpdateFunc: updateFunc})
+	rpcServer, err = StartGRPC(r)
 	if err != nil {
 		panic(err)
 	}
 
-	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers(), graphql.MaxParallelism(20)}
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers(), graphql.MaxParallelism(api.MaxParallelism)}
 	schema := graphql.MustParseSchema(api.Schema, r, opts...)
 
 	http.Handle("/", CorsMiddleware(IdentityMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("rendering igraphql")
 		w.Write(page)
-	}), r.Aggregator)))
+	}), r)))
 
-	http.Handle("/graphql", CorsMiddleware(IdentityMiddleware(&relay.Handler{Schema: schema}, r.Aggregator)))
+	http.Handle("/graphql", CorsMiddleware(IdentityMiddleware(&relay.Handler{Schema: schema}, r)))
+	http.Handle("/blocks/", BlocksHandler(r))
 
 	return r
 }
 
 func main() {
 	Setup()
-	fmt.Println("running on port 9011 path: /graphql")
+	fmt.Println("running on port 9011 path: /graphql (gRPC on GRPC_PORT, default 9012)")
 	log.Fatal(http.ListenAndServe(":9011", nil))
 }
 
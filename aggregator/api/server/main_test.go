@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/abrbuilder"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/car"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlocksHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := api.NewResolver(ctx, &api.Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+	mux := http.NewServeMux()
+	mux.Handle("/blocks/", BlocksHandler(r))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	signedTree, err := consensus.NewSignedChainTree(ctx, treeKey.PublicKey, nodestore.MustMemoryStore(ctx))
+	require.Nil(t, err)
+	tree := signedTree.ChainTree
+	did := signedTree.MustId()
+
+	txn, err := chaintree.NewSetDataTransaction("some/path", "hi")
+	require.Nil(t, err)
+	abr, err := abrbuilder.NewAddBlockRequest(ctx, tree, treeKey, []*transactions.Transaction{txn})
+	require.Nil(t, err)
+	bits, err := abr.Marshal()
+	require.Nil(t, err)
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/blocks/addBlock", bytes.NewReader(bits))
+	require.Nil(t, err)
+	req.Header.Set("Content-Type", api.ContentTypeProtobuf)
+	req.Header.Set("Accept", api.ContentTypeCAR)
+	resp, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+	roots, _, err := car.Read(resp.Body)
+	require.Nil(t, err)
+	require.Len(t, roots, 1)
+
+	treeURL := srv.URL + "/blocks/tree?" + url.Values{"did": {did}}.Encode()
+	resp, err = http.Get(treeURL)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, `"`+roots[0].String()+`"`, etag)
+
+	req, err = http.NewRequest(http.MethodGet, treeURL, nil)
+	require.Nil(t, err)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+}
+
+func TestPublicTopicACLsByDefault(t *testing.T) {
+	defer os.Unsetenv("PUBLIC_TOPIC_ACLS")
+
+	os.Unsetenv("PUBLIC_TOPIC_ACLS")
+	assert.True(t, publicTopicACLs())
+	os.Setenv("PUBLIC_TOPIC_ACLS", "true")
+	assert.True(t, publicTopicACLs())
+	os.Setenv("PUBLIC_TOPIC_ACLS", "false")
+	assert.False(t, publicTopicACLs())
+}
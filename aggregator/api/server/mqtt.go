@@ -2,10 +2,12 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/fhmq/hmq/broker"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api"
 )
 
 // fs.BoolVar(&help, "h", false, "Show this message.")
@@ -30,7 +32,14 @@ import (
 // 	fs.BoolVar(&config.Debug, "debug", false, "enable Debug logging.")
 // 	fs.BoolVar(&config.Debug, "d", false, "enable Debug logging.")
 
-func StartMQTT() (mqtt.Client, error) {
+// StartMQTT starts the embedded broker (authorizing clients against the resolver, see brokerAuth)
+// and returns the connected internal client the server publishes with. With publicTopicACLs subscriptions
+// to public/trees/<did> follow the read policy of the tree as well (and wildcard subscriptions are denied).
+func StartMQTT(resolver *api.Resolver, publicTopicACLs bool) (mqtt.Client, error) {
+	brokerAuth, err := newBrokerAuth(resolver, publicTopicACLs)
+	if err != nil {
+		return nil, err
+	}
 
 	// TODO: make these ports configurable
 	b, err := broker.NewBroker(&broker.Config{
@@ -41,15 +50,28 @@ func StartMQTT() (mqtt.Client, error) {
 		WsPath:   "/mqtt",
 		WsPort:   "8081",
 		Host:     "0.0.0.0",
+		Plugin: broker.Plugins{
+			Auth:   brokerAuth,
+			Bridge: brokerAuth,
+		},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error starting broker")
 	}
 	b.Start()
 
+	// the broker starts listening in the background, so wait for it
+	// to accept connections before connecting the internal client
+	err = waitForListener("localhost:1883", 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
 	mqttOpts := mqtt.NewClientOptions()
 	mqttOpts.AddBroker("tcp://localhost:1883")
-	mqttOpts.ClientID = "server-internal"
+	mqttOpts.ClientID = internalClientID
+	mqttOpts.Username = internalUsername
+	mqttOpts.Password = brokerAuth.internalPassword
 	cli := mqtt.NewClient(mqttOpts)
 	tok := cli.Connect()
 	didConnect := tok.WaitTimeout(2 * time.Second)
@@ -59,3 +81,15 @@ func StartMQTT() (mqtt.Client, error) {
 
 	return cli, nil
 }
+
+func waitForListener(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err == nil {
+			return conn.Close()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("timeout waiting for broker")
+}
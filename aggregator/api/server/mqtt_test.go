@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"os"
 	"testing"
 	"time"
 
@@ -16,6 +17,10 @@ func TestPublishesToMqtt(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// the wildcard subscription below needs the public topics without ACLs
+	os.Setenv("PUBLIC_TOPIC_ACLS", "false")
+	defer os.Unsetenv("PUBLIC_TOPIC_ACLS")
+
 	resolver := Setup()
 	agg := resolver.Aggregator
 
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fhmq/hmq/broker"
+	"github.com/fhmq/hmq/plugins/auth"
+	"github.com/fhmq/hmq/plugins/bridge"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api/publisher"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+)
+
+const (
+	internalClientID = "server-internal"
+	internalUsername = "server-internal"
+
+	userToUserTopicPrefix = "public/userToUser/"
+
+	// pendingTimeout is how long the identity of a client that passed CheckConnect is kept until
+	// the broker reports the connection (clients that never finish connecting are dropped after it)
+	pendingTimeout = time.Minute
+)
+
+var (
+	treeTopicPrefix        = publisher.PublicTopic("")
+	privateTreeTopicPrefix = publisher.PrivateTopic("")
+	messageTopicSuffix     = strings.TrimPrefix(publisher.MessageTopic(""), publisher.PrivateTopic(""))
+)
+
+// TokenHandler is the standalone equivalent of the Cognito/IoT token handler of the Lambda.
+// It issues broker credentials for the verified requester: the username is the DID
+// and the password is a session token (see identity.Session).
+func TokenHandler(resolver *api.Resolver) api.TokenHandlerFunc {
+	return func(ctx context.Context) (*api.IdentityTokenPayload, error) {
+		requester := api.RequesterFromCtx(ctx)
+		if requester == nil {
+			logger.Warningf("no requester")
+			return &api.IdentityTokenPayload{
+				Result: false,
+			}, nil
+		}
+		session, err := resolver.Sessions.Issue(requester)
+		if err != nil {
+			return nil, fmt.Errorf("error issuing session: %w", err)
+		}
+		return &api.IdentityTokenPayload{
+			Result: true,
+			Token:  session.String(),
+			Id:     requester.Sub,
+		}, nil
+	}
+}
+
+// brokerAuth is the hmq auth plugin mirroring the IoT policy used in production:
+// anyone can connect (anonymously or with credentials from TokenHandler),
+// subscribing to private/trees/<did> follows the read policy of the tree (with the policy.MethodSubscribe method),
+// private/trees/<did>/messages can only be subscribed to by identities with did as their subject,
+// only the server publishes tree updates and messages, and connected identities can still publish
+// directly (unchecked) to public/userToUser.
+// With publicTopicACLs (the default, see publicTopicACLs) subscribing to public/trees/<did> follows the read policy
+// as well (also with the policy.MethodSubscribe method rather than GET, so read policies that only allow GET deny
+// it), which rules out wildcard subscriptions and trees that do not exist yet, otherwise anything under public/ can
+// be subscribed to.
+// Credentials are only checked at connect and the read policy only at subscribe, so a connection outlives its
+// session and a subscription the read policy of its tree.
+// It is also the bridge plugin of the broker, to forget clients when they disconnect.
+type brokerAuth struct {
+	resolver         *api.Resolver
+	internalPassword string
+	publicTopicACLs  bool
+
+	lock    sync.RWMutex
+	pending map[string]*pendingClient     // clientID -> identity that passed CheckConnect
+	clients map[string]*identity.Identity // clientID -> identity (nil when anonymous) of connected clients
+}
+
+type pendingClient struct {
+	identity *identity.Identity
+	checked  time.Time
+}
+
+var _ auth.Auth = (*brokerAuth)(nil)
+var _ bridge.BridgeMQ = (*brokerAuth)(nil)
+
+func newBrokerAuth(resolver *api.Resolver, publicTopicACLs bool) (*brokerAuth, error) {
+	secret := make([]byte, 16)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, fmt.Errorf("error generating password: %w", err)
+	}
+	return &brokerAuth{
+		resolver:         resolver,
+		internalPassword: hex.EncodeToString(secret),
+		publicTopicACLs:  publicTopicACLs,
+		pending:          make(map[string]*pendingClient),
+		clients:          make(map[string]*identity.Identity),
+	}, nil
+}
+
+func (ba *brokerAuth) CheckConnect(clientID, username, password string) bool {
+	if username == internalUsername {
+		return clientID == internalClientID && subtle.ConstantTimeCompare([]byte(password), []byte(ba.internalPassword)) == 1
+	}
+	if clientID == internalClientID {
+		return false
+	}
+
+	var id *identity.Identity
+	if username != "" || password != "" {
+		session, err := identity.SessionFromString(password)
+		if err != nil {
+			logger.Debugf("invalid broker password for %s: %v", clientID, err)
+			return false
+		}
+		if err := ba.resolver.Sessions.Check(session); err != nil {
+			logger.Debugf("unverified broker session for %s: %v", clientID, err)
+			return false
+		}
+		if session.Sub != username {
+			logger.Debugf("broker username %s does not match session %s", username, session.Sub)
+			return false
+		}
+		id = &session.Identity
+	}
+
+	now := time.Now()
+	ba.lock.Lock()
+	defer ba.lock.Unlock()
+	for pendingID, pending := range ba.pending {
+		if now.Sub(pending.checked) > pendingTimeout {
+			delete(ba.pending, pendingID)
+		}
+	}
+	// the client is only connected once the broker reports it (see Publish), an existing connection with
+	// the same clientID is closed by the broker first
+	ba.pending[clientID] = &pendingClient{identity: id, checked: now}
+	return true
+}
+
+// Publish receives the events of the broker (as its bridge plugin) to track the connected clients
+func (ba *brokerAuth) Publish(e *bridge.Elements) error {
+	ba.lock.Lock()
+	defer ba.lock.Unlock()
+	switch e.Action {
+	case bridge.Connect:
+		if pending, ok := ba.pending[e.ClientID]; ok {
+			ba.clients[e.ClientID] = pending.identity
+			delete(ba.pending, e.ClientID)
+		}
+	case bridge.Disconnect:
+		delete(ba.clients, e.ClientID)
+	}
+	return nil
+}
+
+// identityOf returns the identity of clientID and whether it is a known client
+func (ba *brokerAuth) identityOf(clientID string) (*identity.Identity, bool) {
+	ba.lock.RLock()
+	defer ba.lock.RUnlock()
+	if id, ok := ba.clients[clientID]; ok {
+		return id, true
+	}
+	if pending, ok := ba.pending[clientID]; ok {
+		return pending.identity, true
+	}
+	return nil, false
+}
+
+func (ba *brokerAuth) CheckACL(action, clientID, username, ip, topic string) bool {
+	if username == internalUsername && clientID == internalClientID {
+		return true
+	}
+
+	id, ok := ba.identityOf(clientID)
+	if !ok || (id != nil && id.Sub != username) {
+		return false
+	}
+
+	switch action {
+	case broker.PUB:
+		// updates and messages (see messaging) are only published by the server, public/userToUser
+		// is kept for existing clients
+		return id != nil && strings.HasPrefix(topic, userToUserTopicPrefix)
+	case broker.SUB:
+		var did string
+		switch {
+		case strings.HasPrefix(topic, treeTopicPrefix):
+			if !ba.publicTopicACLs {
+				return true
+			}
+			did = strings.TrimPrefix(topic, treeTopicPrefix)
+		case strings.HasPrefix(topic, privateTreeTopicPrefix) && strings.HasSuffix(topic, messageTopicSuffix):
+			did = strings.TrimSuffix(strings.TrimPrefix(topic, privateTreeTopicPrefix), messageTopicSuffix)
+			return id != nil && did != "" && id.Sub == did
+		case strings.HasPrefix(topic, privateTreeTopicPrefix):
+			did = strings.TrimPrefix(topic, privateTreeTopicPrefix)
+		default:
+			return strings.HasPrefix(topic, "public/")
+		}
+		// wildcards would skip the read policy of the trees they match
+		if did == "" || strings.ContainsAny(did, "+#/") {
+			return false
+		}
+		ctx := context.TODO()
+		// an unknown tree has no read policy yet, a subscription would outlive the policy it gets
+		_, err := ba.resolver.Aggregator.GetTip(ctx, did)
+		if err != nil {
+			logger.Debugf("not allowing subscription to %s: %v", did, err)
+			return false
+		}
+		allowed, err := ba.resolver.Aggregator.ReadAllowed(ctx, &policy.ReadInput{
+			Method:   policy.MethodSubscribe,
+			Object:   did,
+			Identity: id,
+		})
+		if err != nil {
+			logger.Errorf("error checking read policy for %s: %v", did, err)
+			return false
+		}
+		return allowed
+	default:
+		return false
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/fhmq/hmq/broker"
+	"github.com/fhmq/hmq/plugins/bridge"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api/publisher"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrokerAuth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resolver, err := api.NewResolver(ctx, &api.Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+	ba, err := newBrokerAuth(resolver, true)
+	require.Nil(t, err)
+
+	reader := "did:tupelo:reader"
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	abr := testhelpers.NewValidTransactionWithPathAndValue(t, treeKey, ".well-known/policies/read", fmt.Sprintf(`
+		package read
+		default allow = false
+
+		allow {
+			input.identity.sub == "%s"
+		}
+	`, reader))
+	_, err = resolver.Aggregator.Add(ctx, &abr)
+	require.Nil(t, err)
+	privateTopic := treeTopicPrefix + string(abr.ObjectId)
+
+	publicAbr := testhelpers.NewValidTransaction(t)
+	_, err = resolver.Aggregator.Add(ctx, &publicAbr)
+	require.Nil(t, err)
+	publicTopic := treeTopicPrefix + string(publicAbr.ObjectId)
+
+	resolver.TokenHandler = TokenHandler(resolver)
+	creds, err := resolver.IdentityToken(context.WithValue(ctx, api.IdentityContextKey, identity.Identity{Iss: reader, Sub: reader}))
+	require.Nil(t, err)
+	require.True(t, creds.Result)
+	assert.Equal(t, reader, creds.Id)
+
+	t.Run("anonymous", func(t *testing.T) {
+		require.True(t, ba.CheckConnect("anon", "", ""))
+		assert.True(t, ba.CheckACL(broker.SUB, "anon", "", "", publicTopic))
+		assert.False(t, ba.CheckACL(broker.SUB, "anon", "", "", privateTopic))
+		assert.False(t, ba.CheckACL(broker.SUB, "anon", "", "", treeTopicPrefix+"#"))
+		// unknown trees have no read policy yet
+		assert.False(t, ba.CheckACL(broker.SUB, "anon", "", "", treeTopicPrefix+"did:tupelo:unknown"))
+		assert.False(t, ba.CheckACL(broker.PUB, "anon", "", "", publicTopic))
+	})
+
+	t.Run("with credentials", func(t *testing.T) {
+		require.True(t, ba.CheckConnect("reader", creds.Id, creds.Token))
+		assert.True(t, ba.CheckACL(broker.SUB, "reader", reader, "", publicTopic))
+		assert.True(t, ba.CheckACL(broker.SUB, "reader", reader, "", privateTopic))
+		assert.False(t, ba.CheckACL(broker.PUB, "reader", reader, "", privateTopic))
+		assert.True(t, ba.CheckACL(broker.PUB, "reader", reader, "", userToUserTopicPrefix+reader))
+		assert.False(t, ba.CheckACL(broker.PUB, "anon", "", "", userToUserTopicPrefix+reader))
+		// only the recipient can subscribe to messages
+		assert.True(t, ba.CheckACL(broker.SUB, "reader", reader, "", publisher.MessageTopic(reader)))
+		assert.False(t, ba.CheckACL(broker.SUB, "reader", reader, "", publisher.MessageTopic("did:tupelo:someoneelse")))
+		assert.False(t, ba.CheckACL(broker.SUB, "anon", "", "", publisher.MessageTopic(reader)))
+	})
+
+	t.Run("private topics", func(t *testing.T) {
+		privateTreeTopic := privateTreeTopicPrefix + string(abr.ObjectId)
+		assert.False(t, ba.CheckACL(broker.SUB, "anon", "", "", privateTreeTopic))
+		assert.True(t, ba.CheckACL(broker.SUB, "reader", reader, "", privateTreeTopic))
+		assert.False(t, ba.CheckACL(broker.SUB, "reader", reader, "", privateTreeTopicPrefix+"#"))
+		// unknown trees can't be subscribed to privately
+		assert.False(t, ba.CheckACL(broker.SUB, "reader", reader, "", privateTreeTopicPrefix+"did:tupelo:unknown"))
+
+		// read policies see the SUBSCRIBE method
+		subscribeOnlyKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		subscribeOnly := testhelpers.NewValidTransactionWithPathAndValue(t, subscribeOnlyKey, ".well-known/policies/read", `
+			package read
+			default allow = false
+
+			allow {
+				input.method == "SUBSCRIBE"
+			}
+		`)
+		_, err = resolver.Aggregator.Add(ctx, &subscribeOnly)
+		require.Nil(t, err)
+		assert.True(t, ba.CheckACL(broker.SUB, "anon", "", "", privateTreeTopicPrefix+string(subscribeOnly.ObjectId)))
+
+		resp, err := resolver.Aggregator.ResolveWithReadControls(ctx, nil, string(subscribeOnly.ObjectId), []string{"tree"})
+		require.Nil(t, err)
+		assert.Nil(t, resp.Value)
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		assert.False(t, ba.CheckConnect("other", "did:tupelo:someoneelse", creds.Token))
+		assert.False(t, ba.CheckConnect("other", reader, "notasession"))
+		assert.False(t, ba.CheckConnect(internalClientID, "", ""))
+		assert.False(t, ba.CheckConnect(internalClientID, internalUsername, "wrong"))
+		// unknown clients have no rights
+		assert.False(t, ba.CheckACL(broker.SUB, "unconnected", "", "", publicTopic))
+	})
+
+	t.Run("disconnected clients are forgotten", func(t *testing.T) {
+		require.True(t, ba.CheckConnect("leaving", creds.Id, creds.Token))
+		require.Nil(t, ba.Publish(&bridge.Elements{ClientID: "leaving", Action: bridge.Connect}))
+		assert.True(t, ba.CheckACL(broker.SUB, "leaving", reader, "", privateTopic))
+		require.Nil(t, ba.Publish(&bridge.Elements{ClientID: "leaving", Action: bridge.Disconnect}))
+		assert.False(t, ba.CheckACL(broker.SUB, "leaving", reader, "", publicTopic))
+		assert.NotContains(t, ba.clients, "leaving")
+		assert.NotContains(t, ba.pending, "leaving")
+
+		// a reconnect closes the existing connection after the new one passed CheckConnect
+		require.True(t, ba.CheckConnect("reconnecting", "", ""))
+		require.Nil(t, ba.Publish(&bridge.Elements{ClientID: "reconnecting", Action: bridge.Connect}))
+		require.True(t, ba.CheckConnect("reconnecting", creds.Id, creds.Token))
+		require.Nil(t, ba.Publish(&bridge.Elements{ClientID: "reconnecting", Action: bridge.Disconnect}))
+		require.Nil(t, ba.Publish(&bridge.Elements{ClientID: "reconnecting", Action: bridge.Connect}))
+		assert.True(t, ba.CheckACL(broker.SUB, "reconnecting", reader, "", privateTopic))
+	})
+
+	t.Run("internal client", func(t *testing.T) {
+		require.True(t, ba.CheckConnect(internalClientID, internalUsername, ba.internalPassword))
+		assert.True(t, ba.CheckACL(broker.PUB, internalClientID, internalUsername, "", privateTopic))
+	})
+}
+
+func TestBrokerAuthPublicTopics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resolver, err := api.NewResolver(ctx, &api.Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+	// without publicTopicACLs anything under public/ can be subscribed to
+	ba, err := newBrokerAuth(resolver, false)
+	require.Nil(t, err)
+
+	require.True(t, ba.CheckConnect("anon", "", ""))
+	assert.True(t, ba.CheckACL(broker.SUB, "anon", "", "", treeTopicPrefix+"#"))
+	assert.True(t, ba.CheckACL(broker.SUB, "anon", "", "", treeTopicPrefix+"did:tupelo:unknown"))
+	// private topics still follow the read policies
+	assert.False(t, ba.CheckACL(broker.SUB, "anon", "", "", privateTreeTopicPrefix+"did:tupelo:unknown"))
+	assert.False(t, ba.CheckACL(broker.SUB, "anon", "", "", privateTreeTopicPrefix+"#"))
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+)
+
+// MaxSubscribeTrees is the most trees subscribeTrees takes at once
+var MaxSubscribeTrees = 100
+
+// SubscriptionHandlerFunc grants requester the subscriptions to the private topics of dids (see publisher.PrivateTopic)
+// and revokes the ones it was granted before for any other tree
+type SubscriptionHandlerFunc func(ctx context.Context, requester *identity.Identity, dids []string) error
+
+type SubscribeTreesInput struct {
+	Input struct {
+		Dids []string
+	}
+}
+
+type SubscribeTreesPayload struct {
+	Dids []string
+}
+
+/*
+SubscribeTrees asks for the updates of the trees to be delivered to the private topics of the requester. It is
+needed where the broker can't evaluate read policies itself (IoT policies on AWS, see SubscriptionHandler), the
+hmq broker of the standalone server checks the read policy of every subscription anyway.
+It returns the trees whose read policy allows the requester to subscribe (policy.MethodSubscribe), these replace
+the trees of any earlier call. Trees that do not exist yet are left out, a subscription would outlive the policy
+they get.
+*/
+func (r *Resolver) SubscribeTrees(ctx context.Context, input SubscribeTreesInput) (*SubscribeTreesPayload, error) {
+	if len(input.Input.Dids) > MaxSubscribeTrees {
+		return nil, &CodedError{Code: ErrCodeBadInput, Err: fmt.Errorf("at most %d trees can be subscribed to", MaxSubscribeTrees)}
+	}
+	requester := RequesterFromCtx(ctx)
+	if requester == nil {
+		if authErr := AuthErrorFromCtx(ctx); authErr != nil {
+			return nil, authErr
+		}
+		return nil, fmt.Errorf("subscribeTrees requires an identity")
+	}
+
+	allowed := []string{}
+	seen := make(map[string]bool, len(input.Input.Dids))
+	for _, did := range input.Input.Dids {
+		if seen[did] {
+			continue
+		}
+		seen[did] = true
+		_, err := r.Aggregator.GetTip(ctx, did)
+		if err != nil {
+			logger.Debugf("not subscribing to %s: %v", did, err)
+			continue
+		}
+		ok, err := r.Aggregator.ReadAllowed(ctx, &policy.ReadInput{
+			Method:   policy.MethodSubscribe,
+			Object:   did,
+			Identity: requester,
+		})
+		if err != nil {
+			return nil, NewCodedError(fmt.Errorf("error checking read policy: %w", err))
+		}
+		if ok {
+			allowed = append(allowed, did)
+		}
+	}
+
+	if r.SubscriptionHandler != nil {
+		err := r.SubscriptionHandler(ctx, requester, allowed)
+		if err != nil {
+			return nil, fmt.Errorf("error subscribing: %w", err)
+		}
+	}
+	return &SubscribeTreesPayload{
+		Dids: allowed,
+	}, nil
+}
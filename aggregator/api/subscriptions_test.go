@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribeTrees(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := NewResolver(ctx, &Config{KeyValueStore: aggregator.NewMemoryStore()})
+	require.Nil(t, err)
+	var granted []string
+	r.SubscriptionHandler = func(_ context.Context, requester *identity.Identity, dids []string) error {
+		assert.Equal(t, "did:tupelo:subscriber", requester.Sub)
+		granted = dids
+		return nil
+	}
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema, err := graphql.ParseSchema(Schema, r, opts...)
+	require.Nil(t, err)
+
+	openKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	openAbr := testhelpers.NewValidTransactionWithPathAndValue(t, openKey, "some/path", "hi")
+	_, err = r.Aggregator.Add(ctx, &openAbr)
+	require.Nil(t, err)
+	openDid := string(openAbr.ObjectId)
+
+	closedKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	closedAbr := testhelpers.NewValidTransactionWithPathAndValue(t, closedKey, ".well-known/policies/read", `
+		package read
+		default allow = true
+		allow = false {
+			input.method == "SUBSCRIBE"
+		}
+	`)
+	_, err = r.Aggregator.Add(ctx, &closedAbr)
+	require.Nil(t, err)
+	closedDid := string(closedAbr.ObjectId)
+
+	query := `mutation subscribeTrees($dids: [String!]!) {
+		subscribeTrees(input: {dids: $dids}) {
+			dids
+		}
+	}`
+	variables := map[string]interface{}{
+		"dids": []interface{}{openDid, closedDid, openDid, "did:tupelo:missing"},
+	}
+
+	t.Run("requires an identity", func(t *testing.T) {
+		schemaResp := schema.Exec(ctx, query, "subscribeTrees", variables)
+		require.Len(t, schemaResp.Errors, 1)
+	})
+
+	t.Run("grants the trees whose read policy allows it", func(t *testing.T) {
+		identCtx := context.WithValue(ctx, IdentityContextKey, identity.Identity{
+			Iss: "did:tupelo:subscriber",
+			Sub: "did:tupelo:subscriber",
+		})
+		schemaResp := schema.Exec(identCtx, query, "subscribeTrees", variables)
+		require.Len(t, schemaResp.Errors, 0)
+
+		resp := &struct {
+			SubscribeTrees struct {
+				Dids []string `json:"dids"`
+			} `json:"subscribeTrees"`
+		}{}
+		require.Nil(t, json.Unmarshal(schemaResp.Data, resp))
+		assert.Equal(t, []string{openDid}, resp.SubscribeTrees.Dids)
+		assert.Equal(t, []string{openDid}, granted)
+	})
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+)
+
+type TreeInput struct {
+	Did string
+}
+
+type TreePayload struct {
+	Did       string
+	Tip       *CID
+	Height    *int32
+	UpdatedAt *int32
+	Owners    *[]string
+}
+
+// Tree returns the metadata of the latest version of a tree without resolving it, see Aggregator.TreeMetadata
+func (r *Resolver) Tree(ctx context.Context, input TreeInput) (*TreePayload, error) {
+	requester := RequesterFromCtx(ctx)
+	logger.Infof("tree %s with requester %v", input.Did, requester)
+
+	meta, err := r.Aggregator.TreeMetadata(ctx, requester, input.Did)
+	if err != nil {
+		logger.Errorf("error getting tree metadata: %v", err)
+		return nil, NewCodedError(fmt.Errorf("error getting tree metadata: %w", err))
+	}
+	return treeToPayload(input.Did, meta), nil
+}
+
+func treeToPayload(did string, meta *aggregator.TreeMetadata) *TreePayload {
+	payload := &TreePayload{Did: did}
+	if meta == nil {
+		return payload
+	}
+	height := int32(meta.Height)
+	payload.Tip = NewCID(meta.Tip)
+	payload.Height = &height
+	payload.Owners = &meta.Owners
+	if !meta.UpdatedAt.IsZero() {
+		updatedAt := int32(meta.UpdatedAt.Unix())
+		payload.UpdatedAt = &updatedAt
+	}
+	return payload
+}
@@ -0,0 +1,374 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/chaintree/typecaster"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+)
+
+var (
+	blamePrefix        = datastore.NewKey("_trees/blame")        // /<did>/<height> -> the blames of the block
+	blameIndexedPrefix = datastore.NewKey("_trees/blameIndexed") // /<did> -> the number of indexed blocks
+)
+
+func init() {
+	cbornode.RegisterCborType(storedBlame{})
+}
+
+// BlameEntry is a transaction that touched a path (see Blame)
+type BlameEntry struct {
+	Height uint64
+	// Block is the block of the chain that had the transaction and Tip is the tip of the tree after it
+	Block cid.Cid
+	Tip   cid.Cid
+	// Signers are the addresses that signed the block
+	Signers     []string
+	Transaction *transactions.Transaction
+	// Path is the path that the transaction changed (starting with "tree")
+	Path []string
+	// Value is the value of the blamed path at Tip (nil when it was not set), links are left as links
+	Value interface{}
+}
+
+// BlameResponse is every transaction that touched a path, the newest first
+type BlameResponse struct {
+	Tip     cid.Cid // undefined when the tree was not found
+	Entries []BlameEntry
+}
+
+// storedBlame is a BlameEntry (without the value) as it is stored in the blame index
+type storedBlame struct {
+	Height      uint64   `refmt:"height"`
+	Block       cid.Cid  `refmt:"block"`
+	Tip         cid.Cid  `refmt:"tip"`
+	Signers     []string `refmt:"signers"`
+	Transaction []byte   `refmt:"transaction"` // protobuf
+	Path        []string `refmt:"path"`
+}
+
+// Blame returns the transactions that touched path (a transaction touches a path when it changes the path,
+// one of its parents or one of its children) from the latest version of objectID back to its genesis.
+// With AggregatorConfig.BlameIndex the transactions come from the index built in Add rather than from
+// walking the chain.
+func (a *Aggregator) Blame(ctx context.Context, objectID string, path []string) (*BlameResponse, error) {
+	return a.blame(ctx, objectID, path, func(path []string) (bool, error) {
+		return true, nil
+	})
+}
+
+// BlameWithReadControls is Blame for the paths the read policies allow, the transactions that changed
+// paths the read policies do not allow are left out.
+func (a *Aggregator) BlameWithReadControls(ctx context.Context, id *identity.Identity, objectID string, path []string) (*BlameResponse, error) {
+	readable, err := a.getReadable(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+	if readable.latest == nil {
+		return &BlameResponse{}, nil
+	}
+	return a.blame(ctx, objectID, path, func(path []string) (bool, error) {
+		return a.evaluateReadPolicies(ctx, readable.readPolicy, &policy.ReadInput{
+			Method:   policy.MethodGet,
+			Object:   objectID,
+			Path:     strings.Join(path, "/"),
+			Identity: id,
+		})
+	})
+}
+
+func (a *Aggregator) blame(ctx context.Context, objectID string, path []string, allowed func(path []string) (bool, error)) (*BlameResponse, error) {
+	tip, err := a.GetTip(ctx, objectID)
+	if err == ErrNotFound {
+		return &BlameResponse{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting tip: %w", err)
+	}
+	isAllowed, err := allowed(path)
+	if err != nil {
+		return nil, err
+	}
+	if !isAllowed {
+		return &BlameResponse{}, nil
+	}
+
+	var stored []*storedBlame
+	indexed, err := a.blameIndexed(objectID)
+	if err != nil {
+		return nil, err
+	}
+	if indexed {
+		stored, err = a.indexedBlames(objectID)
+	} else {
+		stored, err = a.chainBlames(ctx, *tip, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tree := dag.NewDag(ctx, *tip, a.DagStore)
+	resp := &BlameResponse{Tip: *tip}
+	for _, s := range stored {
+		if !pathsOverlap(s.Path, path) {
+			continue
+		}
+		isAllowed, err := allowed(s.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !isAllowed {
+			continue
+		}
+		txn := &transactions.Transaction{}
+		err = txn.Unmarshal(s.Transaction)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding transaction: %w", err)
+		}
+		val, remain, err := tree.WithNewTip(s.Tip).Resolve(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving %s at %s: %w", strings.Join(path, "/"), s.Tip.String(), err)
+		}
+		if len(remain) > 0 {
+			val = nil
+		}
+		resp.Entries = append(resp.Entries, BlameEntry{
+			Height:      s.Height,
+			Block:       s.Block,
+			Tip:         s.Tip,
+			Signers:     s.Signers,
+			Transaction: txn,
+			Path:        s.Path,
+			Value:       val,
+		})
+	}
+	return resp, nil
+}
+
+// chainBlames walks the chain of the tree at tip back to (and including) the block at height until
+func (a *Aggregator) chainBlames(ctx context.Context, tip cid.Cid, until uint64) ([]*storedBlame, error) {
+	tree := dag.NewDag(ctx, tip, a.DagStore)
+	chain := &chaintree.Chain{}
+	err := tree.ResolveInto(ctx, []string{chaintree.ChainLabel}, chain)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving chain: %w", err)
+	}
+
+	var blames []*storedBlame
+	resultingTip := tip
+	blockCid := chain.End
+	for blockCid != nil {
+		node, err := tree.Get(ctx, *blockCid)
+		if err != nil {
+			return nil, fmt.Errorf("error getting block %s: %w", blockCid.String(), err)
+		}
+		block := &chaintree.BlockWithHeaders{}
+		err = cbornode.DecodeInto(node.RawData(), block)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding block %s: %w", blockCid.String(), err)
+		}
+		blockBlames, err := newBlockBlames(*blockCid, resultingTip, block)
+		if err != nil {
+			return nil, err
+		}
+		blames = append(blames, blockBlames...)
+
+		if block.Height <= until || block.PreviousTip == nil {
+			break
+		}
+		resultingTip = *block.PreviousTip
+		blockCid = block.PreviousBlock
+	}
+	return blames, nil
+}
+
+// newBlockBlames returns the blames of the transactions of block, the last transaction first
+func newBlockBlames(blockCid cid.Cid, resultingTip cid.Cid, block *chaintree.BlockWithHeaders) ([]*storedBlame, error) {
+	headers := &consensus.StandardHeaders{}
+	err := typecaster.ToType(block.Headers, headers)
+	if err != nil {
+		return nil, fmt.Errorf("error casting headers: %w", err)
+	}
+	signers := make([]string, 0, len(headers.Signatures))
+	for addr := range headers.Signatures {
+		signers = append(signers, addr)
+	}
+	sort.Strings(signers)
+
+	blames := make([]*storedBlame, 0, len(block.Transactions))
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		txn := block.Transactions[i]
+		bits, err := txn.Marshal()
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling transaction: %w", err)
+		}
+		blames = append(blames, &storedBlame{
+			Height:      block.Height,
+			Block:       blockCid,
+			Tip:         resultingTip,
+			Signers:     signers,
+			Transaction: bits,
+			Path:        transactionPath(txn),
+		})
+	}
+	return blames, nil
+}
+
+// transactionPath is the path (starting with "tree") that the transaction changes
+func transactionPath(txn *transactions.Transaction) []string {
+	switch txn.Type {
+	case transactions.Transaction_SETDATA:
+		path, err := consensus.DecodePath(txn.SetDataPayload.GetPath())
+		if err != nil {
+			// invalid paths are rejected when the block is validated
+			return []string{"tree", consensus.TreePathForData}
+		}
+		return append([]string{"tree", consensus.TreePathForData}, path...)
+	case transactions.Transaction_SETOWNERSHIP:
+		return strings.Split("tree/"+consensus.TreePathForAuthentications, "/")
+	case transactions.Transaction_ESTABLISHTOKEN, transactions.Transaction_MINTTOKEN, transactions.Transaction_SENDTOKEN, transactions.Transaction_RECEIVETOKEN:
+		return strings.Split("tree/"+consensus.TreePathForTokens, "/")
+	case transactions.Transaction_STAKE:
+		return strings.Split("tree/"+consensus.TreePathForStake, "/")
+	default:
+		return []string{"tree"}
+	}
+}
+
+// pathsOverlap is true when one path is the same as (or a parent of) the other
+func pathsOverlap(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// blameKey is the key of the blames of the block at height, which are stored as one list (the last
+// transaction first) so that indexing the chain again puts the same keys
+func blameKey(objectID string, height uint64) datastore.Key {
+	return blamePrefix.ChildString(objectID).ChildString(strconv.FormatUint(height, 10))
+}
+
+// blameCount is the number of blocks of objectID in the blame index (its blocks from the genesis are)
+func (a *Aggregator) blameCount(objectID string) (uint64, error) {
+	bits, err := a.keyValueStore.Get(blameIndexedPrefix.ChildString(objectID))
+	if err == datastore.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error getting blame index: %w", err)
+	}
+	var count uint64
+	err = cbornode.DecodeInto(bits, &count)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding blame index: %w", err)
+	}
+	return count, nil
+}
+
+func (a *Aggregator) blameIndexed(objectID string) (bool, error) {
+	count, err := a.blameCount(objectID)
+	return count > 0, err
+}
+
+// updateBlameIndex indexes the block at height, if that fails the tree is indexed again (from its genesis)
+// with the next block and Blame walks the chain until then
+func (a *Aggregator) updateBlameIndex(ctx context.Context, objectID string, tip cid.Cid, height uint64) {
+	err := a.indexBlames(ctx, objectID, tip, height)
+	if err == nil {
+		return
+	}
+	logger.Errorf("error indexing blames of %s: %v", objectID, err)
+	err = a.keyValueStore.Delete(blameIndexedPrefix.ChildString(objectID))
+	if err != nil && err != datastore.ErrNotFound {
+		logger.Errorf("error deleting blame index of %s: %v", objectID, err)
+	}
+}
+
+// indexBlames adds the blocks of the tree up to tip (the block at height) that are not in the blame index
+// yet to it (see Add), the first time a tree is indexed that is the whole chain.
+func (a *Aggregator) indexBlames(ctx context.Context, objectID string, tip cid.Cid, height uint64) error {
+	count, err := a.blameCount(objectID)
+	if err != nil {
+		return err
+	}
+	until := count
+	if until > height {
+		until = height
+	}
+	blames, err := a.chainBlames(ctx, tip, until)
+	if err != nil {
+		return err
+	}
+
+	batch, err := a.keyValueStore.Batch()
+	if err != nil {
+		return fmt.Errorf("error creating batch: %w", err)
+	}
+	// the blames of a block are next to each other
+	for start := 0; start < len(blames); {
+		end := start + 1
+		for end < len(blames) && blames[end].Height == blames[start].Height {
+			end++
+		}
+		bits, err := cbornode.DumpObject(blames[start:end])
+		if err != nil {
+			return fmt.Errorf("error encoding blames: %w", err)
+		}
+		err = batch.Put(blameKey(objectID, blames[start].Height), bits)
+		if err != nil {
+			return fmt.Errorf("error putting blames: %w", err)
+		}
+		start = end
+	}
+	bits, err := cbornode.DumpObject(height + 1)
+	if err != nil {
+		return fmt.Errorf("error encoding blame index: %w", err)
+	}
+	err = batch.Put(blameIndexedPrefix.ChildString(objectID), bits)
+	if err != nil {
+		return fmt.Errorf("error putting blame index: %w", err)
+	}
+	err = batch.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing blame index: %w", err)
+	}
+	return nil
+}
+
+// indexedBlames returns the blames in the index of objectID, the newest first. The blames of every block
+// are read with a Get rather than a Query, which stores like go-ds-dynamodb implement as a Scan.
+func (a *Aggregator) indexedBlames(objectID string) ([]*storedBlame, error) {
+	count, err := a.blameCount(objectID)
+	if err != nil {
+		return nil, err
+	}
+	var blames []*storedBlame
+	for height := count; height > 0; height-- {
+		bits, err := a.keyValueStore.Get(blameKey(objectID, height-1))
+		if err != nil {
+			return nil, fmt.Errorf("error getting blames of block %d: %w", height-1, err)
+		}
+		var blockBlames []*storedBlame
+		err = cbornode.DecodeInto(bits, &blockBlames)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding blames: %w", err)
+		}
+		blames = append(blames, blockBlames...)
+	}
+	return blames, nil
+}
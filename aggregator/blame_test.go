@@ -0,0 +1,224 @@
+package aggregator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/chaintree/safewrap"
+	"github.com/quorumcontrol/messages/v2/build/go/services"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/testhelpers"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nextABR signs a block with txs on top of tree (which is updated) and returns its ABR
+func nextABR(t testing.TB, tree *chaintree.ChainTree, treeKey *ecdsa.PrivateKey, txs ...*transactions.Transaction) services.AddBlockRequest {
+	ctx := context.TODO()
+	sw := safewrap.SafeWrap{}
+
+	previousTip := tree.Dag.Tip
+	root := &chaintree.RootNode{}
+	require.Nil(t, tree.Dag.ResolveInto(ctx, []string{}, root))
+	chain := &chaintree.Chain{}
+	require.Nil(t, tree.Dag.ResolveInto(ctx, []string{chaintree.ChainLabel}, chain))
+	state := testhelpers.DagToByteNodes(t, tree.Dag)
+
+	unsignedBlock := &chaintree.BlockWithHeaders{
+		Block: chaintree.Block{
+			Height:       0,
+			Transactions: txs,
+		},
+	}
+	if chain.End != nil {
+		unsignedBlock.PreviousTip = &previousTip
+		unsignedBlock.Height = root.Height + 1
+	}
+	block, err := consensus.SignBlock(ctx, unsignedBlock, treeKey)
+	require.Nil(t, err)
+	_, err = tree.ProcessBlock(ctx, block)
+	require.Nil(t, err)
+
+	bits := sw.WrapObject(block).RawData()
+	require.Nil(t, sw.Err)
+
+	return services.AddBlockRequest{
+		PreviousTip: previousTip.Bytes(),
+		Height:      block.Height,
+		NewTip:      tree.Dag.Tip.Bytes(),
+		Payload:     bits,
+		State:       state,
+		ObjectId:    []byte(root.Id),
+	}
+}
+
+func TestBlame(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, indexed := range []bool{false, true} {
+		agg, err := NewAggregator(ctx, &AggregatorConfig{KeyValueStore: NewMemoryStore(), Group: types.NewNotaryGroup("testnotary"), BlameIndex: indexed})
+		require.Nil(t, err)
+
+		treeKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		did := consensus.EcdsaPubkeyToDid(treeKey.PublicKey)
+		signer := crypto.PubkeyToAddress(treeKey.PublicKey).String()
+		tree, err := chaintree.NewChainTree(ctx, consensus.NewEmptyTree(ctx, did, nodestore.MustMemoryStore(ctx)), nil, consensus.DefaultTransactors)
+		require.Nil(t, err)
+
+		add := func(t *testing.T, txs ...*transactions.Transaction) {
+			abr := nextABR(t, tree, treeKey, txs...)
+			_, err := agg.Add(ctx, &abr)
+			require.Nil(t, err)
+		}
+		setData := func(t *testing.T, path string, value interface{}) *transactions.Transaction {
+			txn, err := chaintree.NewSetDataTransaction(path, value)
+			require.Nil(t, err)
+			return txn
+		}
+
+		add(t, setData(t, "a/b", "first"), setData(t, "other", "x"))
+		first := tree.Dag.Tip
+		add(t, setData(t, "other", "y"))
+		add(t, setData(t, "a", map[string]interface{}{"b": "second"}))
+		third := tree.Dag.Tip
+
+		name := "walking the chain"
+		if indexed {
+			name = "with the index"
+		}
+		t.Run(name, func(t *testing.T) {
+			hasIndex, err := agg.blameIndexed(did)
+			require.Nil(t, err)
+			assert.Equal(t, indexed, hasIndex)
+
+			resp, err := agg.Blame(ctx, did, []string{"tree", "data", "a", "b"})
+			require.Nil(t, err)
+			assert.True(t, resp.Tip.Equals(third))
+			require.Len(t, resp.Entries, 2)
+
+			assert.Equal(t, uint64(2), resp.Entries[0].Height)
+			assert.True(t, resp.Entries[0].Tip.Equals(third))
+			assert.Equal(t, []string{"tree", "data", "a"}, resp.Entries[0].Path)
+			assert.Equal(t, "second", resp.Entries[0].Value)
+			assert.Equal(t, []string{signer}, resp.Entries[0].Signers)
+			assert.Equal(t, transactions.Transaction_SETDATA, resp.Entries[0].Transaction.Type)
+
+			assert.Equal(t, uint64(0), resp.Entries[1].Height)
+			assert.True(t, resp.Entries[1].Tip.Equals(first))
+			assert.Equal(t, []string{"tree", "data", "a", "b"}, resp.Entries[1].Path)
+			assert.Equal(t, "first", resp.Entries[1].Value)
+			assert.True(t, resp.Entries[1].Block.Defined())
+
+			// children of the path are blamed as well
+			resp, err = agg.Blame(ctx, did, []string{"tree", "data"})
+			require.Nil(t, err)
+			assert.Len(t, resp.Entries, 4)
+		})
+	}
+
+	t.Run("unknown trees", func(t *testing.T) {
+		agg, err := NewAggregator(ctx, &AggregatorConfig{KeyValueStore: NewMemoryStore(), Group: types.NewNotaryGroup("testnotary")})
+		require.Nil(t, err)
+		resp, err := agg.Blame(ctx, "did:tupelo:unknown", []string{"tree"})
+		require.Nil(t, err)
+		assert.Len(t, resp.Entries, 0)
+		assert.False(t, resp.Tip.Defined())
+	})
+}
+
+func TestBlameReindex(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	agg, err := NewAggregator(ctx, &AggregatorConfig{KeyValueStore: NewMemoryStore(), Group: types.NewNotaryGroup("testnotary"), BlameIndex: true})
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	did := consensus.EcdsaPubkeyToDid(treeKey.PublicKey)
+	tree, err := chaintree.NewChainTree(ctx, consensus.NewEmptyTree(ctx, did, nodestore.MustMemoryStore(ctx)), nil, consensus.DefaultTransactors)
+	require.Nil(t, err)
+
+	add := func(t *testing.T, path string, value interface{}) {
+		txn, err := chaintree.NewSetDataTransaction(path, value)
+		require.Nil(t, err)
+		abr := nextABR(t, tree, treeKey, txn)
+		_, err = agg.Add(ctx, &abr)
+		require.Nil(t, err)
+	}
+	heights := func(t *testing.T) []uint64 {
+		resp, err := agg.Blame(ctx, did, []string{"tree", "data"})
+		require.Nil(t, err)
+		var heights []uint64
+		for _, entry := range resp.Entries {
+			heights = append(heights, entry.Height)
+		}
+		return heights
+	}
+
+	add(t, "a", 1)
+	add(t, "a", 2)
+	add(t, "a", 3)
+	assert.Equal(t, []uint64{2, 1, 0}, heights(t))
+
+	// for instance after indexing a block failed, the next Add indexes the whole chain again
+	require.Nil(t, agg.keyValueStore.Delete(blameIndexedPrefix.ChildString(did)))
+	add(t, "a", 4)
+	hasIndex, err := agg.blameIndexed(did)
+	require.Nil(t, err)
+	assert.True(t, hasIndex)
+	assert.Equal(t, []uint64{3, 2, 1, 0}, heights(t))
+}
+
+func TestBlameWithReadControls(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	agg, err := NewAggregator(ctx, &AggregatorConfig{KeyValueStore: NewMemoryStore(), Group: types.NewNotaryGroup("testnotary"), BlameIndex: true})
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	var txs []*transactions.Transaction
+	for path, value := range map[string]interface{}{
+		"public":   "hi",
+		"secret/s": "hidden",
+		".well-known/policies": map[string]string{
+			"read": `
+				package read
+				default allow = true
+
+				allow = false {
+					startswith(input.path, "tree/data/secret")
+				}
+			`,
+		},
+	} {
+		txn, err := chaintree.NewSetDataTransaction(path, value)
+		require.Nil(t, err)
+		txs = append(txs, txn)
+	}
+	abr := NewValidTransactionWithTransactions(t, treeKey, txs...)
+	_, err = agg.Add(ctx, &abr)
+	require.Nil(t, err)
+	did := string(abr.ObjectId)
+
+	resp, err := agg.BlameWithReadControls(ctx, nil, did, []string{"tree", "data"})
+	require.Nil(t, err)
+	require.Len(t, resp.Entries, 2)
+	for _, entry := range resp.Entries {
+		assert.NotEqual(t, "secret", entry.Path[2])
+	}
+
+	resp, err = agg.BlameWithReadControls(ctx, nil, did, []string{"tree", "data", "secret", "s"})
+	require.Nil(t, err)
+	assert.Len(t, resp.Entries, 0)
+}
@@ -0,0 +1,133 @@
+// Package car reads and writes CAR v1 files (https://github.com/ipld/specs/blob/master/block-layer/content-addressable-archives.md)
+// of dag-cbor blocks, which is what chaintrees are made of.
+package car
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/quorumcontrol/chaintree/safewrap"
+)
+
+func init() {
+	cbornode.RegisterCborType(header{})
+}
+
+// MaxSectionSize limits the size of a single block (or the header) when reading
+var MaxSectionSize uint64 = 4 << 20
+
+type header struct {
+	Roots   []cid.Cid `refmt:"roots"`
+	Version uint64    `refmt:"version"`
+}
+
+// Write writes a CAR v1 of the nodes to w
+func Write(w io.Writer, roots []cid.Cid, nodes []format.Node) error {
+	sw := &safewrap.SafeWrap{}
+	h := sw.WrapObject(&header{Roots: roots, Version: 1})
+	if sw.Err != nil {
+		return fmt.Errorf("error wrapping header: %w", sw.Err)
+	}
+	err := writeSection(w, h.RawData())
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		err = writeSection(w, n.Cid().Bytes(), n.RawData())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSection(w io.Writer, parts ...[]byte) error {
+	var length int
+	for _, p := range parts {
+		length += len(p)
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(length))
+	_, err := w.Write(buf[:n])
+	if err != nil {
+		return fmt.Errorf("error writing: %w", err)
+	}
+	for _, p := range parts {
+		_, err = w.Write(p)
+		if err != nil {
+			return fmt.Errorf("error writing: %w", err)
+		}
+	}
+	return nil
+}
+
+// Read reads a CAR v1, every block is checked against its CID
+func Read(r io.Reader) ([]cid.Cid, []format.Node, error) {
+	br := bufio.NewReader(r)
+
+	headerBits, err := readSection(br)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading header: %w", err)
+	}
+	h := &header{}
+	err = cbornode.DecodeInto(headerBits, h)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding header: %w", err)
+	}
+	if h.Version != 1 {
+		return nil, nil, fmt.Errorf("unsupported version %d", h.Version)
+	}
+
+	sw := &safewrap.SafeWrap{}
+	var nodes []format.Node
+	for {
+		section, err := readSection(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading block: %w", err)
+		}
+		n, id, err := cid.CidFromBytes(section)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decoding cid: %w", err)
+		}
+		node := sw.Decode(section[n:])
+		if sw.Err != nil {
+			return nil, nil, fmt.Errorf("error decoding block %s: %w", id.String(), sw.Err)
+		}
+		if !node.Cid().Equals(id) {
+			return nil, nil, fmt.Errorf("block does not match cid %s", id.String())
+		}
+		nodes = append(nodes, node)
+	}
+	return h.Roots, nodes, nil
+}
+
+// readSection returns io.EOF only when there are no more sections
+func readSection(br *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	if length > MaxSectionSize {
+		return nil, fmt.Errorf("section of %d bytes is too large", length)
+	}
+	bits := make([]byte, length)
+	_, err = io.ReadFull(br, bits)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return bits, nil
+}
@@ -0,0 +1,53 @@
+package car
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/quorumcontrol/chaintree/safewrap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	sw := &safewrap.SafeWrap{}
+	child := sw.WrapObject(map[string]interface{}{"hello": "world"})
+	root := sw.WrapObject(map[string]interface{}{"child": child.Cid()})
+	require.Nil(t, sw.Err)
+
+	buf := &bytes.Buffer{}
+	err := Write(buf, []cid.Cid{root.Cid()}, []format.Node{root, child})
+	require.Nil(t, err)
+
+	roots, nodes, err := Read(bytes.NewReader(buf.Bytes()))
+	require.Nil(t, err)
+	require.Len(t, roots, 1)
+	assert.True(t, roots[0].Equals(root.Cid()))
+	require.Len(t, nodes, 2)
+	assert.True(t, nodes[0].Cid().Equals(root.Cid()))
+	assert.Equal(t, child.RawData(), nodes[1].RawData())
+
+	t.Run("empty", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.Nil(t, Write(buf, nil, nil))
+		roots, nodes, err := Read(buf)
+		require.Nil(t, err)
+		assert.Len(t, roots, 0)
+		assert.Len(t, nodes, 0)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, _, err := Read(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+		require.NotNil(t, err)
+	})
+
+	t.Run("mismatched cid", func(t *testing.T) {
+		bad := &bytes.Buffer{}
+		require.Nil(t, Write(bad, nil, nil))
+		require.Nil(t, writeSection(bad, root.Cid().Bytes(), child.RawData()))
+		_, _, err := Read(bad)
+		require.NotNil(t, err)
+	})
+}
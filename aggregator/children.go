@@ -0,0 +1,178 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+)
+
+// The types of a Child
+const (
+	ChildTypeMap    = "map"
+	ChildTypeList   = "list"
+	ChildTypeLink   = "link"
+	ChildTypeString = "string"
+	ChildTypeInt    = "int"
+	ChildTypeFloat  = "float"
+	ChildTypeBool   = "bool"
+	ChildTypeBytes  = "bytes"
+	ChildTypeNull   = "null"
+)
+
+// Child is a key under a path, Link is only defined for ChildTypeLink
+type Child struct {
+	Key  string
+	Type string
+	Link cid.Cid
+}
+
+// ChildrenResponse is a page of the children of a path
+type ChildrenResponse struct {
+	Tip      cid.Cid // undefined when the tree was not found
+	Children []Child
+	HasMore  bool
+}
+
+// Children lists (at most first of) the keys under path that come after the key after (empty for the start).
+// Map keys are sorted and list keys are the indexes. Nothing is listed when the read policies do not allow path,
+// children they do not allow (for the path of the child) are skipped, the values are not returned so large maps
+// can be listed cheaply.
+func (a *Aggregator) Children(ctx context.Context, id *identity.Identity, objectID string, path []string, first int, after string) (*ChildrenResponse, error) {
+	readable, err := a.getReadable(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+	if readable.latest == nil {
+		return &ChildrenResponse{}, nil
+	}
+	// like a Resolve of path, a path the read policies do not allow is not found
+	allowed, err := a.evaluateReadPolicies(ctx, readable.readPolicy, &policy.ReadInput{
+		Method:   policy.MethodGet,
+		Object:   objectID,
+		Path:     strings.Join(path, "/"),
+		Identity: id,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return &ChildrenResponse{}, nil
+	}
+
+	val, remain, err := readable.latest.Dag.Resolve(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving: %w", err)
+	}
+	if len(remain) > 0 {
+		return &ChildrenResponse{}, nil
+	}
+
+	keys, values, err := childKeys(val, after)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ChildrenResponse{Tip: readable.latest.Dag.Tip}
+	for i, key := range keys {
+		allowed, err := a.evaluateReadPolicies(ctx, readable.readPolicy, &policy.ReadInput{
+			Method:   policy.MethodGet,
+			Object:   objectID,
+			Path:     strings.Join(append(append([]string{}, path...), key), "/"),
+			Identity: id,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
+		if len(resp.Children) == first {
+			resp.HasMore = true
+			break
+		}
+		resp.Children = append(resp.Children, newChild(key, values[i]))
+	}
+	return resp, nil
+}
+
+// childKeys returns the keys (and their values) of val that come after the key after
+func childKeys(val interface{}, after string) ([]string, []interface{}, error) {
+	switch val := val.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		start := 0
+		if after != "" {
+			start = sort.SearchStrings(keys, after)
+			if start < len(keys) && keys[start] == after {
+				start++
+			}
+		}
+		keys = keys[start:]
+		values := make([]interface{}, len(keys))
+		for i, k := range keys {
+			values[i] = val[k]
+		}
+		return keys, values, nil
+	case []interface{}:
+		start := 0
+		if after != "" {
+			idx, err := strconv.Atoi(after)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid list key %s: %w", after, err)
+			}
+			start = idx + 1
+		}
+		if start < 0 {
+			start = 0
+		}
+		if start > len(val) {
+			start = len(val)
+		}
+		keys := make([]string, 0, len(val)-start)
+		for i := start; i < len(val); i++ {
+			keys = append(keys, strconv.Itoa(i))
+		}
+		return keys, val[start:], nil
+	default:
+		// simple values have no children
+		return nil, nil, nil
+	}
+}
+
+func newChild(key string, val interface{}) Child {
+	child := Child{Key: key}
+	switch val := val.(type) {
+	case cid.Cid:
+		child.Type = ChildTypeLink
+		child.Link = val
+	case map[string]interface{}:
+		child.Type = ChildTypeMap
+	case []interface{}:
+		child.Type = ChildTypeList
+	case string:
+		child.Type = ChildTypeString
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		child.Type = ChildTypeInt
+	case float32, float64:
+		child.Type = ChildTypeFloat
+	case bool:
+		child.Type = ChildTypeBool
+	case []byte:
+		child.Type = ChildTypeBytes
+	case nil:
+		child.Type = ChildTypeNull
+	default:
+		child.Type = fmt.Sprintf("%T", val)
+	}
+	return child
+}
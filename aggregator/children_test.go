@@ -0,0 +1,142 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChildren(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	agg, err := NewAggregator(ctx, &AggregatorConfig{KeyValueStore: NewMemoryStore(), Group: types.NewNotaryGroup("testnotary")})
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	abr := NewValidTransactionWithPathAndValue(t, treeKey, "things", map[string]interface{}{
+		"b":    1,
+		"a":    "hi",
+		"c":    map[string]interface{}{"d": true},
+		"list": []interface{}{"one", "two", "three"},
+		"e":    nil,
+	})
+	_, err = agg.Add(ctx, &abr)
+	require.Nil(t, err)
+	did := string(abr.ObjectId)
+	thingsPath := []string{"tree", "data", "things"}
+
+	keysOf := func(children []Child) []string {
+		keys := make([]string, len(children))
+		for i, c := range children {
+			keys[i] = c.Key
+		}
+		return keys
+	}
+
+	t.Run("pages through sorted keys", func(t *testing.T) {
+		resp, err := agg.Children(ctx, nil, did, thingsPath, 2, "")
+		require.Nil(t, err)
+		assert.True(t, resp.Tip.Defined())
+		assert.Equal(t, []string{"a", "b"}, keysOf(resp.Children))
+		assert.Equal(t, ChildTypeString, resp.Children[0].Type)
+		assert.Equal(t, ChildTypeInt, resp.Children[1].Type)
+		assert.True(t, resp.HasMore)
+
+		resp, err = agg.Children(ctx, nil, did, thingsPath, 2, "b")
+		require.Nil(t, err)
+		assert.Equal(t, []string{"c", "e"}, keysOf(resp.Children))
+		assert.Equal(t, ChildTypeMap, resp.Children[0].Type)
+		assert.Equal(t, ChildTypeNull, resp.Children[1].Type)
+		assert.True(t, resp.HasMore)
+
+		resp, err = agg.Children(ctx, nil, did, thingsPath, 2, "e")
+		require.Nil(t, err)
+		assert.Equal(t, []string{"list"}, keysOf(resp.Children))
+		assert.Equal(t, ChildTypeList, resp.Children[0].Type)
+		assert.False(t, resp.HasMore)
+	})
+
+	t.Run("lists", func(t *testing.T) {
+		resp, err := agg.Children(ctx, nil, did, append(thingsPath, "list"), 10, "0")
+		require.Nil(t, err)
+		assert.Equal(t, []string{"1", "2"}, keysOf(resp.Children))
+		assert.False(t, resp.HasMore)
+	})
+
+	t.Run("links", func(t *testing.T) {
+		resp, err := agg.Children(ctx, nil, did, []string{"tree"}, 10, "")
+		require.Nil(t, err)
+		require.Contains(t, keysOf(resp.Children), "data")
+		for _, c := range resp.Children {
+			if c.Key == "data" {
+				assert.Equal(t, ChildTypeLink, c.Type)
+				assert.True(t, c.Link.Defined())
+			}
+		}
+	})
+
+	t.Run("missing paths and trees", func(t *testing.T) {
+		resp, err := agg.Children(ctx, nil, did, []string{"tree", "data", "nope"}, 10, "")
+		require.Nil(t, err)
+		assert.Len(t, resp.Children, 0)
+
+		resp, err = agg.Children(ctx, nil, "did:tupelo:unknown", thingsPath, 10, "")
+		require.Nil(t, err)
+		assert.Len(t, resp.Children, 0)
+		assert.False(t, resp.Tip.Defined())
+	})
+
+	t.Run("applies read policies per child", func(t *testing.T) {
+		treeKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		abr := NewValidTransactionWithPathAndValue(t, treeKey, ".well-known/policies", map[string]string{
+			"read": `
+				package read
+				default allow = true
+
+				allow = false {
+					input.path == "tree/data/.well-known/policies/secret"
+				}
+			`,
+			"secret": `
+				package secret
+				value = 1
+			`,
+		})
+		_, err = agg.Add(ctx, &abr)
+		require.Nil(t, err)
+
+		resp, err := agg.Children(ctx, nil, string(abr.ObjectId), []string{"tree", "data", ".well-known", "policies"}, 10, "")
+		require.Nil(t, err)
+		assert.Equal(t, []string{"read"}, keysOf(resp.Children))
+	})
+
+	t.Run("applies read policies to the path", func(t *testing.T) {
+		treeKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		// only the path itself is denied, not its children
+		abr := NewValidTransactionWithPathAndValue(t, treeKey, ".well-known/policies", map[string]string{
+			"read": `
+				package read
+				default allow = true
+
+				allow = false {
+					input.path == "tree/data/.well-known/policies"
+				}
+			`,
+		})
+		_, err = agg.Add(ctx, &abr)
+		require.Nil(t, err)
+
+		resp, err := agg.Children(ctx, nil, string(abr.ObjectId), []string{"tree", "data", ".well-known", "policies"}, 10, "")
+		require.Nil(t, err)
+		assert.Len(t, resp.Children, 0)
+		assert.False(t, resp.Tip.Defined())
+	})
+}
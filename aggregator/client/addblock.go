@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/quorumcontrol/messages/v2/build/go/services"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/abrbuilder"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+)
+
+// NewTree creates a new (genesis) tree owned by key in the local store
+func (c *Client) NewTree(ctx context.Context, key *ecdsa.PrivateKey) (*consensus.SignedChainTree, error) {
+	return consensus.NewSignedChainTree(ctx, key.PublicKey, c.store)
+}
+
+// AddBlockResponse is the response of the addBlock mutation
+type AddBlockResponse struct {
+	Valid     bool
+	NewTip    cid.Cid
+	NewBlocks []format.Node
+	// ErrorCode says why a block is not valid (one of the api.ErrCode constants)
+	ErrorCode string
+	// CurrentTip is the tip of the tree on the aggregator when the ErrorCode is api.ErrCodeTipConflict
+	CurrentTip cid.Cid
+}
+
+const addBlockMutation = `mutation addBlock($addBlockRequest: String!) {
+	addBlock(input: {addBlockRequest: $addBlockRequest}) {
+		valid
+		newTip
+		newBlocks {
+			data
+		}
+		errorCode
+		currentTip
+	}
+}`
+
+// AddBlock submits the AddBlockRequest, the new blocks of a valid response are added to the local store
+func (c *Client) AddBlock(ctx context.Context, abr *services.AddBlockRequest) (*AddBlockResponse, error) {
+	if c.blocksEndpoint != "" {
+		return c.addBlockBinary(ctx, abr)
+	}
+
+	bits, err := abr.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling: %w", err)
+	}
+
+	resp := &struct {
+		AddBlock *struct {
+			Valid      bool    `json:"valid"`
+			NewTip     string  `json:"newTip"`
+			NewBlocks  []Block `json:"newBlocks"`
+			ErrorCode  string  `json:"errorCode"`
+			CurrentTip string  `json:"currentTip"`
+		} `json:"addBlock"`
+	}{}
+	err = c.query(ctx, addBlockMutation, map[string]interface{}{
+		"addBlockRequest": base64.StdEncoding.EncodeToString(bits),
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.AddBlock == nil {
+		return nil, fmt.Errorf("missing addBlock response")
+	}
+	if !resp.AddBlock.Valid {
+		invalid := &AddBlockResponse{Valid: false, NewTip: cid.Undef, ErrorCode: resp.AddBlock.ErrorCode}
+		if resp.AddBlock.CurrentTip != "" {
+			invalid.CurrentTip, err = castTip(resp.AddBlock.CurrentTip)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return invalid, nil
+	}
+
+	newTip, err := castTip(resp.AddBlock.NewTip)
+	if err != nil {
+		return nil, err
+	}
+	newBlocks, err := blocksToNodes(resp.AddBlock.NewBlocks)
+	if err != nil {
+		return nil, err
+	}
+	err = c.store.AddMany(ctx, newBlocks)
+	if err != nil {
+		return nil, fmt.Errorf("error storing new blocks: %w", err)
+	}
+
+	return &AddBlockResponse{
+		Valid:     true,
+		NewTip:    newTip,
+		NewBlocks: newBlocks,
+	}, nil
+}
+
+// PlayTransactions builds, signs and submits a block of transactions and then moves tree to the new tip.
+// The tree must be backed by the client's Store. A block the aggregator rejects returns an error.
+func (c *Client) PlayTransactions(ctx context.Context, tree *consensus.SignedChainTree, treeKey *ecdsa.PrivateKey, txs []*transactions.Transaction) (*AddBlockResponse, error) {
+	abr, err := abrbuilder.NewAddBlockRequest(ctx, tree.ChainTree, treeKey, txs)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.AddBlock(ctx, abr)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Valid {
+		return resp, fmt.Errorf("invalid block for %s (%s)", string(abr.ObjectId), resp.ErrorCode)
+	}
+	logger.Debugf("%s updated to %s", string(abr.ObjectId), resp.NewTip.String())
+	err = abrbuilder.ApplyResponse(ctx, tree.ChainTree, &aggregator.AddResponse{
+		IsValid:  resp.Valid,
+		NewTip:   resp.NewTip,
+		NewNodes: resp.NewBlocks,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
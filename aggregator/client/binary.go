@@ -0,0 +1,131 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/messages/v2/build/go/services"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/car"
+)
+
+// doBinary makes a request to the binary endpoints (see api.Resolver.BinaryHandler) asking for a CAR
+func (c *Client) doBinary(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Accept", api.ContentTypeCAR)
+	err := c.setIdentityHeader(req.Header)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting %s: %w", req.URL.Path, err)
+	}
+	return resp, nil
+}
+
+func statusError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+func (c *Client) addBlockBinary(ctx context.Context, abr *services.AddBlockRequest) (*AddBlockResponse, error) {
+	bits, err := abr.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.blocksEndpoint+"/addBlock", bytes.NewReader(bits))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", api.ContentTypeProtobuf)
+
+	resp, err := c.doBinary(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		return &AddBlockResponse{Valid: false, ErrorCode: api.ErrCodeTipConflict}, nil
+	case http.StatusUnprocessableEntity:
+		return &AddBlockResponse{Valid: false}, nil
+	default:
+		return nil, statusError(resp)
+	}
+
+	roots, newBlocks, err := car.Read(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	if len(roots) != 1 {
+		return nil, fmt.Errorf("expected 1 root, got %d", len(roots))
+	}
+	err = c.store.AddMany(ctx, newBlocks)
+	if err != nil {
+		return nil, fmt.Errorf("error storing new blocks: %w", err)
+	}
+	return &AddBlockResponse{
+		Valid:     true,
+		NewTip:    roots[0],
+		NewBlocks: newBlocks,
+	}, nil
+}
+
+// resolveBinary fetches the touched blocks and then resolves the value from the local store
+func (c *Client) resolveBinary(ctx context.Context, did string, path string) (*ResolveResponse, error) {
+	query := url.Values{"did": {did}, "path": {path}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.blocksEndpoint+"/resolve?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := c.doBinary(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	splitPath := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return &ResolveResponse{RemainingPath: splitPath}, nil
+	default:
+		return nil, statusError(resp)
+	}
+
+	roots, touched, err := car.Read(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	if len(roots) != 1 {
+		return nil, fmt.Errorf("expected 1 root, got %d", len(roots))
+	}
+	err = c.store.AddMany(ctx, touched)
+	if err != nil {
+		return nil, fmt.Errorf("error storing touched blocks: %w", err)
+	}
+
+	val, remaining, err := dag.NewDag(ctx, roots[0], c.store).Resolve(ctx, splitPath)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving locally: %w", err)
+	}
+	if remainingHeader := resp.Header.Get(api.RemainingPathHeader); remainingHeader != strings.Join(remaining, "/") {
+		return nil, fmt.Errorf("remaining path %v does not match the aggregator's %s", remaining, remainingHeader)
+	}
+
+	return &ResolveResponse{
+		Tip:           roots[0],
+		RemainingPath: remaining,
+		Value:         val,
+		TouchedBlocks: touched,
+	}, nil
+}
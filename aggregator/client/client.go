@@ -0,0 +1,215 @@
+// Package client is a Go client for the tupelo-lite aggregator API, it mirrors the TypeScript Client and Community.
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/chaintree/safewrap"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+)
+
+var logger = logging.Logger("client")
+
+// IdentityDuration is how long the signed identity sent with each request is valid for
+var IdentityDuration = 30 * time.Second
+
+// Config configures a Client
+type Config struct {
+	// Endpoint is the URL of the GraphQL API, for instance http://localhost:9011/graphql
+	Endpoint string
+	// BlocksEndpoint is the URL of the binary endpoints (optional), for instance http://localhost:9011/blocks.
+	// When it is set blocks are moved as CARs instead of base64 in GraphQL (see api.Resolver.BinaryHandler).
+	BlocksEndpoint string
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+	// Store keeps the blocks of added and resolved trees, defaults to a memory store
+	Store nodestore.DagStore
+
+	// Broker is the MQTT broker used by Subscribe (optional), for instance tcp://localhost:1883
+	Broker string
+	// PrivateTopics subscribes to the private topics of trees (see publisher.WithPrivateTopics)
+	PrivateTopics bool
+}
+
+type Client struct {
+	endpoint       string
+	blocksEndpoint string
+	httpClient     *http.Client
+	store          nodestore.DagStore
+	broker         string
+	privateTopics  bool
+
+	lock    sync.RWMutex
+	did     string
+	signers []identity.Signer
+
+	mqttLock sync.Mutex
+	mqtt     mqtt.Client
+}
+
+func New(ctx context.Context, config *Config) (*Client, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("missing endpoint")
+	}
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	store := config.Store
+	if store == nil {
+		var err error
+		store, err = nodestore.MemoryStore(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error creating store: %w", err)
+		}
+	}
+	return &Client{
+		endpoint:       config.Endpoint,
+		blocksEndpoint: strings.TrimSuffix(config.BlocksEndpoint, "/"),
+		httpClient:     httpClient,
+		store:          store,
+		broker:         config.Broker,
+		privateTopics:  config.PrivateTopics,
+	}, nil
+}
+
+// Store is the local store of blocks
+func (c *Client) Store() nodestore.DagStore {
+	return c.store
+}
+
+// Identify signs every following request as did (with enough of the owners of did to meet its threshold).
+// Calling it without signers sends requests anonymously again.
+func (c *Client) Identify(did string, signers ...identity.Signer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.did = did
+	c.signers = signers
+}
+
+// identityHeader returns the signed identity for the X-Tupelo-Id header (empty when anonymous)
+func (c *Client) identityHeader() (string, error) {
+	c.lock.RLock()
+	did, signers := c.did, c.signers
+	c.lock.RUnlock()
+
+	if len(signers) == 0 {
+		return "", nil
+	}
+
+	now := time.Now().UTC()
+	id := &identity.Identity{
+		Iss: did,
+		Sub: did,
+		Iat: now.Unix(),
+		Exp: now.Add(IdentityDuration).Unix(),
+	}
+
+	signed := make([]*identity.IdentityWithSignature, len(signers))
+	for i, signer := range signers {
+		is, err := id.SignWith(signer)
+		if err != nil {
+			return "", fmt.Errorf("error signing identity: %w", err)
+		}
+		signed[i] = is
+	}
+	if len(signed) == 1 {
+		return signed[0].String(), nil
+	}
+	combined, err := identity.CombineSignatures(signed...)
+	if err != nil {
+		return "", fmt.Errorf("error combining signatures: %w", err)
+	}
+	return combined.String(), nil
+}
+
+func (c *Client) setIdentityHeader(header http.Header) error {
+	id, err := c.identityHeader()
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		header.Set(identity.IdentityHeaderField, id)
+	}
+	return nil
+}
+
+// Close disconnects from the MQTT broker (if connected)
+func (c *Client) Close() {
+	c.mqttLock.Lock()
+	defer c.mqttLock.Unlock()
+	if c.mqtt != nil {
+		c.mqtt.Disconnect(250)
+		c.mqtt = nil
+	}
+}
+
+// Block is a block as returned by the API
+type Block struct {
+	Data string `json:"data"` // base64
+}
+
+func blocksToNodes(blocks []Block) ([]format.Node, error) {
+	sw := &safewrap.SafeWrap{}
+	nodes := make([]format.Node, len(blocks))
+	for i, blk := range blocks {
+		bits, err := base64.StdEncoding.DecodeString(blk.Data)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding block: %w", err)
+		}
+		nodes[i] = sw.Decode(bits)
+	}
+	if sw.Err != nil {
+		return nil, fmt.Errorf("error decoding block: %w", sw.Err)
+	}
+	return nodes, nil
+}
+
+// IdentityToken is the response of the identityToken query
+type IdentityToken struct {
+	Result bool   `json:"result"`
+	Token  string `json:"token"`
+	Id     string `json:"id"`
+}
+
+const identityTokenQuery = `query {
+	identityToken {
+		result
+		token
+		id
+	}
+}`
+
+// IdentityToken returns credentials for the message queue for the identified requester (see Identify)
+func (c *Client) IdentityToken(ctx context.Context) (*IdentityToken, error) {
+	resp := &struct {
+		IdentityToken *IdentityToken `json:"identityToken"`
+	}{}
+	err := c.query(ctx, identityTokenQuery, nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.IdentityToken == nil {
+		return nil, fmt.Errorf("missing identity token")
+	}
+	return resp.IdentityToken, nil
+}
+
+func castTip(tip string) (cid.Cid, error) {
+	id, err := cid.Decode(tip)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("error decoding tip %s: %w", tip, err)
+	}
+	return id, nil
+}
@@ -0,0 +1,327 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/fhmq/hmq/broker"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api/publisher"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testServer struct {
+	resolver       *api.Resolver
+	endpoint       string
+	blocksEndpoint string
+	broker         string
+}
+
+func freePort(t testing.TB) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	return fmt.Sprintf("%d", l.Addr().(*net.TCPAddr).Port)
+}
+
+// newTestServer starts the API (the same way api/server does, but on an httptest server) and an MQTT broker
+func newTestServer(ctx context.Context, t testing.TB) *testServer {
+	port := freePort(t)
+	b, err := broker.NewBroker(&broker.Config{
+		Worker: 16,
+		Host:   "127.0.0.1",
+		Port:   port,
+	})
+	require.Nil(t, err)
+	b.Start()
+	brokerURL := "tcp://127.0.0.1:" + port
+	// the broker listens in the background
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", "127.0.0.1:"+port)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, 2*time.Second, 10*time.Millisecond)
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(brokerURL)
+	opts.SetClientID(t.Name() + "-server")
+	cli := mqtt.NewClient(opts)
+	require.True(t, cli.Connect().WaitTimeout(2*time.Second))
+
+	updateFunc, err := publisher.Wrap(ctx, func(ctx context.Context, topic string, msg string) error {
+		tok := cli.Publish(topic, byte(1), false, msg)
+		tok.Wait()
+		return tok.Error()
+	})
+	require.Nil(t, err)
+
+	r, err := api.NewResolver(ctx, &api.Config{
+		KeyValueStore: aggregator.NewMemoryStore(),
+		UpdateFunc:    updateFunc,
+	})
+	require.Nil(t, err)
+	r.TokenHandler = func(ctx context.Context) (*api.IdentityTokenPayload, error) {
+		requester := api.RequesterFromCtx(ctx)
+		if requester == nil {
+			return &api.IdentityTokenPayload{Result: false}, nil
+		}
+		return &api.IdentityTokenPayload{Result: true, Token: "token", Id: requester.Sub}, nil
+	}
+
+	schema := graphql.MustParseSchema(api.Schema, r, graphql.UseFieldResolvers())
+	authenticated := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx, err := r.Authenticate(req.Context(), req.Header)
+			if err != nil {
+				authErr := api.NewAuthError(err)
+				w.WriteHeader(authErr.StatusCode)
+				w.Write(authErr.Response())
+				return
+			}
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/graphql", authenticated(&relay.Handler{Schema: schema}))
+	mux.Handle("/blocks/", authenticated(http.StripPrefix("/blocks", r.BinaryHandler())))
+	srv := httptest.NewServer(mux)
+
+	t.Cleanup(func() {
+		srv.Close()
+		cli.Disconnect(250)
+	})
+
+	return &testServer{
+		resolver:       r,
+		endpoint:       srv.URL + "/graphql",
+		blocksEndpoint: srv.URL + "/blocks",
+		broker:         brokerURL,
+	}
+}
+
+func setDataTxn(t testing.TB, path string, value interface{}) []*transactions.Transaction {
+	txn, err := chaintree.NewSetDataTransaction(path, value)
+	require.Nil(t, err)
+	return []*transactions.Transaction{txn}
+}
+
+func TestPlayTransactionsAndResolve(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := newTestServer(ctx, t)
+	c, err := New(ctx, &Config{Endpoint: ts.endpoint})
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	tree, err := c.NewTree(ctx, treeKey)
+	require.Nil(t, err)
+	did := tree.MustId()
+
+	_, err = c.GetTip(ctx, did)
+	require.Equal(t, aggregator.ErrNotFound, err)
+
+	resp, err := c.PlayTransactions(ctx, tree, treeKey, setDataTxn(t, "some/path", "hi"))
+	require.Nil(t, err)
+	require.True(t, resp.Valid)
+	assert.True(t, tree.Tip().Equals(resp.NewTip))
+
+	// a second block needs the state of the first
+	resp, err = c.PlayTransactions(ctx, tree, treeKey, setDataTxn(t, "other/path", "bye"))
+	require.Nil(t, err)
+	require.True(t, resp.Valid)
+
+	serverTip, err := ts.resolver.Aggregator.GetTip(ctx, did)
+	require.Nil(t, err)
+	assert.True(t, serverTip.Equals(tree.Tip()))
+
+	tip, err := c.GetTip(ctx, did)
+	require.Nil(t, err)
+	assert.True(t, tip.Equals(tree.Tip()))
+
+	meta, err := c.Tree(ctx, did)
+	require.Nil(t, err)
+	assert.True(t, meta.Tip.Equals(tree.Tip()))
+	assert.Equal(t, uint64(1), meta.Height)
+	assert.False(t, meta.UpdatedAt.IsZero())
+
+	t.Run("resolve caches touched blocks", func(t *testing.T) {
+		otherClient, err := New(ctx, &Config{Endpoint: ts.endpoint})
+		require.Nil(t, err)
+
+		resolved, err := otherClient.Resolve(ctx, did, "tree/data/some/path")
+		require.Nil(t, err)
+		assert.Equal(t, "hi", resolved.Value)
+		assert.Len(t, resolved.RemainingPath, 0)
+		require.NotEmpty(t, resolved.TouchedBlocks)
+
+		latest, err := otherClient.GetLatest(ctx, did)
+		require.Nil(t, err)
+		val, _, err := latest.ChainTree.Dag.Resolve(ctx, []string{"tree", "data", "some", "path"})
+		require.Nil(t, err)
+		assert.Equal(t, "hi", val)
+	})
+
+	t.Run("stale trees are rejected", func(t *testing.T) {
+		stale, err := c.NewTree(ctx, treeKey)
+		require.Nil(t, err)
+		resp, err := c.PlayTransactions(ctx, stale, treeKey, setDataTxn(t, "some/path", "again"))
+		require.NotNil(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, api.ErrCodeTipConflict, resp.ErrorCode)
+		assert.True(t, resp.CurrentTip.Equals(tree.Tip()))
+	})
+}
+
+func TestBinaryTransport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := newTestServer(ctx, t)
+	c, err := New(ctx, &Config{Endpoint: ts.endpoint, BlocksEndpoint: ts.blocksEndpoint})
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	tree, err := c.NewTree(ctx, treeKey)
+	require.Nil(t, err)
+	did := tree.MustId()
+
+	_, err = c.GetTip(ctx, did)
+	require.Equal(t, aggregator.ErrNotFound, err)
+
+	_, err = c.PlayTransactions(ctx, tree, treeKey, setDataTxn(t, "some/path", "hi"))
+	require.Nil(t, err)
+	resp, err := c.PlayTransactions(ctx, tree, treeKey, setDataTxn(t, "other/path", "bye"))
+	require.Nil(t, err)
+	assert.True(t, tree.Tip().Equals(resp.NewTip))
+
+	tip, err := c.GetTip(ctx, did)
+	require.Nil(t, err)
+	assert.True(t, tip.Equals(tree.Tip()))
+
+	otherClient, err := New(ctx, &Config{Endpoint: ts.endpoint, BlocksEndpoint: ts.blocksEndpoint})
+	require.Nil(t, err)
+	resolved, err := otherClient.Resolve(ctx, did, "tree/data/some/path/deeper")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"deeper"}, resolved.RemainingPath)
+	assert.True(t, resolved.Tip.Equals(tree.Tip()))
+
+	resolved, err = otherClient.Resolve(ctx, did, "tree/data/other/path")
+	require.Nil(t, err)
+	assert.Equal(t, "bye", resolved.Value)
+	assert.Len(t, resolved.RemainingPath, 0)
+
+	t.Run("invalid blocks", func(t *testing.T) {
+		otherKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		_, err = c.PlayTransactions(ctx, tree, otherKey, setDataTxn(t, "some/path", "nope"))
+		require.NotNil(t, err)
+		assert.True(t, tree.Tip().Equals(resp.NewTip))
+	})
+}
+
+func TestIdentify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := newTestServer(ctx, t)
+	c, err := New(ctx, &Config{Endpoint: ts.endpoint})
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	tree, err := c.NewTree(ctx, treeKey)
+	require.Nil(t, err)
+	did := tree.MustId()
+	_, err = c.PlayTransactions(ctx, tree, treeKey, setDataTxn(t, "some/path", "hi"))
+	require.Nil(t, err)
+
+	token, err := c.IdentityToken(ctx)
+	require.Nil(t, err)
+	assert.False(t, token.Result)
+
+	c.Identify(did, &identity.Secp256k1Signer{Key: treeKey})
+	token, err = c.IdentityToken(ctx)
+	require.Nil(t, err)
+	assert.True(t, token.Result)
+	assert.Equal(t, did, token.Id)
+
+	t.Run("non owners are anonymous", func(t *testing.T) {
+		otherKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		c.Identify(did, &identity.Secp256k1Signer{Key: otherKey})
+		token, err := c.IdentityToken(ctx)
+		require.Nil(t, err)
+		assert.False(t, token.Result)
+	})
+
+	t.Run("strict auth errors have codes", func(t *testing.T) {
+		ts.resolver.StrictAuth = true
+		defer func() { ts.resolver.StrictAuth = false }()
+
+		otherKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		c.Identify(did, &identity.Secp256k1Signer{Key: otherKey})
+		_, err = c.IdentityToken(ctx)
+		require.NotNil(t, err)
+		var gqlErr *Error
+		require.True(t, errors.As(err, &gqlErr))
+		assert.Equal(t, api.AuthNotOwner, gqlErr.Code())
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := newTestServer(ctx, t)
+	c, err := New(ctx, &Config{Endpoint: ts.endpoint, Broker: ts.broker})
+	require.Nil(t, err)
+	defer c.Close()
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	tree, err := c.NewTree(ctx, treeKey)
+	require.Nil(t, err)
+	did := tree.MustId()
+
+	updates := make(chan *publisher.AddBlockMessage, 1)
+	sub, err := c.Subscribe(ctx, did, func(msg *publisher.AddBlockMessage) {
+		updates <- msg
+	})
+	require.Nil(t, err)
+
+	resp, err := c.PlayTransactions(ctx, tree, treeKey, setDataTxn(t, "some/path", "hi"))
+	require.Nil(t, err)
+
+	select {
+	case update := <-updates:
+		assert.Equal(t, did, update.Did)
+		assert.True(t, update.NewTip.Equals(resp.NewTip))
+		assert.Equal(t, uint64(0), update.Height)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for update")
+	}
+
+	require.Nil(t, sub.Unsubscribe())
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Error is an error returned by the GraphQL API
+type Error struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Code is the "code" extension of the error (for instance api.AuthExpired), empty if there is none
+func (e *Error) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// Errors are all the errors of a GraphQL response
+type Errors []*Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Message
+	}
+	return "graphql errors: " + strings.Join(msgs, ", ")
+}
+
+// Unwrap returns the first error so that errors.As works with *Error
+func (e Errors) Unwrap() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e[0]
+}
+
+type graphqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors Errors          `json:"errors"`
+}
+
+// query posts a GraphQL query (or mutation) and decodes the data of the response into result
+func (c *Client) query(ctx context.Context, query string, variables map[string]interface{}, result interface{}) error {
+	body, err := json.Marshal(&graphqlRequest{
+		Query:     query,
+		Variables: variables,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	err = c.setIdentityHeader(req.Header)
+	if err != nil {
+		return err
+	}
+
+	httpResp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+
+	// rejected requests (see api.AuthError) have a GraphQL shaped body as well
+	resp := &graphqlResponse{}
+	err = json.Unmarshal(respBody, resp)
+	if err != nil {
+		if httpResp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status %d: %s", httpResp.StatusCode, string(respBody))
+		}
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if len(resp.Errors) > 0 {
+		return resp.Errors
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", httpResp.StatusCode)
+	}
+
+	if result == nil {
+		return nil
+	}
+	err = json.Unmarshal(resp.Data, result)
+	if err != nil {
+		return fmt.Errorf("error decoding data: %w", err)
+	}
+	return nil
+}
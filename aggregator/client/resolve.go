@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+)
+
+// ResolveResponse is the response of the resolve query
+type ResolveResponse struct {
+	// Tip is the tip that was resolved, it is only defined when using the BlocksEndpoint
+	Tip           cid.Cid
+	RemainingPath []string
+	Value         interface{}
+	TouchedBlocks []format.Node
+}
+
+const resolveQuery = `query resolve($did: String!, $path: String!) {
+	resolve(input: {did: $did, path: $path}) {
+		value
+		remainingPath
+		touchedBlocks {
+			data
+		}
+	}
+}`
+
+// Resolve resolves path in the latest version of the tree on the aggregator. The blocks touched
+// while resolving are added to the local store so the same path can then be resolved locally.
+func (c *Client) Resolve(ctx context.Context, did string, path string) (*ResolveResponse, error) {
+	logger.Debugf("resolve %s %s", did, path)
+	if c.blocksEndpoint != "" {
+		return c.resolveBinary(ctx, did, path)
+	}
+
+	resp := &struct {
+		Resolve *struct {
+			Value         interface{} `json:"value"`
+			RemainingPath []string    `json:"remainingPath"`
+			TouchedBlocks []Block     `json:"touchedBlocks"`
+		} `json:"resolve"`
+	}{}
+	err := c.query(ctx, resolveQuery, map[string]interface{}{
+		"did":  did,
+		"path": path,
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Resolve == nil {
+		return nil, fmt.Errorf("missing resolve response")
+	}
+
+	touched, err := blocksToNodes(resp.Resolve.TouchedBlocks)
+	if err != nil {
+		return nil, err
+	}
+	err = c.store.AddMany(ctx, touched)
+	if err != nil {
+		return nil, fmt.Errorf("error storing touched blocks: %w", err)
+	}
+
+	return &ResolveResponse{
+		RemainingPath: resp.Resolve.RemainingPath,
+		Value:         resp.Resolve.Value,
+		TouchedBlocks: touched,
+	}, nil
+}
+
+const treeQuery = `query tree($did: String!) {
+	tree(did: $did) {
+		tip
+		height
+		updatedAt
+		owners
+	}
+}`
+
+// Tree returns the metadata of the latest version of the tree on the aggregator without resolving
+// anything (aggregator.ErrNotFound for an unknown or unreadable tree)
+func (c *Client) Tree(ctx context.Context, did string) (*aggregator.TreeMetadata, error) {
+	resp := &struct {
+		Tree *struct {
+			Tip       *string  `json:"tip"`
+			Height    uint64   `json:"height"`
+			UpdatedAt *int64   `json:"updatedAt"`
+			Owners    []string `json:"owners"`
+		} `json:"tree"`
+	}{}
+	err := c.query(ctx, treeQuery, map[string]interface{}{
+		"did": did,
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Tree == nil {
+		return nil, fmt.Errorf("missing tree response")
+	}
+	if resp.Tree.Tip == nil {
+		return nil, aggregator.ErrNotFound
+	}
+
+	tip, err := castTip(*resp.Tree.Tip)
+	if err != nil {
+		return nil, err
+	}
+	meta := &aggregator.TreeMetadata{
+		Tip:    tip,
+		Height: resp.Tree.Height,
+		Owners: resp.Tree.Owners,
+	}
+	if resp.Tree.UpdatedAt != nil {
+		meta.UpdatedAt = time.Unix(*resp.Tree.UpdatedAt, 0)
+	}
+	return meta, nil
+}
+
+// GetTip returns the tip of the tree on the aggregator (aggregator.ErrNotFound for an unknown or unreadable tree)
+func (c *Client) GetTip(ctx context.Context, did string) (cid.Cid, error) {
+	meta, err := c.Tree(ctx, did)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return meta.Tip, nil
+}
+
+// GetLatest returns the latest version of the tree backed by the local store. Only the root is fetched,
+// use Resolve to fetch (and cache) the blocks of the paths that are needed.
+func (c *Client) GetLatest(ctx context.Context, did string) (*consensus.SignedChainTree, error) {
+	tip, err := c.fetchRoot(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := chaintree.NewChainTree(ctx, dag.NewDag(ctx, tip, c.store), nil, consensus.DefaultTransactors)
+	if err != nil {
+		return nil, fmt.Errorf("error creating tree: %w", err)
+	}
+	return consensus.NewSignedChainTreeFromChainTree(tree), nil
+}
+
+// fetchRoot adds the root of the latest version of the tree to the local store and returns its tip
+func (c *Client) fetchRoot(ctx context.Context, did string) (cid.Cid, error) {
+	resp, err := c.Resolve(ctx, did, "/")
+	if err != nil {
+		return cid.Undef, err
+	}
+	if resp.Tip.Defined() {
+		return resp.Tip, nil
+	}
+	if len(resp.TouchedBlocks) == 0 {
+		return cid.Undef, aggregator.ErrNotFound
+	}
+	return resp.TouchedBlocks[0].Cid(), nil
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/api/publisher"
+)
+
+// MQTTTimeout is how long to wait for the broker to connect or acknowledge a subscription
+var MQTTTimeout = 5 * time.Second
+
+// ErrSubscriptionDenied is returned when the broker refuses a subscription
+// (for instance when the read policy of a tree does not allow it)
+var ErrSubscriptionDenied = errors.New("subscription denied")
+
+// UpdateHandler is called for every update of a subscribed tree
+type UpdateHandler func(msg *publisher.AddBlockMessage)
+
+// Subscription is a subscription to the updates of a tree
+type Subscription struct {
+	client *Client
+	topic  string
+}
+
+// Unsubscribe stops the updates
+func (s *Subscription) Unsubscribe() error {
+	cli, err := s.client.mqttClient(context.Background())
+	if err != nil {
+		return err
+	}
+	tok := cli.Unsubscribe(s.topic)
+	if !tok.WaitTimeout(MQTTTimeout) {
+		return fmt.Errorf("timeout unsubscribing from %s", s.topic)
+	}
+	return tok.Error()
+}
+
+// Subscribe calls handler for every update of the tree. The broker connection is made on the first
+// subscription, with the credentials of IdentityToken when the client is identified (see Identify).
+func (c *Client) Subscribe(ctx context.Context, did string, handler UpdateHandler) (*Subscription, error) {
+	cli, err := c.mqttClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	topic := publisher.PublicTopic(did)
+	if c.privateTopics {
+		topic = publisher.PrivateTopic(did)
+	}
+
+	tok := cli.Subscribe(topic, byte(1), func(_ mqtt.Client, msg mqtt.Message) {
+		update := &publisher.AddBlockMessage{}
+		err := json.Unmarshal(msg.Payload(), update)
+		if err != nil {
+			logger.Errorf("error decoding update on %s: %v", msg.Topic(), err)
+			return
+		}
+		handler(update)
+	})
+	if !tok.WaitTimeout(MQTTTimeout) {
+		return nil, fmt.Errorf("timeout subscribing to %s", topic)
+	}
+	if err := tok.Error(); err != nil {
+		return nil, fmt.Errorf("error subscribing to %s: %w", topic, err)
+	}
+	if tok.(*mqtt.SubscribeToken).Result()[topic] == 0x80 {
+		return nil, fmt.Errorf("%w: %s", ErrSubscriptionDenied, topic)
+	}
+
+	return &Subscription{
+		client: c,
+		topic:  topic,
+	}, nil
+}
+
+func (c *Client) mqttClient(ctx context.Context) (mqtt.Client, error) {
+	c.mqttLock.Lock()
+	defer c.mqttLock.Unlock()
+
+	if c.mqtt != nil {
+		return c.mqtt, nil
+	}
+	if c.broker == "" {
+		return nil, fmt.Errorf("no broker configured")
+	}
+
+	clientID := make([]byte, 8)
+	_, err := rand.Read(clientID)
+	if err != nil {
+		return nil, fmt.Errorf("error generating client id: %w", err)
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(c.broker)
+	opts.SetClientID("tupelo-lite-" + hex.EncodeToString(clientID))
+
+	c.lock.RLock()
+	identified := len(c.signers) > 0
+	c.lock.RUnlock()
+	if identified {
+		token, err := c.IdentityToken(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting identity token: %w", err)
+		}
+		if !token.Result {
+			return nil, fmt.Errorf("identity token refused")
+		}
+		opts.SetUsername(token.Id)
+		opts.SetPassword(token.Token)
+	}
+
+	cli := mqtt.NewClient(opts)
+	tok := cli.Connect()
+	if !tok.WaitTimeout(MQTTTimeout) {
+		return nil, fmt.Errorf("timeout connecting to %s", c.broker)
+	}
+	if err := tok.Error(); err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", c.broker, err)
+	}
+	c.mqtt = cli
+	return cli, nil
+}
@@ -0,0 +1,243 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+)
+
+// The types of a Change
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// Change is a path that is different between two versions of a tree. OldValue is nil for added
+// paths and NewValue is nil for removed ones. Values can have links (cid.Cid) to the rest of
+// the tree, an added (or removed) map or list is a single change rather than one for each key.
+type Change struct {
+	Path     []string
+	Type     string
+	OldValue interface{}
+	NewValue interface{}
+}
+
+// DiffResponse is the changes from one version of a tree to another, ordered by path
+type DiffResponse struct {
+	From    cid.Cid
+	To      cid.Cid
+	Changes []Change
+}
+
+// Diff walks the tree (the "tree" of the root) of both versions of objectID, skipping the links that
+// are the same in both, and returns the paths that were added, removed or modified. Both tips must be
+// versions of objectID that are in the DagStore.
+func (a *Aggregator) Diff(ctx context.Context, objectID string, fromTip, toTip cid.Cid) (*DiffResponse, error) {
+	return a.diff(ctx, objectID, fromTip, toTip, func(path []string) (bool, error) {
+		return true, nil
+	})
+}
+
+// DiffWithReadControls is Diff with only the changes that the read policies allow (for the path of the change).
+// The latest version of the tree has the read policies that are used, toTip is the latest tip when undefined.
+// It returns nil when the tree is not found or its latest version is not readable.
+func (a *Aggregator) DiffWithReadControls(ctx context.Context, id *identity.Identity, objectID string, fromTip, toTip cid.Cid) (*DiffResponse, error) {
+	readable, err := a.getReadable(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+	if readable.latest == nil {
+		return nil, nil
+	}
+	if !toTip.Defined() {
+		toTip = readable.latest.Dag.Tip
+	}
+	allowed := func(path []string) (bool, error) {
+		return a.evaluateReadPolicies(ctx, readable.readPolicy, &policy.ReadInput{
+			Method:   policy.MethodGet,
+			Object:   objectID,
+			Path:     strings.Join(path, "/"),
+			Identity: id,
+		})
+	}
+	isReadable, err := allowed([]string{})
+	if err != nil {
+		return nil, err
+	}
+	if !isReadable {
+		return nil, nil
+	}
+	return a.diff(ctx, objectID, fromTip, toTip, allowed)
+}
+
+// differ is the state of a single diff
+type differ struct {
+	dag     *dag.Dag
+	allowed func(path []string) (bool, error)
+	changes []Change
+}
+
+func (a *Aggregator) diff(ctx context.Context, objectID string, fromTip, toTip cid.Cid, allowed func(path []string) (bool, error)) (*DiffResponse, error) {
+	d := &differ{
+		dag:     dag.NewDag(ctx, toTip, a.DagStore),
+		allowed: allowed,
+	}
+	fromTree, err := d.treeOf(ctx, objectID, fromTip)
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := d.treeOf(ctx, objectID, toTip)
+	if err != nil {
+		return nil, err
+	}
+	err = d.walk(ctx, []string{"tree"}, fromTree, toTree)
+	if err != nil {
+		return nil, err
+	}
+	return &DiffResponse{
+		From:    fromTip,
+		To:      toTip,
+		Changes: d.changes,
+	}, nil
+}
+
+// treeOf returns the link to the tree of the version of objectID at tip
+func (d *differ) treeOf(ctx context.Context, objectID string, tip cid.Cid) (interface{}, error) {
+	root, err := d.load(ctx, tip)
+	if err != nil {
+		return nil, err
+	}
+	rootMap, ok := root.(map[string]interface{})
+	if !ok || rootMap["id"] != objectID {
+		return nil, fmt.Errorf("%s is not a version of %s", tip.String(), objectID)
+	}
+	return rootMap["tree"], nil
+}
+
+func (d *differ) load(ctx context.Context, id cid.Cid) (interface{}, error) {
+	val, _, err := d.dag.ResolveAt(ctx, id, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", id.String(), err)
+	}
+	return val, nil
+}
+
+func (d *differ) walk(ctx context.Context, path []string, from, to interface{}) error {
+	fromLink, fromIsLink := from.(cid.Cid)
+	toLink, toIsLink := to.(cid.Cid)
+	if fromIsLink && toIsLink && fromLink.Equals(toLink) {
+		return nil
+	}
+
+	var err error
+	if fromIsLink {
+		from, err = d.load(ctx, fromLink)
+		if err != nil {
+			return err
+		}
+	}
+	if toIsLink {
+		to, err = d.load(ctx, toLink)
+		if err != nil {
+			return err
+		}
+	}
+
+	fromKeys, fromValues, fromHasKeys := diffKeys(from)
+	toKeys, toValues, toHasKeys := diffKeys(to)
+	if !fromHasKeys || !toHasKeys || reflect.TypeOf(from) != reflect.TypeOf(to) {
+		if reflect.DeepEqual(from, to) {
+			return nil
+		}
+		return d.add(path, ChangeModified, from, to)
+	}
+
+	keys := make(map[string]struct{}, len(fromKeys)+len(toKeys))
+	for _, k := range append(append([]string{}, fromKeys...), toKeys...) {
+		keys[k] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sortKeys(sorted, from)
+
+	for _, k := range sorted {
+		childPath := append(append([]string{}, path...), k)
+		fromVal, inFrom := fromValues[k]
+		toVal, inTo := toValues[k]
+		switch {
+		case !inFrom:
+			err = d.add(childPath, ChangeAdded, nil, toVal)
+		case !inTo:
+			err = d.add(childPath, ChangeRemoved, fromVal, nil)
+		default:
+			err = d.walk(ctx, childPath, fromVal, toVal)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *differ) add(path []string, changeType string, oldValue, newValue interface{}) error {
+	allowed, err := d.allowed(path)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return nil
+	}
+	d.changes = append(d.changes, Change{
+		Path:     path,
+		Type:     changeType,
+		OldValue: oldValue,
+		NewValue: newValue,
+	})
+	return nil
+}
+
+// diffKeys returns the keys and values of maps and lists (by index), false for other values
+func diffKeys(val interface{}) ([]string, map[string]interface{}, bool) {
+	switch val := val.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		return keys, val, true
+	case []interface{}:
+		keys := make([]string, len(val))
+		values := make(map[string]interface{}, len(val))
+		for i, v := range val {
+			keys[i] = strconv.Itoa(i)
+			values[keys[i]] = v
+		}
+		return keys, values, true
+	default:
+		return nil, nil, false
+	}
+}
+
+// sortKeys sorts map keys as strings and list keys as indexes
+func sortKeys(keys []string, val interface{}) {
+	if _, isList := val.([]interface{}); isList {
+		sort.Slice(keys, func(i, j int) bool {
+			a, _ := strconv.Atoi(keys[i])
+			b, _ := strconv.Atoi(keys[j])
+			return a < b
+		})
+		return
+	}
+	sort.Strings(keys)
+}
@@ -0,0 +1,131 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ipfs/go-cid"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	agg, err := NewAggregator(ctx, &AggregatorConfig{KeyValueStore: NewMemoryStore(), Group: types.NewNotaryGroup("testnotary")})
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+
+	setData := func(t *testing.T, values map[string]interface{}) []*transactions.Transaction {
+		var txs []*transactions.Transaction
+		for path, value := range values {
+			txn, err := chaintree.NewSetDataTransaction(path, value)
+			require.Nil(t, err)
+			txs = append(txs, txn)
+		}
+		return txs
+	}
+
+	abr := NewValidTransactionWithTransactions(t, treeKey, setData(t, map[string]interface{}{
+		"a/b":      "x",
+		"a/c":      "y",
+		"secret/s": "hidden",
+		".well-known/policies": map[string]string{
+			"read": `
+				package read
+				default allow = true
+
+				allow = false {
+					startswith(input.path, "tree/data/secret")
+				}
+			`,
+		},
+	})...)
+	resp, err := agg.Add(ctx, &abr)
+	require.Nil(t, err)
+	did := string(abr.ObjectId)
+	firstTip := resp.NewTip
+
+	// process the next block straight into the DagStore of the aggregator
+	latest, err := agg.GetLatest(ctx, did)
+	require.Nil(t, err)
+	// replacing a removes a/c
+	txs := setData(t, map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": "z",
+			"d": map[string]interface{}{"e": "f"},
+		},
+		"secret/s": "changed",
+	})
+	block, err := consensus.SignBlock(ctx, &chaintree.BlockWithHeaders{
+		Block: chaintree.Block{
+			PreviousTip:  &firstTip,
+			Height:       1,
+			Transactions: txs,
+		},
+	}, treeKey)
+	require.Nil(t, err)
+	_, err = latest.ProcessBlock(ctx, block)
+	require.Nil(t, err)
+	secondTip := latest.Dag.Tip
+
+	t.Run("diffs two versions", func(t *testing.T) {
+		diff, err := agg.Diff(ctx, did, firstTip, secondTip)
+		require.Nil(t, err)
+		assert.True(t, diff.From.Equals(firstTip))
+		assert.True(t, diff.To.Equals(secondTip))
+		assert.Equal(t, []Change{
+			{Path: []string{"tree", "data", "a", "b"}, Type: ChangeModified, OldValue: "x", NewValue: "z"},
+			{Path: []string{"tree", "data", "a", "c"}, Type: ChangeRemoved, OldValue: "y"},
+			{Path: []string{"tree", "data", "a", "d"}, Type: ChangeAdded, NewValue: map[string]interface{}{"e": "f"}},
+			{Path: []string{"tree", "data", "secret", "s"}, Type: ChangeModified, OldValue: "hidden", NewValue: "changed"},
+		}, diff.Changes)
+	})
+
+	t.Run("the same tip has no changes", func(t *testing.T) {
+		diff, err := agg.Diff(ctx, did, secondTip, secondTip)
+		require.Nil(t, err)
+		assert.Len(t, diff.Changes, 0)
+	})
+
+	t.Run("tips must be versions of the tree", func(t *testing.T) {
+		otherKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		other := NewValidTransactionWithPathAndValue(t, otherKey, "a/b", "x")
+		otherResp, err := agg.Add(ctx, &other)
+		require.Nil(t, err)
+
+		_, err = agg.Diff(ctx, did, otherResp.NewTip, secondTip)
+		require.NotNil(t, err)
+	})
+
+	t.Run("read controls filter changes", func(t *testing.T) {
+		diff, err := agg.DiffWithReadControls(ctx, nil, did, firstTip, secondTip)
+		require.Nil(t, err)
+		require.Len(t, diff.Changes, 3)
+		for _, change := range diff.Changes {
+			assert.NotEqual(t, "secret", change.Path[2])
+		}
+	})
+
+	t.Run("read controls default to the latest tip", func(t *testing.T) {
+		diff, err := agg.DiffWithReadControls(ctx, nil, did, firstTip, cid.Undef)
+		require.Nil(t, err)
+		assert.True(t, diff.To.Equals(firstTip))
+		assert.Len(t, diff.Changes, 0)
+	})
+
+	t.Run("unknown trees", func(t *testing.T) {
+		diff, err := agg.DiffWithReadControls(ctx, nil, "did:tupelo:unknown", firstTip, secondTip)
+		require.Nil(t, err)
+		assert.Nil(t, diff)
+	})
+}
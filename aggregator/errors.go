@@ -0,0 +1,68 @@
+package aggregator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+)
+
+// Reasons for rejecting a block (see AddError)
+var (
+	ErrTipConflict      = fmt.Errorf("TipConflict")
+	ErrPolicyDenied     = fmt.Errorf("PolicyDenied")
+	ErrInvalidSignature = fmt.Errorf("InvalidSignature")
+	ErrSchemaViolation  = fmt.Errorf("SchemaViolation")
+)
+
+// AddError is returned by Add when a block is rejected. It matches ErrInvalidBlock
+// and its Reason (if known) with errors.Is.
+type AddError struct {
+	// Reason is ErrTipConflict, ErrPolicyDenied, ErrInvalidSignature, ErrSchemaViolation or nil when the block is otherwise invalid
+	Reason error
+	// CurrentTip is the tip the block conflicted with (only for ErrTipConflict)
+	CurrentTip cid.Cid
+	// Err is the validation error, if there was one
+	Err error
+}
+
+func (e *AddError) Error() string {
+	msg := ErrInvalidBlock.Error()
+	if e.Reason != nil {
+		msg += ": " + e.Reason.Error()
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *AddError) Is(target error) bool {
+	return target == ErrInvalidBlock || (e.Reason != nil && target == e.Reason)
+}
+
+func (e *AddError) Unwrap() error {
+	return e.Err
+}
+
+// rejected classifies the result of an invalid ValidateAbr. The ownership check
+// rejects blocks without a coded error, so those are reported as invalid signatures
+// (as are blocks without enough owner signatures for the threshold of the tree).
+func rejected(err error) *AddError {
+	var schemaErr *policy.SchemaViolationError
+	var codedErr *consensus.ErrorCode
+	switch {
+	case err == nil:
+		return &AddError{Reason: ErrInvalidSignature}
+	case errors.As(err, &codedErr) && codedErr.Code == policy.ThresholdCode:
+		return &AddError{Reason: ErrInvalidSignature, Err: err}
+	case errors.Is(err, policy.ErrDenied):
+		return &AddError{Reason: ErrPolicyDenied, Err: err}
+	case errors.As(err, &schemaErr):
+		return &AddError{Reason: ErrSchemaViolation, Err: err}
+	default:
+		return &AddError{Err: err}
+	}
+}
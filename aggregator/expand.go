@@ -0,0 +1,123 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+)
+
+// ResolveOptions expand the value of a resolve (see ResolveWithOptions)
+type ResolveOptions struct {
+	// Depth is how many levels of links are replaced with the value they link to
+	Depth int
+	// Fields projects the value to these (slash separated) paths, empty for the whole value
+	Fields []string
+	// MaxHops is how many "did:tupelo:..." references to other trees are followed (see resolveGrafted)
+	MaxHops int
+}
+
+// projection is a tree of the fields to keep, a nil projection keeps everything
+type projection map[string]projection
+
+func newProjection(fields []string) projection {
+	if len(fields) == 0 {
+		return nil
+	}
+	proj := projection{}
+	for _, field := range fields {
+		var parts []string
+		for _, part := range strings.Split(field, "/") {
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+		current := proj
+		for i, part := range parts {
+			sub, ok := current[part]
+			if ok && sub == nil {
+				// the whole value is already kept
+				break
+			}
+			if i == len(parts)-1 {
+				current[part] = nil
+				break
+			}
+			if !ok {
+				sub = projection{}
+				current[part] = sub
+			}
+			current = sub
+		}
+	}
+	return proj
+}
+
+// expansion is the state of expanding a single resolve
+type expansion struct {
+	readable *readableTree
+	dag      *dag.Dag
+	identity *identity.Identity
+}
+
+// expand replaces links (up to depth levels) with the values they link to and drops what is not in proj.
+// Links are only followed when the read policies allow their path, otherwise they are left as links.
+func (a *Aggregator) expand(ctx context.Context, exp *expansion, val interface{}, path []string, depth int, proj projection) (interface{}, error) {
+	switch val := val.(type) {
+	case cid.Cid:
+		if depth <= 0 {
+			return val, nil
+		}
+		allowed, err := a.evaluateReadPolicies(ctx, exp.readable.readPolicy, &policy.ReadInput{
+			Method:   policy.MethodGet,
+			Object:   exp.readable.objectID,
+			Path:     strings.Join(path, "/"),
+			Identity: exp.identity,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return val, nil
+		}
+		linked, _, err := exp.dag.ResolveAt(ctx, val, []string{})
+		if err != nil {
+			return nil, fmt.Errorf("error resolving %s: %w", val.String(), err)
+		}
+		return a.expand(ctx, exp, linked, path, depth-1, proj)
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			var sub projection
+			if proj != nil {
+				var ok bool
+				sub, ok = proj[k]
+				if !ok {
+					continue
+				}
+			}
+			child, err := a.expand(ctx, exp, v, append(append([]string{}, path...), k), depth, sub)
+			if err != nil {
+				return nil, err
+			}
+			expanded[k] = child
+		}
+		return expanded, nil
+	case []interface{}:
+		expanded := make([]interface{}, len(val))
+		for i, v := range val {
+			child, err := a.expand(ctx, exp, v, append(append([]string{}, path...), fmt.Sprint(i)), depth, proj)
+			if err != nil {
+				return nil, err
+			}
+			expanded[i] = child
+		}
+		return expanded, nil
+	default:
+		return val, nil
+	}
+}
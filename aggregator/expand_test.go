@@ -0,0 +1,102 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ipfs/go-cid"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProjection(t *testing.T) {
+	assert.Nil(t, newProjection(nil))
+	assert.Equal(t, projection{
+		"a": projection{"b": nil, "c": nil},
+		"d": nil,
+	}, newProjection([]string{"a/b", "/a/c/", "d", "d/e"}))
+	assert.Equal(t, projection{"a": nil}, newProjection([]string{"a", "a/b"}))
+}
+
+func TestResolveWithOptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	agg, err := NewAggregator(ctx, &AggregatorConfig{KeyValueStore: NewMemoryStore(), Group: types.NewNotaryGroup("testnotary")})
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+
+	var txs []*transactions.Transaction
+	for path, value := range map[string]interface{}{
+		"a/b/c":    "deep",
+		"a/x":      "shallow",
+		"secret/s": "hidden",
+		".well-known/policies": map[string]string{
+			"read": `
+				package read
+				default allow = true
+
+				allow = false {
+					startswith(input.path, "tree/data/secret")
+				}
+			`,
+		},
+	} {
+		txn, err := chaintree.NewSetDataTransaction(path, value)
+		require.Nil(t, err)
+		txs = append(txs, txn)
+	}
+	abr := NewValidTransactionWithTransactions(t, treeKey, txs...)
+	_, err = agg.Add(ctx, &abr)
+	require.Nil(t, err)
+	did := string(abr.ObjectId)
+	dataPath := []string{"tree", "data"}
+
+	t.Run("without options links are left", func(t *testing.T) {
+		resp, err := agg.ResolveWithReadControls(ctx, nil, did, dataPath)
+		require.Nil(t, err)
+		_, isLink := resp.Value.(map[string]interface{})["a"].(cid.Cid)
+		assert.True(t, isLink)
+	})
+
+	t.Run("expands links up to depth", func(t *testing.T) {
+		plain, err := agg.ResolveWithReadControls(ctx, nil, did, dataPath)
+		require.Nil(t, err)
+
+		resp, err := agg.ResolveWithOptions(ctx, nil, did, dataPath, &ResolveOptions{Depth: 1})
+		require.Nil(t, err)
+		a := resp.Value.(map[string]interface{})["a"].(map[string]interface{})
+		assert.Equal(t, "shallow", a["x"])
+		_, isLink := a["b"].(cid.Cid)
+		assert.True(t, isLink)
+		assert.Greater(t, len(resp.TouchedBlocks), len(plain.TouchedBlocks))
+
+		resp, err = agg.ResolveWithOptions(ctx, nil, did, dataPath, &ResolveOptions{Depth: 2})
+		require.Nil(t, err)
+		a = resp.Value.(map[string]interface{})["a"].(map[string]interface{})
+		assert.Equal(t, "deep", a["b"].(map[string]interface{})["c"])
+	})
+
+	t.Run("projects fields", func(t *testing.T) {
+		resp, err := agg.ResolveWithOptions(ctx, nil, did, dataPath, &ResolveOptions{Depth: 5, Fields: []string{"a/b"}})
+		require.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"a": map[string]interface{}{
+				"b": map[string]interface{}{"c": "deep"},
+			},
+		}, resp.Value)
+	})
+
+	t.Run("does not expand unreadable links", func(t *testing.T) {
+		resp, err := agg.ResolveWithOptions(ctx, nil, did, dataPath, &ResolveOptions{Depth: 5, Fields: []string{"secret"}})
+		require.Nil(t, err)
+		_, isLink := resp.Value.(map[string]interface{})["secret"].(cid.Cid)
+		assert.True(t, isLink)
+	})
+}
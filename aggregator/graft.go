@@ -0,0 +1,99 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+)
+
+const graftPrefix = "did:tupelo:"
+
+// ResolveHop is one of the trees a grafted resolve went through
+type ResolveHop struct {
+	ObjectID      string
+	Path          []string
+	Tip           cid.Cid // undefined when the tree was not found or is not readable
+	TouchedBlocks []format.Node
+}
+
+type getReadableFunc func(ctx context.Context, objectID string) (*readableTree, error)
+
+// resolveGrafted resolves path and, like graftabledag.GlobalResolve, when that resolves to a "did:tupelo:<did>/<path>"
+// string it continues by resolving the rest of the path in the other tree (up to opts.MaxHops times). Every hop is
+// checked against the read policies of its tree, a tree that cannot be read looks the same as one that is not found.
+// Only string values are followed (not lists of them).
+func (a *Aggregator) resolveGrafted(ctx context.Context, get getReadableFunc, id *identity.Identity, objectID string, path []string, opts *ResolveOptions) (*ResolveResponse, error) {
+	seen := map[string]bool{
+		graftKey(objectID, path): true,
+	}
+	var hops []ResolveHop
+	var touched []format.Node
+	touchedCids := make(map[cid.Cid]struct{})
+
+	for {
+		readable, err := get(ctx, objectID)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := a.resolveReadable(ctx, readable, id, path, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		hops = append(hops, ResolveHop{
+			ObjectID:      objectID,
+			Path:          path,
+			Tip:           resp.Tip,
+			TouchedBlocks: resp.TouchedBlocks,
+		})
+		for _, node := range resp.TouchedBlocks {
+			if _, ok := touchedCids[node.Cid()]; !ok {
+				touchedCids[node.Cid()] = struct{}{}
+				touched = append(touched, node)
+			}
+		}
+
+		nextID, nextPath, isGraft := graftTarget(resp)
+		if !isGraft || len(hops) > opts.MaxHops {
+			return &ResolveResponse{
+				Tip:           hops[0].Tip,
+				RemainingPath: resp.RemainingPath,
+				Value:         resp.Value,
+				TouchedBlocks: touched,
+				Hops:          hops,
+			}, nil
+		}
+
+		key := graftKey(nextID, nextPath)
+		if seen[key] {
+			return nil, fmt.Errorf("loop detected; %s was already visited in this resolution", key)
+		}
+		seen[key] = true
+		logger.Debugf("resolve following graft from %s to %s", objectID, key)
+		objectID, path = nextID, nextPath
+	}
+}
+
+// graftTarget returns the tree and path a resolve continues in when its value is a reference to another tree
+func graftTarget(resp *ResolveResponse) (string, []string, bool) {
+	ref, ok := resp.Value.(string)
+	if !ok || !strings.HasPrefix(ref, graftPrefix) {
+		return "", nil, false
+	}
+	parts := strings.Split(ref, "/")
+	var path []string
+	for _, part := range parts[1:] {
+		if part != "" {
+			path = append(path, part)
+		}
+	}
+	return parts[0], append(path, resp.RemainingPath...), true
+}
+
+func graftKey(objectID string, path []string) string {
+	return objectID + "/" + strings.Join(path, "/")
+}
@@ -0,0 +1,90 @@
+package aggregator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveGrafted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	agg, err := NewAggregator(ctx, &AggregatorConfig{KeyValueStore: NewMemoryStore(), Group: types.NewNotaryGroup("testnotary")})
+	require.Nil(t, err)
+
+	newKey := func(t *testing.T) (*ecdsa.PrivateKey, string) {
+		key, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		return key, consensus.EcdsaPubkeyToDid(key.PublicKey)
+	}
+	add := func(t *testing.T, key *ecdsa.PrivateKey, path string, value interface{}) {
+		abr := NewValidTransactionWithPathAndValue(t, key, path, value)
+		_, err := agg.Add(ctx, &abr)
+		require.Nil(t, err)
+	}
+
+	targetKey, targetDid := newKey(t)
+	add(t, targetKey, "x/y", "z")
+
+	lockedKey, lockedDid := newKey(t)
+	add(t, lockedKey, ".well-known/policies", map[string]string{
+		"read": `
+			package read
+			default allow = false
+		`,
+	})
+
+	loopKey, loopDid := newKey(t)
+	add(t, loopKey, "self", loopDid+"/tree/data/self")
+
+	originKey, originDid := newKey(t)
+	add(t, originKey, "refs", map[string]interface{}{
+		"target": targetDid + "/tree/data",
+		"locked": lockedDid + "/tree/data",
+		"loop":   loopDid + "/tree/data/self",
+	})
+
+	t.Run("follows grafts", func(t *testing.T) {
+		resp, err := agg.ResolveWithOptions(ctx, nil, originDid, []string{"tree", "data", "refs", "target", "x", "y"}, &ResolveOptions{MaxHops: 1})
+		require.Nil(t, err)
+		assert.Equal(t, "z", resp.Value)
+		assert.Len(t, resp.RemainingPath, 0)
+		require.Len(t, resp.Hops, 2)
+		assert.Equal(t, originDid, resp.Hops[0].ObjectID)
+		assert.Equal(t, targetDid, resp.Hops[1].ObjectID)
+		assert.Equal(t, []string{"tree", "data", "x", "y"}, resp.Hops[1].Path)
+		assert.NotEmpty(t, resp.Hops[1].TouchedBlocks)
+		assert.True(t, resp.Tip.Equals(resp.Hops[0].Tip))
+		assert.Equal(t, len(resp.Hops[0].TouchedBlocks)+len(resp.Hops[1].TouchedBlocks), len(resp.TouchedBlocks))
+	})
+
+	t.Run("without hops the reference is returned", func(t *testing.T) {
+		resp, err := agg.ResolveWithReadControls(ctx, nil, originDid, []string{"tree", "data", "refs", "target", "x", "y"})
+		require.Nil(t, err)
+		assert.Equal(t, targetDid+"/tree/data", resp.Value)
+		assert.Equal(t, []string{"x", "y"}, resp.RemainingPath)
+		assert.Len(t, resp.Hops, 0)
+	})
+
+	t.Run("checks the read policy of every hop", func(t *testing.T) {
+		resp, err := agg.ResolveWithOptions(ctx, nil, originDid, []string{"tree", "data", "refs", "locked"}, &ResolveOptions{MaxHops: 3})
+		require.Nil(t, err)
+		assert.Nil(t, resp.Value)
+		assert.Equal(t, []string{"tree", "data"}, resp.RemainingPath)
+		require.Len(t, resp.Hops, 2)
+		assert.False(t, resp.Hops[1].Tip.Defined())
+		assert.Len(t, resp.Hops[1].TouchedBlocks, 0)
+	})
+
+	t.Run("detects loops", func(t *testing.T) {
+		_, err := agg.ResolveWithOptions(ctx, nil, originDid, []string{"tree", "data", "refs", "loop"}, &ResolveOptions{MaxHops: 5})
+		require.NotNil(t, err)
+	})
+}
@@ -0,0 +1,113 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/typecaster"
+	"github.com/quorumcontrol/messages/v2/build/go/signatures"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+)
+
+// SignBlock is consensus.SignBlock for any Scheme. The signature is stored under the owner string of the signer
+// (see PublicKeyToAddress) with its public key, secp256k1 signatures are the same as the ones of consensus.SignBlock.
+func SignBlock(ctx context.Context, blockWithHeaders *chaintree.BlockWithHeaders, signer Signer) (*chaintree.BlockWithHeaders, error) {
+	hsh, err := consensus.BlockToHash(blockWithHeaders.Block)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing block: %w", err)
+	}
+	sig, err := SignHash(signer, hsh)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := sig.Address(hsh)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := &consensus.StandardHeaders{}
+	if blockWithHeaders.Headers != nil {
+		err = typecaster.ToType(blockWithHeaders.Headers, headers)
+		if err != nil {
+			return nil, fmt.Errorf("error casting headers: %w", err)
+		}
+	}
+	if headers.Signatures == nil {
+		headers.Signatures = make(consensus.SignatureMap)
+	}
+	publicKey := &signatures.PublicKey{PublicKey: sig.PublicKey}
+	if signer.Scheme() == Secp256k1 {
+		publicKey.Type = signatures.PublicKey_KeyTypeSecp256k1
+	}
+	headers.Signatures[addr] = &signatures.Signature{
+		Ownership: &signatures.Ownership{PublicKey: publicKey},
+		Signature: sig.Signature,
+	}
+
+	var marshaledHeaders map[string]interface{}
+	err = typecaster.ToType(headers, &marshaledHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("error casting headers: %w", err)
+	}
+	blockWithHeaders.Headers = marshaledHeaders
+	return blockWithHeaders, nil
+}
+
+// BlockSigners returns the owner strings of the valid signatures of a block, whatever their Scheme.
+// Signatures that do not verify, or that are stored under an owner string other than their signer's, are left out.
+func BlockSigners(ctx context.Context, blockWithHeaders *chaintree.BlockWithHeaders) ([]string, error) {
+	headers := &consensus.StandardHeaders{}
+	if blockWithHeaders.Headers != nil {
+		err := typecaster.ToType(blockWithHeaders.Headers, headers)
+		if err != nil {
+			return nil, fmt.Errorf("error converting headers: %w", err)
+		}
+	}
+	if len(headers.Signatures) == 0 {
+		return nil, nil
+	}
+	hsh, err := consensus.BlockToHash(blockWithHeaders.Block)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing block: %w", err)
+	}
+
+	var signers []string
+	for owner, sig := range headers.Signatures {
+		if sig == nil {
+			continue
+		}
+		var publicKey []byte
+		if sig.Ownership != nil && sig.Ownership.PublicKey != nil {
+			publicKey = sig.Ownership.PublicKey.PublicKey
+		}
+		scheme, err := SchemeFor(ownerScheme(owner))
+		if err != nil {
+			return nil, err
+		}
+		addr, verified, err := scheme.Verify(hsh, sig.Signature, publicKey)
+		if err != nil {
+			logger.Warningf("error verifying signature of %s: %v", owner, err)
+			continue
+		}
+		if !verified || addr != owner {
+			logger.Warningf("invalid signature of %s", owner)
+			continue
+		}
+		signers = append(signers, owner)
+	}
+	return signers, nil
+}
+
+// ownerScheme is the Scheme of an owner string, the prefix of "<scheme>:0x<public key>" or Secp256k1 for addresses
+func ownerScheme(owner string) string {
+	i := strings.Index(owner, ":")
+	if i < 0 {
+		return Secp256k1
+	}
+	if _, ok := schemes[owner[:i]]; !ok {
+		return Secp256k1
+	}
+	return owner[:i]
+}
@@ -0,0 +1,89 @@
+package identity
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockSigners(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	secpKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	signers := []Signer{
+		&Secp256k1Signer{Key: secpKey},
+		&Ed25519Signer{Key: edKey},
+		&P256Signer{Key: p256Key},
+	}
+	edAddr, err := PublicKeyToAddress(Ed25519, signers[1].PublicKey())
+	require.Nil(t, err)
+	p256Addr, err := PublicKeyToAddress(P256, signers[2].PublicKey())
+	require.Nil(t, err)
+	secpAddr := crypto.PubkeyToAddress(secpKey.PublicKey).String()
+
+	newBlock := func(t *testing.T) *chaintree.BlockWithHeaders {
+		txn, err := chaintree.NewSetDataTransaction("some/path", "value")
+		require.Nil(t, err)
+		return &chaintree.BlockWithHeaders{
+			Block: chaintree.Block{Transactions: []*transactions.Transaction{txn}},
+		}
+	}
+
+	t.Run("every scheme", func(t *testing.T) {
+		block := newBlock(t)
+		for _, signer := range signers {
+			block, err = SignBlock(ctx, block, signer)
+			require.Nil(t, err)
+		}
+		addrs, err := BlockSigners(ctx, block)
+		require.Nil(t, err)
+		assert.ElementsMatch(t, []string{secpAddr, edAddr, p256Addr}, addrs)
+	})
+
+	t.Run("secp256k1 signatures match consensus.SignBlock", func(t *testing.T) {
+		block, err := SignBlock(ctx, newBlock(t), signers[0])
+		require.Nil(t, err)
+		isSigned, err := consensus.IsBlockSignedBy(ctx, block, secpAddr)
+		require.Nil(t, err)
+		assert.True(t, isSigned)
+
+		block, err = consensus.SignBlock(ctx, newBlock(t), secpKey)
+		require.Nil(t, err)
+		addrs, err := BlockSigners(ctx, block)
+		require.Nil(t, err)
+		assert.Equal(t, []string{secpAddr}, addrs)
+	})
+
+	t.Run("leaves out signatures of other blocks", func(t *testing.T) {
+		signed, err := SignBlock(ctx, newBlock(t), signers[1])
+		require.Nil(t, err)
+		other := newBlock(t)
+		other.Height = 1
+		other.Headers = signed.Headers
+		addrs, err := BlockSigners(ctx, other)
+		require.Nil(t, err)
+		assert.Empty(t, addrs)
+	})
+
+	t.Run("unsigned blocks", func(t *testing.T) {
+		addrs, err := BlockSigners(ctx, newBlock(t))
+		require.Nil(t, err)
+		assert.Empty(t, addrs)
+	})
+}
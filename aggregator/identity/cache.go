@@ -0,0 +1,166 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ipfs/go-cid"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/graftabledag"
+)
+
+// VerifyCache caches the expensive part of Verify (resolving the ownership of the subject)
+// per subject DID and subject tip. The signatures and expiration are still
+// checked on every call.
+// A cached result is only used while the subject tree and every tree its ownership was grafted from
+// are still at the tips it was resolved at, so it is never used once any of them has moved on.
+type VerifyCache struct {
+	cache *lru.Cache // did -> *ownership
+
+	lock       sync.Mutex
+	dependents map[string]map[string]bool // grafted did -> the cached dids whose ownership was resolved through it
+}
+
+func NewVerifyCache(size int) (*VerifyCache, error) {
+	vc := &VerifyCache{
+		dependents: make(map[string]map[string]bool),
+	}
+	cache, err := lru.NewWithEvict(size, vc.onEvicted)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cache: %w", err)
+	}
+	vc.cache = cache
+	return vc, nil
+}
+
+// Verify is the same as Token#Verify but skips resolving ownership
+// when the ownership at the subject tip is already known.
+func (vc *VerifyCache) Verify(ctx context.Context, getter graftabledag.DagGetter, t Token) (bool, error) {
+	return checkToVerify(vc.Check(ctx, getter, t))
+}
+
+// Check is the same as Token#Check but skips resolving ownership
+// when the ownership at the subject tip is already known.
+func (vc *VerifyCache) Check(ctx context.Context, getter graftabledag.DagGetter, t Token) error {
+	signers, err := t.verifiedSigners()
+	if err != nil {
+		return err
+	}
+	o, err := vc.ownership(ctx, getter, t.Claims().Sub)
+	if err != nil {
+		return err
+	}
+	return t.Claims().applyOwnership(o, signers)
+}
+
+// CheckSigners checks that enough of the (already verified) signers are owners of did
+// and returns the ones that are.
+func (vc *VerifyCache) CheckSigners(ctx context.Context, getter graftabledag.DagGetter, did string, signers []string) ([]string, error) {
+	o, err := vc.ownership(ctx, getter, did)
+	if err != nil {
+		return nil, err
+	}
+	ownerSigners, ok := o.ownerSigners(signers)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d of %d required owners signed", ErrNotOwner, len(ownerSigners), o.threshold)
+	}
+	return ownerSigners, nil
+}
+
+func (vc *VerifyCache) ownership(ctx context.Context, getter graftabledag.DagGetter, did string) (*ownership, error) {
+	tip, err := getter.GetTip(ctx, did)
+	if err != nil {
+		logger.Errorf("error getting tip: %v", err)
+		return nil, fmt.Errorf("error getting tip: %w", err)
+	}
+
+	if existing, ok := vc.cache.Get(did); ok {
+		o := existing.(*ownership)
+		if o.isCurrent(ctx, getter, *tip) {
+			logger.Debugf("verify cache hit %s", did)
+			return o, nil
+		}
+	}
+
+	recorder := &graftRecorder{DagGetter: getter, did: did, tips: make(map[string]cid.Cid)}
+	o, err := resolveOwnership(ctx, recorder, did)
+	if err != nil {
+		return nil, err
+	}
+	o.grafts = recorder.tips
+	vc.cache.Add(did, o)
+	vc.lock.Lock()
+	for grafted := range o.grafts {
+		if vc.dependents[grafted] == nil {
+			vc.dependents[grafted] = make(map[string]bool)
+		}
+		vc.dependents[grafted][did] = true
+	}
+	vc.lock.Unlock()
+	return o, nil
+}
+
+// Evict removes any cached results for did and for the trees whose ownership was grafted from did,
+// it should be called whenever the tip of did changes.
+func (vc *VerifyCache) Evict(did string) {
+	vc.lock.Lock()
+	dependents := vc.dependents[did]
+	delete(vc.dependents, did)
+	vc.lock.Unlock()
+
+	// outside of the lock, removing calls onEvicted
+	vc.cache.Remove(did)
+	for dependent := range dependents {
+		logger.Debugf("evicting %s grafted from %s", dependent, did)
+		vc.cache.Remove(dependent)
+	}
+}
+
+// onEvicted forgets the grafts of an evicted did
+func (vc *VerifyCache) onEvicted(key interface{}, value interface{}) {
+	did := key.(string)
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+	for grafted := range value.(*ownership).grafts {
+		delete(vc.dependents[grafted], did)
+		if len(vc.dependents[grafted]) == 0 {
+			delete(vc.dependents, grafted)
+		}
+	}
+}
+
+// graftRecorder records the tips of the trees (other than did) that ownership is grafted from while resolving it
+type graftRecorder struct {
+	graftabledag.DagGetter
+	did string
+
+	lock sync.Mutex
+	tips map[string]cid.Cid
+}
+
+func (gr *graftRecorder) GetTip(ctx context.Context, did string) (*cid.Cid, error) {
+	tip, err := gr.DagGetter.GetTip(ctx, did)
+	if err == nil && tip != nil {
+		gr.record(did, *tip)
+	}
+	return tip, err
+}
+
+func (gr *graftRecorder) GetLatest(ctx context.Context, did string) (*chaintree.ChainTree, error) {
+	latest, err := gr.DagGetter.GetLatest(ctx, did)
+	if err == nil && latest != nil {
+		gr.record(did, latest.Dag.Tip)
+	}
+	return latest, err
+}
+
+func (gr *graftRecorder) record(did string, tip cid.Cid) {
+	if did == gr.did {
+		return
+	}
+	gr.lock.Lock()
+	defer gr.lock.Unlock()
+	gr.tips[did] = tip
+}
@@ -0,0 +1,112 @@
+package identity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/testgetter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	addr := crypto.PubkeyToAddress(key.PublicKey).String()
+	did := "did:tupelo:" + addr
+	ident, err := (&Identity{
+		Iss: did,
+		Sub: did,
+		Exp: time.Now().UTC().Unix() + 5000,
+	}).Sign(key)
+	require.Nil(t, err)
+
+	cache, err := NewVerifyCache(10)
+	require.Nil(t, err)
+
+	tree := testgetter.NewChaintreeOwnedBy(t, ctx, addr, []string{addr})
+	getter := testgetter.NewDagGetter(t, ctx, tree)
+
+	verified, err := cache.Verify(ctx, getter, ident)
+	require.Nil(t, err)
+	require.True(t, verified)
+	require.True(t, cache.cache.Contains(did))
+
+	// same did, but the tip has moved to a version without the signer as an owner
+	tree2 := testgetter.NewChaintreeOwnedBy(t, ctx, addr, []string{})
+	getter2 := testgetter.NewDagGetter(t, ctx, tree2)
+
+	verified, err = cache.Verify(ctx, getter2, ident)
+	require.Nil(t, err)
+	require.False(t, verified)
+
+	cache.Evict(did)
+	require.False(t, cache.cache.Contains(did))
+
+	// signatures are still checked on a cache hit
+	verified, err = cache.Verify(ctx, getter, ident)
+	require.Nil(t, err)
+	require.True(t, verified)
+
+	expired, err := (&Identity{
+		Iss: did,
+		Sub: did,
+		Exp: time.Now().UTC().Unix() - 1,
+	}).Sign(key)
+	require.Nil(t, err)
+	verified, err = cache.Verify(ctx, getter, expired)
+	require.Nil(t, err)
+	require.False(t, verified)
+}
+
+func TestVerifyCacheGraftedOwnership(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	addr := crypto.PubkeyToAddress(key.PublicKey).String()
+	did := "did:tupelo:subject"
+	ident, err := (&Identity{
+		Iss: did,
+		Sub: did,
+		Exp: time.Now().UTC().Unix() + 5000,
+	}).Sign(key)
+	require.Nil(t, err)
+
+	cache, err := NewVerifyCache(10)
+	require.Nil(t, err)
+
+	subject := testgetter.NewChaintreeOwnedBy(t, ctx, "subject", []string{"did:tupelo:owner/tree/_tupelo/authentications"})
+	owner := testgetter.NewChaintreeOwnedBy(t, ctx, "owner", []string{addr})
+	getter := testgetter.NewDagGetter(t, ctx, subject, owner)
+
+	verified, err := cache.Verify(ctx, getter, ident)
+	require.Nil(t, err)
+	require.True(t, verified)
+
+	t.Run("is not used once the grafted tree has moved on", func(t *testing.T) {
+		// same subject tip, but the owner tree no longer has the signer as an owner
+		movedOwner := testgetter.NewChaintreeOwnedBy(t, ctx, "owner", []string{})
+		movedGetter := testgetter.NewDagGetter(t, ctx, subject, movedOwner)
+
+		verified, err := cache.Verify(ctx, movedGetter, ident)
+		require.Nil(t, err)
+		require.False(t, verified)
+	})
+
+	t.Run("evicting the grafted tree evicts the subject", func(t *testing.T) {
+		verified, err := cache.Verify(ctx, getter, ident)
+		require.Nil(t, err)
+		require.True(t, verified)
+		require.True(t, cache.cache.Contains(did))
+
+		cache.Evict("did:tupelo:owner")
+		require.False(t, cache.cache.Contains(did))
+		require.Len(t, cache.dependents, 0)
+	})
+}
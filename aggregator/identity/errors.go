@@ -0,0 +1,37 @@
+package identity
+
+import "errors"
+
+// The reasons a presented identity (or session) fails verification. Errors returned
+// from Check wrap one of these, any other error means verification itself failed
+// (for instance the subject tree could not be loaded).
+var (
+	ErrMalformed        = errors.New("malformed identity")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("identity expired")
+	ErrNotOwner         = errors.New("not an owner")
+	ErrRevoked          = errors.New("session revoked")
+)
+
+// IsUnverified returns true when err is one of the reasons an identity
+// fails verification (as opposed to an error while verifying).
+func IsUnverified(err error) bool {
+	for _, reason := range []error{ErrMalformed, ErrInvalidSignature, ErrExpired, ErrNotOwner, ErrRevoked} {
+		if errors.Is(err, reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkToVerify converts the result of a Check into the (verified, error) of Verify
+func checkToVerify(err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	if IsUnverified(err) {
+		logger.Debugf("unverified: %v", err)
+		return false, nil
+	}
+	return false, err
+}
@@ -11,13 +11,11 @@ import (
 	logging "github.com/ipfs/go-log"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/crypto"
 	cbornode "github.com/ipfs/go-ipld-cbor"
 	format "github.com/ipfs/go-ipld-format"
 	"github.com/quorumcontrol/chaintree/graftabledag"
 	"github.com/quorumcontrol/chaintree/safewrap"
 	"github.com/quorumcontrol/chaintree/typecaster"
-	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
 )
 
 var logger = logging.Logger("identity")
@@ -29,13 +27,17 @@ func init() {
 	typecaster.AddType(Identity{})
 	cbornode.RegisterCborType(IdentityWithSignature{})
 	typecaster.AddType(IdentityWithSignature{})
+	cbornode.RegisterCborType(IdentityWithSignatures{})
+	typecaster.AddType(IdentityWithSignatures{})
+	cbornode.RegisterCborType(Signature{})
+	typecaster.AddType(Signature{})
 }
 
 // Unfortunately to use either JWT or HTTP Signature authorization would require going through
 // a lot of hoops because the only identifier we have in a ChainTree is the *address* which requires
 // the specific libseccp256 curve to authenticate against and that isn't supported
 // by any of the bodies - so we're going to create our own auth (boo) but model it
-// on JWTs
+// on JWTs. Ed25519 and P-256 keys are supported as well (see scheme.go).
 
 func nodeToHash(node format.Node) []byte {
 	multiHash := []byte(node.Cid().Hash())
@@ -50,87 +52,142 @@ type Identity struct {
 	Aud string // can be used by policy but not used by server
 	Exp int64  // seconds since the epoch
 	Iat int64  // seconds since the epoch
+
+	// Signers is not part of the signed claims, it is set during verification
+	// to the owner addresses that signed the identity (and so it is available to policies).
+	Signers []string `refmt:"signers,omitempty"`
 }
 
 type IdentityWithSignature struct {
 	Identity
 	Signature []byte
+
+	// Scheme is the signature scheme (see scheme.go), empty means Secp256k1
+	Scheme string `refmt:"scheme,omitempty"`
+	// PublicKey is required for schemes that cannot recover the key from the signature
+	PublicKey []byte `refmt:"publicKey,omitempty"`
 }
 
-func (i *Identity) Sign(key *ecdsa.PrivateKey) (*IdentityWithSignature, error) {
+// Token is a signed Identity, either an IdentityWithSignature or an IdentityWithSignatures
+type Token interface {
+	Verify(ctx context.Context, getter graftabledag.DagGetter) (bool, error)
+	// Check is the same as Verify but returns the reason verification failed (see errors.go)
+	Check(ctx context.Context, getter graftabledag.DagGetter) error
+	// Claims returns the signed Identity, after a successful Verify its Signers are set.
+	Claims() *Identity
+	String() string
+
+	// verifiedSigners checks the signatures and expiration (but not ownership)
+	// and returns the addresses that signed
+	verifiedSigners() ([]string, error)
+}
+
+var _ Token = (*IdentityWithSignature)(nil)
+
+// claimsHash is the hash that is signed, it excludes the Signers
+func (i *Identity) claimsHash() ([]byte, error) {
+	claims := *i
+	claims.Signers = nil
 	sw := &safewrap.SafeWrap{}
-	wrapped := sw.WrapObject(i)
+	wrapped := sw.WrapObject(claims)
 	if sw.Err != nil {
 		return nil, fmt.Errorf("error wrapping: %w", sw.Err)
 	}
+	return nodeToHash(wrapped), nil
+}
+
+func (i *Identity) checkExpiration() error {
+	now := time.Now().UTC().Unix()
+	if now > i.Exp {
+		logger.Warningf("expired identity: now %d, exp: %d", now, i.Exp)
+		return fmt.Errorf("%w: now %d, exp: %d", ErrExpired, now, i.Exp)
+	}
+	return nil
+}
+
+// Sign signs the identity with a secp256k1 key, see SignWith for other schemes
+func (i *Identity) Sign(key *ecdsa.PrivateKey) (*IdentityWithSignature, error) {
+	return i.SignWith(&Secp256k1Signer{Key: key})
+}
+
+func (i *Identity) SignWith(signer Signer) (*IdentityWithSignature, error) {
+	hsh, err := i.claimsHash()
+	if err != nil {
+		return nil, err
+	}
 
-	sig, err := crypto.Sign(nodeToHash(wrapped), key)
+	sig, err := signer.Sign(hsh)
 	if err != nil {
 		return nil, fmt.Errorf("error signing: %w", err)
 	}
-	return &IdentityWithSignature{
-		Identity:  *i,
+	claims := *i
+	claims.Signers = nil
+	is := &IdentityWithSignature{
+		Identity:  claims,
 		Signature: sig,
-	}, nil
+		PublicKey: signer.PublicKey(),
+	}
+	// leave secp256k1 empty so that the encoding is unchanged for existing clients
+	if signer.Scheme() != Secp256k1 {
+		is.Scheme = signer.Scheme()
+	}
+	return is, nil
 }
 
 func (is *IdentityWithSignature) Verify(ctx context.Context, getter graftabledag.DagGetter) (bool, error) {
-	logger.Debugf("Verifying identity: %s", spew.Sdump(is.Identity))
-	sw := &safewrap.SafeWrap{}
-	wrapped := sw.WrapObject(is.Identity)
-	if sw.Err != nil {
-		return false, fmt.Errorf("error wrapping: %w", sw.Err)
-	}
+	return checkToVerify(check(ctx, getter, is))
+}
 
-	hsh := nodeToHash(wrapped)
-	logger.Debugf("verifying %s", hexutil.Encode(hsh))
+func (is *IdentityWithSignature) Check(ctx context.Context, getter graftabledag.DagGetter) error {
+	return check(ctx, getter, is)
+}
+
+func (is *IdentityWithSignature) Claims() *Identity {
+	return &is.Identity
+}
 
-	recoveredPub, err := crypto.SigToPub(hsh, is.Signature)
+func (is *IdentityWithSignature) verifiedSigners() ([]string, error) {
+	logger.Debugf("Verifying identity: %s", spew.Sdump(is.Identity))
+	addr, err := verifySignature(&is.Identity, is.signature())
 	if err != nil {
-		return false, fmt.Errorf("error recovering signature: %w", err)
+		return nil, err
 	}
-
-	verified := crypto.VerifySignature(crypto.FromECDSAPub(recoveredPub), hsh, is.Signature[:len(is.Signature)-1])
-	if !verified {
-		logger.Warningf("unverified signature")
-		return false, nil
+	if err := is.checkExpiration(); err != nil {
+		return nil, err
 	}
+	return []string{addr}, nil
+}
 
-	now := time.Now().UTC().Unix()
-
-	if now > is.Identity.Exp {
-		logger.Warningf("expired identity: now %d, exp: %d", now, is.Identity.Exp)
-		return false, nil
+func (is *IdentityWithSignature) signature() *Signature {
+	return &Signature{
+		Scheme:    is.Scheme,
+		PublicKey: is.PublicKey,
+		Signature: is.Signature,
 	}
-	latest, err := getter.GetLatest(ctx, is.Sub)
-	if err != nil {
-		logger.Errorf("error getting latest: %v", err)
-		return false, fmt.Errorf("error getting latest: %w", err)
-	}
-	graftedOwnership, err := types.NewGraftedOwnership(latest.Dag, getter)
+}
+
+// verifySignature checks a single signature over the claims and returns the address that signed it.
+func verifySignature(claims *Identity, sig *Signature) (string, error) {
+	hsh, err := claims.claimsHash()
 	if err != nil {
-		logger.Errorf("error getting ownership: %v", err)
-		return false, fmt.Errorf("error getting ownership: %w", err)
+		return "", fmt.Errorf("%w: %v", ErrMalformed, err)
 	}
+	logger.Debugf("verifying %s", hexutil.Encode(hsh))
+	return sig.Address(hsh)
+}
 
-	addrs, err := graftedOwnership.ResolveOwners(ctx)
+// check checks the signatures of the token and then that enough of the signers
+// are owners of the subject (see ownership).
+func check(ctx context.Context, getter graftabledag.DagGetter, t Token) error {
+	signers, err := t.verifiedSigners()
 	if err != nil {
-		logger.Errorf("error resolving owners: %v", err)
-		return false, fmt.Errorf("error resolving owners: %w", err)
+		return err
 	}
-	identityAddr, err := is.Address()
+	o, err := resolveOwnership(ctx, getter, t.Claims().Sub)
 	if err != nil {
-		logger.Errorf("error getting addr: %v", err)
-		return false, fmt.Errorf("error getting addr: %w", err)
-	}
-	logger.Debugf("addrs: %v, identity Addr: %s", addrs, identityAddr)
-	for _, addr := range addrs {
-		if addr == identityAddr {
-			return true, nil
-		}
+		return err
 	}
-	logger.Debugf("no addr found")
-	return false, nil
+	return t.Claims().applyOwnership(o, signers)
 }
 
 func (is *IdentityWithSignature) String() string {
@@ -139,27 +196,22 @@ func (is *IdentityWithSignature) String() string {
 	return base64.StdEncoding.EncodeToString(wrapped.RawData())
 }
 
+// Address returns the owner string of the signer (an Ethereum address for secp256k1)
 func (is *IdentityWithSignature) Address() (string, error) {
-	sw := &safewrap.SafeWrap{}
-	wrapped := sw.WrapObject(is.Identity)
-	if sw.Err != nil {
-		return "", fmt.Errorf("error wrapping: %w", sw.Err)
-	}
-	recoveredPub, err := crypto.SigToPub(nodeToHash(wrapped), is.Signature)
-	if err != nil {
-		return "", fmt.Errorf("error recovering signature: %w", err)
-	}
-	return crypto.PubkeyToAddress(*recoveredPub).String(), nil
+	return verifySignature(&is.Identity, is.signature())
 }
 
 func FromString(base64EncodedString string) (*IdentityWithSignature, error) {
 	bits, err := base64.StdEncoding.DecodeString(base64EncodedString)
 	if err != nil {
-		return nil, fmt.Errorf("error decoding: %v", err)
+		return nil, fmt.Errorf("%w: error decoding: %v", ErrMalformed, err)
 	}
 	is := &IdentityWithSignature{}
 	err = cbornode.DecodeInto(bits, is)
-	return is, err
+	if err != nil {
+		return nil, fmt.Errorf("%w: error decoding: %v", ErrMalformed, err)
+	}
+	return is, nil
 }
 
 func FromHeader(headers map[string][]string) (*IdentityWithSignature, error) {
@@ -173,3 +225,39 @@ func FromHeader(headers map[string][]string) (*IdentityWithSignature, error) {
 	}
 	return FromString(head[0])
 }
+
+// TokenFromString decodes either a single or a multi signature identity
+func TokenFromString(base64EncodedString string) (Token, error) {
+	bits, err := base64.StdEncoding.DecodeString(base64EncodedString)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error decoding: %v", ErrMalformed, err)
+	}
+	fields := make(map[string]interface{})
+	err = cbornode.DecodeInto(bits, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error decoding: %v", ErrMalformed, err)
+	}
+	var t Token
+	if _, ok := fields["signatures"]; ok {
+		t = &IdentityWithSignatures{}
+	} else {
+		t = &IdentityWithSignature{}
+	}
+	err = cbornode.DecodeInto(bits, t)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error decoding: %v", ErrMalformed, err)
+	}
+	return t, nil
+}
+
+// TokenFromHeader is the same as FromHeader, but also supports multi signature identities
+func TokenFromHeader(headers map[string][]string) (Token, error) {
+	head, ok := headers[IdentityHeaderField]
+	if !ok {
+		return nil, nil
+	}
+	if head[0] == "" {
+		return nil, nil
+	}
+	return TokenFromString(head[0])
+}
@@ -2,6 +2,7 @@ package identity
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -47,6 +48,7 @@ func TestVerify(t *testing.T) {
 	verified, err := ident.Verify(ctx, getter)
 	require.Nil(t, err)
 	require.True(t, verified)
+	require.Equal(t, []string{addr}, ident.Signers)
 
 	// it fails when the tree isn't owned by the signer
 	tree2 := testgetter.NewChaintreeOwnedBy(t, ctx, addr, []string{})
@@ -90,3 +92,55 @@ func TestFromString(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, ident.Identity.Iss, newIdent.Identity.Iss)
 }
+
+func TestTokenFromString(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err)
+
+	ident, err := (&Identity{
+		Iss: "did:justatest",
+		Exp: time.Now().UTC().Unix() + 5000,
+	}).Sign(key)
+	require.Nil(t, err)
+
+	token, err := TokenFromString(ident.String())
+	require.Nil(t, err)
+	require.IsType(t, &IdentityWithSignature{}, token)
+	require.Equal(t, ident.Identity.Iss, token.Claims().Iss)
+}
+
+func TestCheckErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	addr := crypto.PubkeyToAddress(key.PublicKey).String()
+	did := "did:tupelo:" + addr
+	getter := testgetter.NewDagGetter(t, ctx, testgetter.NewChaintreeOwnedBy(t, ctx, addr, []string{addr}))
+
+	_, err = TokenFromString("notanidentity")
+	assert.True(t, errors.Is(err, ErrMalformed))
+
+	expired, err := (&Identity{Iss: did, Sub: did, Exp: time.Now().UTC().Unix() - 1}).Sign(key)
+	require.Nil(t, err)
+	assert.True(t, errors.Is(expired.Check(ctx, getter), ErrExpired))
+
+	tampered, err := (&Identity{Iss: did, Sub: did, Exp: time.Now().UTC().Unix() + 5000}).Sign(key)
+	require.Nil(t, err)
+	tampered.Signature = tampered.Signature[1:]
+	assert.True(t, errors.Is(tampered.Check(ctx, getter), ErrInvalidSignature))
+
+	otherKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	other, err := (&Identity{Iss: did, Sub: did, Exp: time.Now().UTC().Unix() + 5000}).Sign(otherKey)
+	require.Nil(t, err)
+	err = other.Check(ctx, getter)
+	assert.True(t, errors.Is(err, ErrNotOwner))
+	assert.True(t, IsUnverified(err))
+
+	// Verify hides the reason
+	verified, err := other.Verify(ctx, getter)
+	require.Nil(t, err)
+	require.False(t, verified)
+}
@@ -0,0 +1,136 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/quorumcontrol/chaintree/graftabledag"
+	"github.com/quorumcontrol/chaintree/safewrap"
+)
+
+// IdentityWithSignatures is an identity signed by multiple keys (over the same claims).
+// It verifies when at least the subject tree's threshold (see ThresholdPath) of the signers
+// are owners of the tree.
+type IdentityWithSignatures struct {
+	Identity
+	Signatures []Signature
+}
+
+// Signature is one of the signatures of an IdentityWithSignatures
+type Signature struct {
+	Signature []byte
+	// Scheme is the signature scheme (see scheme.go), empty means Secp256k1
+	Scheme    string `refmt:"scheme,omitempty"`
+	PublicKey []byte `refmt:"publicKey,omitempty"`
+}
+
+var _ Token = (*IdentityWithSignatures)(nil)
+
+// CombineSignatures takes identities signed separately (by each of the owners)
+// and combines them into a single IdentityWithSignatures. The claims must be identical.
+func CombineSignatures(identities ...*IdentityWithSignature) (*IdentityWithSignatures, error) {
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no identities to combine")
+	}
+	expected, err := identities[0].claimsHash()
+	if err != nil {
+		return nil, err
+	}
+	sigs := make([]Signature, len(identities))
+	for i, is := range identities {
+		hsh, err := is.claimsHash()
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(expected, hsh) {
+			return nil, fmt.Errorf("identity %d has different claims", i)
+		}
+		sigs[i] = *is.signature()
+	}
+	claims := identities[0].Identity
+	claims.Signers = nil
+	return &IdentityWithSignatures{
+		Identity:   claims,
+		Signatures: sigs,
+	}, nil
+}
+
+// SignHash signs an arbitrary hash (for instance of a message) rather than the claims of an identity
+func SignHash(signer Signer, hsh []byte) (*Signature, error) {
+	sig, err := signer.Sign(hsh)
+	if err != nil {
+		return nil, fmt.Errorf("error signing: %w", err)
+	}
+	s := &Signature{
+		Signature: sig,
+		PublicKey: signer.PublicKey(),
+	}
+	if signer.Scheme() != Secp256k1 {
+		s.Scheme = signer.Scheme()
+	}
+	return s, nil
+}
+
+// Address verifies the signature over hsh and returns the owner string of the signer
+func (s *Signature) Address(hsh []byte) (string, error) {
+	scheme, err := SchemeFor(s.Scheme)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	addr, verified, err := scheme.Verify(hsh, s.Signature, s.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if !verified {
+		logger.Warningf("unverified signature")
+		return "", ErrInvalidSignature
+	}
+	return addr, nil
+}
+
+func (is *IdentityWithSignatures) Verify(ctx context.Context, getter graftabledag.DagGetter) (bool, error) {
+	return checkToVerify(check(ctx, getter, is))
+}
+
+func (is *IdentityWithSignatures) Check(ctx context.Context, getter graftabledag.DagGetter) error {
+	return check(ctx, getter, is)
+}
+
+func (is *IdentityWithSignatures) Claims() *Identity {
+	return &is.Identity
+}
+
+func (is *IdentityWithSignatures) verifiedSigners() ([]string, error) {
+	if len(is.Signatures) == 0 {
+		return nil, fmt.Errorf("%w: no signatures", ErrMalformed)
+	}
+	addrs, err := is.Addresses()
+	if err != nil {
+		return nil, err
+	}
+	if err := is.checkExpiration(); err != nil {
+		return nil, err
+	}
+	return addrs, nil
+}
+
+// Addresses returns the addresses of all the signers (whether they are owners or not)
+func (is *IdentityWithSignatures) Addresses() ([]string, error) {
+	addrs := make([]string, len(is.Signatures))
+	for i := range is.Signatures {
+		addr, err := verifySignature(&is.Identity, &is.Signatures[i])
+		if err != nil {
+			return nil, err
+		}
+		addrs[i] = addr
+	}
+	return addrs, nil
+}
+
+func (is *IdentityWithSignatures) String() string {
+	sw := &safewrap.SafeWrap{}
+	wrapped := sw.WrapObject(is)
+	return base64.StdEncoding.EncodeToString(wrapped.RawData())
+}
@@ -0,0 +1,112 @@
+package identity
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/testgetter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiSignatureVerify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keys := make([]*ecdsa.PrivateKey, 3)
+	addrs := make([]string, 3)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		keys[i] = key
+		addrs[i] = crypto.PubkeyToAddress(key.PublicKey).String()
+	}
+	outsider, err := crypto.GenerateKey()
+	require.Nil(t, err)
+
+	name := "organization"
+	did := "did:tupelo:" + name
+	tree := testgetter.NewChaintreeWithNodes(t, ctx, name, map[string]interface{}{
+		"_tupelo": map[string]interface{}{
+			"authentications": addrs,
+		},
+		"data": map[string]interface{}{
+			".well-known": map[string]interface{}{
+				"threshold": 2,
+			},
+		},
+	})
+	getter := testgetter.NewDagGetter(t, ctx, tree)
+
+	claims := &Identity{
+		Iss: did,
+		Sub: did,
+		Exp: time.Now().UTC().Unix() + 5000,
+	}
+
+	sign := func(keys ...*ecdsa.PrivateKey) *IdentityWithSignatures {
+		signed := make([]*IdentityWithSignature, len(keys))
+		for i, key := range keys {
+			is, err := claims.Sign(key)
+			require.Nil(t, err)
+			signed[i] = is
+		}
+		combined, err := CombineSignatures(signed...)
+		require.Nil(t, err)
+		return combined
+	}
+
+	t.Run("a single signature does not meet the threshold", func(t *testing.T) {
+		single, err := claims.Sign(keys[0])
+		require.Nil(t, err)
+		verified, err := single.Verify(ctx, getter)
+		require.Nil(t, err)
+		require.False(t, verified)
+	})
+
+	t.Run("two owners meet the threshold", func(t *testing.T) {
+		multi := sign(keys[0], keys[1])
+		verified, err := multi.Verify(ctx, getter)
+		require.Nil(t, err)
+		require.True(t, verified)
+		assert.ElementsMatch(t, addrs[0:2], multi.Signers)
+	})
+
+	t.Run("the same owner twice does not meet the threshold", func(t *testing.T) {
+		multi := sign(keys[0], keys[0])
+		verified, err := multi.Verify(ctx, getter)
+		require.Nil(t, err)
+		require.False(t, verified)
+	})
+
+	t.Run("non-owners do not count", func(t *testing.T) {
+		multi := sign(keys[0], outsider)
+		verified, err := multi.Verify(ctx, getter)
+		require.Nil(t, err)
+		require.False(t, verified)
+	})
+
+	t.Run("survives serialization", func(t *testing.T) {
+		multi := sign(keys[1], keys[2])
+		token, err := TokenFromString(multi.String())
+		require.Nil(t, err)
+		require.IsType(t, &IdentityWithSignatures{}, token)
+
+		verified, err := token.Verify(ctx, getter)
+		require.Nil(t, err)
+		require.True(t, verified)
+		assert.ElementsMatch(t, addrs[1:3], token.Claims().Signers)
+	})
+
+	t.Run("cannot combine different claims", func(t *testing.T) {
+		is1, err := claims.Sign(keys[0])
+		require.Nil(t, err)
+		is2, err := (&Identity{Iss: did, Sub: did, Exp: claims.Exp + 1}).Sign(keys[1])
+		require.Nil(t, err)
+		_, err = CombineSignatures(is1, is2)
+		require.NotNil(t, err)
+	})
+}
@@ -0,0 +1,160 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/chaintree/graftabledag"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+)
+
+// ThresholdPath is where a tree can require more than one of its owners to sign an identity
+// (M-of-N). It lives in tree/data rather than tree/_tupelo because SET_DATA can only set paths
+// within tree/data (".well-known/threshold"), so it is policy.ThresholdValidator that keeps a single
+// owner from changing it. Trees without a threshold require one signer.
+var ThresholdPath = []string{"tree", "data", ".well-known", "threshold"}
+
+// ChangesOwnership is true when the block sets the owners of the tree or a data path that overlaps
+// its threshold (".well-known", ".well-known/threshold" or anything under it)
+func ChangesOwnership(blockWithHeaders *chaintree.BlockWithHeaders) bool {
+	thresholdPath := ThresholdPath[2:]
+	for _, txn := range blockWithHeaders.Transactions {
+		switch txn.Type {
+		case transactions.Transaction_SETOWNERSHIP:
+			return true
+		case transactions.Transaction_SETDATA:
+			var path []string
+			for _, segment := range strings.Split(txn.GetSetDataPayload().Path, "/") {
+				if segment != "" {
+					path = append(path, segment)
+				}
+			}
+			overlaps := true
+			for i := 0; i < len(path) && i < len(thresholdPath); i++ {
+				if path[i] != thresholdPath[i] {
+					overlaps = false
+					break
+				}
+			}
+			if overlaps {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ownership is the resolved (grafted) owners and the signing threshold of a tree at a tip
+type ownership struct {
+	tip       cid.Cid
+	grafts    map[string]cid.Cid // did -> tip of the trees the owners were grafted from
+	owners    []string
+	threshold uint64
+}
+
+// isCurrent returns whether the tree is still at tip and the trees the owners were grafted from are still at theirs
+// (an error getting a tip counts as moved on, resolving the ownership again surfaces it).
+func (o *ownership) isCurrent(ctx context.Context, getter graftabledag.DagGetter, tip cid.Cid) bool {
+	if !o.tip.Equals(tip) {
+		return false
+	}
+	for did, graftTip := range o.grafts {
+		current, err := getter.GetTip(ctx, did)
+		if err != nil || current == nil || !current.Equals(graftTip) {
+			return false
+		}
+	}
+	return true
+}
+
+func resolveOwnership(ctx context.Context, getter graftabledag.DagGetter, did string) (*ownership, error) {
+	latest, err := getter.GetLatest(ctx, did)
+	if err != nil {
+		logger.Errorf("error getting latest: %v", err)
+		return nil, fmt.Errorf("error getting latest: %w", err)
+	}
+	graftedOwnership, err := types.NewGraftedOwnership(latest.Dag, getter)
+	if err != nil {
+		logger.Errorf("error getting ownership: %v", err)
+		return nil, fmt.Errorf("error getting ownership: %w", err)
+	}
+
+	addrs, err := graftedOwnership.ResolveOwners(ctx)
+	if err != nil {
+		logger.Errorf("error resolving owners: %v", err)
+		return nil, fmt.Errorf("error resolving owners: %w", err)
+	}
+
+	threshold, err := Threshold(ctx, latest.Dag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ownership{
+		tip:       latest.Dag.Tip,
+		owners:    addrs,
+		threshold: threshold,
+	}, nil
+}
+
+// Threshold returns the number of owners that have to sign for tree (see ThresholdPath)
+func Threshold(ctx context.Context, tree *dag.Dag) (uint64, error) {
+	val, remain, err := tree.Resolve(ctx, ThresholdPath)
+	if err != nil {
+		return 0, fmt.Errorf("error resolving threshold: %w", err)
+	}
+	if len(remain) > 0 || val == nil {
+		return 1, nil
+	}
+	var threshold uint64
+	switch val := val.(type) {
+	case uint64:
+		threshold = val
+	case int64:
+		threshold = uint64(val)
+	case int:
+		threshold = uint64(val)
+	default:
+		return 0, fmt.Errorf("invalid threshold type: %T", val)
+	}
+	if threshold == 0 {
+		return 1, nil
+	}
+	return threshold, nil
+}
+
+// ownerSigners returns the (unique) signers that are owners and whether
+// there are enough of them to meet the threshold
+func (o *ownership) ownerSigners(signers []string) ([]string, bool) {
+	isOwner := make(map[string]bool, len(o.owners))
+	for _, owner := range o.owners {
+		isOwner[owner] = true
+	}
+
+	var ownerSigners []string
+	seen := make(map[string]bool, len(signers))
+	for _, signer := range signers {
+		if isOwner[signer] && !seen[signer] {
+			ownerSigners = append(ownerSigners, signer)
+		}
+		seen[signer] = true
+	}
+	logger.Debugf("owners: %v, signers: %v, threshold: %d", o.owners, signers, o.threshold)
+	return ownerSigners, uint64(len(ownerSigners)) >= o.threshold
+}
+
+// applyOwnership sets the Signers of the identity if the signers meet the ownership requirements
+func (i *Identity) applyOwnership(o *ownership, signers []string) error {
+	ownerSigners, ok := o.ownerSigners(signers)
+	if !ok {
+		logger.Debugf("not enough owners signed")
+		return fmt.Errorf("%w: %d of %d required owners signed", ErrNotOwner, len(ownerSigners), o.threshold)
+	}
+	i.Signers = ownerSigners
+	return nil
+}
@@ -0,0 +1,298 @@
+package identity
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Supported signature schemes. An empty scheme in a token means Secp256k1 so
+// that tokens created before schemes existed keep working.
+const (
+	Secp256k1 = "secp256k1"
+	Ed25519   = "ed25519"
+	P256      = "p256"
+)
+
+// Scheme verifies signatures over the claims hash and turns public keys into
+// the owner strings that are stored in a tree's _tupelo/authentications.
+// Secp256k1 owners are Ethereum addresses, other schemes are prefixed
+// with the scheme name, for instance "ed25519:0x<hex public key>".
+type Scheme interface {
+	Name() string
+	// Verify checks sig over hsh and returns the owner string of the key that signed it.
+	// publicKey may be empty for schemes that can recover the key from the signature.
+	Verify(hsh, sig, publicKey []byte) (string, bool, error)
+	// Address returns the owner string of publicKey
+	Address(publicKey []byte) (string, error)
+}
+
+// Signer signs the claims hash with a private key of a Scheme.
+type Signer interface {
+	Scheme() string
+	// PublicKey is included in the token for schemes that cannot recover it from the signature
+	PublicKey() []byte
+	Sign(hsh []byte) ([]byte, error)
+}
+
+var schemes = map[string]Scheme{
+	Secp256k1: secp256k1Scheme{},
+	Ed25519:   ed25519Scheme{},
+	P256:      p256Scheme{},
+}
+
+// RegisterScheme makes an additional signature scheme available to tokens.
+// It is not safe to call concurrently with verification and should be called from init.
+func RegisterScheme(s Scheme) {
+	schemes[s.Name()] = s
+}
+
+// SchemeFor returns the registered scheme with name, an empty name is Secp256k1
+func SchemeFor(name string) (Scheme, error) {
+	if name == "" {
+		name = Secp256k1
+	}
+	s, ok := schemes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown signature scheme: %s", name)
+	}
+	return s, nil
+}
+
+// PublicKeyToAddress returns the owner string for a public key of scheme,
+// this is what needs to be set as an owner of a tree for the key to authenticate.
+func PublicKeyToAddress(scheme string, publicKey []byte) (string, error) {
+	s, err := SchemeFor(scheme)
+	if err != nil {
+		return "", err
+	}
+	return s.Address(publicKey)
+}
+
+// secp256k1 signatures are recoverable (65 bytes), so no public key is needed
+type secp256k1Scheme struct{}
+
+func (secp256k1Scheme) Name() string {
+	return Secp256k1
+}
+
+func (secp256k1Scheme) Verify(hsh, sig, _ []byte) (string, bool, error) {
+	if len(sig) != 65 {
+		logger.Warningf("invalid secp256k1 signature length: %d", len(sig))
+		return "", false, nil
+	}
+	recoveredPub, err := crypto.SigToPub(hsh, sig)
+	if err != nil {
+		return "", false, fmt.Errorf("error recovering signature: %w", err)
+	}
+
+	verified := crypto.VerifySignature(crypto.FromECDSAPub(recoveredPub), hsh, sig[:len(sig)-1])
+	if !verified {
+		return "", false, nil
+	}
+	return crypto.PubkeyToAddress(*recoveredPub).String(), true, nil
+}
+
+func (secp256k1Scheme) Address(publicKey []byte) (string, error) {
+	pub, err := crypto.UnmarshalPubkey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("error unmarshaling public key: %w", err)
+	}
+	return crypto.PubkeyToAddress(*pub).String(), nil
+}
+
+// ed25519 signs the claims hash directly as the message
+type ed25519Scheme struct{}
+
+func (ed25519Scheme) Name() string {
+	return Ed25519
+}
+
+func (s ed25519Scheme) Verify(hsh, sig, publicKey []byte) (string, bool, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		logger.Warningf("invalid ed25519 public key length: %d", len(publicKey))
+		return "", false, nil
+	}
+	if !ed25519.Verify(ed25519.PublicKey(publicKey), hsh, sig) {
+		return "", false, nil
+	}
+	addr, err := s.Address(publicKey)
+	if err != nil {
+		return "", false, err
+	}
+	return addr, true, nil
+}
+
+func (ed25519Scheme) Address(publicKey []byte) (string, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("invalid ed25519 public key length: %d", len(publicKey))
+	}
+	return Ed25519 + ":" + hexutil.Encode(publicKey), nil
+}
+
+// p256 is ECDSA with SHA-256 over the claims hash and a 64 byte r||s signature,
+// which is what WebCrypto produces for {name: "ECDSA", hash: "SHA-256"}.
+// Public keys are uncompressed (65 bytes, as exported as "raw" by WebCrypto)
+// or compressed (33 bytes), the address always uses the compressed form.
+type p256Scheme struct{}
+
+func (p256Scheme) Name() string {
+	return P256
+}
+
+func (s p256Scheme) Verify(hsh, sig, publicKey []byte) (string, bool, error) {
+	pub, err := unmarshalP256(publicKey)
+	if err != nil {
+		logger.Warningf("invalid p256 public key: %v", err)
+		return "", false, nil
+	}
+	if len(sig) != 64 {
+		logger.Warningf("invalid p256 signature length: %d", len(sig))
+		return "", false, nil
+	}
+	digest := sha256.Sum256(hsh)
+	r := new(big.Int).SetBytes(sig[:32])
+	sInt := new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(pub, digest[:], r, sInt) {
+		return "", false, nil
+	}
+	addr, err := s.Address(publicKey)
+	if err != nil {
+		return "", false, err
+	}
+	return addr, true, nil
+}
+
+func (p256Scheme) Address(publicKey []byte) (string, error) {
+	pub, err := unmarshalP256(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return P256 + ":" + hexutil.Encode(compressP256(pub.X, pub.Y)), nil
+}
+
+func unmarshalP256(publicKey []byte) (*ecdsa.PublicKey, error) {
+	var x, y *big.Int
+	switch len(publicKey) {
+	case 33:
+		x, y = decompressP256(publicKey)
+	case 65:
+		x, y = elliptic.Unmarshal(elliptic.P256(), publicKey)
+	}
+	if x == nil {
+		return nil, fmt.Errorf("invalid p256 public key")
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
+
+// compressP256 and decompressP256 are elliptic.MarshalCompressed and UnmarshalCompressed, which need Go 1.15
+func compressP256(x, y *big.Int) []byte {
+	compressed := make([]byte, 33)
+	compressed[0] = byte(y.Bit(0)) | 2
+	copy(compressed[1:], leftPad(x.Bytes(), 32))
+	return compressed
+}
+
+func decompressP256(data []byte) (*big.Int, *big.Int) {
+	params := elliptic.P256().Params()
+	if len(data) != 33 || (data[0] != 2 && data[0] != 3) {
+		return nil, nil
+	}
+	x := new(big.Int).SetBytes(data[1:])
+	if x.Cmp(params.P) >= 0 {
+		return nil, nil
+	}
+	// y² = x³ - 3x + b
+	y := new(big.Int).Mul(x, x)
+	y.Mul(y, x)
+	threeX := new(big.Int).Lsh(x, 1)
+	threeX.Add(threeX, x)
+	y.Sub(y, threeX)
+	y.Add(y, params.B)
+	y.Mod(y, params.P)
+	y = y.ModSqrt(y, params.P)
+	if y == nil {
+		return nil, nil
+	}
+	if byte(y.Bit(0)) != data[0]&1 {
+		y.Neg(y).Mod(y, params.P)
+	}
+	if !params.IsOnCurve(x, y) {
+		return nil, nil
+	}
+	return x, y
+}
+
+// leftPad pads b with zeros to size bytes (big.Int.FillBytes needs Go 1.15)
+func leftPad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+// Secp256k1Signer signs with a go-ethereum secp256k1 key
+type Secp256k1Signer struct {
+	Key *ecdsa.PrivateKey
+}
+
+func (s *Secp256k1Signer) Scheme() string {
+	return Secp256k1
+}
+
+// PublicKey is nil because the public key is recovered from the signature
+func (s *Secp256k1Signer) PublicKey() []byte {
+	return nil
+}
+
+func (s *Secp256k1Signer) Sign(hsh []byte) ([]byte, error) {
+	return crypto.Sign(hsh, s.Key)
+}
+
+// Ed25519Signer signs with an ed25519 key
+type Ed25519Signer struct {
+	Key ed25519.PrivateKey
+}
+
+func (s *Ed25519Signer) Scheme() string {
+	return Ed25519
+}
+
+func (s *Ed25519Signer) PublicKey() []byte {
+	return []byte(s.Key.Public().(ed25519.PublicKey))
+}
+
+func (s *Ed25519Signer) Sign(hsh []byte) ([]byte, error) {
+	return ed25519.Sign(s.Key, hsh), nil
+}
+
+// P256Signer signs with a NIST P-256 key
+type P256Signer struct {
+	Key *ecdsa.PrivateKey
+}
+
+func (s *P256Signer) Scheme() string {
+	return P256
+}
+
+func (s *P256Signer) PublicKey() []byte {
+	return compressP256(s.Key.X, s.Key.Y)
+}
+
+func (s *P256Signer) Sign(hsh []byte) ([]byte, error) {
+	digest := sha256.Sum256(hsh)
+	r, sInt, err := ecdsa.Sign(rand.Reader, s.Key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	return append(leftPad(r.Bytes(), 32), leftPad(sInt.Bytes(), 32)...), nil
+}
@@ -0,0 +1,172 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/testgetter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	secpKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+
+	signers := map[string]Signer{
+		Secp256k1: &Secp256k1Signer{Key: secpKey},
+		Ed25519:   &Ed25519Signer{Key: edKey},
+		P256:      &P256Signer{Key: p256Key},
+	}
+
+	for name, signer := range signers {
+		signer := signer
+		t.Run(name, func(t *testing.T) {
+			addr, err := PublicKeyToAddress(signer.Scheme(), signer.PublicKey())
+			if name == Secp256k1 {
+				// secp256k1 signers do not include the public key
+				require.NotNil(t, err)
+				addr = crypto.PubkeyToAddress(secpKey.PublicKey).String()
+			} else {
+				require.Nil(t, err)
+				assert.Contains(t, addr, name+":0x")
+			}
+
+			did := "did:tupelo:" + name
+			tree := testgetter.NewChaintreeOwnedBy(t, ctx, name, []string{addr})
+			getter := testgetter.NewDagGetter(t, ctx, tree)
+
+			ident, err := (&Identity{
+				Iss: did,
+				Sub: did,
+				Exp: time.Now().UTC().Unix() + 5000,
+			}).SignWith(signer)
+			require.Nil(t, err)
+
+			token, err := TokenFromString(ident.String())
+			require.Nil(t, err)
+
+			verified, err := token.Verify(ctx, getter)
+			require.Nil(t, err)
+			require.True(t, verified)
+			assert.Equal(t, []string{addr}, token.Claims().Signers)
+
+			signerAddr, err := ident.Address()
+			require.Nil(t, err)
+			assert.Equal(t, addr, signerAddr)
+
+			t.Run("fails with tampered claims", func(t *testing.T) {
+				tampered := *ident
+				tampered.Exp++
+				verified, err := tampered.Verify(ctx, getter)
+				require.Nil(t, err)
+				require.False(t, verified)
+			})
+		})
+	}
+
+	t.Run("unknown schemes error", func(t *testing.T) {
+		ident, err := (&Identity{
+			Iss: "did:justatest",
+			Exp: time.Now().UTC().Unix() + 5000,
+		}).SignWith(signers[Ed25519])
+		require.Nil(t, err)
+		ident.Scheme = "unknown"
+
+		_, err = ident.Address()
+		require.NotNil(t, err)
+	})
+
+	t.Run("mixed multi signature", func(t *testing.T) {
+		edAddr, err := PublicKeyToAddress(Ed25519, signers[Ed25519].PublicKey())
+		require.Nil(t, err)
+		p256Addr, err := PublicKeyToAddress(P256, signers[P256].PublicKey())
+		require.Nil(t, err)
+
+		name := "mixed"
+		did := "did:tupelo:" + name
+		tree := testgetter.NewChaintreeWithNodes(t, ctx, name, map[string]interface{}{
+			"_tupelo": map[string]interface{}{
+				"authentications": []string{edAddr, p256Addr},
+			},
+			"data": map[string]interface{}{
+				".well-known": map[string]interface{}{
+					"threshold": 2,
+				},
+			},
+		})
+		getter := testgetter.NewDagGetter(t, ctx, tree)
+
+		claims := &Identity{
+			Iss: did,
+			Sub: did,
+			Exp: time.Now().UTC().Unix() + 5000,
+		}
+		edIdent, err := claims.SignWith(signers[Ed25519])
+		require.Nil(t, err)
+		p256Ident, err := claims.SignWith(signers[P256])
+		require.Nil(t, err)
+
+		combined, err := CombineSignatures(edIdent, p256Ident)
+		require.Nil(t, err)
+
+		token, err := TokenFromString(combined.String())
+		require.Nil(t, err)
+		verified, err := token.Verify(ctx, getter)
+		require.Nil(t, err)
+		require.True(t, verified)
+		assert.ElementsMatch(t, []string{edAddr, p256Addr}, token.Claims().Signers)
+	})
+}
+
+func TestP256UncompressedPublicKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	compressed, err := PublicKeyToAddress(P256, compressP256(key.X, key.Y))
+	require.Nil(t, err)
+	uncompressed, err := PublicKeyToAddress(P256, elliptic.Marshal(elliptic.P256(), key.X, key.Y))
+	require.Nil(t, err)
+	assert.Equal(t, compressed, uncompressed)
+}
+
+func TestP256Compression(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.Nil(t, err)
+
+		compressed := compressP256(key.X, key.Y)
+		require.Len(t, compressed, 33)
+		x, y := decompressP256(compressed)
+		require.NotNil(t, x)
+		assert.Equal(t, 0, key.X.Cmp(x))
+		assert.Equal(t, 0, key.Y.Cmp(y))
+	}
+
+	// x is not below the prime of the curve
+	invalid := bytes.Repeat([]byte{0xff}, 33)
+	invalid[0] = 2
+	x, _ := decompressP256(invalid)
+	assert.Nil(t, x)
+	x, _ = decompressP256(append([]byte{4}, invalid[1:]...))
+	assert.Nil(t, x)
+}
+
+func TestLeftPad(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 1, 2}, leftPad([]byte{1, 2}, 4))
+	assert.Equal(t, []byte{1, 2}, leftPad([]byte{1, 2}, 2))
+}
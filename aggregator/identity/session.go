@@ -0,0 +1,251 @@
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/safewrap"
+	"github.com/quorumcontrol/chaintree/typecaster"
+	"github.com/quorumcontrol/tupelo/signer/gossip"
+)
+
+const SessionHeaderField = "X-Tupelo-Session"
+
+// DefaultSessionDuration is how long a session is valid for when the SessionManager
+// is created without an explicit duration
+var DefaultSessionDuration = 5 * time.Minute
+
+func init() {
+	cbornode.RegisterCborType(Session{})
+	typecaster.AddType(Session{})
+}
+
+// Session is issued by the server in exchange for a verified IdentityWithSignature.
+// Unlike the IdentityWithSignature it is signed (HMAC-SHA256) with a secret
+// only the server knows, so verifying it does not require recovering a public key
+// or resolving the ownership of the subject tree.
+type Session struct {
+	Identity
+	// IssuedAt is when the session was issued in nanoseconds since the epoch (Iat is in seconds),
+	// so that it can be told apart from a revocation in the same second
+	IssuedAt  int64
+	Signature []byte
+}
+
+// revokedPrefix is where revocations are stored: /<did> -> nanoseconds since the epoch
+var revokedPrefix = datastore.NewKey("_sessions/revoked")
+
+// SessionManager issues and verifies sessions. It also keeps track of
+// subject DIDs whose ownership has changed so that sessions issued before the change
+// are no longer accepted.
+type SessionManager struct {
+	secret   []byte
+	duration time.Duration
+	store    datastore.Datastore
+
+	// GraftDependents returns the trees whose ownership is grafted from did, their sessions are revoked
+	// along with the sessions of did (optional, see HandleUpdate)
+	GraftDependents func(did string) ([]string, error)
+}
+
+// NewSessionManager returns a SessionManager signing with secret. If secret is empty
+// a random one is generated, which means sessions will only verify against this
+// SessionManager. Revocations are kept in store, which has to be shared by every
+// SessionManager verifying the sessions (in memory only when it is nil).
+func NewSessionManager(secret []byte, duration time.Duration, store datastore.Datastore) (*SessionManager, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			return nil, fmt.Errorf("error generating secret: %w", err)
+		}
+	}
+	if duration == 0 {
+		duration = DefaultSessionDuration
+	}
+	if store == nil {
+		store = dsync.MutexWrap(datastore.NewMapDatastore())
+	}
+	return &SessionManager{
+		secret:   secret,
+		duration: duration,
+		store:    store,
+	}, nil
+}
+
+// Duration returns how long newly issued sessions are valid for
+func (sm *SessionManager) Duration() time.Duration {
+	return sm.duration
+}
+
+// Issue creates a new session for an identity. The identity *must* already be verified.
+func (sm *SessionManager) Issue(id *Identity) (*Session, error) {
+	now := time.Now().UTC()
+	claims := *id
+	claims.Iat = now.Unix()
+	claims.Exp = now.Add(sm.duration).Unix()
+
+	session := &Session{
+		Identity: claims,
+		IssuedAt: now.UnixNano(),
+	}
+	sig, err := sm.sign(session)
+	if err != nil {
+		return nil, err
+	}
+	session.Signature = sig
+	return session, nil
+}
+
+// Verify checks the signature and expiration of the session and that
+// the ownership of the subject has not changed since it was issued.
+func (sm *SessionManager) Verify(s *Session) (bool, error) {
+	return checkToVerify(sm.Check(s))
+}
+
+// Check is the same as Verify but returns the reason verification failed (see errors.go)
+func (sm *SessionManager) Check(s *Session) error {
+	expected, err := sm.sign(s)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, s.Signature) {
+		logger.Warningf("unverified session")
+		return ErrInvalidSignature
+	}
+
+	if err := s.checkExpiration(); err != nil {
+		return err
+	}
+
+	bits, err := sm.store.Get(revokedPrefix.ChildString(s.Sub))
+	if err == datastore.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting revocation: %w", err)
+	}
+	revokedAt, err := strconv.ParseInt(string(bits), 10, 64)
+	if err != nil {
+		return fmt.Errorf("error parsing revocation: %w", err)
+	}
+	if s.IssuedAt <= revokedAt {
+		logger.Debugf("session for %s issued before revocation", s.Sub)
+		return ErrRevoked
+	}
+	return nil
+}
+
+// Revoke invalidates every session issued for did up until now.
+func (sm *SessionManager) Revoke(did string) error {
+	now := time.Now().UTC().UnixNano()
+	// there is at most one revocation per tree (the next one overwrites it)
+	err := sm.store.Put(revokedPrefix.ChildString(did), []byte(strconv.FormatInt(now, 10)))
+	if err != nil {
+		return fmt.Errorf("error storing revocation: %w", err)
+	}
+	return nil
+}
+
+// revokeWithDependents revokes the sessions of did and of the trees whose ownership is (transitively) grafted from it
+func (sm *SessionManager) revokeWithDependents(did string) error {
+	seen := map[string]bool{did: true}
+	queue := []string{did}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		logger.Debugf("revoking sessions for %s", next)
+		err := sm.Revoke(next)
+		if err != nil {
+			return err
+		}
+		if sm.GraftDependents == nil {
+			continue
+		}
+		dependents, err := sm.GraftDependents(next)
+		if err != nil {
+			return fmt.Errorf("error getting dependents of %s: %w", next, err)
+		}
+		for _, dependent := range dependents {
+			if !seen[dependent] {
+				seen[dependent] = true
+				queue = append(queue, dependent)
+			}
+		}
+	}
+	return nil
+}
+
+// HandleUpdate is meant to be called for every new block (see aggregator.UpdateFunc) and revokes sessions for the
+// tree (and the trees whose ownership is grafted from it) when the block changes the tree's owners or threshold
+// (see ChangesOwnership).
+func (sm *SessionManager) HandleUpdate(wrapper *gossip.AddBlockWrapper) {
+	block := &chaintree.BlockWithHeaders{}
+	err := cbornode.DecodeInto(wrapper.Payload, block)
+	if err != nil {
+		logger.Errorf("error decoding block: %v", err)
+		return
+	}
+	if !ChangesOwnership(block) {
+		return
+	}
+	err = sm.revokeWithDependents(string(wrapper.ObjectId))
+	if err != nil {
+		logger.Errorf("error revoking sessions for %s: %v", string(wrapper.ObjectId), err)
+	}
+}
+
+// sign signs the identity and issue time of the session
+func (sm *SessionManager) sign(s *Session) ([]byte, error) {
+	sw := &safewrap.SafeWrap{}
+	wrapped := sw.WrapObject(&s.Identity)
+	if sw.Err != nil {
+		return nil, fmt.Errorf("error wrapping: %w", sw.Err)
+	}
+	mac := hmac.New(sha256.New, sm.secret)
+	mac.Write(wrapped.RawData())
+	issuedAt := make([]byte, 8)
+	binary.BigEndian.PutUint64(issuedAt, uint64(s.IssuedAt))
+	mac.Write(issuedAt)
+	return mac.Sum(nil), nil
+}
+
+func (s *Session) String() string {
+	sw := &safewrap.SafeWrap{}
+	wrapped := sw.WrapObject(s)
+	return base64.StdEncoding.EncodeToString(wrapped.RawData())
+}
+
+func SessionFromString(base64EncodedString string) (*Session, error) {
+	bits, err := base64.StdEncoding.DecodeString(base64EncodedString)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error decoding: %v", ErrMalformed, err)
+	}
+	s := &Session{}
+	err = cbornode.DecodeInto(bits, s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error decoding: %v", ErrMalformed, err)
+	}
+	return s, nil
+}
+
+func SessionFromHeader(headers map[string][]string) (*Session, error) {
+	head, ok := headers[SessionHeaderField]
+	if !ok {
+		return nil, nil
+	}
+	if head[0] == "" {
+		return nil, nil
+	}
+	return SessionFromString(head[0])
+}
@@ -0,0 +1,199 @@
+package identity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dsync "github.com/ipfs/go-datastore/sync"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/safewrap"
+	"github.com/quorumcontrol/messages/v2/build/go/services"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo/signer/gossip"
+	"github.com/stretchr/testify/require"
+)
+
+func wrapperWithTransactions(t *testing.T, did string, txns ...*transactions.Transaction) *gossip.AddBlockWrapper {
+	sw := &safewrap.SafeWrap{}
+	block := sw.WrapObject(&chaintree.BlockWithHeaders{
+		Block: chaintree.Block{
+			Transactions: txns,
+		},
+	})
+	require.Nil(t, sw.Err)
+	return &gossip.AddBlockWrapper{
+		AddBlockRequest: &services.AddBlockRequest{
+			ObjectId: []byte(did),
+			Payload:  block.RawData(),
+		},
+	}
+}
+
+func TestSessionVerify(t *testing.T) {
+	sm, err := NewSessionManager(nil, time.Minute, nil)
+	require.Nil(t, err)
+
+	session, err := sm.Issue(&Identity{Iss: "did:tupelo:test", Sub: "did:tupelo:test"})
+	require.Nil(t, err)
+
+	fromString, err := SessionFromString(session.String())
+	require.Nil(t, err)
+
+	verified, err := sm.Verify(fromString)
+	require.Nil(t, err)
+	require.True(t, verified)
+
+	t.Run("fails with a tampered subject", func(t *testing.T) {
+		tampered := *fromString
+		tampered.Sub = "did:tupelo:someoneelse"
+		verified, err := sm.Verify(&tampered)
+		require.Nil(t, err)
+		require.False(t, verified)
+	})
+
+	t.Run("fails with a tampered issue time", func(t *testing.T) {
+		tampered := *fromString
+		tampered.IssuedAt++
+		verified, err := sm.Verify(&tampered)
+		require.Nil(t, err)
+		require.False(t, verified)
+	})
+
+	t.Run("fails with a different secret", func(t *testing.T) {
+		other, err := NewSessionManager(nil, time.Minute, nil)
+		require.Nil(t, err)
+		verified, err := other.Verify(fromString)
+		require.Nil(t, err)
+		require.False(t, verified)
+	})
+
+	t.Run("fails when expired", func(t *testing.T) {
+		expired := *fromString
+		expired.Exp = time.Now().UTC().Unix() - 1
+		expired.Signature, err = sm.sign(&expired)
+		require.Nil(t, err)
+		verified, err := sm.Verify(&expired)
+		require.Nil(t, err)
+		require.False(t, verified)
+	})
+}
+
+func TestSessionRevocation(t *testing.T) {
+	sm, err := NewSessionManager(nil, time.Minute, nil)
+	require.Nil(t, err)
+
+	did := "did:tupelo:test"
+	session, err := sm.Issue(&Identity{Iss: did, Sub: did})
+	require.Nil(t, err)
+
+	// a data change does not revoke the session
+	setData, err := chaintree.NewSetDataTransaction("some/path", "value")
+	require.Nil(t, err)
+	sm.HandleUpdate(wrapperWithTransactions(t, did, setData))
+
+	verified, err := sm.Verify(session)
+	require.Nil(t, err)
+	require.True(t, verified)
+
+	// but an ownership change does
+	setOwnership, err := chaintree.NewSetOwnershipTransaction([]string{"0xnewowner"})
+	require.Nil(t, err)
+	sm.HandleUpdate(wrapperWithTransactions(t, did, setOwnership))
+
+	verified, err = sm.Verify(session)
+	require.Nil(t, err)
+	require.False(t, verified)
+}
+
+func TestSessionRevocationOnThresholdChange(t *testing.T) {
+	sm, err := NewSessionManager(nil, time.Minute, nil)
+	require.Nil(t, err)
+
+	did := "did:tupelo:test"
+	for _, path := range []string{".well-known/threshold", ".well-known", "/.well-known/threshold/"} {
+		session, err := sm.Issue(&Identity{Iss: did, Sub: did})
+		require.Nil(t, err)
+
+		// other well-known paths do not revoke the session
+		setOther, err := chaintree.NewSetDataTransaction(".well-known/policies", "value")
+		require.Nil(t, err)
+		sm.HandleUpdate(wrapperWithTransactions(t, did, setOther))
+		verified, err := sm.Verify(session)
+		require.Nil(t, err)
+		require.True(t, verified)
+
+		setThreshold, err := chaintree.NewSetDataTransaction(path, 2)
+		require.Nil(t, err)
+		sm.HandleUpdate(wrapperWithTransactions(t, did, setThreshold))
+		verified, err = sm.Verify(session)
+		require.Nil(t, err)
+		require.False(t, verified, path)
+	}
+}
+
+func TestSessionRevocationIsShared(t *testing.T) {
+	store := dsync.MutexWrap(datastore.NewMapDatastore())
+	secret := []byte("secret")
+	sm, err := NewSessionManager(secret, time.Minute, store)
+	require.Nil(t, err)
+	// another instance behind the same load balancer
+	other, err := NewSessionManager(secret, time.Minute, store)
+	require.Nil(t, err)
+
+	did := "did:tupelo:test"
+	session, err := sm.Issue(&Identity{Iss: did, Sub: did})
+	require.Nil(t, err)
+
+	setOwnership, err := chaintree.NewSetOwnershipTransaction([]string{"0xnewowner"})
+	require.Nil(t, err)
+	other.HandleUpdate(wrapperWithTransactions(t, did, setOwnership))
+
+	verified, err := sm.Verify(session)
+	require.Nil(t, err)
+	require.False(t, verified)
+
+	t.Run("sessions issued after the revocation verify (within the same second)", func(t *testing.T) {
+		session, err := sm.Issue(&Identity{Iss: did, Sub: did})
+		require.Nil(t, err)
+		verified, err := other.Verify(session)
+		require.Nil(t, err)
+		require.True(t, verified)
+	})
+}
+
+func TestSessionRevocationOfGraftedTrees(t *testing.T) {
+	sm, err := NewSessionManager(nil, time.Minute, nil)
+	require.Nil(t, err)
+
+	owner := "did:tupelo:owner"
+	grafted := "did:tupelo:grafted"
+	transitive := "did:tupelo:transitive"
+	unrelated := "did:tupelo:unrelated"
+	sm.GraftDependents = func(did string) ([]string, error) {
+		switch did {
+		case owner:
+			return []string{grafted}, nil
+		case grafted:
+			// cycles end
+			return []string{transitive, owner}, nil
+		}
+		return nil, nil
+	}
+
+	sessions := make(map[string]*Session)
+	for _, did := range []string{owner, grafted, transitive, unrelated} {
+		sessions[did], err = sm.Issue(&Identity{Iss: did, Sub: did})
+		require.Nil(t, err)
+	}
+
+	setOwnership, err := chaintree.NewSetOwnershipTransaction([]string{"0xnewowner"})
+	require.Nil(t, err)
+	sm.HandleUpdate(wrapperWithTransactions(t, owner, setOwnership))
+
+	for did, session := range sessions {
+		verified, err := sm.Verify(session)
+		require.Nil(t, err)
+		require.Equal(t, did == unrelated, verified, did)
+	}
+}
@@ -0,0 +1,552 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/chaintree/typecaster"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+)
+
+var (
+	indexGenerationKey     = datastore.NewKey("_indexes/generation")  // the generation the indexes are read from
+	indexRebuildingKey     = datastore.NewKey("_indexes/rebuilding")  // the generation RebuildIndexes is writing
+	indexGenerationsPrefix = datastore.NewKey("_indexes/generations") // /<generation>/<index keys>
+
+	// the keys below are within the store of a generation (see indexStore)
+	indexEntriesPrefix = datastore.NewKey("_indexes/entries") // /<name>/<value> -> DIDs
+	indexValuesPrefix  = datastore.NewKey("_indexes/values")  // /<name>/<did> -> values
+	staleTreesKey      = datastore.NewKey("_indexes/stale")   // DIDs whose index updates failed
+)
+
+// defaultIndexGeneration is the generation before the indexes are first rebuilt
+const defaultIndexGeneration = "0"
+
+// maxStaleReindex limits the stale trees that an Add indexes again
+const maxStaleReindex = 10
+
+// IndexesPath is where the config tree defines indexes, a map of index names to
+// the (slash separated) path that is indexed, for example {"type": "tree/data/type"}
+var IndexesPath = []string{"tree", "data", ".well-known", "indexes"}
+
+// ErrUnknownIndex is returned by Find for indexes that are not defined
+var ErrUnknownIndex = fmt.Errorf("unknown index")
+
+// IndexDefinition indexes the DIDs of trees by the value at Path. Strings, numbers and bools are
+// indexed by their string form, lists of them are indexed by each of their items.
+type IndexDefinition struct {
+	Name string
+	Path []string
+}
+
+// FindResponse is a page of sorted DIDs (see Find and OwnedTrees)
+type FindResponse struct {
+	Dids    []string
+	HasMore bool
+}
+
+// ParseIndexDefinitions parses comma separated name=path definitions (for example "type=tree/data/type")
+func ParseIndexDefinitions(defs string) ([]IndexDefinition, error) {
+	var definitions []IndexDefinition
+	for _, def := range strings.Split(defs, ",") {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+		parts := strings.SplitN(def, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid index definition %s, expected name=path", def)
+		}
+		definitions = append(definitions, IndexDefinition{
+			Name: parts[0],
+			Path: splitIndexPath(parts[1]),
+		})
+	}
+	return definitions, nil
+}
+
+func splitIndexPath(path string) []string {
+	var split []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			split = append(split, segment)
+		}
+	}
+	return split
+}
+
+// indexesFromTree returns the index definitions of the config tree (see IndexesPath)
+func indexesFromTree(ctx context.Context, tree *dag.Dag) ([]IndexDefinition, error) {
+	val, remain, err := tree.Resolve(ctx, IndexesPath)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving indexes: %w", err)
+	}
+	if len(remain) > 0 || val == nil {
+		return nil, nil
+	}
+	paths := make(map[string]string)
+	err = typecaster.ToType(val, &paths)
+	if err != nil {
+		return nil, fmt.Errorf("error casting indexes: %w", err)
+	}
+	definitions := make([]IndexDefinition, 0, len(paths))
+	for name, path := range paths {
+		definitions = append(definitions, IndexDefinition{Name: name, Path: splitIndexPath(path)})
+	}
+	return definitions, nil
+}
+
+// indexDefinitions are the indexes of the AggregatorConfig and the config tree (which wins when both define a name)
+func (a *Aggregator) indexDefinitions() map[string]IndexDefinition {
+	definitions := make(map[string]IndexDefinition, len(a.indexes)+len(a.configIndexes))
+	for _, def := range a.indexes {
+		definitions[def.Name] = def
+	}
+	for _, def := range a.configIndexes {
+		definitions[def.Name] = def
+	}
+	return definitions
+}
+
+// encodeIndexValue makes a value safe to use in a key
+func encodeIndexValue(value string) string {
+	return "v" + base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+func indexValuesOf(val interface{}) []string {
+	switch val := val.(type) {
+	case string:
+		return []string{val}
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return []string{fmt.Sprint(val)}
+	case []interface{}:
+		var values []string
+		seen := make(map[string]bool)
+		for _, item := range val {
+			if _, isList := item.([]interface{}); isList {
+				continue
+			}
+			for _, value := range indexValuesOf(item) {
+				if !seen[value] {
+					seen[value] = true
+					values = append(values, value)
+				}
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+func indexValuesKey(name string, objectID string) datastore.Key {
+	return indexValuesPrefix.ChildString(name).ChildString(objectID)
+}
+
+func indexEntriesKey(name string, value string) datastore.Key {
+	return indexEntriesPrefix.ChildString(name).ChildString(encodeIndexValue(value))
+}
+
+// indexesConfigured is true when Add maintains any index (including the owner index and search)
+func (a *Aggregator) indexesConfigured() bool {
+	return len(a.indexes) > 0 || len(a.configIndexes) > 0 || a.searchConfigured() || a.ownerIndex
+}
+
+// indexStore is the store of the index keys of generation. Indexes (including the owner index and search) are
+// kept in generations so that RebuildIndexes can build them from scratch while the current ones are still used.
+func (a *Aggregator) indexStore(generation string) *generationStore {
+	prefix := indexGenerationsPrefix.ChildString(generation)
+	return &generationStore{
+		Batching: namespace.Wrap(a.keyValueStore, prefix),
+		prefix:   prefix,
+		entries:  a.entries,
+	}
+}
+
+func (a *Aggregator) getIndexGeneration(key datastore.Key) (string, error) {
+	bits, err := a.keyValueStore.Get(key)
+	if err == datastore.ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error getting index generation: %w", err)
+	}
+	return string(bits), nil
+}
+
+// readIndexStore is the store the indexes are read from
+func (a *Aggregator) readIndexStore() (*generationStore, error) {
+	generation, err := a.getIndexGeneration(indexGenerationKey)
+	if err != nil {
+		return nil, err
+	}
+	if generation == "" {
+		generation = defaultIndexGeneration
+	}
+	return a.indexStore(generation), nil
+}
+
+// writeIndexStores are the stores that index updates go to, the current one and the one RebuildIndexes is writing
+func (a *Aggregator) writeIndexStores() ([]*generationStore, error) {
+	current, err := a.readIndexStore()
+	if err != nil {
+		return nil, err
+	}
+	rebuilding, err := a.getIndexGeneration(indexRebuildingKey)
+	if err != nil {
+		return nil, err
+	}
+	if rebuilding == "" {
+		return []*generationStore{current}, nil
+	}
+	return []*generationStore{current, a.indexStore(rebuilding)}, nil
+}
+
+/*
+updateTreeIndexes updates the indexes, search and owners of objectID after the block from previousTip (nil for
+a new tree) to tip (see Add). A tree whose update fails is marked stale and indexed again by a later Add (see
+reindexStaleTrees), so that a failed update does not leave the indexes out of date until they are rebuilt.
+*/
+func (a *Aggregator) updateTreeIndexes(ctx context.Context, objectID string, previousTip *cid.Cid, tip cid.Cid) error {
+	if !a.indexesConfigured() {
+		return nil
+	}
+	stores, err := a.writeIndexStores()
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for _, store := range stores {
+		err = a.updateTreeIndexesIn(ctx, store, objectID, previousTip, tip)
+		if err == nil {
+			continue
+		}
+		errs = append(errs, err.Error())
+		staleErr := a.markStale(store, objectID, true)
+		if staleErr != nil {
+			errs = append(errs, staleErr.Error())
+		}
+	}
+	err = a.logSearchChange(objectID, tip)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	reindexErr := a.reindexStaleTrees(ctx, stores)
+	if reindexErr != nil {
+		errs = append(errs, reindexErr.Error())
+	}
+	pendingErr := a.indexPendingOwners(ctx, stores)
+	if pendingErr != nil {
+		errs = append(errs, pendingErr.Error())
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error updating indexes of %s: %s", objectID, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (a *Aggregator) updateTreeIndexesIn(ctx context.Context, store *generationStore, objectID string, previousTip *cid.Cid, tip cid.Cid) error {
+	err := a.updateIndexes(ctx, store, objectID, tip)
+	if err != nil {
+		return fmt.Errorf("error updating indexes: %w", err)
+	}
+	err = a.updateSearch(ctx, store, objectID, tip)
+	if err != nil {
+		return fmt.Errorf("error updating search: %w", err)
+	}
+	err = a.updateOwnerIndex(ctx, store, objectID, previousTip, tip)
+	if err != nil {
+		return fmt.Errorf("error updating owner index: %w", err)
+	}
+	return nil
+}
+
+// indexTree indexes the latest version of objectID from scratch (queueing the trees grafted from it
+// when its owners changed with queueDependents, which RebuildIndexes does not need as it indexes every tree)
+func (a *Aggregator) indexTree(ctx context.Context, store *generationStore, objectID string, queueDependents bool) error {
+	tip, err := a.GetTip(ctx, objectID)
+	if err != nil {
+		return fmt.Errorf("error getting tip: %w", err)
+	}
+	err = a.updateIndexes(ctx, store, objectID, *tip)
+	if err != nil {
+		return fmt.Errorf("error updating indexes: %w", err)
+	}
+	err = a.updateSearch(ctx, store, objectID, *tip)
+	if err != nil {
+		return fmt.Errorf("error updating search: %w", err)
+	}
+	err = a.indexOwners(ctx, store, objectID, queueDependents)
+	if err != nil {
+		return fmt.Errorf("error updating owner index: %w", err)
+	}
+	return nil
+}
+
+func (a *Aggregator) markStale(store *generationStore, objectID string, stale bool) error {
+	return store.updateKeyList(staleTreesKey, objectID, stale)
+}
+
+// reindexStaleTrees indexes (at most maxStaleReindex of) the trees whose index updates failed again
+func (a *Aggregator) reindexStaleTrees(ctx context.Context, stores []*generationStore) error {
+	for _, store := range stores {
+		stale, err := store.listKeys(staleTreesKey, "", maxStaleReindex)
+		if err != nil {
+			return err
+		}
+		for _, did := range stale {
+			err = a.indexTree(ctx, store, did, true)
+			if err != nil {
+				// it stays stale
+				logger.Errorf("error indexing stale tree %s: %v", did, err)
+				continue
+			}
+			err = a.markStale(store, did, false)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateIndexes updates the index entries of objectID for the tree at tip
+func (a *Aggregator) updateIndexes(ctx context.Context, store *generationStore, objectID string, tip cid.Cid) error {
+	definitions := a.indexDefinitions()
+	if len(definitions) == 0 {
+		return nil
+	}
+	tree := dag.NewDag(ctx, tip, a.DagStore)
+
+	batch, err := store.Batch()
+	if err != nil {
+		return fmt.Errorf("error creating batch: %w", err)
+	}
+	for name, def := range definitions {
+		val, remain, err := tree.Resolve(ctx, def.Path)
+		if err != nil {
+			return fmt.Errorf("error resolving %s: %w", strings.Join(def.Path, "/"), err)
+		}
+		var values []string
+		if len(remain) == 0 {
+			values = indexValuesOf(val)
+		}
+		err = updateIndex(store, batch, name, objectID, values)
+		if err != nil {
+			return err
+		}
+	}
+	err = batch.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing indexes: %w", err)
+	}
+	return nil
+}
+
+func updateIndex(store *generationStore, batch datastore.Batch, name string, objectID string, values []string) error {
+	var previous []string
+	bits, err := store.Get(indexValuesKey(name, objectID))
+	if err != nil && err != datastore.ErrNotFound {
+		return fmt.Errorf("error getting index values: %w", err)
+	}
+	if err == nil {
+		err = cbornode.DecodeInto(bits, &previous)
+		if err != nil {
+			return fmt.Errorf("error decoding index values: %w", err)
+		}
+	}
+
+	current := make(map[string]bool, len(values))
+	for _, value := range values {
+		current[value] = true
+	}
+	for _, value := range previous {
+		if !current[value] {
+			err = store.updateKeyList(indexEntriesKey(name, value), objectID, false)
+			if err != nil {
+				return fmt.Errorf("error deleting index entry: %w", err)
+			}
+		}
+	}
+	for value := range current {
+		err = store.updateKeyList(indexEntriesKey(name, value), objectID, true)
+		if err != nil {
+			return fmt.Errorf("error putting index entry: %w", err)
+		}
+	}
+
+	if len(values) == 0 {
+		if len(previous) == 0 {
+			return nil
+		}
+		err = batch.Delete(indexValuesKey(name, objectID))
+		if err != nil {
+			return fmt.Errorf("error deleting index values: %w", err)
+		}
+		return nil
+	}
+	bits, err = cbornode.DumpObject(values)
+	if err != nil {
+		return fmt.Errorf("error encoding index values: %w", err)
+	}
+	err = batch.Put(indexValuesKey(name, objectID), bits)
+	if err != nil {
+		return fmt.Errorf("error putting index values: %w", err)
+	}
+	return nil
+}
+
+// Find lists (at most first of) the DIDs of the trees whose value in the index is value and that come after the DID after
+// (empty for the start). Trees whose read policies do not allow the path of the index are skipped.
+func (a *Aggregator) Find(ctx context.Context, id *identity.Identity, index string, value string, first int, after string) (*FindResponse, error) {
+	def, ok := a.indexDefinitions()[index]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownIndex, index)
+	}
+
+	store, err := a.readIndexStore()
+	if err != nil {
+		return nil, err
+	}
+	dids, err := store.listKeys(indexEntriesKey(index, value), after, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &FindResponse{}
+	for _, did := range dids {
+		allowed, err := a.ReadAllowed(ctx, &policy.ReadInput{
+			Method:   policy.MethodGet,
+			Object:   did,
+			Path:     strings.Join(def.Path, "/"),
+			Identity: id,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
+		if len(resp.Dids) == first {
+			resp.HasMore = true
+			break
+		}
+		resp.Dids = append(resp.Dids, did)
+	}
+	return resp, nil
+}
+
+/*
+RebuildIndexes indexes the latest version of every tree (including the owner index and search) from scratch, it is
+needed after index (or search) definitions are added or changed for the trees that are already stored. The indexes
+are built in a new generation while the current one is still used (and updated by Add), once every tree is indexed
+the new generation replaces the current one, which is then removed, as are the search changes logged before the
+rebuild (see RebuildSearch).
+*/
+func (a *Aggregator) RebuildIndexes(ctx context.Context) error {
+	previous, err := a.getIndexGeneration(indexGenerationKey)
+	if err != nil {
+		return err
+	}
+	if previous == "" {
+		previous = defaultIndexGeneration
+	}
+	started := time.Now()
+	generation := strconv.FormatInt(started.UnixNano(), 36)
+	err = a.keyValueStore.Put(indexRebuildingKey, []byte(generation))
+	if err != nil {
+		return fmt.Errorf("error putting index generation: %w", err)
+	}
+	store := a.indexStore(generation)
+
+	// tips are stored by DID at the root of the key value store, prefixes only match whole namespaces
+	results, err := a.keyValueStore.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		return fmt.Errorf("error querying trees: %w", err)
+	}
+	indexed := 0
+	for result := range results.Next() {
+		if result.Error != nil {
+			results.Close()
+			return fmt.Errorf("error querying trees: %w", result.Error)
+		}
+		key := datastore.NewKey(result.Key)
+		if !key.Parent().Equal(datastore.NewKey("/")) || !strings.HasPrefix(key.BaseNamespace(), "did:") {
+			continue
+		}
+		// the tip is read again, Adds since the query are already in the new generation
+		err = a.indexTree(ctx, store, key.BaseNamespace(), false)
+		if err != nil {
+			// for instance grafted ownership with a loop, which Add does not index either
+			logger.Errorf("error indexing %s: %v", key.BaseNamespace(), err)
+			markErr := a.markStale(store, key.BaseNamespace(), true)
+			if markErr != nil {
+				results.Close()
+				return markErr
+			}
+		}
+		indexed++
+	}
+	err = results.Close()
+	if err != nil {
+		return fmt.Errorf("error querying trees: %w", err)
+	}
+
+	err = a.keyValueStore.Put(indexGenerationKey, []byte(generation))
+	if err != nil {
+		return fmt.Errorf("error putting index generation: %w", err)
+	}
+	err = a.keyValueStore.Delete(indexRebuildingKey)
+	if err != nil && err != datastore.ErrNotFound {
+		return fmt.Errorf("error deleting index generation: %w", err)
+	}
+	logger.Infof("rebuilt the indexes of %d trees", indexed)
+
+	// the trees that changed before the rebuild are indexed at their latest version
+	err = a.PruneSearchChanges(started)
+	if err != nil {
+		logger.Errorf("error pruning search changes: %v", err)
+	}
+
+	err = a.deleteIndexGeneration(previous)
+	if err != nil {
+		// the keys are unused, so only log
+		logger.Errorf("error deleting index generation %s: %v", previous, err)
+	}
+	return nil
+}
+
+// deleteIndexGeneration deletes the keys of an index generation that is no longer used
+func (a *Aggregator) deleteIndexGeneration(generation string) error {
+	store := a.indexStore(generation)
+	err := a.entries.DeleteLists(store.prefix)
+	if err != nil {
+		return fmt.Errorf("error deleting index entries: %w", err)
+	}
+	results, err := store.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		return fmt.Errorf("error querying index generation: %w", err)
+	}
+	defer results.Close()
+	for result := range results.Next() {
+		if result.Error != nil {
+			return fmt.Errorf("error querying index generation: %w", result.Error)
+		}
+		err = store.Delete(datastore.NewKey(result.Key))
+		if err != nil && err != datastore.ErrNotFound {
+			return fmt.Errorf("error deleting %s: %w", result.Key, err)
+		}
+	}
+	return nil
+}
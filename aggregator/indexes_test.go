@@ -0,0 +1,279 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIndexDefinitions(t *testing.T) {
+	defs, err := ParseIndexDefinitions("type=tree/data/type, tags=/tree/data/tags/")
+	require.Nil(t, err)
+	assert.Equal(t, []IndexDefinition{
+		{Name: "type", Path: []string{"tree", "data", "type"}},
+		{Name: "tags", Path: []string{"tree", "data", "tags"}},
+	}, defs)
+
+	defs, err = ParseIndexDefinitions("")
+	require.Nil(t, err)
+	assert.Len(t, defs, 0)
+
+	_, err = ParseIndexDefinitions("tree/data/type")
+	require.NotNil(t, err)
+}
+
+func TestIndexes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := NewMemoryStore()
+	agg, err := NewAggregator(ctx, &AggregatorConfig{
+		KeyValueStore: store,
+		Group:         types.NewNotaryGroup("testnotary"),
+		Indexes: []IndexDefinition{
+			{Name: "type", Path: []string{"tree", "data", "type"}},
+			{Name: "tags", Path: []string{"tree", "data", "tags"}},
+		},
+	})
+	require.Nil(t, err)
+
+	setData := func(t *testing.T, path string, value interface{}) *transactions.Transaction {
+		txn, err := chaintree.NewSetDataTransaction(path, value)
+		require.Nil(t, err)
+		return txn
+	}
+
+	noteKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	noteDid := consensus.EcdsaPubkeyToDid(noteKey.PublicKey)
+	note, err := chaintree.NewChainTree(ctx, consensus.NewEmptyTree(ctx, noteDid, nodestore.MustMemoryStore(ctx)), nil, consensus.DefaultTransactors)
+	require.Nil(t, err)
+	abr := nextABR(t, note, noteKey, setData(t, "type", "note"), setData(t, "tags", []string{"a", "b"}))
+	_, err = agg.Add(ctx, &abr)
+	require.Nil(t, err)
+
+	otherKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	otherAbr := NewValidTransactionWithPathAndValue(t, otherKey, "type", "note")
+	_, err = agg.Add(ctx, &otherAbr)
+	require.Nil(t, err)
+	otherDid := string(otherAbr.ObjectId)
+
+	privateKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	privateAbr := NewValidTransactionWithTransactions(t, privateKey,
+		setData(t, "type", "note"),
+		setData(t, ".well-known/policies", map[string]string{
+			"read": `
+				package read
+				default allow = false
+			`,
+		}),
+	)
+	_, err = agg.Add(ctx, &privateAbr)
+	require.Nil(t, err)
+
+	sorted := []string{noteDid, otherDid}
+	if otherDid < noteDid {
+		sorted = []string{otherDid, noteDid}
+	}
+
+	t.Run("finds the readable trees with a value", func(t *testing.T) {
+		resp, err := agg.Find(ctx, nil, "type", "note", 10, "")
+		require.Nil(t, err)
+		assert.Equal(t, sorted, resp.Dids)
+		assert.False(t, resp.HasMore)
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		resp, err := agg.Find(ctx, nil, "type", "note", 1, "")
+		require.Nil(t, err)
+		assert.Equal(t, sorted[:1], resp.Dids)
+		assert.True(t, resp.HasMore)
+
+		resp, err = agg.Find(ctx, nil, "type", "note", 1, resp.Dids[0])
+		require.Nil(t, err)
+		assert.Equal(t, sorted[1:], resp.Dids)
+		assert.False(t, resp.HasMore)
+	})
+
+	t.Run("indexes the items of lists", func(t *testing.T) {
+		resp, err := agg.Find(ctx, nil, "tags", "b", 10, "")
+		require.Nil(t, err)
+		assert.Equal(t, []string{noteDid}, resp.Dids)
+	})
+
+	t.Run("does not match prefixes of values", func(t *testing.T) {
+		resp, err := agg.Find(ctx, nil, "type", "not", 10, "")
+		require.Nil(t, err)
+		assert.Len(t, resp.Dids, 0)
+	})
+
+	t.Run("unknown indexes", func(t *testing.T) {
+		_, err := agg.Find(ctx, nil, "missing", "note", 10, "")
+		assert.True(t, errors.Is(err, ErrUnknownIndex))
+	})
+
+	t.Run("updates the entries of a tree on add", func(t *testing.T) {
+		abr := nextABR(t, note, noteKey, setData(t, "type", "task"), setData(t, "tags", []string{"b", "c"}))
+		_, err = agg.Add(ctx, &abr)
+		require.Nil(t, err)
+
+		resp, err := agg.Find(ctx, nil, "type", "note", 10, "")
+		require.Nil(t, err)
+		assert.Equal(t, []string{otherDid}, resp.Dids)
+
+		resp, err = agg.Find(ctx, nil, "type", "task", 10, "")
+		require.Nil(t, err)
+		assert.Equal(t, []string{noteDid}, resp.Dids)
+
+		resp, err = agg.Find(ctx, nil, "tags", "a", 10, "")
+		require.Nil(t, err)
+		assert.Len(t, resp.Dids, 0)
+	})
+
+	t.Run("indexes stale trees again on add", func(t *testing.T) {
+		indexStore, err := agg.readIndexStore()
+		require.Nil(t, err)
+		// an update of the tree failed
+		require.Nil(t, indexStore.updateKeyList(indexEntriesKey("type", "task"), noteDid, false))
+		require.Nil(t, agg.markStale(indexStore, noteDid, true))
+		resp, err := agg.Find(ctx, nil, "type", "task", 10, "")
+		require.Nil(t, err)
+		assert.Len(t, resp.Dids, 0)
+
+		key, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		abr := NewValidTransactionWithPathAndValue(t, key, "type", "other")
+		_, err = agg.Add(ctx, &abr)
+		require.Nil(t, err)
+
+		resp, err = agg.Find(ctx, nil, "type", "task", 10, "")
+		require.Nil(t, err)
+		assert.Equal(t, []string{noteDid}, resp.Dids)
+		stale, err := indexStore.getKeyList(staleTreesKey)
+		require.Nil(t, err)
+		assert.Len(t, stale, 0)
+	})
+
+	t.Run("adds update the generation that is being rebuilt", func(t *testing.T) {
+		require.Nil(t, store.Put(indexRebuildingKey, []byte("next")))
+		defer func() {
+			require.Nil(t, store.Delete(indexRebuildingKey))
+			require.Nil(t, agg.deleteIndexGeneration("next"))
+		}()
+
+		key, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		abr := NewValidTransactionWithPathAndValue(t, key, "type", "draft")
+		_, err = agg.Add(ctx, &abr)
+		require.Nil(t, err)
+
+		for _, generation := range []string{defaultIndexGeneration, "next"} {
+			dids, err := agg.indexStore(generation).getKeyList(indexEntriesKey("type", "draft"))
+			require.Nil(t, err)
+			assert.Equal(t, []string{string(abr.ObjectId)}, dids, generation)
+		}
+	})
+
+	t.Run("rebuilds the indexes of stored trees", func(t *testing.T) {
+		// a new definition for the trees that are already stored
+		rebuilt, err := NewAggregator(ctx, &AggregatorConfig{
+			KeyValueStore: store,
+			Group:         types.NewNotaryGroup("testnotary"),
+			Indexes: []IndexDefinition{
+				{Name: "kind", Path: []string{"tree", "data", "type"}},
+			},
+		})
+		require.Nil(t, err)
+
+		resp, err := rebuilt.Find(ctx, nil, "kind", "note", 10, "")
+		require.Nil(t, err)
+		assert.Len(t, resp.Dids, 0)
+
+		require.Nil(t, rebuilt.RebuildIndexes(ctx))
+
+		resp, err = rebuilt.Find(ctx, nil, "kind", "note", 10, "")
+		require.Nil(t, err)
+		assert.Equal(t, []string{otherDid}, resp.Dids)
+
+		// the entries of the previous definitions are removed
+		resp, err = agg.Find(ctx, nil, "type", "task", 10, "")
+		require.Nil(t, err)
+		assert.Len(t, resp.Dids, 0)
+
+		// with the rest of the previous generation
+		results, err := agg.indexStore(defaultIndexGeneration).Query(query.Query{KeysOnly: true})
+		require.Nil(t, err)
+		previous, err := results.Rest()
+		require.Nil(t, err)
+		assert.Len(t, previous, 0)
+	})
+}
+
+func TestIndexesFromConfigTree(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	configTreeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+
+	agg, err := NewAggregator(ctx, &AggregatorConfig{
+		KeyValueStore: NewMemoryStore(),
+		Group:         types.NewNotaryGroup("testnotary"),
+		ConfigTree:    consensus.EcdsaPubkeyToDid(configTreeKey.PublicKey),
+	})
+	require.Nil(t, err)
+
+	configAbr := NewValidTransactionWithPathAndValue(t, configTreeKey, ".well-known/indexes", map[string]string{
+		"color": "tree/data/color",
+	})
+	_, err = agg.Add(ctx, &configAbr)
+	require.Nil(t, err)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	abr := NewValidTransactionWithPathAndValue(t, treeKey, "color", "blue")
+	_, err = agg.Add(ctx, &abr)
+	require.Nil(t, err)
+
+	resp, err := agg.Find(ctx, nil, "color", "blue", 10, "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{string(abr.ObjectId)}, resp.Dids)
+}
+
+func TestNoIndexesConfigured(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := NewMemoryStore()
+	agg, err := NewAggregator(ctx, &AggregatorConfig{
+		KeyValueStore: store,
+		Group:         types.NewNotaryGroup("testnotary"),
+	})
+	require.Nil(t, err)
+
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	abr := NewValidTransactionWithPathAndValue(t, key, "type", "note")
+	_, err = agg.Add(ctx, &abr)
+	require.Nil(t, err)
+
+	for _, prefix := range []string{"/_indexes", entriesPrefix.String()} {
+		results, err := store.Query(query.Query{Prefix: prefix, KeysOnly: true})
+		require.Nil(t, err)
+		entries, err := results.Rest()
+		require.Nil(t, err)
+		assert.Len(t, entries, 0, prefix)
+	}
+}
@@ -0,0 +1,142 @@
+package aggregator
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+/*
+Index entries (the DIDs with a value of an index, the trees owned by an address, ...) are stored in an EntryStore
+as an item per entry rather than as a list in a single value: two Adds updating the same list at the same time
+do not lose each other's entries and lists are not limited by the size of a value. Listing the keys under a
+prefix of a key value store is a Query, which stores like go-ds-dynamodb implement as a Scan of the whole table,
+so stores like that need an EntryStore that can list the entries of a list itself (see api/handler).
+*/
+
+// entriesPrefix is where the entries of the default EntryStore are (see NewDatastoreEntries)
+var entriesPrefix = datastore.NewKey("_entries")
+
+// EntryStore stores the entries (names) of lists as an item per entry
+type EntryStore interface {
+	PutEntry(list datastore.Key, name string) error
+	// DeleteEntry deletes the entry, entries that do not exist are not an error
+	DeleteEntry(list datastore.Key, name string) error
+	// ListEntries returns (at most limit, 0 for every one, of) the sorted names of list that come after after
+	ListEntries(list datastore.Key, after string, limit int) ([]string, error)
+	// DeleteLists deletes the entries of every list under prefix
+	DeleteLists(prefix datastore.Key) error
+}
+
+// NewDatastoreEntries stores entries as keys of store, lists are listed with a Query
+func NewDatastoreEntries(store datastore.Datastore) EntryStore {
+	return &datastoreEntries{store: store}
+}
+
+type datastoreEntries struct {
+	store datastore.Datastore
+}
+
+func (de *datastoreEntries) PutEntry(list datastore.Key, name string) error {
+	return de.store.Put(entriesPrefix.Child(list).ChildString(name), []byte{1})
+}
+
+func (de *datastoreEntries) DeleteEntry(list datastore.Key, name string) error {
+	err := de.store.Delete(entriesPrefix.Child(list).ChildString(name))
+	if err == datastore.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func (de *datastoreEntries) ListEntries(list datastore.Key, after string, limit int) ([]string, error) {
+	listKey := entriesPrefix.Child(list)
+	results, err := de.store.Query(query.Query{Prefix: listKey.String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		key := datastore.NewKey(entry.Key)
+		// the entries of lists below this one have the prefix too
+		if key.Parent().Equal(listKey) && key.BaseNamespace() > after {
+			names = append(names, key.BaseNamespace())
+		}
+	}
+	sort.Strings(names)
+	if limit > 0 && len(names) > limit {
+		names = names[:limit]
+	}
+	return names, nil
+}
+
+func (de *datastoreEntries) DeleteLists(prefix datastore.Key) error {
+	results, err := de.store.Query(query.Query{Prefix: entriesPrefix.Child(prefix).String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err = de.store.Delete(datastore.NewKey(entry.Key))
+		if err != nil && err != datastore.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// generationStore is the store of an index generation (see indexStore), the entries of its lists are in the
+// EntryStore under the prefix of the generation
+type generationStore struct {
+	datastore.Batching
+	prefix  datastore.Key
+	entries EntryStore
+}
+
+// getKeyList returns every entry of the list at key
+func (gs *generationStore) getKeyList(key datastore.Key) ([]string, error) {
+	return gs.listKeys(key, "", 0)
+}
+
+// listKeys returns (at most limit, 0 for every one, of) the entries of the list at key that come after after
+func (gs *generationStore) listKeys(key datastore.Key, after string, limit int) ([]string, error) {
+	names, err := gs.entries.ListEntries(gs.prefix.Child(key), after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %w", key.String(), err)
+	}
+	return names, nil
+}
+
+// updateKeyList adds name to (or removes it from) the list at key
+func (gs *generationStore) updateKeyList(key datastore.Key, name string, add bool) error {
+	var err error
+	if add {
+		err = gs.entries.PutEntry(gs.prefix.Child(key), name)
+	} else {
+		err = gs.entries.DeleteEntry(gs.prefix.Child(key), name)
+	}
+	if err != nil {
+		return fmt.Errorf("error updating %s: %w", key.String(), err)
+	}
+	return nil
+}
+
+// addToKeyList adds names to the list at key
+func (gs *generationStore) addToKeyList(key datastore.Key, names []string) error {
+	for _, name := range names {
+		err := gs.updateKeyList(key, name, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
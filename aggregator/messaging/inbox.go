@@ -0,0 +1,253 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/quorumcontrol/chaintree/safewrap"
+)
+
+var (
+	inboxPrefix    = datastore.NewKey("_messages/inbox") // /<did>/<id>
+	inboxIDsPrefix = datastore.NewKey("_messages/ids")   // /<did> -> ids
+)
+
+// messageIDPattern is the format of the IDs that Put creates: <sent>-<cid>
+var messageIDPattern = regexp.MustCompile(`^([0-9]{20})-([A-Za-z0-9]+)$`)
+
+// ErrInvalidMessageID is returned by Delete for IDs that Put did not create
+var ErrInvalidMessageID = fmt.Errorf("invalid message id")
+
+// Inbox durably stores messages in a key value store until the recipient acknowledges them.
+// The IDs of the messages of a recipient are kept in a single value, so listing them is a Get
+// rather than a prefix Query (which some stores implement as a Scan of the whole table).
+type Inbox struct {
+	store datastore.Batching
+}
+
+// InboxMessage is a stored message and the ID used to acknowledge it
+type InboxMessage struct {
+	ID      string
+	Message *SignedMessage
+}
+
+func NewInbox(store datastore.Batching) *Inbox {
+	return &Inbox{store: store}
+}
+
+// recipientPrefix is the prefix of the inbox of did, the did is checked so that it cannot point
+// outside of the inboxes (keys are cleaned, so "../" would)
+func recipientPrefix(did string) (datastore.Key, error) {
+	prefix := inboxPrefix.ChildString(did)
+	if !prefix.Parent().Equal(inboxPrefix) || prefix.BaseNamespace() != did {
+		return datastore.Key{}, fmt.Errorf("invalid recipient: %s", did)
+	}
+	return prefix, nil
+}
+
+// messageKey is the key of the message id in the inbox of did, ids are checked the same way
+func messageKey(did string, id string) (datastore.Key, error) {
+	prefix, err := recipientPrefix(did)
+	if err != nil {
+		return datastore.Key{}, err
+	}
+	matches := messageIDPattern.FindStringSubmatch(id)
+	if matches == nil {
+		return datastore.Key{}, fmt.Errorf("%w: %s", ErrInvalidMessageID, id)
+	}
+	if _, err := cid.Decode(matches[2]); err != nil {
+		return datastore.Key{}, fmt.Errorf("%w: %s", ErrInvalidMessageID, id)
+	}
+	key := prefix.ChildString(id)
+	if !key.Parent().Equal(prefix) {
+		return datastore.Key{}, fmt.Errorf("%w: %s", ErrInvalidMessageID, id)
+	}
+	return key, nil
+}
+
+// Put stores the message in the inbox of the recipient and returns its ID.
+// IDs sort in the order the messages were sent.
+func (i *Inbox) Put(ctx context.Context, sm *SignedMessage) (string, error) {
+	cid, err := sm.ID()
+	if err != nil {
+		return "", err
+	}
+	id := fmt.Sprintf("%020d-%s", sm.Sent, cid)
+
+	sw := &safewrap.SafeWrap{}
+	wrapped := sw.WrapObject(sm)
+	if sw.Err != nil {
+		return "", fmt.Errorf("error wrapping: %w", sw.Err)
+	}
+	key, err := messageKey(sm.To, id)
+	if err != nil {
+		return "", err
+	}
+	err = i.store.Put(key, wrapped.RawData())
+	if err != nil {
+		return "", fmt.Errorf("error storing message: %w", err)
+	}
+	ids, err := i.ids(sm.To)
+	if err != nil {
+		return "", err
+	}
+	j := sort.SearchStrings(ids, id)
+	if j < len(ids) && ids[j] == id {
+		return id, nil
+	}
+	ids = append(ids, "")
+	copy(ids[j+1:], ids[j:])
+	ids[j] = id
+	err = i.putIDs(sm.To, ids)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// ids returns the (sorted) IDs of the messages in the inbox of did
+func (i *Inbox) ids(did string) ([]string, error) {
+	prefix, err := recipientPrefix(did)
+	if err != nil {
+		return nil, err
+	}
+	bits, err := i.store.Get(inboxIDsPrefix.ChildString(did))
+	if err == datastore.ErrNotFound {
+		return i.legacyIDs(prefix)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting inbox: %w", err)
+	}
+	var ids []string
+	err = cbornode.DecodeInto(bits, &ids)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding inbox: %w", err)
+	}
+	return ids, nil
+}
+
+// legacyIDs lists the IDs of an inbox from before they were kept in a single value (an empty list is stored
+// for an empty inbox, so this only happens once for every recipient)
+func (i *Inbox) legacyIDs(prefix datastore.Key) ([]string, error) {
+	results, err := i.store.Query(query.Query{
+		Prefix:   prefix.String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error querying inbox: %w", err)
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, fmt.Errorf("error querying inbox: %w", err)
+	}
+	ids := []string{}
+	for _, entry := range entries {
+		key := datastore.NewKey(entry.Key)
+		if key.Parent().Equal(prefix) {
+			ids = append(ids, key.BaseNamespace())
+		}
+	}
+	// orders are not supported by every datastore (for instance dynamo), so sort here
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (i *Inbox) putIDs(did string, ids []string) error {
+	if ids == nil {
+		ids = []string{}
+	}
+	bits, err := cbornode.DumpObject(ids)
+	if err != nil {
+		return fmt.Errorf("error encoding inbox: %w", err)
+	}
+	err = i.store.Put(inboxIDsPrefix.ChildString(did), bits)
+	if err != nil {
+		return fmt.Errorf("error storing inbox: %w", err)
+	}
+	return nil
+}
+
+// List returns up to limit (0 for all) of the oldest messages in the inbox of did
+func (i *Inbox) List(ctx context.Context, did string, limit int) ([]*InboxMessage, error) {
+	ids, err := i.ids(did)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []*InboxMessage
+	for _, id := range ids {
+		if limit > 0 && len(msgs) == limit {
+			break
+		}
+		key, err := messageKey(did, id)
+		if err != nil {
+			return nil, err
+		}
+		bits, err := i.store.Get(key)
+		if err == datastore.ErrNotFound {
+			// acknowledged while the IDs were listed
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error getting message: %w", err)
+		}
+		sm := &SignedMessage{}
+		err = cbornode.DecodeInto(bits, sm)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding message: %w", err)
+		}
+		msgs = append(msgs, &InboxMessage{
+			ID:      id,
+			Message: sm,
+		})
+	}
+	return msgs, nil
+}
+
+// Delete removes (acknowledges) the messages from the inbox of did, nothing is deleted
+// when any of the ids is not one that Put created (see ErrInvalidMessageID)
+func (i *Inbox) Delete(ctx context.Context, did string, ids ...string) error {
+	keys := make([]datastore.Key, len(ids))
+	for j, id := range ids {
+		key, err := messageKey(did, id)
+		if err != nil {
+			return err
+		}
+		keys[j] = key
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	stored, err := i.ids(did)
+	if err != nil {
+		return err
+	}
+	deleted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		deleted[id] = true
+	}
+	remaining := make([]string, 0, len(stored))
+	for _, id := range stored {
+		if !deleted[id] {
+			remaining = append(remaining, id)
+		}
+	}
+	err = i.putIDs(did, remaining)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err := i.store.Delete(key)
+		if err != nil && err != datastore.ErrNotFound {
+			return fmt.Errorf("error deleting message: %w", err)
+		}
+	}
+	return nil
+}
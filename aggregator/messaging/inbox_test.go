@@ -0,0 +1,81 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ipfs/go-datastore"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInbox(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := aggregator.NewMemoryStore()
+	inbox := NewInbox(store)
+
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	recipient := "did:tupelo:recipient"
+	sm, err := (&Message{
+		From: consensus.EcdsaPubkeyToDid(key.PublicKey),
+		To:   recipient,
+		Body: "hi",
+		Sent: time.Now().Unix(),
+	}).Sign(&identity.Secp256k1Signer{Key: key})
+	require.Nil(t, err)
+
+	id, err := inbox.Put(ctx, sm)
+	require.Nil(t, err)
+
+	t.Run("ids cannot point outside of the inbox", func(t *testing.T) {
+		// for instance the tip of another tree
+		victim := datastore.NewKey("did:tupelo:victim")
+		require.Nil(t, store.Put(victim, []byte("tip")))
+
+		for _, invalid := range []string{"../../../did:tupelo:victim", "../" + id, id + "/..", "notanid"} {
+			err := inbox.Delete(ctx, recipient, invalid)
+			assert.True(t, errors.Is(err, ErrInvalidMessageID), invalid)
+		}
+		// nothing is deleted when any id is invalid
+		err := inbox.Delete(ctx, recipient, id, "../../../did:tupelo:victim")
+		assert.True(t, errors.Is(err, ErrInvalidMessageID))
+
+		has, err := store.Has(victim)
+		require.Nil(t, err)
+		assert.True(t, has)
+		msgs, err := inbox.List(ctx, recipient, 0)
+		require.Nil(t, err)
+		assert.Len(t, msgs, 1)
+	})
+
+	t.Run("recipients cannot point outside of the inboxes", func(t *testing.T) {
+		_, err := inbox.List(ctx, "../did:tupelo:victim", 0)
+		assert.NotNil(t, err)
+		err = inbox.Delete(ctx, "../../did:tupelo:victim/x", id)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("lists inboxes stored before their ids were", func(t *testing.T) {
+		require.Nil(t, store.Delete(inboxIDsPrefix.ChildString(recipient)))
+		msgs, err := inbox.List(ctx, recipient, 0)
+		require.Nil(t, err)
+		require.Len(t, msgs, 1)
+		assert.Equal(t, id, msgs[0].ID)
+	})
+
+	t.Run("acknowledged messages are deleted", func(t *testing.T) {
+		require.Nil(t, inbox.Delete(ctx, recipient, id))
+		msgs, err := inbox.List(ctx, recipient, 0)
+		require.Nil(t, err)
+		assert.Len(t, msgs, 0)
+	})
+}
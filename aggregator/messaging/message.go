@@ -0,0 +1,113 @@
+package messaging
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/quorumcontrol/chaintree/safewrap"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+)
+
+func init() {
+	cbornode.RegisterCborType(Message{})
+	cbornode.RegisterCborType(SignedMessage{})
+}
+
+// Message is sent from one tree to another, Body is opaque to the aggregator
+// (other than being available to the recipient's message policy)
+type Message struct {
+	From string // sender DID
+	To   string // recipient DID
+	Body string
+	Sent int64 // seconds since the epoch
+}
+
+// SignedMessage is a Message signed by owners of the sender tree
+type SignedMessage struct {
+	Message
+	Signatures []identity.Signature
+}
+
+// Sign signs the message with each of the signers (enough of the owners
+// of the sender tree to meet its threshold).
+func (m *Message) Sign(signers ...identity.Signer) (*SignedMessage, error) {
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("no signers")
+	}
+	hsh, err := m.hash()
+	if err != nil {
+		return nil, err
+	}
+	sigs := make([]identity.Signature, len(signers))
+	for i, signer := range signers {
+		sig, err := identity.SignHash(signer, hsh)
+		if err != nil {
+			return nil, err
+		}
+		sigs[i] = *sig
+	}
+	return &SignedMessage{
+		Message:    *m,
+		Signatures: sigs,
+	}, nil
+}
+
+func (m *Message) hash() ([]byte, error) {
+	sw := &safewrap.SafeWrap{}
+	wrapped := sw.WrapObject(m)
+	if sw.Err != nil {
+		return nil, fmt.Errorf("error wrapping: %w", sw.Err)
+	}
+	multiHash := []byte(wrapped.Cid().Hash())
+	return multiHash[2:], nil
+}
+
+// Addresses verifies the signatures and returns the addresses of the signers
+func (sm *SignedMessage) Addresses() ([]string, error) {
+	if len(sm.Signatures) == 0 {
+		return nil, fmt.Errorf("%w: no signatures", identity.ErrMalformed)
+	}
+	hsh, err := sm.hash()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", identity.ErrMalformed, err)
+	}
+	addrs := make([]string, len(sm.Signatures))
+	for i := range sm.Signatures {
+		addr, err := sm.Signatures[i].Address(hsh)
+		if err != nil {
+			return nil, err
+		}
+		addrs[i] = addr
+	}
+	return addrs, nil
+}
+
+// ID is the content identifier of the signed message
+func (sm *SignedMessage) ID() (string, error) {
+	sw := &safewrap.SafeWrap{}
+	wrapped := sw.WrapObject(sm)
+	if sw.Err != nil {
+		return "", fmt.Errorf("error wrapping: %w", sw.Err)
+	}
+	return wrapped.Cid().String(), nil
+}
+
+func (sm *SignedMessage) String() string {
+	sw := &safewrap.SafeWrap{}
+	wrapped := sw.WrapObject(sm)
+	return base64.StdEncoding.EncodeToString(wrapped.RawData())
+}
+
+func FromString(base64EncodedString string) (*SignedMessage, error) {
+	bits, err := base64.StdEncoding.DecodeString(base64EncodedString)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error decoding: %v", identity.ErrMalformed, err)
+	}
+	sm := &SignedMessage{}
+	err = cbornode.DecodeInto(bits, sm)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error decoding: %v", identity.ErrMalformed, err)
+	}
+	return sm, nil
+}
@@ -0,0 +1,124 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	logging "github.com/ipfs/go-log"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+)
+
+var logger = logging.Logger("messaging")
+
+// MaxMessageAge is how far the Sent time of a message can be from now
+var MaxMessageAge = 5 * time.Minute
+
+// ErrNotAllowed is returned when the recipient's message policy does not allow the message
+// (trees without a message policy do not accept messages)
+var ErrNotAllowed = errors.New("message not allowed")
+
+// RelayFunc delivers a verified message to the recipient (see publisher.WrapMessages)
+type RelayFunc func(ctx context.Context, sm *SignedMessage) error
+
+type Config struct {
+	Aggregator *aggregator.Aggregator
+	// Relay is optional
+	Relay RelayFunc
+	// Inbox is optional, when set messages are stored until the recipient acknowledges them
+	Inbox datastore.Batching
+}
+
+// Messenger verifies messages from owners of one tree to another, checks them against the
+// recipient tree's message policy and then relays (and optionally stores) them.
+type Messenger struct {
+	aggregator *aggregator.Aggregator
+	relay      RelayFunc
+	inbox      *Inbox
+}
+
+func NewMessenger(config *Config) *Messenger {
+	m := &Messenger{
+		aggregator: config.Aggregator,
+		relay:      config.Relay,
+	}
+	if config.Inbox != nil {
+		m.inbox = NewInbox(config.Inbox)
+	}
+	return m
+}
+
+// Inbox returns the durable inbox (nil when not configured)
+func (m *Messenger) Inbox() *Inbox {
+	return m.inbox
+}
+
+// Send verifies and delivers the message, it returns whether the message was stored in the inbox.
+// Verification failures wrap the identity errors, policy failures are ErrNotAllowed.
+func (m *Messenger) Send(ctx context.Context, sm *SignedMessage) (bool, error) {
+	now := time.Now().UTC()
+	sent := time.Unix(sm.Sent, 0)
+	if sent.Before(now.Add(-MaxMessageAge)) || sent.After(now.Add(MaxMessageAge)) {
+		return false, fmt.Errorf("%w: message sent at %d", identity.ErrExpired, sm.Sent)
+	}
+
+	addrs, err := sm.Addresses()
+	if err != nil {
+		return false, err
+	}
+	signers, err := m.aggregator.CheckSigners(ctx, sm.From, addrs)
+	if err != nil {
+		return false, err
+	}
+
+	recipient, err := m.aggregator.GetLatest(ctx, sm.To)
+	if err == aggregator.ErrNotFound {
+		return false, fmt.Errorf("%w: unknown recipient %s", ErrNotAllowed, sm.To)
+	}
+	if err != nil {
+		return false, fmt.Errorf("error getting recipient: %w", err)
+	}
+
+	allowed, err := policy.MessageValidator(ctx, recipient.Dag, m.aggregator, &policy.MessageInput{
+		From: sm.From,
+		To:   sm.To,
+		Body: sm.Body,
+		Sent: sm.Sent,
+		Identity: &identity.Identity{
+			Iss:     sm.From,
+			Sub:     sm.From,
+			Signers: signers,
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("error validating: %w", err)
+	}
+	if !allowed {
+		return false, ErrNotAllowed
+	}
+
+	stored := false
+	if m.inbox != nil {
+		_, err = m.inbox.Put(ctx, sm)
+		if err != nil {
+			return false, err
+		}
+		stored = true
+	}
+
+	if m.relay != nil {
+		err = m.relay(ctx, sm)
+		if err != nil {
+			// the message is in the inbox (if there is one), so delivery can still happen
+			logger.Errorf("error relaying message: %v", err)
+			if !stored {
+				return false, fmt.Errorf("error relaying message: %w", err)
+			}
+		}
+	}
+	return stored, nil
+}
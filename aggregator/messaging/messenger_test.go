@@ -0,0 +1,118 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/tupelo-lite/aggregator"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/testhelpers"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := aggregator.NewMemoryStore()
+	agg, err := aggregator.NewAggregator(ctx, &aggregator.AggregatorConfig{KeyValueStore: store, Group: types.NewNotaryGroup("testnotary")})
+	require.Nil(t, err)
+
+	senderKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	senderAbr := testhelpers.NewValidTransactionWithPathAndValue(t, senderKey, "name", "sender")
+	_, err = agg.Add(ctx, &senderAbr)
+	require.Nil(t, err)
+	sender := string(senderAbr.ObjectId)
+
+	recipientKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	recipientAbr := testhelpers.NewValidTransactionWithPathAndValue(t, recipientKey, ".well-known/policies/message", `
+		package message
+		default allow = false
+
+		allow {
+			count(input.identity.signers) > 0
+			not input.body == "spam"
+		}
+	`)
+	_, err = agg.Add(ctx, &recipientAbr)
+	require.Nil(t, err)
+	recipient := string(recipientAbr.ObjectId)
+
+	var relayed []*SignedMessage
+	messenger := NewMessenger(&Config{
+		Aggregator: agg,
+		Inbox:      store,
+		Relay: func(ctx context.Context, sm *SignedMessage) error {
+			relayed = append(relayed, sm)
+			return nil
+		},
+	})
+
+	send := func(t *testing.T, body string, sent time.Time, signers ...identity.Signer) (bool, error) {
+		sm, err := (&Message{
+			From: sender,
+			To:   recipient,
+			Body: body,
+			Sent: sent.Unix(),
+		}).Sign(signers...)
+		require.Nil(t, err)
+		// round trip to make sure that it survives the wire
+		sm, err = FromString(sm.String())
+		require.Nil(t, err)
+		return messenger.Send(ctx, sm)
+	}
+
+	t.Run("allowed messages are relayed and stored", func(t *testing.T) {
+		stored, err := send(t, "hi", time.Now(), &identity.Secp256k1Signer{Key: senderKey})
+		require.Nil(t, err)
+		assert.True(t, stored)
+		require.Len(t, relayed, 1)
+		assert.Equal(t, "hi", relayed[0].Body)
+
+		msgs, err := messenger.Inbox().List(ctx, recipient, 0)
+		require.Nil(t, err)
+		require.Len(t, msgs, 1)
+		assert.Equal(t, sender, msgs[0].Message.From)
+
+		require.Nil(t, messenger.Inbox().Delete(ctx, recipient, msgs[0].ID))
+		msgs, err = messenger.Inbox().List(ctx, recipient, 0)
+		require.Nil(t, err)
+		require.Len(t, msgs, 0)
+	})
+
+	t.Run("the recipient policy is applied", func(t *testing.T) {
+		_, err := send(t, "spam", time.Now(), &identity.Secp256k1Signer{Key: senderKey})
+		require.True(t, errors.Is(err, ErrNotAllowed))
+	})
+
+	t.Run("non owners cannot send", func(t *testing.T) {
+		otherKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		_, err = send(t, "hi", time.Now(), &identity.Secp256k1Signer{Key: otherKey})
+		require.True(t, errors.Is(err, identity.ErrNotOwner))
+	})
+
+	t.Run("old messages are rejected", func(t *testing.T) {
+		_, err := send(t, "hi", time.Now().Add(-2*MaxMessageAge), &identity.Secp256k1Signer{Key: senderKey})
+		require.True(t, errors.Is(err, identity.ErrExpired))
+	})
+
+	t.Run("trees without a message policy do not accept messages", func(t *testing.T) {
+		sm, err := (&Message{
+			From: recipient,
+			To:   sender,
+			Body: "hi",
+			Sent: time.Now().Unix(),
+		}).Sign(&identity.Secp256k1Signer{Key: recipientKey})
+		require.Nil(t, err)
+		_, err = messenger.Send(ctx, sm)
+		require.True(t, errors.Is(err, ErrNotAllowed))
+	})
+}
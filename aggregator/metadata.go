@@ -0,0 +1,168 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/chaintree/typecaster"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+)
+
+var metadataPrefix = datastore.NewKey("_trees/metadata")
+
+var authenticationsPath = strings.Split("tree/"+consensus.TreePathForAuthentications, "/")
+
+func init() {
+	cbornode.RegisterCborType(storedMetadata{})
+}
+
+// TreeMetadata is what the aggregator keeps about the latest version of a tree so that
+// it can be returned without building the tree
+type TreeMetadata struct {
+	Tip    cid.Cid
+	Height uint64
+	// UpdatedAt is when the aggregator stored the tip, zero for trees stored before it kept metadata
+	UpdatedAt time.Time
+	// Owners are the authentications of the tree, grafted owners (did:tupelo:...) are not resolved
+	Owners []string
+}
+
+// storedMetadata is TreeMetadata as it is stored in the KeyValueStore
+type storedMetadata struct {
+	Tip       cid.Cid  `refmt:"tip"`
+	Height    uint64   `refmt:"height"`
+	UpdatedAt int64    `refmt:"updatedAt"` // unix nanoseconds
+	Owners    []string `refmt:"owners"`
+}
+
+func metadataKey(objectID string) datastore.Key {
+	return metadataPrefix.ChildString(objectID)
+}
+
+// TreeMetadata returns the metadata of the latest version of the tree, or nil when the tree is not found.
+// A tree whose read policies do not allow reading its root (an empty path) looks the same as one that is not found.
+// Only the read policies are evaluated, the tree itself is not built.
+func (a *Aggregator) TreeMetadata(ctx context.Context, id *identity.Identity, objectID string) (*TreeMetadata, error) {
+	tip, err := a.GetTip(ctx, objectID)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting tip: %w", err)
+	}
+	tree := dag.NewDag(ctx, *tip, a.DagStore)
+
+	readPolicy, err := policy.NewReadPolicy(ctx, tree, a)
+	if err != nil {
+		return nil, fmt.Errorf("error getting read policy: %w", err)
+	}
+	allowed, err := a.evaluateReadPolicies(ctx, readPolicy, &policy.ReadInput{
+		Method:   policy.MethodGet,
+		Object:   objectID,
+		Path:     "",
+		Identity: id,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, nil
+	}
+
+	stored, err := a.storedMetadata(objectID)
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil && stored.Tip.Equals(*tip) {
+		return &TreeMetadata{
+			Tip:       stored.Tip,
+			Height:    stored.Height,
+			UpdatedAt: time.Unix(0, stored.UpdatedAt),
+			Owners:    stored.Owners,
+		}, nil
+	}
+
+	// the metadata is missing (or from an older tip) so get what the tree has
+	logger.Debugf("no metadata stored for %s at %s", objectID, tip.String())
+	return metadataFromDag(ctx, objectID, tree)
+}
+
+func (a *Aggregator) storedMetadata(objectID string) (*storedMetadata, error) {
+	bits, err := a.keyValueStore.Get(metadataKey(objectID))
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting metadata: %w", err)
+	}
+	stored := &storedMetadata{}
+	err = cbornode.DecodeInto(bits, stored)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding metadata: %w", err)
+	}
+	return stored, nil
+}
+
+// storeMetadata stores the metadata of the tree at tip (see Add)
+func (a *Aggregator) storeMetadata(ctx context.Context, objectID string, tip cid.Cid) error {
+	meta, err := metadataFromDag(ctx, objectID, dag.NewDag(ctx, tip, a.DagStore))
+	if err != nil {
+		return err
+	}
+	bits, err := cbornode.DumpObject(&storedMetadata{
+		Tip:       tip,
+		Height:    meta.Height,
+		UpdatedAt: time.Now().UnixNano(),
+		Owners:    meta.Owners,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding metadata: %w", err)
+	}
+	err = a.keyValueStore.Put(metadataKey(objectID), bits)
+	if err != nil {
+		return fmt.Errorf("error putting metadata: %w", err)
+	}
+	return nil
+}
+
+// metadataFromDag gets the metadata of the tree from its blocks (without UpdatedAt)
+func metadataFromDag(ctx context.Context, objectID string, tree *dag.Dag) (*TreeMetadata, error) {
+	uncastHeight, _, err := tree.Resolve(ctx, []string{"height"})
+	if err != nil {
+		return nil, fmt.Errorf("error resolving height: %w", err)
+	}
+	var height uint64
+	if uncastHeight != nil {
+		err = typecaster.ToType(uncastHeight, &height)
+		if err != nil {
+			return nil, fmt.Errorf("error casting height: %w", err)
+		}
+	}
+
+	uncastAuths, _, err := tree.Resolve(ctx, authenticationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving authentications: %w", err)
+	}
+	// like consensus.SignedChainTree, a tree without authentications is owned by its genesis key
+	owners := []string{consensus.DidToAddr(objectID)}
+	if uncastAuths != nil {
+		err = typecaster.ToType(uncastAuths, &owners)
+		if err != nil {
+			return nil, fmt.Errorf("error casting authentications: %w", err)
+		}
+	}
+
+	return &TreeMetadata{
+		Tip:    tree.Tip,
+		Height: height,
+		Owners: owners,
+	}, nil
+}
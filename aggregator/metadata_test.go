@@ -0,0 +1,80 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ipfs/go-datastore"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTreeMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := NewMemoryStore()
+	agg, err := NewAggregator(ctx, &AggregatorConfig{KeyValueStore: store, Group: types.NewNotaryGroup("testnotary")})
+	require.Nil(t, err)
+
+	t.Run("unknown trees have no metadata", func(t *testing.T) {
+		meta, err := agg.TreeMetadata(ctx, nil, "did:tupelo:unknown")
+		require.Nil(t, err)
+		assert.Nil(t, meta)
+	})
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	abr := NewValidTransactionWithPathAndValue(t, treeKey, "some/path", "hi")
+	did := string(abr.ObjectId)
+	before := time.Now()
+	resp, err := agg.Add(ctx, &abr)
+	require.Nil(t, err)
+
+	t.Run("metadata is stored on add", func(t *testing.T) {
+		meta, err := agg.TreeMetadata(ctx, nil, did)
+		require.Nil(t, err)
+		require.NotNil(t, meta)
+		assert.True(t, meta.Tip.Equals(resp.NewTip))
+		assert.Equal(t, abr.Height, meta.Height)
+		assert.False(t, meta.UpdatedAt.Before(before))
+		assert.Equal(t, []string{crypto.PubkeyToAddress(treeKey.PublicKey).String()}, meta.Owners)
+	})
+
+	t.Run("falls back to the tree without stored metadata", func(t *testing.T) {
+		stored, err := agg.TreeMetadata(ctx, nil, did)
+		require.Nil(t, err)
+		require.Nil(t, store.Delete(metadataKey(did)))
+
+		meta, err := agg.TreeMetadata(ctx, nil, did)
+		require.Nil(t, err)
+		require.NotNil(t, meta)
+		assert.True(t, meta.Tip.Equals(resp.NewTip))
+		assert.Equal(t, stored.Height, meta.Height)
+		assert.Equal(t, stored.Owners, meta.Owners)
+		assert.True(t, meta.UpdatedAt.IsZero())
+
+		_, err = store.Get(metadataKey(did))
+		assert.Equal(t, datastore.ErrNotFound, err)
+	})
+
+	t.Run("respects the read policy", func(t *testing.T) {
+		lockedKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		locked := NewValidTransactionWithPathAndValue(t, lockedKey, ".well-known/policies", map[string]string{
+			"read": `
+				package read
+				default allow = false
+			`,
+		})
+		_, err = agg.Add(ctx, &locked)
+		require.Nil(t, err)
+
+		meta, err := agg.TreeMetadata(ctx, nil, string(locked.ObjectId))
+		require.Nil(t, err)
+		assert.Nil(t, meta)
+	})
+}
@@ -0,0 +1,154 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+)
+
+// MaxWalkEvaluations limits the paths that WalkReadableNodes evaluates the read policies of, a walk that
+// reaches it fails with ErrWalkLimit
+var MaxWalkEvaluations = 10000
+
+// ErrWalkLimit is returned by WalkReadableNodes for trees with more than MaxWalkEvaluations paths
+var ErrWalkLimit = fmt.Errorf("the tree has too many paths to check the read policies of")
+
+// nodeLink is a link of a node and the path it is at
+type nodeLink struct {
+	cid  cid.Cid
+	path []string
+}
+
+/*
+WalkReadableNodes calls fn with the nodes of the latest version of objectID that the read policies allow
+(ErrNotFound when the tree does not exist or its root is not readable). The read policies are evaluated for
+the path of every node and every value in it: a node is only passed when all of them are allowed and the
+nodes under a denied path are skipped, so the nodes expose no more than ResolveWithReadControls does.
+Each path is evaluated once, at most MaxWalkEvaluations of them.
+*/
+func (a *Aggregator) WalkReadableNodes(ctx context.Context, id *identity.Identity, objectID string, fn func(format.Node) error) error {
+	readable, err := a.getReadable(ctx, objectID)
+	if err != nil {
+		return err
+	}
+	if readable.latest == nil {
+		return ErrNotFound
+	}
+
+	allowedPaths := make(map[string]bool)
+	allowed := func(path []string) (bool, error) {
+		joined := strings.Join(path, "/")
+		isAllowed, ok := allowedPaths[joined]
+		if ok {
+			return isAllowed, nil
+		}
+		if len(allowedPaths) >= MaxWalkEvaluations {
+			return false, ErrWalkLimit
+		}
+		isAllowed, err := a.evaluateReadPolicies(ctx, readable.readPolicy, &policy.ReadInput{
+			Method:   policy.MethodGet,
+			Object:   objectID,
+			Path:     joined,
+			Identity: id,
+		})
+		if err != nil {
+			return false, err
+		}
+		allowedPaths[joined] = isAllowed
+		return isAllowed, nil
+	}
+
+	rootAllowed, err := allowed(nil)
+	if err != nil {
+		return err
+	}
+	if !rootAllowed {
+		return ErrNotFound
+	}
+
+	seen := make(map[cid.Cid]bool)
+	queue := []nodeLink{{cid: readable.latest.Dag.Tip}}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if seen[next.cid] {
+			continue
+		}
+		seen[next.cid] = true
+
+		node, err := readable.latest.Dag.Get(ctx, next.cid)
+		if err != nil {
+			return fmt.Errorf("error getting node %s: %w", next.cid.String(), err)
+		}
+		var val interface{}
+		err = cbornode.DecodeInto(node.RawData(), &val)
+		if err != nil {
+			return fmt.Errorf("error decoding node %s: %w", next.cid.String(), err)
+		}
+
+		var values [][]string
+		var links []nodeLink
+		collectNodePaths(next.path, val, &values, &links)
+
+		readableNode := true
+		for _, path := range values {
+			isAllowed, err := allowed(path)
+			if err != nil {
+				return err
+			}
+			if !isAllowed {
+				readableNode = false
+				break
+			}
+		}
+		if readableNode {
+			err = fn(node)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, link := range links {
+			isAllowed, err := allowed(link.path)
+			if err != nil {
+				return err
+			}
+			if isAllowed {
+				queue = append(queue, link)
+			}
+		}
+	}
+	return nil
+}
+
+// collectNodePaths adds the paths of the values within a node (including maps and lists) to values and its links to links
+func collectNodePaths(path []string, val interface{}, values *[][]string, links *[]nodeLink) {
+	switch val := val.(type) {
+	case cid.Cid:
+		*links = append(*links, nodeLink{cid: val, path: path})
+	case map[string]interface{}:
+		*values = append(*values, path)
+		for k, v := range val {
+			collectNodePaths(append(append([]string{}, path...), k), v, values, links)
+		}
+	case map[interface{}]interface{}:
+		*values = append(*values, path)
+		for k, v := range val {
+			collectNodePaths(append(append([]string{}, path...), fmt.Sprint(k)), v, values, links)
+		}
+	case []interface{}:
+		*values = append(*values, path)
+		for i, v := range val {
+			collectNodePaths(append(append([]string{}, path...), strconv.Itoa(i)), v, values, links)
+		}
+	default:
+		*values = append(*values, path)
+	}
+}
@@ -0,0 +1,118 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalkReadableNodes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	agg, err := NewAggregator(ctx, &AggregatorConfig{KeyValueStore: NewMemoryStore(), Group: types.NewNotaryGroup("testnotary")})
+	require.Nil(t, err)
+
+	walk := func(t *testing.T, objectID string) []cid.Cid {
+		var cids []cid.Cid
+		err := agg.WalkReadableNodes(ctx, nil, objectID, func(n format.Node) error {
+			cids = append(cids, n.Cid())
+			return nil
+		})
+		require.Nil(t, err)
+		return cids
+	}
+	dataNode := func(t *testing.T, objectID string) (cid.Cid, cid.Cid) {
+		latest, err := agg.GetLatest(ctx, objectID)
+		require.Nil(t, err)
+		tree, _, err := latest.Dag.Resolve(ctx, []string{"tree"})
+		require.Nil(t, err)
+		return latest.Dag.Tip, tree.(map[string]interface{})["data"].(cid.Cid)
+	}
+
+	t.Run("without a policy every node is readable", func(t *testing.T) {
+		treeKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		abr := NewValidTransactionWithPathAndValue(t, treeKey, "some/path", "hi")
+		_, err = agg.Add(ctx, &abr)
+		require.Nil(t, err)
+
+		latest, err := agg.GetLatest(ctx, string(abr.ObjectId))
+		require.Nil(t, err)
+		nodes, err := latest.Dag.Nodes(ctx)
+		require.Nil(t, err)
+		assert.Len(t, walk(t, string(abr.ObjectId)), len(nodes))
+	})
+
+	t.Run("skips nodes with denied paths", func(t *testing.T) {
+		treeKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		setPolicy, err := chaintree.NewSetDataTransaction(".well-known/policies", map[string]string{
+			// only the secret path itself is denied, not the paths under it
+			"read": `
+				package read
+				default allow = true
+				allow = false {
+					input.path == "tree/data/secret"
+				}
+			`,
+		})
+		require.Nil(t, err)
+		setSecret, err := chaintree.NewSetDataTransaction("secret", "shh")
+		require.Nil(t, err)
+		abr := NewValidTransactionWithTransactions(t, treeKey, setPolicy, setSecret)
+		_, err = agg.Add(ctx, &abr)
+		require.Nil(t, err)
+		did := string(abr.ObjectId)
+
+		root, data := dataNode(t, did)
+		cids := walk(t, did)
+		assert.Contains(t, cids, root)
+		// the secret is a value of the data node
+		assert.NotContains(t, cids, data)
+	})
+
+	t.Run("unreadable trees are not found", func(t *testing.T) {
+		treeKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		abr := NewValidTransactionWithPathAndValue(t, treeKey, ".well-known/policies", map[string]string{
+			"read": `
+				package read
+				default allow = false
+			`,
+		})
+		_, err = agg.Add(ctx, &abr)
+		require.Nil(t, err)
+
+		err = agg.WalkReadableNodes(ctx, nil, string(abr.ObjectId), func(n format.Node) error {
+			return nil
+		})
+		assert.Equal(t, ErrNotFound, err)
+		assert.Equal(t, ErrNotFound, agg.WalkReadableNodes(ctx, nil, "did:tupelo:missing", func(n format.Node) error {
+			return nil
+		}))
+	})
+
+	t.Run("limits the evaluated paths", func(t *testing.T) {
+		defer func(max int) { MaxWalkEvaluations = max }(MaxWalkEvaluations)
+		MaxWalkEvaluations = 2
+
+		treeKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		abr := NewValidTransactionWithPathAndValue(t, treeKey, "some/path", "hi")
+		_, err = agg.Add(ctx, &abr)
+		require.Nil(t, err)
+
+		err = agg.WalkReadableNodes(ctx, nil, string(abr.ObjectId), func(n format.Node) error {
+			return nil
+		})
+		assert.Equal(t, ErrWalkLimit, err)
+	})
+}
@@ -0,0 +1,308 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+)
+
+var (
+	// within the store of an index generation (see indexStore)
+	ownedTreesPrefix      = datastore.NewKey("_owners/trees")   // /<address> -> DIDs
+	treeOwnersPrefix      = datastore.NewKey("_owners/owners")  // /<did>
+	graftDependentsPrefix = datastore.NewKey("_owners/grafts")  // /<grafted did> -> DIDs
+	pendingOwnersKey      = datastore.NewKey("_owners/pending") // DIDs whose grafted owners changed
+)
+
+// ErrNoOwnerIndex is returned by OwnedTrees when AggregatorConfig.OwnerIndex is not set
+var ErrNoOwnerIndex = fmt.Errorf("the owner index is not enabled")
+
+// maxPendingOwners limits the trees with changed grafted owners that an Add indexes the owners of
+const maxPendingOwners = 10
+
+func init() {
+	cbornode.RegisterCborType(storedOwners{})
+}
+
+// storedOwners are the (resolved) owners of a tree and the trees its authentications are grafted from
+type storedOwners struct {
+	Owners []string `refmt:"owners"`
+	Grafts []string `refmt:"grafts"`
+}
+
+func treeOwnersKey(objectID string) datastore.Key {
+	return treeOwnersPrefix.ChildString(objectID)
+}
+
+// updateOwnerIndex indexes the owners of objectID when the block from previousTip (nil for a new tree)
+// to tip changed its authentications (see Add)
+func (a *Aggregator) updateOwnerIndex(ctx context.Context, store *generationStore, objectID string, previousTip *cid.Cid, tip cid.Cid) error {
+	if !a.ownerIndex {
+		return nil
+	}
+	if previousTip != nil {
+		previous, _, err := dag.NewDag(ctx, *previousTip, a.DagStore).Resolve(ctx, authenticationsPath)
+		if err != nil {
+			return fmt.Errorf("error resolving previous authentications: %w", err)
+		}
+		current, _, err := dag.NewDag(ctx, tip, a.DagStore).Resolve(ctx, authenticationsPath)
+		if err != nil {
+			return fmt.Errorf("error resolving authentications: %w", err)
+		}
+		if reflect.DeepEqual(previous, current) {
+			return nil
+		}
+	}
+	return a.indexOwners(ctx, store, objectID, true)
+}
+
+// indexOwners resolves the (grafted) owners of the latest version of objectID and updates the index. When the
+// owners change (and with queueDependents), the trees whose authentications are grafted from objectID are queued
+// to be indexed again (see indexPendingOwners).
+func (a *Aggregator) indexOwners(ctx context.Context, store *generationStore, objectID string, queueDependents bool) error {
+	if !a.ownerIndex {
+		return nil
+	}
+	latest, err := a.GetLatest(ctx, objectID)
+	if err != nil {
+		return fmt.Errorf("error getting latest: %w", err)
+	}
+	// grafts from trees that do not exist yet resolve to no owners (but are indexed), the tree
+	// queues its dependents once it is added (its owners change from none)
+	graftedOwnership, err := types.NewGraftedOwnership(latest.Dag, &genesisGetter{a})
+	if err != nil {
+		return fmt.Errorf("error getting ownership: %w", err)
+	}
+	owners, err := graftedOwnership.ResolveOwners(ctx)
+	if err != nil {
+		return fmt.Errorf("error resolving owners: %w", err)
+	}
+	grafts, err := authenticationGrafts(ctx, latest.Dag)
+	if err != nil {
+		return err
+	}
+	current := &storedOwners{
+		Owners: uniqueSorted(owners),
+		Grafts: grafts,
+	}
+
+	previous := &storedOwners{}
+	bits, err := store.Get(treeOwnersKey(objectID))
+	if err != nil && err != datastore.ErrNotFound {
+		return fmt.Errorf("error getting owners: %w", err)
+	}
+	if err == nil {
+		err = cbornode.DecodeInto(bits, previous)
+		if err != nil {
+			return fmt.Errorf("error decoding owners: %w", err)
+		}
+	}
+
+	err = updateEntries(store, ownedTreesPrefix, objectID, previous.Owners, current.Owners)
+	if err != nil {
+		return err
+	}
+	err = updateEntries(store, graftDependentsPrefix, objectID, previous.Grafts, current.Grafts)
+	if err != nil {
+		return err
+	}
+
+	if queueDependents && !reflect.DeepEqual(previous.Owners, current.Owners) {
+		dependents, err := store.getKeyList(graftDependentsPrefix.ChildString(objectID))
+		if err != nil {
+			return err
+		}
+		queued := make([]string, 0, len(dependents))
+		for _, dependent := range dependents {
+			if dependent != objectID {
+				queued = append(queued, dependent)
+			}
+		}
+		err = store.addToKeyList(pendingOwnersKey, queued)
+		if err != nil {
+			return fmt.Errorf("error queueing owners: %w", err)
+		}
+	}
+
+	// the owners are put last, a failed update is done again when the tree is indexed again
+	bits, err = cbornode.DumpObject(current)
+	if err != nil {
+		return fmt.Errorf("error encoding owners: %w", err)
+	}
+	err = store.Put(treeOwnersKey(objectID), bits)
+	if err != nil {
+		return fmt.Errorf("error putting owners: %w", err)
+	}
+	return nil
+}
+
+// indexPendingOwners indexes the owners of (at most maxPendingOwners of) the trees whose grafted owners changed,
+// the ones that fail are marked stale (see reindexStaleTrees)
+func (a *Aggregator) indexPendingOwners(ctx context.Context, stores []*generationStore) error {
+	if !a.ownerIndex {
+		return nil
+	}
+	for _, store := range stores {
+		pending, err := store.listKeys(pendingOwnersKey, "", maxPendingOwners)
+		if err != nil {
+			return err
+		}
+		for _, did := range pending {
+			err = store.updateKeyList(pendingOwnersKey, did, false)
+			if err != nil {
+				return err
+			}
+
+			err = a.indexOwners(ctx, store, did, true)
+			if err != nil {
+				logger.Errorf("error indexing owners of %s: %v", did, err)
+				err = a.markStale(store, did, true)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// genesisGetter gets the (empty) genesis state of the trees that do not exist yet
+type genesisGetter struct {
+	*Aggregator
+}
+
+func (gg *genesisGetter) GetTip(ctx context.Context, objectID string) (*cid.Cid, error) {
+	tip, err := gg.Aggregator.GetTip(ctx, objectID)
+	if err == ErrNotFound {
+		genesis := consensus.NewEmptyTree(ctx, objectID, nodestore.MustMemoryStore(ctx))
+		return &genesis.Tip, nil
+	}
+	return tip, err
+}
+
+func (gg *genesisGetter) GetLatest(ctx context.Context, objectID string) (*chaintree.ChainTree, error) {
+	latest, err := gg.Aggregator.GetLatest(ctx, objectID)
+	if err == ErrNotFound {
+		genesis := consensus.NewEmptyTree(ctx, objectID, nodestore.MustMemoryStore(ctx))
+		return chaintree.NewChainTree(ctx, genesis, nil, consensus.DefaultTransactors)
+	}
+	return latest, err
+}
+
+// updateEntries removes objectID from the prefix/<previous> lists and adds it to the prefix/<current> ones
+func updateEntries(store *generationStore, prefix datastore.Key, objectID string, previous, current []string) error {
+	isCurrent := make(map[string]bool, len(current))
+	for _, name := range current {
+		isCurrent[name] = true
+	}
+	for _, name := range previous {
+		if isCurrent[name] {
+			continue
+		}
+		err := store.updateKeyList(prefix.ChildString(name), objectID, false)
+		if err != nil {
+			return fmt.Errorf("error deleting %s entry: %w", prefix.String(), err)
+		}
+	}
+	for _, name := range current {
+		err := store.updateKeyList(prefix.ChildString(name), objectID, true)
+		if err != nil {
+			return fmt.Errorf("error putting %s entry: %w", prefix.String(), err)
+		}
+	}
+	return nil
+}
+
+// authenticationGrafts returns the DIDs that the authentications of tree are grafted from
+// ("did:tupelo:<did>/tree/_tupelo/authentications" owners)
+func authenticationGrafts(ctx context.Context, tree *dag.Dag) ([]string, error) {
+	uncastAuths, _, err := tree.Resolve(ctx, authenticationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving authentications: %w", err)
+	}
+	var grafts []string
+	var collect func(val interface{})
+	collect = func(val interface{}) {
+		switch val := val.(type) {
+		case string:
+			if strings.HasPrefix(val, "did:tupelo:") {
+				grafts = append(grafts, strings.SplitN(val, "/", 2)[0])
+			}
+		case []interface{}:
+			for _, item := range val {
+				collect(item)
+			}
+		}
+	}
+	collect(uncastAuths)
+	return uniqueSorted(grafts), nil
+}
+
+func uniqueSorted(vals []string) []string {
+	seen := make(map[string]bool, len(vals))
+	unique := make([]string, 0, len(vals))
+	for _, val := range vals {
+		if !seen[val] {
+			seen[val] = true
+			unique = append(unique, val)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// OwnedTrees lists (at most first of) the DIDs of the trees owned by any of addresses that come after
+// the DID after (empty for the start). Owners grafted from other trees are resolved, so a tree is
+// also listed for the owners of the trees its authentications are grafted from.
+func (a *Aggregator) OwnedTrees(ctx context.Context, addresses []string, first int, after string) (*FindResponse, error) {
+	if !a.ownerIndex {
+		return nil, ErrNoOwnerIndex
+	}
+	store, err := a.readIndexStore()
+	if err != nil {
+		return nil, err
+	}
+	var dids []string
+	for _, address := range addresses {
+		// one more than a page tells whether there are more
+		owned, err := store.listKeys(ownedTreesPrefix.ChildString(address), after, first+1)
+		if err != nil {
+			return nil, err
+		}
+		dids = append(dids, owned...)
+	}
+
+	resp := &FindResponse{}
+	for _, did := range uniqueSorted(dids) {
+		if len(resp.Dids) == first {
+			resp.HasMore = true
+			break
+		}
+		resp.Dids = append(resp.Dids, did)
+	}
+	return resp, nil
+}
+
+// GraftDependents returns the DIDs of the trees whose authentications are grafted from objectID
+// (none without AggregatorConfig.OwnerIndex)
+func (a *Aggregator) GraftDependents(objectID string) ([]string, error) {
+	if !a.ownerIndex {
+		return nil, nil
+	}
+	store, err := a.readIndexStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.getKeyList(graftDependentsPrefix.ChildString(objectID))
+}
@@ -0,0 +1,163 @@
+package aggregator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnedTrees(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := NewMemoryStore()
+	agg, err := NewAggregator(ctx, &AggregatorConfig{KeyValueStore: store, Group: types.NewNotaryGroup("testnotary"), OwnerIndex: true})
+	require.Nil(t, err)
+
+	newKey := func(t *testing.T) (*ecdsa.PrivateKey, string) {
+		key, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		return key, crypto.PubkeyToAddress(key.PublicKey).String()
+	}
+	newTree := func(t *testing.T, key *ecdsa.PrivateKey) (*chaintree.ChainTree, string) {
+		did := consensus.EcdsaPubkeyToDid(key.PublicKey)
+		tree, err := chaintree.NewChainTree(ctx, consensus.NewEmptyTree(ctx, did, nodestore.MustMemoryStore(ctx)), nil, consensus.DefaultTransactors)
+		require.Nil(t, err)
+		return tree, did
+	}
+	setOwners := func(t *testing.T, tree *chaintree.ChainTree, key *ecdsa.PrivateKey, owners ...string) {
+		txn, err := chaintree.NewSetOwnershipTransaction(owners)
+		require.Nil(t, err)
+		abr := nextABR(t, tree, key, txn)
+		_, err = agg.Add(ctx, &abr)
+		require.Nil(t, err)
+	}
+	owned := func(t *testing.T, addresses ...string) []string {
+		resp, err := agg.OwnedTrees(ctx, addresses, 20, "")
+		require.Nil(t, err)
+		return resp.Dids
+	}
+
+	aliceKey, alice := newKey(t)
+	bobKey, bob := newKey(t)
+	_, carol := newKey(t)
+
+	// a tree without authentications is owned by its genesis key
+	abr := NewValidTransactionWithPathAndValue(t, aliceKey, "some/path", "hi")
+	_, err = agg.Add(ctx, &abr)
+	require.Nil(t, err)
+	aliceDid := string(abr.ObjectId)
+	assert.Equal(t, []string{aliceDid}, owned(t, alice))
+
+	sharedKey, shared := newKey(t)
+	sharedTree, sharedDid := newTree(t, sharedKey)
+	setOwners(t, sharedTree, sharedKey, bob)
+
+	t.Run("indexes changed authentications", func(t *testing.T) {
+		assert.Len(t, owned(t, shared), 0)
+		assert.Equal(t, []string{sharedDid}, owned(t, bob))
+	})
+
+	t.Run("lists the trees of every address", func(t *testing.T) {
+		resp, err := agg.OwnedTrees(ctx, []string{alice, bob}, 1, "")
+		require.Nil(t, err)
+		assert.Len(t, resp.Dids, 1)
+		assert.True(t, resp.HasMore)
+
+		resp, err = agg.OwnedTrees(ctx, []string{alice, bob}, 1, resp.Dids[0])
+		require.Nil(t, err)
+		assert.Len(t, resp.Dids, 1)
+		assert.False(t, resp.HasMore)
+	})
+
+	graftedKey, _ := newKey(t)
+	graftedTree, graftedDid := newTree(t, graftedKey)
+	setOwners(t, graftedTree, graftedKey, sharedDid+"/tree/_tupelo/authentications")
+
+	t.Run("resolves grafted owners", func(t *testing.T) {
+		assert.ElementsMatch(t, []string{sharedDid, graftedDid}, owned(t, bob))
+	})
+
+	t.Run("updates grafted owners when the grafted tree changes", func(t *testing.T) {
+		setOwners(t, sharedTree, bobKey, carol)
+
+		assert.Len(t, owned(t, bob), 0)
+		assert.ElementsMatch(t, []string{sharedDid, graftedDid}, owned(t, carol))
+	})
+
+	t.Run("rebuilds the owner index", func(t *testing.T) {
+		// for instance a tree stored before the owner index
+		indexStore, err := agg.readIndexStore()
+		require.Nil(t, err)
+		require.Nil(t, indexStore.updateKeyList(ownedTreesPrefix.ChildString(alice), aliceDid, false))
+		assert.Len(t, owned(t, alice), 0)
+
+		require.Nil(t, agg.RebuildIndexes(ctx))
+
+		assert.Equal(t, []string{aliceDid}, owned(t, alice))
+		assert.ElementsMatch(t, []string{sharedDid, graftedDid}, owned(t, carol))
+	})
+
+	t.Run("queues the owners of grafted trees", func(t *testing.T) {
+		hubKey, hub := newKey(t)
+		hubTree, hubDid := newTree(t, hubKey)
+		setOwners(t, hubTree, hubKey, hub)
+
+		dependents := make([]string, maxPendingOwners+1)
+		for i := range dependents {
+			key, _ := newKey(t)
+			tree, did := newTree(t, key)
+			setOwners(t, tree, key, hubDid+"/tree/_tupelo/authentications")
+			dependents[i] = did
+		}
+		assert.Len(t, owned(t, hub), len(dependents)+1)
+
+		_, dave := newKey(t)
+		setOwners(t, hubTree, hubKey, dave)
+		// the Add indexes at most maxPendingOwners of them
+		indexStore, err := agg.readIndexStore()
+		require.Nil(t, err)
+		pending, err := indexStore.getKeyList(pendingOwnersKey)
+		require.Nil(t, err)
+		require.Len(t, pending, 1)
+		assert.Contains(t, dependents, pending[0])
+		assert.Contains(t, owned(t, hub), pending[0])
+
+		// a later Add indexes the rest
+		otherKey, _ := newKey(t)
+		abr := NewValidTransactionWithPathAndValue(t, otherKey, "some/path", "hi")
+		_, err = agg.Add(ctx, &abr)
+		require.Nil(t, err)
+		pending, err = indexStore.getKeyList(pendingOwnersKey)
+		require.Nil(t, err)
+		assert.Len(t, pending, 0)
+		assert.Len(t, owned(t, hub), 0)
+		assert.ElementsMatch(t, append([]string{hubDid}, dependents...), owned(t, dave))
+	})
+
+	t.Run("indexes grafts from trees that do not exist yet", func(t *testing.T) {
+		futureKey, _ := newKey(t)
+		futureTree, futureDid := newTree(t, futureKey)
+		waitingKey, _ := newKey(t)
+		waitingTree, waitingDid := newTree(t, waitingKey)
+		setOwners(t, waitingTree, waitingKey, futureDid+"/tree/_tupelo/authentications")
+
+		indexStore, err := agg.readIndexStore()
+		require.Nil(t, err)
+		dependents, err := indexStore.getKeyList(graftDependentsPrefix.ChildString(futureDid))
+		require.Nil(t, err)
+		assert.Equal(t, []string{waitingDid}, dependents)
+
+		_, erin := newKey(t)
+		setOwners(t, futureTree, futureKey, erin)
+		assert.ElementsMatch(t, []string{futureDid, waitingDid}, owned(t, erin))
+	})
+}
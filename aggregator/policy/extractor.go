@@ -9,34 +9,30 @@ import (
 	"github.com/quorumcontrol/chaintree/graftabledag"
 )
 
+// PolicyFromTree prepares the policy of tree, its modules at policyPath and the modules it imports
+// (see ParsePolicyImport), which are resolved through the getter
 func PolicyFromTree(ctx context.Context, mainPolicyName string, wantsPolicyName string, getter graftabledag.DagGetter, tree *dag.Dag) (query *rego.PreparedEvalQuery, hasWants bool, err error) {
-	policies, remain, err := tree.Resolve(ctx, policyPath)
+	modules, hasPolicies, err := policyModules(ctx, getter, tree)
 	if err != nil {
-		return nil, false, fmt.Errorf("error getting policy: %v", err)
+		return nil, false, err
 	}
-	// If the tree has no policies then default to allow
-	if len(remain) > 0 {
+	// If the tree has no policies then default to allow, an empty policy map is still evaluated (and allows nothing)
+	if !hasPolicies {
 		return nil, false, nil
 	}
+	return prepareQuery(ctx, mainPolicyName, wantsPolicyName, modules)
+}
 
-	// otherwise we have a policy map and we should evaluate
-
-	policyMap, ok := policies.(map[string]interface{})
-	if !ok {
-		return nil, false, fmt.Errorf("error converting poicies: %T %v", policies, policies)
-	}
-
+func prepareQuery(ctx context.Context, mainPolicyName string, wantsPolicyName string, policyModules []policyModule) (query *rego.PreparedEvalQuery, hasWants bool, err error) {
 	var modules []func(*rego.Rego)
 
-	for k := range policyMap {
-		policy, _, err := tree.Resolve(ctx, append(policyPath, k))
-		if err != nil {
-			return nil, false, fmt.Errorf("error resolving: %v", policies)
+	for _, module := range policyModules {
+		modules = append(modules, rego.Module(module.File, module.Source))
+		if module.Name == "wants" {
+			hasWants = true
 		}
-		modules = append(modules, rego.Module(k, policy.(string)))
 	}
 
-	_, hasWants = policyMap["wants"]
 	queryString := "allow = data." + mainPolicyName + ".allow"
 	if hasWants {
 		queryString += "; wants = data." + wantsPolicyName + ".paths"
@@ -0,0 +1,242 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/chaintree/graftabledag"
+	"github.com/quorumcontrol/chaintree/typecaster"
+)
+
+var policyImportsPath = []string{"tree", "data", ".well-known", "policyImports"}
+
+// policyModule is a rego module of a tree, File is unique for every module (see policyModules)
+type policyModule struct {
+	Name   string
+	File   string
+	Source string
+}
+
+// PolicyImport is a parsed entry of tree/data/.well-known/policyImports
+type PolicyImport struct {
+	Did  string
+	Path []string // relative to tree/data
+	Tip  *cid.Cid // nil for the latest version of the tree
+}
+
+func (pi *PolicyImport) String() string {
+	str := pi.Did + "/" + strings.Join(pi.Path, "/")
+	if pi.Tip != nil {
+		str += "@" + pi.Tip.String()
+	}
+	return str
+}
+
+/*
+ParsePolicyImport parses an import of policy modules from another tree: "<did>/<path>[@<tip>]".
+The path is relative to tree/data of the imported tree and is either a module (a string) or a map
+of modules, for instance "did:tupelo:org/policies/rbac" or "did:tupelo:org/policies". Without a tip
+the latest version of the tree is imported, a tip pins the import to that version of the tree so that
+changes to the imported tree do not change the policies of the importing one.
+*/
+func ParsePolicyImport(str string) (*PolicyImport, error) {
+	if !strings.HasPrefix(str, "did:tupelo:") {
+		return nil, fmt.Errorf("invalid policy import %s: expected a did:tupelo: DID", str)
+	}
+	var tip *cid.Cid
+	if i := strings.LastIndex(str, "@"); i >= 0 {
+		pinned, err := cid.Decode(str[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy import %s: invalid tip: %w", str, err)
+		}
+		tip = &pinned
+		str = str[:i]
+	}
+	parts := strings.SplitN(str, "/", 2)
+	var path []string
+	if len(parts) == 2 {
+		for _, segment := range strings.Split(parts[1], "/") {
+			if segment != "" {
+				path = append(path, segment)
+			}
+		}
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("invalid policy import %s: missing path", str)
+	}
+	return &PolicyImport{
+		Did:  parts[0],
+		Path: path,
+		Tip:  tip,
+	}, nil
+}
+
+// policyModules returns the modules at policyPath of tree followed by the modules it imports (see importedModules).
+// hasPolicies is false when the tree has neither a policy map (even an empty one) nor imported modules.
+func policyModules(ctx context.Context, getter graftabledag.DagGetter, tree *dag.Dag) (modules []policyModule, hasPolicies bool, err error) {
+	modules, hasPolicies, err = localModules(ctx, tree)
+	if err != nil {
+		return nil, false, err
+	}
+	imported, err := importedModules(ctx, getter, tree, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	return append(modules, imported...), hasPolicies || len(imported) > 0, nil
+}
+
+func localModules(ctx context.Context, tree *dag.Dag) ([]policyModule, bool, error) {
+	policies, remain, err := tree.Resolve(ctx, policyPath)
+	if err != nil {
+		return nil, false, fmt.Errorf("error getting policy: %v", err)
+	}
+	// If the tree has no policies then default to allow
+	if len(remain) > 0 {
+		return nil, false, nil
+	}
+
+	policyMap, ok := policies.(map[string]interface{})
+	if !ok {
+		return nil, false, fmt.Errorf("error converting poicies: %T %v", policies, policies)
+	}
+
+	modules := make([]policyModule, 0, len(policyMap))
+	for k := range policyMap {
+		policy, _, err := tree.Resolve(ctx, append(policyPath, k))
+		if err != nil {
+			return nil, false, fmt.Errorf("error resolving: %v", policies)
+		}
+		source, ok := policy.(string)
+		if !ok {
+			return nil, false, fmt.Errorf("error converting policy %s: %T", k, policy)
+		}
+		modules = append(modules, policyModule{Name: k, File: k, Source: source})
+	}
+	return modules, true, nil
+}
+
+/*
+importedModules resolves the imports at tree/data/.well-known/policyImports of tree through the getter,
+including the imports of the imported trees. importing is the chain of DIDs that led to tree and is used
+to detect import cycles. A module that is imported more than once (through different trees) is only
+returned once.
+*/
+func importedModules(ctx context.Context, getter graftabledag.DagGetter, tree *dag.Dag, importing []string) ([]policyModule, error) {
+	uncastImports, remain, err := tree.Resolve(ctx, policyImportsPath)
+	if err != nil {
+		return nil, fmt.Errorf("error getting policy imports: %w", err)
+	}
+	if len(remain) > 0 || uncastImports == nil {
+		return nil, nil
+	}
+	var imports []string
+	err = typecaster.ToType(uncastImports, &imports)
+	if err != nil {
+		return nil, fmt.Errorf("error converting policy imports: %w", err)
+	}
+
+	did, _, err := tree.Resolve(ctx, []string{"id"})
+	if err != nil {
+		return nil, fmt.Errorf("error getting id: %w", err)
+	}
+	importing = append(append([]string{}, importing...), fmt.Sprint(did))
+
+	var modules []policyModule
+	seen := make(map[string]bool)
+	for _, str := range imports {
+		policyImport, err := ParsePolicyImport(str)
+		if err != nil {
+			return nil, err
+		}
+		for _, importer := range importing {
+			if importer == policyImport.Did {
+				return nil, fmt.Errorf("policy import cycle: %s -> %s", strings.Join(importing, " -> "), policyImport.Did)
+			}
+		}
+
+		importedTree, err := importedDag(ctx, getter, policyImport)
+		if err != nil {
+			return nil, err
+		}
+		imported, err := modulesAt(ctx, importedTree, policyImport)
+		if err != nil {
+			return nil, err
+		}
+		// the modules an imported module builds on
+		dependencies, err := importedModules(ctx, getter, importedTree, importing)
+		if err != nil {
+			return nil, fmt.Errorf("error importing %s: %w", str, err)
+		}
+		for _, module := range append(imported, dependencies...) {
+			if !seen[module.File] {
+				seen[module.File] = true
+				modules = append(modules, module)
+			}
+		}
+	}
+	return modules, nil
+}
+
+// importedDag returns the imported tree, at the pinned tip if there is one
+func importedDag(ctx context.Context, getter graftabledag.DagGetter, policyImport *PolicyImport) (*dag.Dag, error) {
+	latest, err := getter.GetLatest(ctx, policyImport.Did)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s: %w", policyImport.Did, err)
+	}
+	if policyImport.Tip == nil {
+		return latest.Dag, nil
+	}
+	pinned := latest.Dag.WithNewTip(*policyImport.Tip)
+	// the tip must be a version of the imported tree and not of any other
+	did, _, err := pinned.Resolve(ctx, []string{"id"})
+	if err != nil {
+		return nil, fmt.Errorf("error resolving pinned tip of %s: %w", policyImport.String(), err)
+	}
+	if did != policyImport.Did {
+		return nil, fmt.Errorf("invalid policy import %s: the tip is not a version of %s", policyImport.String(), policyImport.Did)
+	}
+	return pinned, nil
+}
+
+// modulesAt returns the module (or the map of modules) at the path of the import
+func modulesAt(ctx context.Context, tree *dag.Dag, policyImport *PolicyImport) ([]policyModule, error) {
+	path := append([]string{"tree", "data"}, policyImport.Path...)
+	val, remain, err := tree.Resolve(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", policyImport.String(), err)
+	}
+	if len(remain) > 0 {
+		return nil, fmt.Errorf("error importing %s: no policy at %s", policyImport.String(), strings.Join(policyImport.Path, "/"))
+	}
+
+	switch val := val.(type) {
+	case string:
+		name := policyImport.Path[len(policyImport.Path)-1]
+		return []policyModule{{Name: name, File: policyImport.String(), Source: val}}, nil
+	case map[string]interface{}:
+		names := make([]string, 0, len(val))
+		for k := range val {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		modules := make([]policyModule, 0, len(names))
+		for _, k := range names {
+			module, _, err := tree.Resolve(ctx, append(path, k))
+			if err != nil {
+				return nil, fmt.Errorf("error resolving %s: %w", policyImport.String(), err)
+			}
+			source, ok := module.(string)
+			if !ok {
+				return nil, fmt.Errorf("error importing %s: policy %s is a %T", policyImport.String(), k, module)
+			}
+			modules = append(modules, policyModule{Name: k, File: policyImport.String() + "/" + k, Source: source})
+		}
+		return modules, nil
+	default:
+		return nil, fmt.Errorf("error importing %s: expected a policy or a map of policies, got %T", policyImport.String(), val)
+	}
+}
@@ -0,0 +1,199 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/testgetter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const publicOnly = `
+	package lib.public
+	default allowed = false
+	allowed {
+		input.path == "tree/data/public"
+	}
+`
+
+// importingRead is a read policy that only allows what the imported lib.public allows
+var importingRead = map[string]interface{}{
+	"read": `
+		package read
+		default allow = false
+		allow {
+			data.lib.public.allowed
+		}
+	`,
+}
+
+func libraryTree(t *testing.T, ctx context.Context, name string, imports ...string) *chaintree.ChainTree {
+	data := map[string]interface{}{
+		"policies": map[string]interface{}{
+			"public": publicOnly,
+		},
+	}
+	if len(imports) > 0 {
+		data[".well-known"] = map[string]interface{}{
+			"policyImports": imports,
+		}
+	}
+	return testgetter.NewChaintreeWithNodes(t, ctx, name, map[string]interface{}{"data": data})
+}
+
+func importingTree(t *testing.T, ctx context.Context, imports ...string) *dag.Dag {
+	return testgetter.NewChaintreeWithNodes(t, ctx, "importing", map[string]interface{}{
+		"data": map[string]interface{}{
+			".well-known": map[string]interface{}{
+				"policies":      importingRead,
+				"policyImports": imports,
+			},
+		},
+	}).Dag
+}
+
+func readAllowed(t *testing.T, ctx context.Context, tree *dag.Dag, getter *testgetter.TestDagGetter, path string) bool {
+	allowed, err := ReadValidator(ctx, tree, getter, &ReadInput{Method: MethodGet, Path: path})
+	require.Nil(t, err)
+	return allowed
+}
+
+func TestParsePolicyImport(t *testing.T) {
+	policyImport, err := ParsePolicyImport("did:tupelo:org/policies/rbac")
+	require.Nil(t, err)
+	assert.Equal(t, "did:tupelo:org", policyImport.Did)
+	assert.Equal(t, []string{"policies", "rbac"}, policyImport.Path)
+	assert.Nil(t, policyImport.Tip)
+
+	tip := testgetter.NewChaintree(t, context.Background(), "org").Dag.Tip
+	policyImport, err = ParsePolicyImport("did:tupelo:org/policies@" + tip.String())
+	require.Nil(t, err)
+	assert.Equal(t, []string{"policies"}, policyImport.Path)
+	require.NotNil(t, policyImport.Tip)
+	assert.True(t, tip.Equals(*policyImport.Tip))
+
+	for _, invalid := range []string{"policies/rbac", "did:tupelo:org", "did:tupelo:org/policies@notacid"} {
+		_, err = ParsePolicyImport(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestPolicyImports(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("imports a module", func(t *testing.T) {
+		getter := testgetter.NewDagGetter(t, ctx, libraryTree(t, ctx, "org"))
+		tree := importingTree(t, ctx, "did:tupelo:org/policies/public")
+		assert.True(t, readAllowed(t, ctx, tree, getter, "tree/data/public"))
+		assert.False(t, readAllowed(t, ctx, tree, getter, "tree/data/private"))
+	})
+
+	t.Run("imports a map of modules", func(t *testing.T) {
+		getter := testgetter.NewDagGetter(t, ctx, libraryTree(t, ctx, "org"))
+		tree := importingTree(t, ctx, "did:tupelo:org/policies")
+		assert.True(t, readAllowed(t, ctx, tree, getter, "tree/data/public"))
+		assert.False(t, readAllowed(t, ctx, tree, getter, "tree/data/private"))
+	})
+
+	t.Run("imports the imports of imported trees", func(t *testing.T) {
+		base := libraryTree(t, ctx, "base")
+		// a library that builds on lib.public of base
+		wrapper := testgetter.NewChaintreeWithNodes(t, ctx, "wrapper", map[string]interface{}{
+			"data": map[string]interface{}{
+				"policies": map[string]interface{}{
+					"wrapper": `
+						package lib.wrapper
+						allowed {
+							data.lib.public.allowed
+						}
+					`,
+				},
+				".well-known": map[string]interface{}{
+					"policyImports": []string{"did:tupelo:base/policies/public"},
+				},
+			},
+		})
+		getter := testgetter.NewDagGetter(t, ctx, base, wrapper)
+		// both are imported directly as well, but only compiled once
+		tree := importingTree(t, ctx, "did:tupelo:wrapper/policies/wrapper", "did:tupelo:base/policies/public")
+		assert.True(t, readAllowed(t, ctx, tree, getter, "tree/data/public"))
+	})
+
+	t.Run("detects import cycles", func(t *testing.T) {
+		getter := testgetter.NewDagGetter(t, ctx,
+			libraryTree(t, ctx, "a", "did:tupelo:b/policies/public"),
+			libraryTree(t, ctx, "b", "did:tupelo:a/policies/public"),
+		)
+		tree := importingTree(t, ctx, "did:tupelo:a/policies/public")
+		_, err := ReadValidator(ctx, tree, getter, &ReadInput{Method: MethodGet, Path: "tree/data/public"})
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), "policy import cycle: did:tupelo:importing -> did:tupelo:a -> did:tupelo:b -> did:tupelo:a")
+
+		// importing itself is a cycle too
+		getter = testgetter.NewDagGetter(t, ctx, libraryTree(t, ctx, "self", "did:tupelo:self/policies/public"))
+		_, err = ReadValidator(ctx, importingTree(t, ctx, "did:tupelo:self/policies/public"), getter, &ReadInput{Method: MethodGet, Path: "tree/data/public"})
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), "policy import cycle")
+	})
+
+	t.Run("errors on missing modules", func(t *testing.T) {
+		getter := testgetter.NewDagGetter(t, ctx, libraryTree(t, ctx, "org"))
+		_, err := ReadValidator(ctx, importingTree(t, ctx, "did:tupelo:org/policies/missing"), getter, &ReadInput{Method: MethodGet, Path: "tree/data/public"})
+		require.NotNil(t, err)
+	})
+
+	t.Run("pins the imported tree", func(t *testing.T) {
+		library := libraryTree(t, ctx, "org")
+		pinnedTip := library.Dag.Tip
+		getter := testgetter.NewDagGetter(t, ctx, library)
+
+		// the library is changed to allow everything
+		changed, err := library.Dag.SetAsLink(ctx, []string{"tree", "data", "policies", "public"}, `
+			package lib.public
+			allowed = true
+		`)
+		require.Nil(t, err)
+		library.Dag = changed
+
+		latest := importingTree(t, ctx, "did:tupelo:org/policies/public")
+		assert.True(t, readAllowed(t, ctx, latest, getter, "tree/data/private"))
+
+		pinned := importingTree(t, ctx, "did:tupelo:org/policies/public@"+pinnedTip.String())
+		assert.False(t, readAllowed(t, ctx, pinned, getter, "tree/data/private"))
+		assert.True(t, readAllowed(t, ctx, pinned, getter, "tree/data/public"))
+
+		// the tip has to be a version of the imported tree
+		other := libraryTree(t, ctx, "other")
+		pinnedRoot, err := library.Dag.Get(ctx, pinnedTip)
+		require.Nil(t, err)
+		require.Nil(t, other.Dag.AddNodes(ctx, pinnedRoot))
+		_, err = ReadValidator(ctx, importingTree(t, ctx, "did:tupelo:other/policies/public@"+pinnedTip.String()), testgetter.NewDagGetter(t, ctx, other), &ReadInput{Method: MethodGet, Path: "tree/data/public"})
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), "not a version of did:tupelo:other")
+	})
+}
+
+func TestEmptyPolicies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	getter := testgetter.NewDagGetter(t, ctx)
+	tree := testgetter.NewChaintreeWithNodes(t, ctx, "empty", map[string]interface{}{
+		"data": map[string]interface{}{
+			".well-known": map[string]interface{}{
+				"policies": map[string]interface{}{},
+			},
+		},
+	}).Dag
+
+	// an existing (empty) policy map is evaluated rather than allowing everything
+	query, _, err := PolicyFromTree(ctx, "read", "wants", getter, tree)
+	require.Nil(t, err)
+	assert.NotNil(t, query)
+	allowed, _ := ReadValidator(ctx, tree, getter, &ReadInput{Method: MethodGet, Path: "tree/data/public"})
+	assert.False(t, allowed)
+}
@@ -0,0 +1,65 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/chaintree/graftabledag"
+	"github.com/quorumcontrol/chaintree/typecaster"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+)
+
+func init() {
+	typecaster.AddType(MessageInput{})
+}
+
+// MessageInput is the input to the "message" policy of the recipient tree
+type MessageInput struct {
+	From string
+	To   string
+	Body string
+	Sent int64
+	// Identity is the sender, its Signers are the owners of the sender tree that signed the message
+	Identity *identity.Identity
+}
+
+func (mi *MessageInput) ToInputMap() (PolicyInputMap, error) {
+	inputMap := make(map[string]interface{})
+
+	err := typecaster.ToType(mi, &inputMap)
+	return inputMap, err
+}
+
+// MessageValidator evaluates the "message" policy of the recipient tree (which can be imported). Unlike reads,
+// a tree without a message policy does not accept messages.
+func MessageValidator(ctx context.Context, tree *dag.Dag, getter graftabledag.DagGetter, input *MessageInput) (bool, chaintree.CodedError) {
+	modules, _, err := policyModules(ctx, getter, tree)
+	if err != nil {
+		return false, errToCoded(err)
+	}
+	hasMessage := false
+	for _, module := range modules {
+		if module.Name == "message" {
+			hasMessage = true
+		}
+	}
+	if !hasMessage {
+		return false, nil
+	}
+
+	query, hasWants, err := prepareQuery(ctx, "message", "messageWants", modules)
+	if err != nil {
+		return false, errToCoded(err)
+	}
+
+	inputMap, err := input.ToInputMap()
+
+	if err != nil {
+		return false, errToCoded(fmt.Errorf("error getting input: %w", err))
+	}
+
+	isValid, err := PolicyValidator(ctx, *query, tree, getter, hasWants, inputMap)
+	return isValid, errToCoded(err)
+}
@@ -0,0 +1,67 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/testgetter"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessagePolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := nodestore.MustMemoryStore(ctx)
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	did := consensus.EcdsaPubkeyToDid(treeKey.PublicKey)
+
+	input := &MessageInput{
+		From:     "did:tupelo:friend",
+		To:       did,
+		Body:     "hi",
+		Identity: &identity.Identity{Sub: "did:tupelo:friend"},
+	}
+
+	// no policies at all
+	valid, err := MessageValidator(ctx, consensus.NewEmptyTree(ctx, did, store), testgetter.NewDagGetter(t, ctx), input)
+	require.Nil(t, err)
+	require.False(t, valid)
+
+	// policies, but no message policy
+	tree, err := consensus.NewEmptyTree(ctx, did, store).SetAsLink(ctx, []string{"tree", "data", ".well-known", "policies"}, map[string]string{
+		"read": `
+			package read
+			default allow = true
+		`,
+	})
+	require.Nil(t, err)
+	valid, err = MessageValidator(ctx, tree, testgetter.NewDagGetter(t, ctx), input)
+	require.Nil(t, err)
+	require.False(t, valid)
+
+	tree, err = consensus.NewEmptyTree(ctx, did, store).SetAsLink(ctx, []string{"tree", "data", ".well-known", "policies"}, map[string]string{
+		"message": `
+			package message
+			default allow = false
+
+			allow {
+				input.identity.sub == "did:tupelo:friend"
+			}
+		`,
+	})
+	require.Nil(t, err)
+	valid, err = MessageValidator(ctx, tree, testgetter.NewDagGetter(t, ctx), input)
+	require.Nil(t, err)
+	require.True(t, valid)
+
+	input.Identity = &identity.Identity{Sub: "did:tupelo:stranger"}
+	valid, err = MessageValidator(ctx, tree, testgetter.NewDagGetter(t, ctx), input)
+	require.Nil(t, err)
+	require.False(t, valid)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/open-policy-agent/opa/rego"
 	"github.com/quorumcontrol/chaintree/chaintree"
 	"github.com/quorumcontrol/chaintree/dag"
 	"github.com/quorumcontrol/chaintree/graftabledag"
@@ -15,6 +16,16 @@ func init() {
 	typecaster.AddType(ReadInput{})
 }
 
+// The methods of a ReadInput
+const (
+	// MethodGet is used when resolving paths in the tree
+	MethodGet = "GET"
+	// MethodSubscribe is used when subscribing to updates of the tree (see publisher.PrivateTopic, and
+	// publisher.PublicTopic on the standalone server unless PUBLIC_TOPIC_ACLS=false). There is no fallback to
+	// MethodGet: read policies that only allow GET (e.g. `allow { input.method == "GET" }`) deny subscriptions.
+	MethodSubscribe = "SUBSCRIBE"
+)
+
 type ReadInput struct {
 	Object   string
 	Method   string
@@ -30,21 +41,47 @@ func (ri *ReadInput) ToInputMap() (PolicyInputMap, error) {
 }
 
 func ReadValidator(ctx context.Context, tree *dag.Dag, getter graftabledag.DagGetter, input *ReadInput) (bool, chaintree.CodedError) {
-	query, hasWants, err := PolicyFromTree(ctx, "read", "readWants", getter, tree)
+	readPolicy, err := NewReadPolicy(ctx, tree, getter)
 	if err != nil {
 		return false, errToCoded(err)
 	}
+	isValid, err := readPolicy.Allowed(ctx, input)
+	return isValid, errToCoded(err)
+}
+
+// ReadPolicy is the prepared read policy of a tree so that it can be evaluated
+// against many ReadInputs (concurrently) without being compiled again.
+type ReadPolicy struct {
+	query    *rego.PreparedEvalQuery
+	hasWants bool
+	tree     *dag.Dag
+	getter   graftabledag.DagGetter
+}
+
+func NewReadPolicy(ctx context.Context, tree *dag.Dag, getter graftabledag.DagGetter) (*ReadPolicy, error) {
+	query, hasWants, err := PolicyFromTree(ctx, "read", "readWants", getter, tree)
+	if err != nil {
+		return nil, err
+	}
+	return &ReadPolicy{
+		query:    query,
+		hasWants: hasWants,
+		tree:     tree,
+		getter:   getter,
+	}, nil
+}
+
+// Allowed evaluates the policy against input, a tree without a read policy allows everything
+func (rp *ReadPolicy) Allowed(ctx context.Context, input *ReadInput) (bool, error) {
 	// if there is no query and no error then assume no policies
-	if query == nil {
+	if rp.query == nil {
 		return true, nil
 	}
 
 	inputMap, err := input.ToInputMap()
-
 	if err != nil {
-		return false, errToCoded(fmt.Errorf("error getting input: %w", err))
+		return false, fmt.Errorf("error getting input: %w", err)
 	}
 
-	isValid, err := PolicyValidator(ctx, *query, tree, getter, hasWants, inputMap)
-	return isValid, errToCoded(err)
+	return PolicyValidator(ctx, *rp.query, rp.tree, rp.getter, rp.hasWants, inputMap)
 }
@@ -118,3 +118,43 @@ func TestReadPolicyWithWants(t *testing.T) {
 	require.Nil(t, err)
 	require.False(t, valid)
 }
+
+func TestReadPolicyWithSigners(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := nodestore.MustMemoryStore(ctx)
+
+	policies := map[string]string{
+		"read": `
+			package read
+			default allow = false
+
+			allow {
+				count(input.identity.signers) >= 2
+			}
+		`,
+	}
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	did := consensus.EcdsaPubkeyToDid(treeKey.PublicKey)
+
+	tree, err := consensus.NewEmptyTree(ctx, did, store).SetAsLink(ctx, []string{"tree", "data", ".well-known", "policies"}, policies)
+	require.Nil(t, err)
+
+	valid, err := ReadValidator(ctx, tree, testgetter.NewDagGetter(t, ctx), &ReadInput{
+		Object:   did,
+		Path:     "/tree/data",
+		Identity: &identity.Identity{Sub: did, Signers: []string{"0xone"}},
+	})
+	require.Nil(t, err)
+	require.False(t, valid)
+
+	valid, err = ReadValidator(ctx, tree, testgetter.NewDagGetter(t, ctx), &ReadInput{
+		Object:   did,
+		Path:     "/tree/data",
+		Identity: &identity.Identity{Sub: did, Signers: []string{"0xone", "0xtwo"}},
+	})
+	require.Nil(t, err)
+	require.True(t, valid)
+}
@@ -0,0 +1,464 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/santhosh-tekuri/jsonschema"
+)
+
+// SchemaViolationCode is the code of a SchemaViolationError
+const SchemaViolationCode = 422
+
+var schemasPath = []string{"tree", "data", ".well-known", "schemas"}
+
+// SchemaViolation is a value that does not conform to its schema
+type SchemaViolation struct {
+	Path    string // the path of the value in the tree (including the pointer into the value)
+	Schema  string // the glob of the schema (relative to tree/data)
+	Message string
+}
+
+// SchemaViolationError is the CodedError of the schema validator (see SchemaValidatorGenerator)
+// when a block leaves values that do not conform to the schemas of the tree
+type SchemaViolationError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaViolationError) GetCode() int {
+	return SchemaViolationCode
+}
+
+func (e *SchemaViolationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		msgs[i] = violation.Path + ": " + violation.Message
+	}
+	return fmt.Sprintf("%d - schema violations: %s", SchemaViolationCode, strings.Join(msgs, "; "))
+}
+
+/*
+SchemaValidator validates the values of the tree after the block against the JSON Schemas
+of the tree (after the block, so a schema applies from the block that adds it). Schemas are
+JSON strings stored under tree/data/.well-known/schemas/<path-glob>, the glob is relative to
+tree/data and each of its segments is matched with path.Match against the keys of the tree.
+Values that do not exist are not validated (use "required" in the schema of the parent).
+Only the values a block changes are validated (all of them when it changes the schemas), so
+the values of a tree that the schemas do not apply to or that the block leaves alone are not read.
+
+For example:
+
+```
+".well-known/schemas/profile": `{"type": "object", "required": ["name"]}`,
+".well-known/schemas/posts/*": `{"type": "object", "properties": {"title": {"type": "string"}}}`,
+```
+
+Only references within a schema ("#/...") are supported.
+*/
+func SchemaValidator(ctx context.Context, tree *dag.Dag, blockWithHeaders *chaintree.BlockWithHeaders) (bool, chaintree.CodedError) {
+	hasSchemas, err := hasSchemas(ctx, tree)
+	if err != nil {
+		return false, errToCoded(err)
+	}
+	changed, changesSchemas := changedDataPaths(blockWithHeaders)
+	if !hasSchemas && !changesSchemas {
+		return true, nil
+	}
+
+	// validators run before the transactions, so play them on a copy of the tree
+	chainTree, err := chaintree.NewChainTree(ctx, tree, nil, consensus.DefaultTransactors)
+	if err != nil {
+		return false, errToCoded(fmt.Errorf("error creating tree: %w", err))
+	}
+	newTree, valid, err := chainTree.ProcessBlockImmutable(ctx, blockWithHeaders)
+	if !valid || err != nil {
+		// the transactions are rejected by the tree itself
+		return true, nil
+	}
+
+	if changesSchemas {
+		changed = nil
+	}
+	violations, err := validateSchemas(ctx, newTree.Dag, changed)
+	if err != nil {
+		return false, errToCoded(err)
+	}
+	if len(violations) > 0 {
+		return false, &SchemaViolationError{Violations: violations}
+	}
+	return true, nil
+}
+
+// SchemaValidatorGenerator is the chaintree.BlockValidatorFunc generator for SchemaValidator
+func SchemaValidatorGenerator(ctx context.Context, ng *types.NotaryGroup) (chaintree.BlockValidatorFunc, error) {
+	var schemaValidator chaintree.BlockValidatorFunc = func(tree *dag.Dag, blockWithHeaders *chaintree.BlockWithHeaders) (bool, chaintree.CodedError) {
+		return SchemaValidator(ctx, tree, blockWithHeaders)
+	}
+	return schemaValidator, nil
+}
+
+func hasSchemas(ctx context.Context, tree *dag.Dag) (bool, error) {
+	val, remain, err := tree.Resolve(ctx, schemasPath)
+	if err != nil {
+		return false, fmt.Errorf("error resolving schemas: %w", err)
+	}
+	return len(remain) == 0 && val != nil, nil
+}
+
+/*
+changedDataPaths returns the paths (relative to tree/data) the transactions of the block set and
+whether they change the schemas (by setting them, a parent of them or a path within them).
+*/
+func changedDataPaths(blockWithHeaders *chaintree.BlockWithHeaders) ([][]string, bool) {
+	schemasGlob := schemasPath[2:]
+	var changed [][]string
+	changesSchemas := false
+	for _, txn := range blockWithHeaders.Transactions {
+		if txn.Type != transactions.Transaction_SETDATA {
+			continue
+		}
+		path := splitPath(txn.GetSetDataPayload().Path)
+		if overlaps(path, schemasGlob) {
+			changesSchemas = true
+		}
+		changed = append(changed, path)
+	}
+	return changed, changesSchemas
+}
+
+func splitPath(str string) []string {
+	var segments []string
+	for _, segment := range strings.Split(str, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// overlaps is true when one of the paths is within the other
+func overlaps(a []string, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ResolveSchemas resolves the schemas of tree (after blockWithHeaders) and the values of the block they apply to,
+which is what SchemaValidator reads of the tree after a block (so that a tracked tree includes their nodes in
+the state of an AddBlockRequest).
+*/
+func ResolveSchemas(ctx context.Context, tree *dag.Dag, blockWithHeaders *chaintree.BlockWithHeaders) error {
+	changed, changesSchemas := changedDataPaths(blockWithHeaders)
+	if changesSchemas {
+		changed = nil
+	}
+	_, err := validateSchemas(ctx, tree, changed)
+	return err
+}
+
+// validateSchemas returns the violations of the values of tree against its schemas, ordered by schema glob.
+// With changed paths (relative to tree/data) only the values within or around them are validated, otherwise all of them.
+func validateSchemas(ctx context.Context, tree *dag.Dag, changed [][]string) ([]SchemaViolation, error) {
+	val, remain, err := tree.Resolve(ctx, schemasPath)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving schemas: %w", err)
+	}
+	if len(remain) > 0 || val == nil {
+		return nil, nil
+	}
+	schemas := make(map[string]string)
+	err = collectSchemas(ctx, tree, nil, val, schemas)
+	if err != nil {
+		return nil, err
+	}
+
+	globs := make([]string, 0, len(schemas))
+	for glob := range schemas {
+		globs = append(globs, glob)
+	}
+	sort.Strings(globs)
+
+	var violations []SchemaViolation
+	for _, glob := range globs {
+		schema, err := compileSchema(glob, schemas[glob])
+		if err != nil {
+			return nil, err
+		}
+		var paths [][]string
+		if changed == nil {
+			paths, err = matchingPaths(ctx, tree, []string{"tree", "data"}, strings.Split(glob, "/"))
+		} else {
+			paths, err = changedMatchingPaths(ctx, tree, strings.Split(glob, "/"), changed)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, valuePath := range paths {
+			value, remain, err := tree.Resolve(ctx, valuePath)
+			if err != nil {
+				return nil, fmt.Errorf("error resolving %s: %w", strings.Join(valuePath, "/"), err)
+			}
+			if len(remain) > 0 {
+				continue
+			}
+			doc, err := toJSONDoc(ctx, tree, value)
+			if err != nil {
+				return nil, err
+			}
+			err = schema.ValidateInterface(doc)
+			if err == nil {
+				continue
+			}
+			validationErr, ok := err.(*jsonschema.ValidationError)
+			if !ok {
+				return nil, fmt.Errorf("error validating %s: %w", strings.Join(valuePath, "/"), err)
+			}
+			violations = append(violations, leafViolations(strings.Join(valuePath, "/"), glob, validationErr)...)
+		}
+	}
+	return violations, nil
+}
+
+// collectSchemas adds the schemas (strings) under val to schemas by their glob, maps are segments of the glob
+func collectSchemas(ctx context.Context, tree *dag.Dag, glob []string, val interface{}, schemas map[string]string) error {
+	switch val := val.(type) {
+	case string:
+		if len(glob) == 0 {
+			return fmt.Errorf("invalid schemas: expected a map of path globs")
+		}
+		schemas[strings.Join(glob, "/")] = val
+		return nil
+	case map[string]interface{}:
+		for k, v := range val {
+			err := collectSchemas(ctx, tree, append(append([]string{}, glob...), splitPath(k)...), v, schemas)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case cid.Cid:
+		linked, _, err := tree.ResolveAt(ctx, val, []string{})
+		if err != nil {
+			return fmt.Errorf("error resolving schemas: %w", err)
+		}
+		return collectSchemas(ctx, tree, glob, linked, schemas)
+	default:
+		return fmt.Errorf("invalid schema at %s: expected a JSON string, got %T", strings.Join(glob, "/"), val)
+	}
+}
+
+func compileSchema(glob string, schema string) (*jsonschema.Schema, error) {
+	doc, err := jsonschema.DecodeJSON(strings.NewReader(schema))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema at %s: %w", glob, err)
+	}
+	// other references would be loaded (from files for instance) by the compiler
+	if ref, ok := externalRef(doc); ok {
+		return nil, fmt.Errorf("invalid schema at %s: unsupported reference %s", glob, ref)
+	}
+	url := "tupelo:///schemas/" + neturl.PathEscape(glob)
+	compiler := jsonschema.NewCompiler()
+	err = compiler.AddResource(url, strings.NewReader(schema))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema at %s: %w", glob, err)
+	}
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema at %s: %w", glob, err)
+	}
+	return compiled, nil
+}
+
+func externalRef(doc interface{}) (string, bool) {
+	switch doc := doc.(type) {
+	case map[string]interface{}:
+		for k, v := range doc {
+			if ref, isString := v.(string); k == "$ref" && isString && !strings.HasPrefix(ref, "#") {
+				return ref, true
+			}
+			if ref, ok := externalRef(v); ok {
+				return ref, true
+			}
+		}
+	case []interface{}:
+		for _, v := range doc {
+			if ref, ok := externalRef(v); ok {
+				return ref, true
+			}
+		}
+	}
+	return "", false
+}
+
+// matchingPaths returns the paths under base that match the glob segments
+func matchingPaths(ctx context.Context, tree *dag.Dag, base []string, glob []string) ([][]string, error) {
+	if len(glob) == 0 {
+		return [][]string{base}, nil
+	}
+	segment := glob[0]
+	if !strings.ContainsAny(segment, `*?[\`) {
+		return matchingPaths(ctx, tree, append(append([]string{}, base...), segment), glob[1:])
+	}
+
+	val, remain, err := tree.Resolve(ctx, base)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", strings.Join(base, "/"), err)
+	}
+	if len(remain) > 0 {
+		return nil, nil
+	}
+	var keys []string
+	switch val := val.(type) {
+	case map[string]interface{}:
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+	case []interface{}:
+		for i := range val {
+			keys = append(keys, strconv.Itoa(i))
+		}
+	}
+
+	var paths [][]string
+	for _, k := range keys {
+		matched, err := path.Match(segment, k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema glob %s: %w", strings.Join(glob, "/"), err)
+		}
+		if !matched {
+			continue
+		}
+		childPaths, err := matchingPaths(ctx, tree, append(append([]string{}, base...), k), glob[1:])
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, childPaths...)
+	}
+	return paths, nil
+}
+
+// changedMatchingPaths returns the paths that match the glob segments and are within or contain one of the changed paths
+func changedMatchingPaths(ctx context.Context, tree *dag.Dag, glob []string, changed [][]string) ([][]string, error) {
+	var paths [][]string
+	seen := make(map[string]bool)
+	for _, changedPath := range changed {
+		matches := true
+		for i := 0; i < len(glob) && i < len(changedPath); i++ {
+			matched, err := path.Match(glob[i], changedPath[i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid schema glob %s: %w", strings.Join(glob, "/"), err)
+			}
+			if !matched {
+				matches = false
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		var changedPaths [][]string
+		if len(changedPath) >= len(glob) {
+			// the change is within the value the schema applies to
+			changedPaths = [][]string{append([]string{"tree", "data"}, changedPath[:len(glob)]...)}
+		} else {
+			// the change contains the values the schema applies to
+			var err error
+			changedPaths, err = matchingPaths(ctx, tree, append([]string{"tree", "data"}, changedPath...), glob[len(changedPath):])
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, valuePath := range changedPaths {
+			joined := strings.Join(valuePath, "/")
+			if !seen[joined] {
+				seen[joined] = true
+				paths = append(paths, valuePath)
+			}
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.Join(paths[i], "/") < strings.Join(paths[j], "/")
+	})
+	return paths, nil
+}
+
+// toJSONDoc expands the links of val and converts it to what encoding/json would decode (see jsonschema.DecodeJSON)
+func toJSONDoc(ctx context.Context, tree *dag.Dag, val interface{}) (interface{}, error) {
+	expanded, err := expandLinks(ctx, tree, val)
+	if err != nil {
+		return nil, err
+	}
+	bits, err := json.Marshal(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding value: %w", err)
+	}
+	return jsonschema.DecodeJSON(bytes.NewReader(bits))
+}
+
+func expandLinks(ctx context.Context, tree *dag.Dag, val interface{}) (interface{}, error) {
+	switch val := val.(type) {
+	case cid.Cid:
+		linked, _, err := tree.ResolveAt(ctx, val, []string{})
+		if err != nil {
+			return nil, fmt.Errorf("error resolving %s: %w", val.String(), err)
+		}
+		return expandLinks(ctx, tree, linked)
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			expandedVal, err := expandLinks(ctx, tree, v)
+			if err != nil {
+				return nil, err
+			}
+			expanded[k] = expandedVal
+		}
+		return expanded, nil
+	case []interface{}:
+		expanded := make([]interface{}, len(val))
+		for i, v := range val {
+			expandedVal, err := expandLinks(ctx, tree, v)
+			if err != nil {
+				return nil, err
+			}
+			expanded[i] = expandedVal
+		}
+		return expanded, nil
+	default:
+		return val, nil
+	}
+}
+
+// leafViolations flattens the causes of err (which are the actual violations)
+func leafViolations(valuePath string, glob string, err *jsonschema.ValidationError) []SchemaViolation {
+	if len(err.Causes) == 0 {
+		return []SchemaViolation{{
+			Path:    valuePath + strings.TrimPrefix(err.InstancePtr, "#"),
+			Schema:  glob,
+			Message: err.Message,
+		}}
+	}
+	var violations []SchemaViolation
+	for _, cause := range err.Causes {
+		violations = append(violations, leafViolations(valuePath, glob, cause)...)
+	}
+	return violations
+}
@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaValidator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := nodestore.MustMemoryStore(ctx)
+
+	schemas := map[string]interface{}{
+		"profile": `{
+			"type": "object",
+			"required": ["name"],
+			"properties": {
+				"name": {"type": "string"},
+				"age": {"type": "integer", "minimum": 0}
+			}
+		}`,
+		"posts": map[string]string{
+			"*": `{"type": "string", "maxLength": 5}`,
+		},
+	}
+
+	treeKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	did := consensus.EcdsaPubkeyToDid(treeKey.PublicKey)
+
+	tree, err := consensus.NewEmptyTree(ctx, did, store).SetAsLink(ctx, schemasPath, schemas)
+	require.Nil(t, err)
+
+	genesisBlock := func(t *testing.T, txs ...*transactions.Transaction) *chaintree.BlockWithHeaders {
+		block, err := consensus.SignBlock(ctx, &chaintree.BlockWithHeaders{
+			Block: chaintree.Block{
+				Height:       0,
+				Transactions: txs,
+			},
+		}, treeKey)
+		require.Nil(t, err)
+		return block
+	}
+	validate := func(t *testing.T, txs ...*transactions.Transaction) (bool, error) {
+		valid, codedErr := SchemaValidator(ctx, tree, genesisBlock(t, txs...))
+		if codedErr != nil {
+			return valid, codedErr
+		}
+		return valid, nil
+	}
+	setData := func(t *testing.T, path string, value interface{}) *transactions.Transaction {
+		txn, err := chaintree.NewSetDataTransaction(path, value)
+		require.Nil(t, err)
+		return txn
+	}
+
+	t.Run("allows conforming values", func(t *testing.T) {
+		valid, err := validate(t,
+			setData(t, "profile", map[string]interface{}{"name": "alice", "age": 30}),
+			setData(t, "posts/first", "hi"),
+			setData(t, "unrelated", 1),
+		)
+		require.Nil(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("rejects values that do not conform", func(t *testing.T) {
+		valid, err := validate(t,
+			setData(t, "profile/age", -1),
+			setData(t, "posts/first", "too long"),
+			setData(t, "posts/second", "ok"),
+		)
+		assert.False(t, valid)
+		require.NotNil(t, err)
+
+		schemaErr, ok := err.(*SchemaViolationError)
+		require.True(t, ok)
+		assert.Equal(t, SchemaViolationCode, schemaErr.GetCode())
+
+		var paths []string
+		for _, violation := range schemaErr.Violations {
+			paths = append(paths, violation.Path)
+		}
+		assert.Equal(t, []string{"tree/data/posts/first", "tree/data/profile"}, paths)
+		assert.Contains(t, err.Error(), "name")
+
+		valid, err = validate(t, setData(t, "profile", map[string]interface{}{"name": "alice", "age": -1}))
+		assert.False(t, valid)
+		require.NotNil(t, err)
+		assert.Equal(t, "tree/data/profile/age", err.(*SchemaViolationError).Violations[0].Path)
+	})
+
+	t.Run("applies schemas from the block that adds them", func(t *testing.T) {
+		empty := consensus.NewEmptyTree(ctx, did, store)
+		valid, codedErr := SchemaValidator(ctx, empty, genesisBlock(t,
+			setData(t, ".well-known/schemas/title", `{"type": "string"}`),
+			setData(t, "title", 1),
+		))
+		assert.False(t, valid)
+		require.NotNil(t, codedErr)
+		assert.Equal(t, SchemaViolationCode, codedErr.GetCode())
+	})
+
+	t.Run("only validates the values the block changes", func(t *testing.T) {
+		// a value from before the schema applied to it
+		existing, err := tree.SetAsLink(ctx, []string{"tree", "data", "posts", "old"}, "too long")
+		require.Nil(t, err)
+		validateExisting := func(t *testing.T, txs ...*transactions.Transaction) bool {
+			valid, codedErr := SchemaValidator(ctx, existing, genesisBlock(t, txs...))
+			return valid && codedErr == nil
+		}
+
+		assert.True(t, validateExisting(t, setData(t, "posts/new", "ok")))
+		assert.True(t, validateExisting(t, setData(t, "unrelated", 1)))
+		assert.False(t, validateExisting(t, setData(t, "posts/old", "still long")))
+		assert.False(t, validateExisting(t, setData(t, "posts", map[string]string{"old": "too long"})))
+		// changing the schemas validates every value
+		assert.False(t, validateExisting(t, setData(t, ".well-known/schemas/title", `{"type": "string"}`)))
+	})
+
+	t.Run("rejects external references", func(t *testing.T) {
+		valid, err := validate(t, setData(t, ".well-known/schemas/secret", `{"$ref": "file:///etc/passwd"}`))
+		assert.False(t, valid)
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), "unsupported reference")
+	})
+}
@@ -0,0 +1,72 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/chaintree/graftabledag"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+)
+
+// ThresholdCode is the code of the threshold validator (see ThresholdValidatorGenerator) when a block
+// that changes the threshold or the ownership of a tree is not signed by enough of its owners
+const ThresholdCode = 423
+
+/*
+ThresholdValidator keeps the threshold of a tree (see identity.ThresholdPath) from being circumvented by a single
+owner: a block that changes the threshold (setting it, a parent of it or a path within it) or the ownership of the
+tree has to be signed by as many of the owners of the tree (before the block) as its threshold requires.
+Signatures of any identity.Scheme count (see identity.SignBlock), so owners with ed25519 or P-256 keys can co-sign.
+Blocks of trees without a threshold only need the one owner signature tupelo requires anyway.
+*/
+func ThresholdValidator(ctx context.Context, getter graftabledag.DagGetter, tree *dag.Dag, blockWithHeaders *chaintree.BlockWithHeaders) (bool, chaintree.CodedError) {
+	if !identity.ChangesOwnership(blockWithHeaders) {
+		return true, nil
+	}
+	threshold, err := identity.Threshold(ctx, tree)
+	if err != nil {
+		return false, errToCoded(err)
+	}
+	if threshold <= 1 {
+		return true, nil
+	}
+
+	graftedOwnership, err := types.NewGraftedOwnership(tree, getter)
+	if err != nil {
+		return false, errToCoded(fmt.Errorf("error getting ownership: %w", err))
+	}
+	owners, err := graftedOwnership.ResolveOwners(ctx)
+	if err != nil {
+		return false, errToCoded(fmt.Errorf("error resolving owners: %w", err))
+	}
+	signers, err := identity.BlockSigners(ctx, blockWithHeaders)
+	if err != nil {
+		return false, errToCoded(fmt.Errorf("error checking signatures: %w", err))
+	}
+	isOwner := make(map[string]bool, len(owners))
+	for _, owner := range owners {
+		isOwner[owner] = true
+	}
+	var signed uint64
+	for _, signer := range signers {
+		if isOwner[signer] {
+			signed++
+		}
+	}
+	if signed < threshold {
+		return false, &consensus.ErrorCode{Code: ThresholdCode, Memo: fmt.Sprintf("%d of %d required owners signed", signed, threshold)}
+	}
+	return true, nil
+}
+
+// ThresholdValidatorGenerator is the chaintree.BlockValidatorFunc generator for ThresholdValidator
+func ThresholdValidatorGenerator(ctx context.Context, ng *types.NotaryGroup) (chaintree.BlockValidatorFunc, error) {
+	var thresholdValidator chaintree.BlockValidatorFunc = func(tree *dag.Dag, blockWithHeaders *chaintree.BlockWithHeaders) (bool, chaintree.CodedError) {
+		return ThresholdValidator(ctx, ng.DagGetter, tree, blockWithHeaders)
+	}
+	return thresholdValidator, nil
+}
@@ -0,0 +1,160 @@
+package policy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/testgetter"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThresholdValidator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := nodestore.MustMemoryStore(ctx)
+
+	keys := make([]*ecdsa.PrivateKey, 3)
+	owners := make([]string, len(keys))
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		keys[i] = key
+		owners[i] = crypto.PubkeyToAddress(key.PublicKey).String()
+	}
+	did := consensus.EcdsaPubkeyToDid(keys[0].PublicKey)
+
+	tree, err := consensus.NewEmptyTree(ctx, did, store).Set(ctx, []string{"tree", "_tupelo", "authentications"}, owners)
+	require.Nil(t, err)
+	tree, err = tree.Set(ctx, identity.ThresholdPath, 2)
+	require.Nil(t, err)
+	getter := testgetter.NewDagGetter(t, ctx)
+
+	validate := func(t *testing.T, signers []*ecdsa.PrivateKey, txs ...*transactions.Transaction) (bool, error) {
+		block := &chaintree.BlockWithHeaders{
+			Block: chaintree.Block{
+				Height:       0,
+				Transactions: txs,
+			},
+		}
+		for _, key := range signers {
+			block, err = consensus.SignBlock(ctx, block, key)
+			require.Nil(t, err)
+		}
+		valid, codedErr := ThresholdValidator(ctx, getter, tree, block)
+		if codedErr != nil {
+			return valid, codedErr
+		}
+		return valid, nil
+	}
+	setData := func(t *testing.T, path string, value interface{}) *transactions.Transaction {
+		txn, err := chaintree.NewSetDataTransaction(path, value)
+		require.Nil(t, err)
+		return txn
+	}
+	setOwnership := func(t *testing.T, owners ...string) *transactions.Transaction {
+		txn, err := chaintree.NewSetOwnershipTransaction(owners)
+		require.Nil(t, err)
+		return txn
+	}
+
+	t.Run("allows other changes with one owner", func(t *testing.T) {
+		valid, err := validate(t, keys[:1], setData(t, "some/path", "value"))
+		require.Nil(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("rejects threshold changes with fewer owners than the threshold", func(t *testing.T) {
+		for _, txn := range []*transactions.Transaction{
+			setData(t, ".well-known/threshold", 1),
+			setData(t, ".well-known", map[string]interface{}{}),
+			setOwnership(t, owners[0]),
+		} {
+			valid, err := validate(t, keys[:1], txn)
+			require.NotNil(t, err)
+			assert.False(t, valid)
+			assert.Equal(t, ThresholdCode, err.(chaintree.CodedError).GetCode())
+		}
+
+		// a key that is not an owner does not count
+		other, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		valid, err := validate(t, []*ecdsa.PrivateKey{keys[0], other}, setData(t, ".well-known/threshold", 1))
+		require.NotNil(t, err)
+		assert.False(t, valid)
+	})
+
+	t.Run("allows threshold changes with enough owners", func(t *testing.T) {
+		valid, err := validate(t, keys[1:], setData(t, ".well-known/threshold", 1))
+		require.Nil(t, err)
+		assert.True(t, valid)
+
+		valid, err = validate(t, keys[:2], setOwnership(t, owners[0]))
+		require.Nil(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("counts the signatures of every scheme", func(t *testing.T) {
+		_, edKey, err := ed25519.GenerateKey(rand.Reader)
+		require.Nil(t, err)
+		p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.Nil(t, err)
+		signers := []identity.Signer{&identity.Ed25519Signer{Key: edKey}, &identity.P256Signer{Key: p256Key}}
+		schemeOwners := make([]string, len(signers))
+		for i, signer := range signers {
+			schemeOwners[i], err = identity.PublicKeyToAddress(signer.Scheme(), signer.PublicKey())
+			require.Nil(t, err)
+		}
+		schemeTree, err := consensus.NewEmptyTree(ctx, did, store).Set(ctx, []string{"tree", "_tupelo", "authentications"}, append([]string{owners[0]}, schemeOwners...))
+		require.Nil(t, err)
+		schemeTree, err = schemeTree.Set(ctx, identity.ThresholdPath, 3)
+		require.Nil(t, err)
+
+		sign := func(t *testing.T, signers ...identity.Signer) *chaintree.BlockWithHeaders {
+			block, err := consensus.SignBlock(ctx, &chaintree.BlockWithHeaders{
+				Block: chaintree.Block{
+					Transactions: []*transactions.Transaction{setData(t, ".well-known/threshold", 1)},
+				},
+			}, keys[0])
+			require.Nil(t, err)
+			for _, signer := range signers {
+				block, err = identity.SignBlock(ctx, block, signer)
+				require.Nil(t, err)
+			}
+			return block
+		}
+
+		valid, codedErr := ThresholdValidator(ctx, getter, schemeTree, sign(t, signers[0]))
+		require.NotNil(t, codedErr)
+		assert.False(t, valid)
+		assert.Equal(t, ThresholdCode, codedErr.GetCode())
+
+		valid, codedErr = ThresholdValidator(ctx, getter, schemeTree, sign(t, signers...))
+		require.Nil(t, codedErr)
+		assert.True(t, valid)
+	})
+
+	t.Run("allows any change without a threshold", func(t *testing.T) {
+		unset, err := consensus.NewEmptyTree(ctx, did, store).Set(ctx, []string{"tree", "_tupelo", "authentications"}, owners)
+		require.Nil(t, err)
+		block, err := consensus.SignBlock(ctx, &chaintree.BlockWithHeaders{
+			Block: chaintree.Block{
+				Transactions: []*transactions.Transaction{setData(t, ".well-known/threshold", 3)},
+			},
+		}, keys[0])
+		require.Nil(t, err)
+		valid, codedErr := ThresholdValidator(ctx, getter, unset, block)
+		require.Nil(t, codedErr)
+		assert.True(t, valid)
+	})
+}
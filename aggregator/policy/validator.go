@@ -20,6 +20,13 @@ var logger = logging.Logger("policy")
 
 type PolicyInputMap map[string]interface{}
 
+// DeniedCode is the code of ErrDenied
+const DeniedCode = 403
+
+// ErrDenied is the CodedError of the generated validator (see ValidatorGenerator) when
+// the tree's policy does not allow a block, it lets callers tell denials apart from other rejections
+var ErrDenied = &consensus.ErrorCode{Code: DeniedCode, Memo: "denied by policy"}
+
 func errToCoded(err error) chaintree.CodedError {
 	if err == nil {
 		return nil
@@ -95,6 +102,13 @@ policies := map[string]string{
 		`,
 	}
 
+Modules can also be imported from other trees, instead of copying them into every tree, by listing them
+at tree/data/.well-known/policyImports (see ParsePolicyImport). They are compiled alongside the tree's
+own modules:
+
+```
+".well-known/policyImports": ["did:tupelo:org/policies/rbac"]
+```
 
 */
 func Validator(ctx context.Context, getter graftabledag.DagGetter, tree *dag.Dag, blockWithHeaders *chaintree.BlockWithHeaders) (bool, chaintree.CodedError) {
@@ -161,7 +175,11 @@ func allowResult(results rego.ResultSet) (bool, error) {
 // ValidatorGenerator passes in the GlobalResolve from the ng so that that paths can be resolved where needed
 func ValidatorGenerator(ctx context.Context, ng *types.NotaryGroup) (chaintree.BlockValidatorFunc, error) {
 	var isOwnerValidator chaintree.BlockValidatorFunc = func(tree *dag.Dag, blockWithHeaders *chaintree.BlockWithHeaders) (bool, chaintree.CodedError) {
-		return Validator(ctx, ng.DagGetter, tree, blockWithHeaders)
+		valid, err := Validator(ctx, ng.DagGetter, tree, blockWithHeaders)
+		if !valid && err == nil {
+			return false, ErrDenied
+		}
+		return valid, err
 	}
 	return isOwnerValidator, nil
 }
@@ -0,0 +1,114 @@
+package aggregator
+
+import (
+	"context"
+	"sync"
+
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+)
+
+// ResolveRequest is one of the resolves of ResolveManyWithReadControls
+type ResolveRequest struct {
+	ObjectID string
+	Path     []string
+	Options  *ResolveOptions
+}
+
+// ResolveManyWithReadControls resolves the requests like ResolveWithReadControls, running at most parallelism
+// of them at a time. The latest version of a tree and its read policy are only loaded once no matter how many
+// requests are for that tree. The responses are in the same order as the requests.
+func (a *Aggregator) ResolveManyWithReadControls(ctx context.Context, id *identity.Identity, requests []ResolveRequest, parallelism int) ([]*ResolveResponse, error) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	trees := newReadableCache(a)
+	responses := make([]*ResolveResponse, len(requests))
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	sem := make(chan struct{}, parallelism)
+
+	for i, req := range requests {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int, req ResolveRequest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			resp, err := a.resolveCached(ctx, trees, id, req)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			responses[i] = resp
+		}(i, req)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
+
+func (a *Aggregator) resolveCached(ctx context.Context, trees *readableCache, id *identity.Identity, req ResolveRequest) (*ResolveResponse, error) {
+	if req.Options != nil && req.Options.MaxHops > 0 {
+		return a.resolveGrafted(ctx, trees.get, id, req.ObjectID, req.Path, req.Options)
+	}
+	readable, err := trees.get(ctx, req.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+	return a.resolveReadable(ctx, readable, id, req.Path, req.Options)
+}
+
+// readableCache loads each tree (see getReadable) once for concurrent callers
+type readableCache struct {
+	aggregator *Aggregator
+
+	lock  sync.Mutex
+	trees map[string]*readableEntry
+}
+
+type readableEntry struct {
+	once     sync.Once
+	readable *readableTree
+	err      error
+}
+
+func newReadableCache(a *Aggregator) *readableCache {
+	return &readableCache{
+		aggregator: a,
+		trees:      make(map[string]*readableEntry),
+	}
+}
+
+func (rc *readableCache) get(ctx context.Context, objectID string) (*readableTree, error) {
+	rc.lock.Lock()
+	entry, ok := rc.trees[objectID]
+	if !ok {
+		entry = &readableEntry{}
+		rc.trees[objectID] = entry
+	}
+	rc.lock.Unlock()
+
+	entry.once.Do(func() {
+		entry.readable, entry.err = rc.aggregator.getReadable(ctx, objectID)
+	})
+	return entry.readable, entry.err
+}
@@ -0,0 +1,83 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveManyWithReadControls(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	agg, err := NewAggregator(ctx, &AggregatorConfig{KeyValueStore: NewMemoryStore(), Group: types.NewNotaryGroup("testnotary")})
+	require.Nil(t, err)
+
+	openKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	openAbr := NewValidTransactionWithPathAndValue(t, openKey, "/my/data", "foo")
+	_, err = agg.Add(ctx, &openAbr)
+	require.Nil(t, err)
+	openDid := string(openAbr.ObjectId)
+
+	lockedKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	lockedAbr := NewValidTransactionWithPathAndValue(t, lockedKey, ".well-known/policies", map[string]string{
+		"read": `
+			package read
+			default allow = false
+
+			allow {
+				input.identity.sub == "did:tupelo:someone"
+			}
+		`,
+	})
+	_, err = agg.Add(ctx, &lockedAbr)
+	require.Nil(t, err)
+	lockedDid := string(lockedAbr.ObjectId)
+
+	policyPath := []string{"tree", "data", ".well-known", "policies"}
+	requests := []ResolveRequest{
+		{ObjectID: openDid, Path: []string{"tree", "data", "my", "data"}},
+		{ObjectID: lockedDid, Path: policyPath},
+		{ObjectID: "did:tupelo:unknown", Path: []string{"tree"}},
+		{ObjectID: openDid, Path: []string{"tree", "data", "my", "data", "deeper"}},
+	}
+
+	responses, err := agg.ResolveManyWithReadControls(ctx, nil, requests, 2)
+	require.Nil(t, err)
+	require.Len(t, responses, len(requests))
+
+	assert.Equal(t, "foo", responses[0].Value)
+	assert.Len(t, responses[0].RemainingPath, 0)
+	assert.NotEmpty(t, responses[0].TouchedBlocks)
+
+	// denied reads look like unknown trees
+	assert.Nil(t, responses[1].Value)
+	assert.Equal(t, policyPath, responses[1].RemainingPath)
+	assert.False(t, responses[1].Tip.Defined())
+
+	assert.Equal(t, []string{"tree"}, responses[2].RemainingPath)
+
+	assert.Equal(t, []string{"deeper"}, responses[3].RemainingPath)
+	assert.True(t, responses[3].Tip.Equals(responses[0].Tip))
+
+	t.Run("allows with the identity", func(t *testing.T) {
+		responses, err := agg.ResolveManyWithReadControls(ctx, &identity.Identity{Sub: "did:tupelo:someone"}, requests[1:2], 1)
+		require.Nil(t, err)
+		assert.NotNil(t, responses[0].Value)
+		assert.Len(t, responses[0].RemainingPath, 0)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := agg.ResolveManyWithReadControls(canceled, nil, requests, 2)
+		require.NotNil(t, err)
+	})
+}
@@ -0,0 +1,502 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/quorumcontrol/chaintree/dag"
+	"github.com/quorumcontrol/chaintree/typecaster"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/identity"
+	"github.com/quorumcontrol/tupelo-lite/aggregator/policy"
+)
+
+var (
+	// within the store of an index generation (see indexStore)
+	searchTermsPrefix = datastore.NewKey("_search/terms") // /<term> -> DIDs
+	searchTreesPrefix = datastore.NewKey("_search/trees") // /<did>
+
+	// the log of the trees that changed, outside of the index generations as search is rebuilt from it (see RebuildSearch)
+	searchChangesPrefix = datastore.NewKey("_search/changes") // /<time>-<did>
+)
+
+// SearchPath is where the config tree defines the searchable paths, a map of tree types to
+// the (slash separated) paths that are indexed, for example {"document": ["tree/data/title"]}
+var SearchPath = []string{"tree", "data", ".well-known", "search"}
+
+// SearchTypePath is the type of a tree for SearchDefinitions
+var SearchTypePath = []string{"tree", "data", "type"}
+
+// AnySearchType is the Type of a SearchDefinition for every tree
+const AnySearchType = "*"
+
+// maxTermLength limits the length of the terms that are indexed (and so of the keys)
+const maxTermLength = 64
+
+// MaxSearchCandidates limits the trees whose read policies a page of Search checks, a page that reaches
+// it has fewer hits than asked for but more can follow (see SearchResponse)
+var MaxSearchCandidates = 1000
+
+func init() {
+	cbornode.RegisterCborType(storedSearch{})
+}
+
+// SearchDefinition makes the strings (or lists of strings) at Paths of the trees of Type searchable
+type SearchDefinition struct {
+	Type  string
+	Paths [][]string
+}
+
+// SearchHit is a tree that matched every term of a search and the paths that did
+type SearchHit struct {
+	Did   string
+	Paths []string
+}
+
+// SearchResponse is a page of hits, sorted by DID. EndCursor is passed as after for the next page, it is the DID
+// of the last hit and the number of the candidates after it that were not hits (see searchCursor), so that the DIDs
+// of unreadable trees are not in it.
+type SearchResponse struct {
+	Hits      []SearchHit
+	HasMore   bool
+	EndCursor string
+}
+
+// storedSearch is what is indexed for a tree, so that it can be removed again
+type storedSearch struct {
+	Terms map[string][]string `refmt:"terms"` // term -> paths
+}
+
+// ParseSearchDefinitions parses comma separated type=path;path definitions (for example "document=tree/data/title;tree/data/body")
+func ParseSearchDefinitions(defs string) ([]SearchDefinition, error) {
+	var definitions []SearchDefinition
+	for _, def := range strings.Split(defs, ",") {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+		parts := strings.SplitN(def, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid search definition %s, expected type=path;path", def)
+		}
+		definition := SearchDefinition{Type: parts[0]}
+		for _, path := range strings.Split(parts[1], ";") {
+			definition.Paths = append(definition.Paths, splitIndexPath(path))
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, nil
+}
+
+// searchFromTree returns the search definitions of the config tree (see SearchPath)
+func searchFromTree(ctx context.Context, tree *dag.Dag) ([]SearchDefinition, error) {
+	val, remain, err := tree.Resolve(ctx, SearchPath)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving search: %w", err)
+	}
+	if len(remain) > 0 || val == nil {
+		return nil, nil
+	}
+	paths := make(map[string][]string)
+	err = typecaster.ToType(val, &paths)
+	if err != nil {
+		return nil, fmt.Errorf("error casting search: %w", err)
+	}
+	definitions := make([]SearchDefinition, 0, len(paths))
+	for treeType, typePaths := range paths {
+		definition := SearchDefinition{Type: treeType}
+		for _, path := range typePaths {
+			definition.Paths = append(definition.Paths, splitIndexPath(path))
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, nil
+}
+
+// searchPaths returns the paths that are searchable for trees of treeType (from the AggregatorConfig and the config tree)
+func (a *Aggregator) searchPaths(treeType string) [][]string {
+	var paths [][]string
+	for _, defs := range [][]SearchDefinition{a.search, a.configSearch} {
+		for _, def := range defs {
+			if def.Type == AnySearchType || def.Type == treeType {
+				paths = append(paths, def.Paths...)
+			}
+		}
+	}
+	return paths
+}
+
+// searchTerms splits text into lower case words
+func searchTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	var terms []string
+	for _, word := range words {
+		if len(word) <= maxTermLength {
+			terms = append(terms, word)
+		}
+	}
+	return uniqueSorted(terms)
+}
+
+func searchStrings(val interface{}) []string {
+	switch val := val.(type) {
+	case string:
+		return []string{val}
+	case []interface{}:
+		var strs []string
+		for _, item := range val {
+			strs = append(strs, searchStrings(item)...)
+		}
+		return strs
+	default:
+		return nil
+	}
+}
+
+func searchTermKey(term string) datastore.Key {
+	return searchTermsPrefix.ChildString(encodeIndexValue(term))
+}
+
+// updateSearch indexes the searchable paths of objectID for the tree at tip (see Add)
+func (a *Aggregator) updateSearch(ctx context.Context, store *generationStore, objectID string, tip cid.Cid) error {
+	if len(a.search) == 0 && len(a.configSearch) == 0 {
+		return nil
+	}
+	tree := dag.NewDag(ctx, tip, a.DagStore)
+
+	var treeType string
+	val, remain, err := tree.Resolve(ctx, SearchTypePath)
+	if err != nil {
+		return fmt.Errorf("error resolving type: %w", err)
+	}
+	if len(remain) == 0 {
+		treeType, _ = val.(string)
+	}
+
+	current := &storedSearch{Terms: make(map[string][]string)}
+	for _, path := range a.searchPaths(treeType) {
+		val, remain, err := tree.Resolve(ctx, path)
+		if err != nil {
+			return fmt.Errorf("error resolving %s: %w", strings.Join(path, "/"), err)
+		}
+		if len(remain) > 0 {
+			continue
+		}
+		joined := strings.Join(path, "/")
+		for _, str := range searchStrings(val) {
+			for _, term := range searchTerms(str) {
+				paths := current.Terms[term]
+				if len(paths) == 0 || paths[len(paths)-1] != joined {
+					current.Terms[term] = append(paths, joined)
+				}
+			}
+		}
+	}
+
+	previous := &storedSearch{}
+	bits, err := store.Get(searchTreesPrefix.ChildString(objectID))
+	if err != nil && err != datastore.ErrNotFound {
+		return fmt.Errorf("error getting search terms: %w", err)
+	}
+	if err == nil {
+		err = cbornode.DecodeInto(bits, previous)
+		if err != nil {
+			return fmt.Errorf("error decoding search terms: %w", err)
+		}
+	}
+	if len(previous.Terms) == 0 && len(current.Terms) == 0 {
+		return nil
+	}
+
+	for term := range previous.Terms {
+		if _, ok := current.Terms[term]; ok {
+			continue
+		}
+		err = store.updateKeyList(searchTermKey(term), objectID, false)
+		if err != nil {
+			return fmt.Errorf("error deleting search term: %w", err)
+		}
+	}
+	// the paths of the terms are in the terms of the tree (see searchHit)
+	for term := range current.Terms {
+		err = store.updateKeyList(searchTermKey(term), objectID, true)
+		if err != nil {
+			return fmt.Errorf("error putting search term: %w", err)
+		}
+	}
+	bits, err = cbornode.DumpObject(current)
+	if err != nil {
+		return fmt.Errorf("error encoding search terms: %w", err)
+	}
+	err = store.Put(searchTreesPrefix.ChildString(objectID), bits)
+	if err != nil {
+		return fmt.Errorf("error putting search terms: %w", err)
+	}
+	return nil
+}
+
+// searchConfigured is true when any paths are searchable
+func (a *Aggregator) searchConfigured() bool {
+	return len(a.search) > 0 || len(a.configSearch) > 0
+}
+
+// searchCursor is the last hit (empty before the first one) and the candidates after it that were not hits, as
+// <did> or <did>|<skip>
+func searchCursor(did string, skip int) string {
+	if skip == 0 {
+		return did
+	}
+	return did + "|" + strconv.Itoa(skip)
+}
+
+func parseSearchCursor(cursor string) (string, int, error) {
+	i := strings.LastIndex(cursor, "|")
+	if i < 0 {
+		return cursor, 0, nil
+	}
+	skip, err := strconv.Atoi(cursor[i+1:])
+	if err != nil || skip < 0 {
+		return "", 0, fmt.Errorf("invalid cursor %s", cursor)
+	}
+	return cursor[:i], skip, nil
+}
+
+// logSearchChange adds the change of objectID to the log of changes (see RebuildSearch)
+func (a *Aggregator) logSearchChange(objectID string, tip cid.Cid) error {
+	if !a.searchConfigured() {
+		return nil
+	}
+	key := searchChangesPrefix.ChildString(fmt.Sprintf("%020d-%s", time.Now().UnixNano(), objectID))
+	err := a.keyValueStore.Put(key, tip.Bytes())
+	if err != nil {
+		return fmt.Errorf("error logging change: %w", err)
+	}
+	return nil
+}
+
+// PruneSearchChanges deletes the changes logged before before from the log of changes (see RebuildSearch),
+// RebuildIndexes prunes the ones before it started
+func (a *Aggregator) PruneSearchChanges(before time.Time) error {
+	results, err := a.keyValueStore.Query(query.Query{
+		Prefix:   searchChangesPrefix.String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return fmt.Errorf("error querying changes: %w", err)
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return fmt.Errorf("error querying changes: %w", err)
+	}
+	pruned := 0
+	for _, entry := range entries {
+		key := datastore.NewKey(entry.Key)
+		parts := strings.SplitN(key.BaseNamespace(), "-", 2)
+		changedAt, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || changedAt >= before.UnixNano() {
+			continue
+		}
+		err = a.keyValueStore.Delete(key)
+		if err != nil && err != datastore.ErrNotFound {
+			return fmt.Errorf("error deleting change: %w", err)
+		}
+		pruned++
+	}
+	logger.Infof("pruned %d search changes", pruned)
+	return nil
+}
+
+/*
+RebuildSearch indexes the search terms of the trees in the log of changes again, of those that changed at or after
+since (the zero time for every logged change). Add logs the trees it stores while search is configured, so unlike
+RebuildIndexes (which is needed for trees stored before that) this only reads the trees that changed, for instance
+to restore the search terms of the changes since a backup of the key value store. Trees are indexed at their latest
+version.
+*/
+func (a *Aggregator) RebuildSearch(ctx context.Context, since time.Time) error {
+	results, err := a.keyValueStore.Query(query.Query{
+		Prefix:   searchChangesPrefix.String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return fmt.Errorf("error querying changes: %w", err)
+	}
+	changed := make(map[string]bool)
+	for result := range results.Next() {
+		if result.Error != nil {
+			results.Close()
+			return fmt.Errorf("error querying changes: %w", result.Error)
+		}
+		parts := strings.SplitN(datastore.NewKey(result.Key).BaseNamespace(), "-", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		changedAt, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || changedAt < since.UnixNano() {
+			continue
+		}
+		changed[parts[1]] = true
+	}
+	err = results.Close()
+	if err != nil {
+		return fmt.Errorf("error querying changes: %w", err)
+	}
+
+	stores, err := a.writeIndexStores()
+	if err != nil {
+		return err
+	}
+	for did := range changed {
+		tip, err := a.GetTip(ctx, did)
+		if err != nil {
+			return fmt.Errorf("error getting tip of %s: %w", did, err)
+		}
+		for _, store := range stores {
+			err = a.updateSearch(ctx, store, did, *tip)
+			if err != nil {
+				return fmt.Errorf("error indexing search of %s: %w", did, err)
+			}
+		}
+	}
+	logger.Infof("rebuilt the search of %d trees", len(changed))
+	return nil
+}
+
+/*
+Search lists (at most first of) the trees that have every word of text in their searchable paths and that
+come after the cursor after (a DID or the EndCursor of a SearchResponse, empty for the start). Only the paths
+that the read policies allow are matched. The candidates are the trees of the rarest term that have the other
+terms as well, a page checks the read policies of at most MaxSearchCandidates of them. The candidates that a
+cursor skips are counted, a tree that gains or loses the terms between pages can shift the next page by one.
+*/
+func (a *Aggregator) Search(ctx context.Context, id *identity.Identity, text string, first int, after string) (*SearchResponse, error) {
+	terms := searchTerms(text)
+	resp := &SearchResponse{}
+	if len(terms) == 0 {
+		return resp, nil
+	}
+	after, skip, err := parseSearchCursor(after)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := a.readIndexStore()
+	if err != nil {
+		return nil, err
+	}
+	matches := make([][]string, len(terms))
+	for i, term := range terms {
+		matches[i], err = store.getKeyList(searchTermKey(term))
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return len(matches[i]) < len(matches[j])
+	})
+	rarest := matches[0]
+	start := sort.SearchStrings(rarest, after)
+	if start < len(rarest) && rarest[start] == after {
+		start++
+	}
+
+	// the cursor starts at the previous one, so that pages without hits still move on
+	lastHit, misses := after, skip
+	candidates := 0
+	for _, did := range rarest[start:] {
+		if !inEvery(matches[1:], did) {
+			continue
+		}
+		if skip > 0 {
+			// checked by a previous page
+			skip--
+			continue
+		}
+		if len(resp.Hits) == first || candidates == MaxSearchCandidates {
+			resp.HasMore = true
+			break
+		}
+		candidates++
+		hit, err := a.searchHit(ctx, store, id, did, terms)
+		if err != nil {
+			return nil, err
+		}
+		if hit != nil {
+			resp.Hits = append(resp.Hits, *hit)
+			lastHit, misses = did, 0
+		} else {
+			misses++
+		}
+	}
+	resp.EndCursor = searchCursor(lastHit, misses)
+	return resp, nil
+}
+
+// inEvery is true when did is in every one of the sorted lists
+func inEvery(lists [][]string, did string) bool {
+	for _, list := range lists {
+		i := sort.SearchStrings(list, did)
+		if i == len(list) || list[i] != did {
+			return false
+		}
+	}
+	return true
+}
+
+// searchHit returns the hit for did when every term matches a path that is readable, nil otherwise
+func (a *Aggregator) searchHit(ctx context.Context, store *generationStore, id *identity.Identity, did string, terms []string) (*SearchHit, error) {
+	stored := &storedSearch{}
+	bits, err := store.Get(searchTreesPrefix.ChildString(did))
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting search terms: %w", err)
+	}
+	err = cbornode.DecodeInto(bits, stored)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding search terms: %w", err)
+	}
+
+	readable := make(map[string]bool)
+	var hitPaths []string
+	for _, term := range terms {
+		matched := false
+		for _, path := range stored.Terms[term] {
+			allowed, checked := readable[path]
+			if !checked {
+				allowed, err = a.ReadAllowed(ctx, &policy.ReadInput{
+					Method:   policy.MethodGet,
+					Object:   did,
+					Path:     path,
+					Identity: id,
+				})
+				if err != nil {
+					return nil, err
+				}
+				readable[path] = allowed
+			}
+			if allowed {
+				matched = true
+				hitPaths = append(hitPaths, path)
+			}
+		}
+		if !matched {
+			return nil, nil
+		}
+	}
+	return &SearchHit{
+		Did:   did,
+		Paths: uniqueSorted(hitPaths),
+	}, nil
+}
@@ -0,0 +1,230 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/quorumcontrol/chaintree/chaintree"
+	"github.com/quorumcontrol/chaintree/nodestore"
+	"github.com/quorumcontrol/messages/v2/build/go/transactions"
+	"github.com/quorumcontrol/tupelo/sdk/consensus"
+	"github.com/quorumcontrol/tupelo/sdk/gossip/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSearchDefinitions(t *testing.T) {
+	defs, err := ParseSearchDefinitions("document=tree/data/title;tree/data/body, *=tree/data/name")
+	require.Nil(t, err)
+	assert.Equal(t, []SearchDefinition{
+		{Type: "document", Paths: [][]string{{"tree", "data", "title"}, {"tree", "data", "body"}}},
+		{Type: AnySearchType, Paths: [][]string{{"tree", "data", "name"}}},
+	}, defs)
+
+	_, err = ParseSearchDefinitions("document")
+	require.NotNil(t, err)
+}
+
+func TestSearch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := NewMemoryStore()
+	agg, err := NewAggregator(ctx, &AggregatorConfig{
+		KeyValueStore: store,
+		Group:         types.NewNotaryGroup("testnotary"),
+		Search: []SearchDefinition{
+			{Type: "document", Paths: [][]string{{"tree", "data", "title"}, {"tree", "data", "secret"}}},
+		},
+	})
+	require.Nil(t, err)
+
+	setData := func(t *testing.T, path string, value interface{}) *transactions.Transaction {
+		txn, err := chaintree.NewSetDataTransaction(path, value)
+		require.Nil(t, err)
+		return txn
+	}
+	readPolicy := setData(t, ".well-known/policies", map[string]string{
+		"read": `
+			package read
+			default allow = true
+
+			allow = false {
+				startswith(input.path, "tree/data/secret")
+			}
+		`,
+	})
+
+	docKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	docDid := consensus.EcdsaPubkeyToDid(docKey.PublicKey)
+	doc, err := chaintree.NewChainTree(ctx, consensus.NewEmptyTree(ctx, docDid, nodestore.MustMemoryStore(ctx)), nil, consensus.DefaultTransactors)
+	require.Nil(t, err)
+	abr := nextABR(t, doc, docKey,
+		setData(t, "type", "document"),
+		setData(t, "title", "The Quick brown fox"),
+		setData(t, "secret", "hidden treasure"),
+		readPolicy,
+	)
+	_, err = agg.Add(ctx, &abr)
+	require.Nil(t, err)
+
+	otherKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	otherAbr := NewValidTransactionWithTransactions(t, otherKey,
+		setData(t, "type", "document"),
+		setData(t, "title", "a lazy brown dog"),
+	)
+	_, err = agg.Add(ctx, &otherAbr)
+	require.Nil(t, err)
+	otherDid := string(otherAbr.ObjectId)
+
+	// not a document
+	untypedKey, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	untypedAbr := NewValidTransactionWithPathAndValue(t, untypedKey, "title", "brown")
+	_, err = agg.Add(ctx, &untypedAbr)
+	require.Nil(t, err)
+
+	search := func(t *testing.T, text string) []SearchHit {
+		resp, err := agg.Search(ctx, nil, text, 10, "")
+		require.Nil(t, err)
+		return resp.Hits
+	}
+
+	t.Run("matches every word case insensitively", func(t *testing.T) {
+		assert.Equal(t, []SearchHit{{Did: docDid, Paths: []string{"tree/data/title"}}}, search(t, "quick BROWN"))
+		assert.Len(t, search(t, "quick dog"), 0)
+		assert.Len(t, search(t, "   "), 0)
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		resp, err := agg.Search(ctx, nil, "brown", 1, "")
+		require.Nil(t, err)
+		require.Len(t, resp.Hits, 1)
+		assert.True(t, resp.HasMore)
+
+		resp, err = agg.Search(ctx, nil, "brown", 1, resp.Hits[0].Did)
+		require.Nil(t, err)
+		require.Len(t, resp.Hits, 1)
+		assert.False(t, resp.HasMore)
+	})
+
+	t.Run("filters unreadable paths", func(t *testing.T) {
+		assert.Len(t, search(t, "treasure"), 0)
+		assert.Len(t, search(t, "fox treasure"), 0)
+	})
+
+	t.Run("limits the candidates of a page", func(t *testing.T) {
+		defer func(max int) { MaxSearchCandidates = max }(MaxSearchCandidates)
+		MaxSearchCandidates = 1
+
+		resp, err := agg.Search(ctx, nil, "brown", 10, "")
+		require.Nil(t, err)
+		require.Len(t, resp.Hits, 1)
+		assert.True(t, resp.HasMore)
+		assert.Equal(t, resp.Hits[0].Did, resp.EndCursor)
+
+		resp, err = agg.Search(ctx, nil, "brown", 10, resp.EndCursor)
+		require.Nil(t, err)
+		require.Len(t, resp.Hits, 1)
+		assert.False(t, resp.HasMore)
+
+		// the cursor moves past candidates that are not hits without their DIDs
+		resp, err = agg.Search(ctx, nil, "treasure", 10, "")
+		require.Nil(t, err)
+		assert.Len(t, resp.Hits, 0)
+		assert.NotContains(t, resp.EndCursor, docDid)
+
+		resp, err = agg.Search(ctx, nil, "treasure", 10, resp.EndCursor)
+		require.Nil(t, err)
+		assert.Len(t, resp.Hits, 0)
+		assert.False(t, resp.HasMore)
+	})
+
+	t.Run("does not return unreadable matches in the cursor", func(t *testing.T) {
+		// the secret of a second document is readable
+		readableKey, err := crypto.GenerateKey()
+		require.Nil(t, err)
+		readableAbr := NewValidTransactionWithTransactions(t, readableKey,
+			setData(t, "type", "document"),
+			setData(t, "secret", "buried treasure"),
+		)
+		_, err = agg.Add(ctx, &readableAbr)
+		require.Nil(t, err)
+		readableDid := string(readableAbr.ObjectId)
+
+		resp, err := agg.Search(ctx, nil, "treasure", 10, "")
+		require.Nil(t, err)
+		require.Len(t, resp.Hits, 1)
+		assert.Equal(t, readableDid, resp.Hits[0].Did)
+		assert.NotContains(t, resp.EndCursor, docDid)
+
+		defer func(max int) { MaxSearchCandidates = max }(MaxSearchCandidates)
+		MaxSearchCandidates = 1
+
+		// one candidate a page, the unreadable one only moves the cursor
+		var hits []SearchHit
+		cursor := ""
+		for i := 0; i < 3; i++ {
+			resp, err = agg.Search(ctx, nil, "treasure", 10, cursor)
+			require.Nil(t, err)
+			assert.NotContains(t, resp.EndCursor, docDid)
+			hits = append(hits, resp.Hits...)
+			cursor = resp.EndCursor
+			if !resp.HasMore {
+				break
+			}
+		}
+		assert.False(t, resp.HasMore)
+		require.Len(t, hits, 1)
+		assert.Equal(t, readableDid, hits[0].Did)
+	})
+
+	t.Run("updates the terms of a tree on add", func(t *testing.T) {
+		abr := nextABR(t, doc, docKey, setData(t, "title", "a slow red fox"))
+		_, err = agg.Add(ctx, &abr)
+		require.Nil(t, err)
+
+		assert.Len(t, search(t, "quick"), 0)
+		hits := search(t, "brown")
+		require.Len(t, hits, 1)
+		assert.Equal(t, otherDid, hits[0].Did)
+		assert.Len(t, search(t, "slow fox"), 1)
+	})
+
+	t.Run("rebuilds from the change log", func(t *testing.T) {
+		indexStore, err := agg.readIndexStore()
+		require.Nil(t, err)
+		require.Nil(t, indexStore.updateKeyList(searchTermKey("slow"), docDid, false))
+
+		// nothing changed since
+		require.Nil(t, agg.RebuildSearch(ctx, time.Now()))
+		assert.Len(t, search(t, "slow"), 0)
+
+		require.Nil(t, agg.RebuildSearch(ctx, time.Time{}))
+		assert.Len(t, search(t, "slow"), 1)
+		assert.Len(t, search(t, "quick"), 0)
+	})
+
+	t.Run("rebuilds", func(t *testing.T) {
+		indexStore, err := agg.readIndexStore()
+		require.Nil(t, err)
+		require.Nil(t, indexStore.updateKeyList(searchTermKey("slow"), docDid, false))
+		assert.Len(t, search(t, "slow"), 0)
+
+		require.Nil(t, agg.RebuildIndexes(ctx))
+		assert.Len(t, search(t, "slow"), 1)
+		assert.Len(t, search(t, "quick"), 0)
+
+		// the changes before the rebuild are pruned
+		results, err := store.Query(query.Query{Prefix: searchChangesPrefix.String(), KeysOnly: true})
+		require.Nil(t, err)
+		changes, err := results.Rest()
+		require.Nil(t, err)
+		assert.Len(t, changes, 0)
+	})
+}
@@ -25,7 +25,7 @@ describe("Client", () => {
         const blks = await graphQLtoBlocks(resp.newBlocks)
         await repo.repo.blocks.putMany(blks)
 
-        tree.tip = new CID(resp.newTip)
+        tree.tip = new CID(resp.newTip!)
         expect((await tree.resolveData("hi")).value).to.equal("hi")
 
         // and now querying the resolve works
@@ -78,10 +78,36 @@ describe("Client", () => {
         const resp2 = await cli.addBlock(abr2)
         expect(resp2.errors).to.be.undefined
         expect(resp2.valid).to.be.false
+        expect(resp2.errorCode).to.equal("POLICY_DENIED")
+        expect(resp2.newTip).to.be.null
         
         repo.close()
     })
 
+    it('reports tip conflicts', async () => {
+        const repo = await Repo.memoryRepo("tipConflicts")
+
+        const tree = await ChainTree.createRandom(new IpfsBlockService(repo.repo))
+        const abr = await tree.newAddBlockRequest([setDataTransaction("hi", "hi")])
+        const resp = await cli.addBlock(abr)
+        expect(resp.valid).to.be.true
+        await updateChainTreeWithResponse(tree, resp)
+
+        // two blocks built on the same tip
+        const abr2 = await tree.newAddBlockRequest([setDataTransaction("first", true)])
+        const abr3 = await tree.newAddBlockRequest([setDataTransaction("second", true)])
+        const resp2 = await cli.addBlock(abr2)
+        expect(resp2.valid).to.be.true
+
+        const resp3 = await cli.addBlock(abr3)
+        expect(resp3.errors).to.be.undefined
+        expect(resp3.valid).to.be.false
+        expect(resp3.errorCode).to.equal("TIP_CONFLICT")
+        expect(resp3.currentTip).to.equal(resp2.newTip)
+
+        repo.close()
+    })
+
     it('identifies without a policy', async () => {
         let cli = new Client("http://localhost:9011/graphql")
 
@@ -165,7 +191,7 @@ describe("Client", () => {
         const blks = await graphQLtoBlocks(resp.newBlocks)
         await repo.repo.blocks.putMany(blks)
 
-        tree.tip = new CID(resp.newTip)
+        tree.tip = new CID(resp.newTip!)
         expect((await tree.resolveData("hi")).value).to.equal("hi")
 
         // and now querying the resolve works
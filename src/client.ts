@@ -20,10 +20,15 @@ export interface IGraphqlBlock {
     data: string
 }
 
+// the reason an addBlock is not valid, a TIP_CONFLICT includes the currentTip of the tree to rebuild the block on
+export type AddBlockErrorCode = "TIP_CONFLICT" | "POLICY_DENIED" | "INVALID_SIGNATURE" | "INVALID_BLOCK"
+
 export interface IAddBlockResponse {
-    newTip: CID
+    newTip?: string // null when the block is not valid
     newBlocks: IGraphqlBlock[]
     valid: boolean
+    errorCode?: AddBlockErrorCode
+    currentTip?: string
     errors: any
 }
 
@@ -41,6 +46,9 @@ export interface IClientIdentityToken {
 }
 
 export async function updateChainTreeWithResponse(tree: ChainTree, resp: IAddBlockResponse) {
+    if (!resp.valid || !resp.newTip) {
+        throw new Error(`invalid block: ${resp.errorCode}`)
+    }
     const blocks = await graphQLtoBlocks(resp.newBlocks)
     await tree.store.putMany(blocks)
     tree.tip = new CID(resp.newTip)
@@ -224,6 +232,8 @@ export class Client {
                             newBlocks {
                                 data
                             }
+                            errorCode
+                            currentTip
                         }
                     }
                 `,
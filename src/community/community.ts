@@ -71,7 +71,10 @@ export class Community {
                 console.error("errors: ", resp.errors)
                 throw new Error("errors: " + resp.errors.toString())
             }
-            log("tree: ", did, " updated to: ", new CID(resp.newTip).toBaseEncodedString())
+            if (!resp.valid) {
+                throw new Error("invalid block: " + resp.errorCode)
+            }
+            log("tree: ", did, " updated to: ", resp.newTip)
             await updateChainTreeWithResponse(tree, resp)
             tree.events.emit('update')
         } catch(err) {